@@ -1,13 +1,29 @@
 package api
 
 import (
+	"context"
 	"database/sql"
+	"ecom/config"
+	"ecom/gateway"
+	"ecom/mailer"
 	"ecom/middleware"
+	"ecom/service/address"
 	"ecom/service/auth"
 	"ecom/service/cart"
+	"ecom/service/idempotency"
+	"ecom/service/inventory"
 	"ecom/service/order"
+	"ecom/service/password"
+	"ecom/service/payment"
 	"ecom/service/product"
+	"ecom/service/promotion"
+	"ecom/service/returns"
+	"ecom/service/shipping"
+	"ecom/service/tax"
+	"ecom/service/token"
+	"ecom/service/uow"
 	"ecom/service/user"
+	"ecom/service/warehouse"
 	"github.com/gorilla/mux"
 	"log"
 	"net/http"
@@ -27,21 +43,81 @@ func (server *APIServer) Run() error {
 	subrouter := router.PathPrefix("/api/v1").Subrouter()
 
 	authStore := auth.NewStore()
+	tokenStore := token.NewStore(server.db)
+	middleware.SetTokenDenylist(tokenStore)
+
+	mail, err := mailer.New(config.ENV)
+	if err != nil {
+		return err
+	}
+
+	payments, err := gateway.New(config.ENV)
+	if err != nil {
+		return err
+	}
+
+	productStore := product.NewStore(server.db)
+	orderStore := order.NewStore(server.db)
+	cartStore := cart.NewStore(server.db)
+	promotionStore := promotion.NewStore(server.db)
+	paymentStore := payment.NewStore(server.db)
+	returnStore := returns.NewStore(server.db)
+	inventoryStore := inventory.NewStore(server.db)
+	warehouseStore := warehouse.NewStore(server.db)
+	shippingStore := shipping.NewStore(server.db)
+	uowStore := uow.NewStore(server.db, productStore, orderStore, cartStore, promotionStore, paymentStore, returnStore, inventoryStore, warehouseStore)
+
+	// stock held by abandoned checkouts goes back on sale once it expires
+	go inventory.NewSweeper(inventoryStore, config.ENV.StockReservationSweepInterval).Run(context.Background())
+
 	userStore := user.NewStore(server.db)
-	userHandler := user.NewHandler(userStore, authStore)
+	cartMerger := cart.NewMerger(uowStore, authStore, config.ENV.CartMergeStrategy)
+	userHandler := user.NewHandler(userStore, authStore, tokenStore, mail, cartMerger)
 	userHandler.UserRoutes(subrouter)
 
-	productStore := product.NewStore(server.db)
+	passwordStore := password.NewStore(server.db)
+	passwordHandler := password.NewHandler(passwordStore, userStore, tokenStore, authStore, mail)
+	passwordHandler.PasswordRoutes(subrouter)
+
+	addressStore := address.NewStore(server.db)
+	addressHandler := address.NewHandler(addressStore)
+	addressSubrouter := subrouter.PathPrefix("/me/addresses").Subrouter()
+	addressSubrouter.Use(middleware.JWTMiddleware)
+	addressHandler.AddressRoutes(addressSubrouter)
+
 	productHandler := product.NewHandler(productStore)
 	productHandler.ProductRoutes(subrouter)
 
-	orderStore := order.NewStore(server.db)
+	warehouseHandler := warehouse.NewHandler(warehouseStore, productStore)
+	warehouseHandler.WarehouseRoutes(subrouter)
+
+	promotionHandler := promotion.NewHandler(promotionStore)
+	promotionHandler.PromotionRoutes(subrouter)
+
+	shippingHandler := shipping.NewHandler(shippingStore)
+	shippingHandler.ShippingRoutes(subrouter)
 
-	cartHandler := cart.NewHandler(orderStore, productStore)
+	taxCalculator := tax.NewTableCalculator(tax.NewStore(server.db), config.ENV.PricesIncludeTax)
+
+	// guests can use the cart too, checkout itself requires a login
+	cartHandler := cart.NewHandler(cartStore, uowStore, productStore, userStore, addressStore, promotionStore, shippingStore, taxCalculator, payments, authStore)
 	cartSubrouter := subrouter.PathPrefix("/cart").Subrouter()
-	cartSubrouter.Use(middleware.JWTMiddleware)
+	idempotencyStore := idempotency.NewStore(server.db)
+	cartSubrouter.Use(middleware.OptionalJWTMiddleware, middleware.Idempotency(idempotencyStore))
 	cartHandler.RegisterRoutes(cartSubrouter)
 
+	orderHandler := order.NewHandler(orderStore, uowStore, payments)
+	orderSubrouter := subrouter.PathPrefix("/orders").Subrouter()
+	orderSubrouter.Use(middleware.JWTMiddleware)
+	orderHandler.OrderRoutes(orderSubrouter)
+
+	returnHandler := returns.NewHandler(returnStore, orderStore, uowStore, payments)
+	returnHandler.ReturnRoutes(subrouter)
+
+	// the provider authenticates itself with the webhook signature
+	paymentHandler := payment.NewHandler(uowStore, payments)
+	paymentHandler.PaymentRoutes(subrouter)
+
 	log.Println("Listening on", server.addr)
 	return http.ListenAndServe(server.addr, router)
 }
@@ -5,11 +5,14 @@ import (
 	"ecom/cmd/api"
 	"ecom/config"
 	"ecom/db"
+	"ecom/domain"
 	"github.com/go-sql-driver/mysql"
 	"log"
 )
 
 func main() {
+	domain.DefaultCurrency = config.ENV.Currency
+
 	db, err := db.NewMySQLStorage(mysql.Config{
 		User:                 config.ENV.DBUser,
 		Passwd:               config.ENV.DBPassword,
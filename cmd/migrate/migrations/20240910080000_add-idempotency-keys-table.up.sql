@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    `userId` VARCHAR(36) NOT NULL,
+    `key` VARCHAR(255) NOT NULL,
+    `requestHash` CHAR(64) NOT NULL,
+    `statusCode` INT NULL,
+    `body` MEDIUMBLOB NULL,
+    `expiresAt` TIMESTAMP NOT NULL,
+    `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (`userId`, `key`),
+    FOREIGN KEY (`userId`) REFERENCES `users`(`id`)
+);
@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS order_status_history;
+
+-- the old statuses can't hold the new ones: paid orders still wait to be
+-- fulfilled and shipped or delivered ones are done
+UPDATE orders SET `status` = 'pending' WHERE `status` = 'paid';
+UPDATE orders SET `status` = 'completed' WHERE `status` IN ('shipped', 'delivered');
+
+ALTER TABLE orders
+    MODIFY `status` ENUM('pending', 'completed', 'cancelled') NOT NULL DEFAULT 'pending';
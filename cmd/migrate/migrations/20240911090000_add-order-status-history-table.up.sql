@@ -0,0 +1,13 @@
+ALTER TABLE orders
+    MODIFY `status` ENUM('pending', 'paid', 'shipped', 'delivered', 'completed', 'cancelled') NOT NULL DEFAULT 'pending';
+
+CREATE TABLE IF NOT EXISTS order_status_history (
+    `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    `orderId` INT UNSIGNED NOT NULL,
+    `fromStatus` VARCHAR(32) NOT NULL,
+    `toStatus` VARCHAR(32) NOT NULL,
+    `actorId` VARCHAR(36) NOT NULL,
+    `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (`id`),
+    FOREIGN KEY (`orderId`) REFERENCES `orders`(`id`)
+);
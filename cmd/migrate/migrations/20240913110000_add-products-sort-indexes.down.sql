@@ -0,0 +1,3 @@
+DROP INDEX idx_products_price ON products;
+DROP INDEX idx_products_name ON products;
+DROP INDEX idx_products_created_at ON products;
@@ -0,0 +1,20 @@
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    `id` VARCHAR(36) NOT NULL,
+    `userId` VARCHAR(36) NOT NULL,
+    `familyId` VARCHAR(36) NOT NULL,
+    `tokenHash` CHAR(64) NOT NULL,
+    `expiresAt` TIMESTAMP NOT NULL,
+    `usedAt` TIMESTAMP NULL DEFAULT NULL,
+    `revokedAt` TIMESTAMP NULL DEFAULT NULL,
+    `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (`id`),
+    UNIQUE KEY (`tokenHash`),
+    KEY (`familyId`),
+    FOREIGN KEY (`userId`) REFERENCES `users`(`id`)
+);
+
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+    `jti` VARCHAR(36) NOT NULL,
+    `expiresAt` TIMESTAMP NOT NULL,
+    PRIMARY KEY (`jti`)
+);
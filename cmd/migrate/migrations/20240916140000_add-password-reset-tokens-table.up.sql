@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS password_reset_tokens (
+    `id` VARCHAR(36) NOT NULL,
+    `userId` VARCHAR(36) NOT NULL,
+    `tokenHash` CHAR(64) NOT NULL,
+    `expiresAt` TIMESTAMP NOT NULL,
+    `usedAt` TIMESTAMP NULL DEFAULT NULL,
+    `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (`id`),
+    UNIQUE KEY (`tokenHash`),
+    FOREIGN KEY (`userId`) REFERENCES `users`(`id`)
+);
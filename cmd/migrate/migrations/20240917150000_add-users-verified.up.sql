@@ -0,0 +1,4 @@
+ALTER TABLE users ADD COLUMN `verified` BOOLEAN NOT NULL DEFAULT FALSE AFTER `role`;
+
+-- accounts created before verification existed are trusted as they are
+UPDATE users SET `verified` = TRUE;
@@ -0,0 +1,4 @@
+ALTER TABLE orders
+    DROP COLUMN `billingAddress`;
+
+DROP TABLE IF EXISTS addresses;
@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS addresses (
+    `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    `userId` VARCHAR(36) NOT NULL,
+    `line1` VARCHAR(255) NOT NULL,
+    `line2` VARCHAR(255) NOT NULL DEFAULT '',
+    `city` VARCHAR(100) NOT NULL,
+    `region` VARCHAR(100) NOT NULL DEFAULT '',
+    `postalCode` VARCHAR(20) NOT NULL,
+    `country` CHAR(2) NOT NULL,
+    `phone` VARCHAR(32) NOT NULL DEFAULT '',
+    `isDefault` BOOLEAN NOT NULL DEFAULT FALSE,
+    `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (`id`),
+    KEY (`userId`),
+    FOREIGN KEY (`userId`) REFERENCES `users`(`id`)
+);
+
+ALTER TABLE orders
+    ADD COLUMN `billingAddress` TEXT NULL AFTER `address`;
@@ -0,0 +1,18 @@
+CREATE TABLE IF NOT EXISTS carts (
+    `id` VARCHAR(36) NOT NULL,
+    `userId` VARCHAR(36) NULL DEFAULT NULL,
+    `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (`id`),
+    UNIQUE KEY (`userId`),
+    FOREIGN KEY (`userId`) REFERENCES `users`(`id`)
+);
+
+CREATE TABLE IF NOT EXISTS cart_items (
+    `cartId` VARCHAR(36) NOT NULL,
+    `productId` INT UNSIGNED NOT NULL,
+    `quantity` INT UNSIGNED NOT NULL,
+    `updatedAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    PRIMARY KEY (`cartId`, `productId`),
+    FOREIGN KEY (`cartId`) REFERENCES `carts`(`id`) ON DELETE CASCADE,
+    FOREIGN KEY (`productId`) REFERENCES `products`(`id`)
+);
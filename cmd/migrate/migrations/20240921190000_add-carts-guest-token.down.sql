@@ -0,0 +1,6 @@
+DELETE FROM carts WHERE userId IS NULL;
+
+ALTER TABLE carts
+    DROP INDEX `tokenHash`,
+    DROP COLUMN `expiresAt`,
+    DROP COLUMN `tokenHash`;
@@ -0,0 +1,4 @@
+ALTER TABLE carts
+    ADD COLUMN `tokenHash` CHAR(64) NULL DEFAULT NULL AFTER `userId`,
+    ADD COLUMN `expiresAt` TIMESTAMP NULL DEFAULT NULL AFTER `tokenHash`,
+    ADD UNIQUE KEY (`tokenHash`);
@@ -0,0 +1,9 @@
+ALTER TABLE products
+    DROP KEY `category`,
+    DROP COLUMN `category`;
+
+ALTER TABLE orders
+    DROP COLUMN `discount`;
+
+DROP TABLE IF EXISTS promotion_redemptions;
+DROP TABLE IF EXISTS promotions;
@@ -0,0 +1,44 @@
+CREATE TABLE IF NOT EXISTS promotions (
+    `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    `code` VARCHAR(64) NOT NULL,
+    `description` VARCHAR(255) NOT NULL DEFAULT '',
+    `type` VARCHAR(32) NOT NULL,
+    `percent` INT UNSIGNED NOT NULL DEFAULT 0,
+    `amountOff` DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    `buyQuantity` INT UNSIGNED NOT NULL DEFAULT 0,
+    `getQuantity` INT UNSIGNED NOT NULL DEFAULT 0,
+    `minSubtotal` DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    `productIds` JSON NOT NULL,
+    `categories` JSON NOT NULL,
+    `startsAt` TIMESTAMP NULL DEFAULT NULL,
+    `endsAt` TIMESTAMP NULL DEFAULT NULL,
+    `usageLimit` INT UNSIGNED NULL DEFAULT NULL,
+    `perUserLimit` INT UNSIGNED NULL DEFAULT NULL,
+    `timesUsed` INT UNSIGNED NOT NULL DEFAULT 0,
+    `active` BOOLEAN NOT NULL DEFAULT TRUE,
+    `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    `deletedAt` TIMESTAMP NULL DEFAULT NULL,
+    PRIMARY KEY (`id`),
+    KEY (`code`)
+);
+
+CREATE TABLE IF NOT EXISTS promotion_redemptions (
+    `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    `promotionId` INT UNSIGNED NOT NULL,
+    `orderId` INT UNSIGNED NOT NULL,
+    `userId` VARCHAR(36) NOT NULL,
+    `code` VARCHAR(64) NOT NULL,
+    `discount` DECIMAL(10, 2) NOT NULL,
+    `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (`id`),
+    KEY (`promotionId`, `userId`),
+    FOREIGN KEY (`promotionId`) REFERENCES `promotions`(`id`),
+    FOREIGN KEY (`orderId`) REFERENCES `orders`(`id`)
+);
+
+ALTER TABLE orders
+    ADD COLUMN `discount` DECIMAL(10, 2) NOT NULL DEFAULT 0 AFTER `total`;
+
+ALTER TABLE products
+    ADD COLUMN `category` VARCHAR(100) NOT NULL DEFAULT '' AFTER `image`,
+    ADD KEY (`category`);
@@ -0,0 +1,27 @@
+CREATE TABLE IF NOT EXISTS tax_rates (
+    `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    `country` CHAR(2) NOT NULL,
+    `region` VARCHAR(100) NOT NULL DEFAULT '',
+    `postalPrefix` VARCHAR(20) NOT NULL DEFAULT '',
+    `taxClass` VARCHAR(32) NOT NULL DEFAULT 'standard',
+    `name` VARCHAR(100) NOT NULL,
+    `rate` INT UNSIGNED NOT NULL,
+    PRIMARY KEY (`id`),
+    UNIQUE KEY (`country`, `region`, `postalPrefix`, `taxClass`)
+);
+
+CREATE TABLE IF NOT EXISTS order_item_taxes (
+    `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    `orderItemId` INT UNSIGNED NOT NULL,
+    `name` VARCHAR(100) NOT NULL,
+    `rate` INT UNSIGNED NOT NULL,
+    `amount` DECIMAL(10, 2) NOT NULL,
+    PRIMARY KEY (`id`),
+    FOREIGN KEY (`orderItemId`) REFERENCES `order_items`(`id`)
+);
+
+ALTER TABLE orders
+    ADD COLUMN `tax` DECIMAL(10, 2) NOT NULL DEFAULT 0 AFTER `discount`;
+
+ALTER TABLE products
+    ADD COLUMN `taxClass` VARCHAR(32) NOT NULL DEFAULT 'standard' AFTER `category`;
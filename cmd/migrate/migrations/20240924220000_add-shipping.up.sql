@@ -0,0 +1,39 @@
+CREATE TABLE IF NOT EXISTS shipping_zones (
+    `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    `name` VARCHAR(100) NOT NULL,
+    PRIMARY KEY (`id`)
+);
+
+CREATE TABLE IF NOT EXISTS shipping_zone_areas (
+    `zoneId` INT UNSIGNED NOT NULL,
+    `country` CHAR(2) NOT NULL,
+    `region` VARCHAR(100) NOT NULL DEFAULT '',
+    PRIMARY KEY (`zoneId`, `country`, `region`),
+    FOREIGN KEY (`zoneId`) REFERENCES `shipping_zones`(`id`) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS shipping_methods (
+    `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    `zoneId` INT UNSIGNED NULL DEFAULT NULL,
+    `name` VARCHAR(100) NOT NULL,
+    `type` VARCHAR(32) NOT NULL,
+    `rate` DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    `perKg` DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    `freeOver` DECIMAL(10, 2) NOT NULL DEFAULT 0,
+    `maxWeight` INT UNSIGNED NOT NULL DEFAULT 0,
+    `active` BOOLEAN NOT NULL DEFAULT TRUE,
+    PRIMARY KEY (`id`),
+    FOREIGN KEY (`zoneId`) REFERENCES `shipping_zones`(`id`)
+);
+
+ALTER TABLE products
+    ADD COLUMN `weight` INT UNSIGNED NOT NULL DEFAULT 0 AFTER `taxClass`,
+    ADD COLUMN `length` INT UNSIGNED NOT NULL DEFAULT 0 AFTER `weight`,
+    ADD COLUMN `width` INT UNSIGNED NOT NULL DEFAULT 0 AFTER `length`,
+    ADD COLUMN `height` INT UNSIGNED NOT NULL DEFAULT 0 AFTER `width`;
+
+ALTER TABLE orders
+    ADD COLUMN `shippingMethodId` INT UNSIGNED NULL DEFAULT NULL AFTER `tax`,
+    ADD COLUMN `shippingMethod` VARCHAR(100) NOT NULL DEFAULT '' AFTER `shippingMethodId`,
+    ADD COLUMN `shipping` DECIMAL(10, 2) NOT NULL DEFAULT 0 AFTER `shippingMethod`,
+    ADD CONSTRAINT `fk_orders_shipping_method` FOREIGN KEY (`shippingMethodId`) REFERENCES `shipping_methods`(`id`);
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS payments (
+    `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    `orderId` INT UNSIGNED NOT NULL,
+    `provider` VARCHAR(32) NOT NULL,
+    `reference` VARCHAR(100) NOT NULL,
+    `amount` DECIMAL(10, 2) NOT NULL,
+    `status` VARCHAR(32) NOT NULL,
+    `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (`id`),
+    UNIQUE KEY (`provider`, `reference`),
+    FOREIGN KEY (`orderId`) REFERENCES `orders`(`id`)
+);
@@ -0,0 +1,10 @@
+DROP TABLE IF EXISTS refund_items;
+DROP TABLE IF EXISTS refunds;
+
+ALTER TABLE order_items
+    DROP COLUMN `refundedQuantity`,
+    DROP COLUMN `total`;
+
+ALTER TABLE orders
+    DROP COLUMN `refunded`,
+    MODIFY `status` ENUM('pending', 'paid', 'shipped', 'delivered', 'completed', 'cancelled') NOT NULL DEFAULT 'pending';
@@ -0,0 +1,34 @@
+ALTER TABLE orders
+    MODIFY `status` ENUM('pending', 'paid', 'shipped', 'delivered', 'completed', 'cancelled', 'partially_refunded', 'refunded') NOT NULL DEFAULT 'pending',
+    ADD COLUMN `refunded` DECIMAL(10, 2) NOT NULL DEFAULT 0 AFTER `shipping`;
+
+ALTER TABLE order_items
+    ADD COLUMN `total` DECIMAL(10, 2) NOT NULL DEFAULT 0 AFTER `price`,
+    ADD COLUMN `refundedQuantity` INT UNSIGNED NOT NULL DEFAULT 0 AFTER `total`;
+
+-- older items were charged their plain price
+UPDATE order_items SET `total` = `price` * `quantity`;
+
+CREATE TABLE IF NOT EXISTS refunds (
+    `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    `orderId` INT UNSIGNED NOT NULL,
+    `paymentId` INT UNSIGNED NOT NULL,
+    `amount` DECIMAL(10, 2) NOT NULL,
+    `reason` VARCHAR(255) NOT NULL DEFAULT '',
+    `restock` BOOLEAN NOT NULL DEFAULT FALSE,
+    `actorId` VARCHAR(36) NOT NULL,
+    `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (`id`),
+    FOREIGN KEY (`orderId`) REFERENCES `orders`(`id`),
+    FOREIGN KEY (`paymentId`) REFERENCES `payments`(`id`)
+);
+
+CREATE TABLE IF NOT EXISTS refund_items (
+    `refundId` INT UNSIGNED NOT NULL,
+    `orderItemId` INT UNSIGNED NOT NULL,
+    `quantity` INT UNSIGNED NOT NULL,
+    `amount` DECIMAL(10, 2) NOT NULL,
+    PRIMARY KEY (`refundId`, `orderItemId`),
+    FOREIGN KEY (`refundId`) REFERENCES `refunds`(`id`) ON DELETE CASCADE,
+    FOREIGN KEY (`orderItemId`) REFERENCES `order_items`(`id`)
+);
@@ -0,0 +1,35 @@
+CREATE TABLE IF NOT EXISTS return_requests (
+    `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    `orderId` INT UNSIGNED NOT NULL,
+    `userId` VARCHAR(36) NOT NULL,
+    `status` VARCHAR(32) NOT NULL,
+    `refundId` INT UNSIGNED NULL DEFAULT NULL,
+    `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (`id`),
+    FOREIGN KEY (`orderId`) REFERENCES `orders`(`id`),
+    FOREIGN KEY (`userId`) REFERENCES `users`(`id`),
+    FOREIGN KEY (`refundId`) REFERENCES `refunds`(`id`)
+);
+
+CREATE TABLE IF NOT EXISTS return_items (
+    `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    `returnId` INT UNSIGNED NOT NULL,
+    `orderItemId` INT UNSIGNED NOT NULL,
+    `quantity` INT UNSIGNED NOT NULL,
+    `reason` VARCHAR(255) NOT NULL,
+    PRIMARY KEY (`id`),
+    FOREIGN KEY (`returnId`) REFERENCES `return_requests`(`id`) ON DELETE CASCADE,
+    FOREIGN KEY (`orderItemId`) REFERENCES `order_items`(`id`)
+);
+
+CREATE TABLE IF NOT EXISTS return_status_history (
+    `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    `returnId` INT UNSIGNED NOT NULL,
+    `fromStatus` VARCHAR(32) NOT NULL,
+    `toStatus` VARCHAR(32) NOT NULL,
+    `actorId` VARCHAR(36) NOT NULL,
+    `note` VARCHAR(255) NOT NULL DEFAULT '',
+    `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (`id`),
+    FOREIGN KEY (`returnId`) REFERENCES `return_requests`(`id`) ON DELETE CASCADE
+);
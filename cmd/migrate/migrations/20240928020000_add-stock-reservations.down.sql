@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS stock_reservations;
+
+ALTER TABLE product_stock DROP COLUMN `reserved`;
@@ -0,0 +1,12 @@
+ALTER TABLE product_stock ADD COLUMN `reserved` INT UNSIGNED NOT NULL DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS stock_reservations (
+    `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    `productId` INT UNSIGNED NOT NULL,
+    `quantity` INT UNSIGNED NOT NULL,
+    `expiresAt` TIMESTAMP NOT NULL,
+    `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (`id`),
+    KEY (`expiresAt`),
+    FOREIGN KEY (`productId`) REFERENCES `products`(`id`)
+);
@@ -0,0 +1,28 @@
+ALTER TABLE order_items
+    DROP FOREIGN KEY `fk_order_items_warehouse`,
+    DROP COLUMN `warehouseId`;
+
+ALTER TABLE stock_reservations
+    DROP FOREIGN KEY `fk_stock_reservations_warehouse`,
+    DROP COLUMN `warehouseId`;
+
+-- fold the stock of every warehouse into one row per product
+INSERT IGNORE INTO product_stock (`product_id`, `warehouse_id`, `quantity`, `reserved`)
+    SELECT DISTINCT `product_id`, 1, 0, 0 FROM product_stock;
+UPDATE product_stock ps
+    JOIN (
+        SELECT `product_id`, SUM(`quantity`) AS `quantity`, SUM(`reserved`) AS `reserved`
+        FROM product_stock
+        GROUP BY `product_id`
+    ) totals ON totals.`product_id` = ps.`product_id`
+    SET ps.`quantity` = totals.`quantity`, ps.`reserved` = totals.`reserved`
+    WHERE ps.`warehouse_id` = 1;
+DELETE FROM product_stock WHERE `warehouse_id` <> 1;
+
+ALTER TABLE product_stock
+    DROP FOREIGN KEY `fk_product_stock_warehouse`,
+    DROP PRIMARY KEY,
+    ADD PRIMARY KEY (`product_id`),
+    DROP COLUMN `warehouse_id`;
+
+DROP TABLE IF EXISTS warehouses;
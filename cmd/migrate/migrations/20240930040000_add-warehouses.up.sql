@@ -0,0 +1,33 @@
+CREATE TABLE IF NOT EXISTS warehouses (
+    `id` INT UNSIGNED NOT NULL AUTO_INCREMENT,
+    `code` VARCHAR(32) NOT NULL,
+    `name` VARCHAR(100) NOT NULL,
+    `country` CHAR(2) NOT NULL,
+    `region` VARCHAR(100) NOT NULL DEFAULT '',
+    `postalCode` VARCHAR(20) NOT NULL DEFAULT '',
+    `priority` INT UNSIGNED NOT NULL DEFAULT 0,
+    `active` BOOLEAN NOT NULL DEFAULT TRUE,
+    `createdAt` TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (`id`),
+    UNIQUE KEY (`code`)
+);
+
+-- the stock, reservations and orders so far belong to the one warehouse
+INSERT INTO warehouses (`id`, `code`, `name`, `country`) VALUES (1, 'main', 'Main warehouse', 'US');
+
+ALTER TABLE product_stock
+    ADD COLUMN `warehouse_id` INT UNSIGNED NOT NULL DEFAULT 1 AFTER `product_id`,
+    DROP PRIMARY KEY,
+    ADD PRIMARY KEY (`product_id`, `warehouse_id`),
+    ADD CONSTRAINT `fk_product_stock_warehouse` FOREIGN KEY (`warehouse_id`) REFERENCES `warehouses`(`id`);
+ALTER TABLE product_stock ALTER COLUMN `warehouse_id` DROP DEFAULT;
+
+ALTER TABLE stock_reservations
+    ADD COLUMN `warehouseId` INT UNSIGNED NOT NULL DEFAULT 1 AFTER `productId`,
+    ADD CONSTRAINT `fk_stock_reservations_warehouse` FOREIGN KEY (`warehouseId`) REFERENCES `warehouses`(`id`);
+ALTER TABLE stock_reservations ALTER COLUMN `warehouseId` DROP DEFAULT;
+
+ALTER TABLE order_items
+    ADD COLUMN `warehouseId` INT UNSIGNED NOT NULL DEFAULT 1,
+    ADD CONSTRAINT `fk_order_items_warehouse` FOREIGN KEY (`warehouseId`) REFERENCES `warehouses`(`id`);
+ALTER TABLE order_items ALTER COLUMN `warehouseId` DROP DEFAULT;
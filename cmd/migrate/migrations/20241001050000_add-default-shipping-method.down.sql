@@ -0,0 +1,4 @@
+-- orders shipped with the default method keep it
+DELETE FROM shipping_methods
+WHERE `name` = 'Standard shipping' AND `type` = 'flat_rate' AND `zoneId` IS NULL AND `rate` = 0
+    AND NOT EXISTS (SELECT 1 FROM orders o WHERE o.shippingMethodId = shipping_methods.id);
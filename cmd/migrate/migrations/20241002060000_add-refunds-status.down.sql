@@ -0,0 +1,8 @@
+-- failed refunds gave nothing back and would read as paid out without a status
+UPDATE return_requests SET refundId = NULL
+WHERE refundId IN (SELECT id FROM refunds WHERE status = 'failed');
+
+DELETE FROM refunds WHERE status = 'failed';
+
+ALTER TABLE refunds
+    DROP COLUMN `status`;
@@ -0,0 +1,4 @@
+-- refunds are written as pending before the provider is asked for the
+-- money, the ones recorded so far were paid out already
+ALTER TABLE refunds
+    ADD COLUMN `status` VARCHAR(32) NOT NULL DEFAULT 'completed' AFTER `amount`;
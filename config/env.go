@@ -4,30 +4,105 @@ import (
 	"fmt"
 	"github.com/joho/godotenv"
 	"os"
+	"strconv"
+	"time"
 )
 
+// EnvDevelopment is the APP_ENV of local development, the only one the
+// payment settings may be left out in.
+const EnvDevelopment = "development"
+
 type Config struct {
-	PublicHost string
-	Port       string
-	DBUser     string
-	DBPassword string
-	DBAddress  string
-	DBName     string
-	JWTSecret  string
+	AppEnv            string
+	PublicHost        string
+	Port              string
+	DBUser            string
+	DBPassword        string
+	DBAddress         string
+	DBName            string
+	JWTSecret         string
+	IdempotencyKeyTTL time.Duration
+	AccessTokenTTL    time.Duration
+	RefreshTokenTTL   time.Duration
+	AppURL            string
+	FrontendURL       string
+	PasswordResetTTL  time.Duration
+	MailDriver        string
+	MailFrom          string
+	MailDir           string
+	SMTPHost          string
+	SMTPPort          string
+	SMTPUser          string
+	SMTPPassword      string
+
+	RequireEmailVerification bool
+	EmailVerificationTTL     time.Duration
+
+	GuestCartTTL      time.Duration
+	CartMergeStrategy string
+
+	Currency         string
+	PricesIncludeTax bool
+
+	PaymentProvider      string
+	PaymentWebhookSecret string
+	PaymentWebhookURL    string
+	PaymentDeclineCards  string
+	PaymentFakeSeed      string
+
+	StockReservationTTL           time.Duration
+	StockReservationSweepInterval time.Duration
+	StockAllocationStrategy       string
 }
 
 var ENV = initConfig()
 
 func initConfig() Config {
 	godotenv.Load()
+	publicHost := getEnv("PUBLIC_HOST", "http://localhost")
+	port := getEnv("PORT", "8080")
+	appURL := getEnv("APP_URL", fmt.Sprintf("%s:%s", publicHost, port))
 	return Config{
-		PublicHost: getEnv("PUBLIC_HOST", "http://localhost"),
-		Port:       getEnv("PORT", "8080"),
-		DBUser:     getEnv("DB_USER", "root"),
-		DBPassword: getEnv("DB_PASSWORD", "root"),
-		DBAddress:  fmt.Sprintf("%s:%s", getEnv("DB_HOST", "127.0.0.1"), getEnv("DB_PORT", "3306")),
-		DBName:     getEnv("DB_NAME", "ecommerce"),
-		JWTSecret:  getEnv("JWT_SECRET", "secret"),
+		AppEnv:            getEnv("APP_ENV", EnvDevelopment),
+		PublicHost:        publicHost,
+		Port:              port,
+		DBUser:            getEnv("DB_USER", "root"),
+		DBPassword:        getEnv("DB_PASSWORD", "root"),
+		DBAddress:         fmt.Sprintf("%s:%s", getEnv("DB_HOST", "127.0.0.1"), getEnv("DB_PORT", "3306")),
+		DBName:            getEnv("DB_NAME", "ecommerce"),
+		JWTSecret:         getEnv("JWT_SECRET", "secret"),
+		IdempotencyKeyTTL: getEnvDuration("IDEMPOTENCY_KEY_TTL", 24*time.Hour),
+		AccessTokenTTL:    getEnvDuration("ACCESS_TOKEN_TTL", 15*time.Minute),
+		RefreshTokenTTL:   getEnvDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour),
+		AppURL:            appURL,
+		FrontendURL:       getEnv("FRONTEND_URL", "http://localhost:3000"),
+		PasswordResetTTL:  getEnvDuration("PASSWORD_RESET_TTL", time.Hour),
+		MailDriver:        getEnv("MAIL_DRIVER", "file"),
+		MailFrom:          getEnv("MAIL_FROM", "no-reply@localhost"),
+		MailDir:           getEnv("MAIL_DIR", "tmp/mail"),
+		SMTPHost:          getEnv("SMTP_HOST", "127.0.0.1"),
+		SMTPPort:          getEnv("SMTP_PORT", "25"),
+		SMTPUser:          getEnv("SMTP_USER", ""),
+		SMTPPassword:      getEnv("SMTP_PASSWORD", ""),
+
+		RequireEmailVerification: getEnvBool("REQUIRE_EMAIL_VERIFICATION", true),
+		EmailVerificationTTL:     getEnvDuration("EMAIL_VERIFICATION_TTL", 48*time.Hour),
+
+		GuestCartTTL:      getEnvDuration("GUEST_CART_TTL", 30*24*time.Hour),
+		CartMergeStrategy: getEnv("CART_MERGE_STRATEGY", "cap"),
+
+		Currency:         getEnv("CURRENCY", "USD"),
+		PricesIncludeTax: getEnvBool("PRICES_INCLUDE_TAX", false),
+
+		PaymentProvider:      getEnv("PAYMENT_PROVIDER", ""),
+		PaymentWebhookSecret: getEnv("PAYMENT_WEBHOOK_SECRET", ""),
+		PaymentWebhookURL:    getEnv("PAYMENT_WEBHOOK_URL", appURL+"/api/v1/payments/webhook"),
+		PaymentDeclineCards:  getEnv("PAYMENT_DECLINE_CARDS", "4000000000000002"),
+		PaymentFakeSeed:      getEnv("PAYMENT_FAKE_SEED", ""),
+
+		StockReservationTTL:           getEnvDuration("STOCK_RESERVATION_TTL", 15*time.Minute),
+		StockReservationSweepInterval: getEnvDuration("STOCK_RESERVATION_SWEEP_INTERVAL", time.Minute),
+		StockAllocationStrategy:       getEnv("STOCK_ALLOCATION_STRATEGY", "priority"),
 	}
 }
 
@@ -37,3 +112,21 @@ func getEnv(key, fallback string) string {
 	}
 	return fallback
 }
+
+func getEnvDuration(key string, fallback time.Duration) time.Duration {
+	if value, ok := os.LookupEnv(key); ok {
+		if duration, err := time.ParseDuration(value); err == nil {
+			return duration
+		}
+	}
+	return fallback
+}
+
+func getEnvBool(key string, fallback bool) bool {
+	if value, ok := os.LookupEnv(key); ok {
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return fallback
+}
@@ -6,6 +6,14 @@ import (
 	"log"
 )
 
+// Querier is the subset of methods shared by *sql.DB and *sql.Tx, so stores
+// can run the same queries inside or outside of a transaction.
+type Querier interface {
+	Exec(query string, args ...any) (sql.Result, error)
+	Query(query string, args ...any) (*sql.Rows, error)
+	QueryRow(query string, args ...any) *sql.Row
+}
+
 func NewMySQLStorage(cfg mysql.Config) (*sql.DB, error) {
 	db, err := sql.Open("mysql", cfg.FormatDSN())
 	if err != nil {
@@ -0,0 +1,59 @@
+package domain
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+var ErrAddressNotFound = errors.New("address not found")
+
+type Address struct {
+	ID         int       `json:"id"`
+	UserID     string    `json:"userId"`
+	Line1      string    `json:"line1"`
+	Line2      string    `json:"line2"`
+	City       string    `json:"city"`
+	Region     string    `json:"region"`
+	PostalCode string    `json:"postalCode"`
+	Country    string    `json:"country"`
+	Phone      string    `json:"phone"`
+	IsDefault  bool      `json:"isDefault"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// String formats the address the way it is stored on orders.
+func (a Address) String() string {
+	parts := []string{a.Line1, a.Line2, a.City, a.Region, a.PostalCode, a.Country}
+	lines := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part != "" {
+			lines = append(lines, part)
+		}
+	}
+	address := strings.Join(lines, ", ")
+	if a.Phone != "" {
+		address += " (" + a.Phone + ")"
+	}
+	return address
+}
+
+type AddressPayload struct {
+	Line1      string `json:"line1" validate:"required,max=255"`
+	Line2      string `json:"line2" validate:"max=255"`
+	City       string `json:"city" validate:"required,max=100"`
+	Region     string `json:"region" validate:"max=100"`
+	PostalCode string `json:"postalCode" validate:"required,max=20"`
+	Country    string `json:"country" validate:"required,len=2,alpha"`
+	Phone      string `json:"phone" validate:"max=32"`
+	IsDefault  bool   `json:"isDefault"`
+}
+
+type AddressRepository interface {
+	GetAddresses(userID string) (*[]Address, error)
+	GetAddressByID(userID string, id int) (*Address, error)
+	GetDefaultAddress(userID string) (*Address, error)
+	CreateAddress(address Address) (int, error)
+	UpdateAddress(address Address) error
+	DeleteAddress(userID string, id int) error
+}
@@ -1,7 +1,17 @@
 package domain
 
 type AuthService interface {
-	CreateToken(secret []byte, userID string, firstName string, lastName string, email string, address string) (string, error)
+	CreateToken(secret []byte, user User) (string, error)
+	// GenerateToken returns a random opaque token, used for refresh and
+	// password reset tokens, and the hash that should be stored in its place.
+	GenerateToken() (token string, hash string, err error)
+	HashToken(token string) string
+	// CreateVerificationToken signs a token proving ownership of the user's
+	// current email address.
+	CreateVerificationToken(secret []byte, user User) (string, error)
+	// ParseVerificationToken returns the user ID and email a verification
+	// token was issued for.
+	ParseVerificationToken(secret []byte, token string) (userID string, email string, err error)
 	HashPassword(password string) (string, error)
 	ComparePassword(hashedPassword, password string) error
 }
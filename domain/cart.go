@@ -1,10 +1,85 @@
 package domain
 
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrCartNotFound     = errors.New("cart not found")
+	ErrCartItemNotFound = errors.New("cart item not found")
+)
+
+// Rules for combining a guest cart with the user's cart on login when both
+// hold the same product.
+const (
+	CartMergeSum    = "sum"    // add the quantities together
+	CartMergeCap    = "cap"    // add the quantities, capped at the stock
+	CartMergeLatest = "latest" // keep the most recently changed quantity
+)
+
 type CartItem struct {
 	ProductID int `json:"productId"`
 	Quantity  int `json:"quantity"`
 }
 
 type CartCheckoutPayload struct {
-	Items []CartItem `json:"items" validate:"required"`
+	// Items are checked out instead of the stored cart when given.
+	Items []CartItem `json:"items"`
+	// AddressID picks a saved shipping address, defaulting to the user's
+	// default address. BillingAddressID defaults to the shipping address.
+	AddressID        *int `json:"addressId"`
+	BillingAddressID *int `json:"billingAddressId"`
+	// ShippingMethodID picks one of the shipping options, defaulting to the
+	// cheapest.
+	ShippingMethodID *int `json:"shippingMethodId"`
+	// PromotionCodes are applied in order, case-insensitively.
+	PromotionCodes []string `json:"promotionCodes" validate:"max=5,dive,required,max=64"`
+	// PaymentSource is the card to charge, required at checkout only.
+	PaymentSource string `json:"paymentSource" validate:"max=255"`
+}
+
+// Cart is the persistent cart of a user, or of a guest identified by an
+// opaque cart token.
+type Cart struct {
+	ID        string     `json:"id"`
+	UserID    string     `json:"userId"`
+	Token     string     `json:"token,omitempty"`
+	Items     []CartLine `json:"items"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+// CartLine is a cart item joined with the product it refers to.
+type CartLine struct {
+	CartItem
+	ProductName string    `json:"productName"`
+	Price       Money     `json:"price"`
+	Available   int       `json:"available"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+type CartItemPayload struct {
+	ProductID int `json:"productId" validate:"required,gt=0"`
+	Quantity  int `json:"quantity" validate:"required,gt=0"`
+}
+
+type CartItemQuantityPayload struct {
+	Quantity int `json:"quantity" validate:"required,gt=0"`
+}
+
+type CartRepository interface {
+	GetOrCreateCart(userID string) (*Cart, error)
+	CreateGuestCart(tokenHash string, expiresAt time.Time) (*Cart, error)
+	GetGuestCart(tokenHash string) (*Cart, error)
+	DeleteCart(cartID string) error
+	GetCartItems(cartID string) (*[]CartItem, error)
+	GetCartLines(cartID string) (*[]CartLine, error)
+	SetCartItem(cartID string, productID, quantity int) error
+	RemoveCartItem(cartID string, productID int) error
+	ClearCart(cartID string) error
+}
+
+// GuestCartMerger moves a guest cart into the user's cart once they sign in.
+type GuestCartMerger interface {
+	MergeGuestCart(userID, cartToken string) error
 }
@@ -0,0 +1,23 @@
+package domain
+
+import "time"
+
+type IdempotencyRecord struct {
+	UserID      string    `json:"userId"`
+	Key         string    `json:"key"`
+	RequestHash string    `json:"requestHash"`
+	StatusCode  int       `json:"statusCode"`
+	Body        []byte    `json:"body"`
+	Completed   bool      `json:"completed"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+type IdempotencyRepository interface {
+	// ReserveIdempotencyKey claims the key for the user. When the key is
+	// already held by an unexpired record, that record is returned with
+	// reserved set to false.
+	ReserveIdempotencyKey(record IdempotencyRecord) (existing *IdempotencyRecord, reserved bool, err error)
+	CompleteIdempotencyKey(userID, key string, statusCode int, body []byte) error
+	ReleaseIdempotencyKey(userID, key string) error
+}
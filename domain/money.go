@@ -0,0 +1,330 @@
+package domain
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is the currency of amounts read from the database and of
+// bare amounts sent by clients.
+var DefaultCurrency = "USD"
+
+// currencyExponents lists the currencies whose minor unit is not a cent.
+// Amounts are stored in DECIMAL(10,2) columns, so currencies with more than
+// two decimal places can't be used.
+var currencyExponents = map[string]int{
+	"JPY": 0,
+	"KRW": 0,
+	"VND": 0,
+}
+
+func currencyExponent(currency string) int {
+	if exponent, ok := currencyExponents[currency]; ok {
+		return exponent
+	}
+	return 2
+}
+
+// Money is an exact amount in the minor unit of an ISO 4217 currency, e.g.
+// cents for USD. Arithmetic never rounds except where documented.
+//
+// The zero value is zero in no particular currency and takes on the
+// currency of whatever it is combined with.
+type Money struct {
+	Amount   int64
+	Currency string
+}
+
+// NewMoney returns the amount given in minor units.
+func NewMoney(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// ParseMoney parses a decimal string such as "12.34" or "-0.5". Digits
+// beyond the currency's minor unit are rejected rather than rounded.
+func ParseMoney(value string, currency string) (Money, error) {
+	invalid := fmt.Errorf("invalid amount %q", value)
+	exponent := currencyExponent(currency)
+
+	s := strings.TrimSpace(value)
+	negative := false
+	if strings.HasPrefix(s, "-") {
+		negative = true
+		s = s[1:]
+	} else if strings.HasPrefix(s, "+") {
+		s = s[1:]
+	}
+
+	whole, fraction, _ := strings.Cut(s, ".")
+	if whole == "" && fraction == "" {
+		return Money{}, invalid
+	}
+	if whole == "" {
+		whole = "0"
+	}
+
+	// trailing zeros are harmless, e.g. "10.500" from a DECIMAL(10,3)
+	fraction = strings.TrimRight(fraction, "0")
+	if len(fraction) > exponent {
+		return Money{}, fmt.Errorf("amount %q has more than %d decimal places", value, exponent)
+	}
+	fraction += strings.Repeat("0", exponent-len(fraction))
+
+	for _, r := range whole + fraction {
+		if r < '0' || r > '9' {
+			return Money{}, invalid
+		}
+	}
+
+	amount, err := strconv.ParseInt(whole+fraction, 10, 64)
+	if err != nil {
+		return Money{}, invalid
+	}
+	if negative {
+		amount = -amount
+	}
+
+	return Money{Amount: amount, Currency: currency}, nil
+}
+
+// MustParseMoney is ParseMoney for constants; it panics on invalid input.
+func MustParseMoney(value string, currency string) Money {
+	m, err := ParseMoney(value, currency)
+	if err != nil {
+		panic(err)
+	}
+	return m
+}
+
+// String formats the amount as a plain decimal, e.g. "12.34".
+func (m Money) String() string {
+	exponent := currencyExponent(m.Currency)
+	amount := m.Amount
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+
+	digits := strconv.FormatInt(amount, 10)
+	if exponent == 0 {
+		return sign + digits
+	}
+	if len(digits) <= exponent {
+		digits = strings.Repeat("0", exponent-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-exponent] + "." + digits[len(digits)-exponent:]
+}
+
+// currencyWith returns the currency shared by m and other. Mixing two
+// different currencies is a programming error and panics.
+func (m Money) currencyWith(other Money) string {
+	switch {
+	case m.Currency == other.Currency || other.Currency == "":
+		return m.Currency
+	case m.Currency == "":
+		return other.Currency
+	}
+	panic(fmt.Sprintf("money: mixing %s and %s", m.Currency, other.Currency))
+}
+
+func (m Money) Add(other Money) Money {
+	return Money{Amount: m.Amount + other.Amount, Currency: m.currencyWith(other)}
+}
+
+func (m Money) Sub(other Money) Money {
+	return Money{Amount: m.Amount - other.Amount, Currency: m.currencyWith(other)}
+}
+
+// Mul multiplies by a whole quantity, which is always exact.
+func (m Money) Mul(quantity int) Money {
+	return Money{Amount: m.Amount * int64(quantity), Currency: m.Currency}
+}
+
+// MulFraction multiplies by numerator/denominator and rounds to the nearest
+// minor unit, halves away from zero. Use it for rates such as tax and
+// percentage discounts, e.g. MulFraction(825, 10000) for 8.25%.
+func (m Money) MulFraction(numerator, denominator int64) Money {
+	if denominator == 0 {
+		panic("money: division by zero")
+	}
+	if denominator < 0 {
+		numerator, denominator = -numerator, -denominator
+	}
+
+	product := m.Amount * numerator
+	quotient, remainder := product/denominator, product%denominator
+	if remainder < 0 {
+		remainder = -remainder
+	}
+	if remainder*2 >= denominator {
+		if product < 0 {
+			quotient--
+		} else {
+			quotient++
+		}
+	}
+
+	return Money{Amount: quotient, Currency: m.Currency}
+}
+
+// Allocate splits m between the given weights without losing a minor unit.
+// Leftover units go to the first shares, so the parts always sum to m.
+func (m Money) Allocate(weights []int64) []Money {
+	parts := make([]Money, len(weights))
+	var total int64
+	for i, weight := range weights {
+		parts[i].Currency = m.Currency
+		total += weight
+	}
+	if total == 0 {
+		return parts
+	}
+
+	remainder := m.Amount
+	for i, weight := range weights {
+		parts[i].Amount = m.Amount * weight / total
+		remainder -= parts[i].Amount
+	}
+
+	step := int64(1)
+	if remainder < 0 {
+		step = -1
+	}
+	for i := 0; remainder != 0; i = (i + 1) % len(parts) {
+		if weights[i] == 0 {
+			continue
+		}
+		parts[i].Amount += step
+		remainder -= step
+	}
+
+	return parts
+}
+
+func (m Money) Neg() Money {
+	return Money{Amount: -m.Amount, Currency: m.Currency}
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+func (m Money) IsNegative() bool {
+	return m.Amount < 0
+}
+
+// Cmp returns -1, 0 or 1 as m is less than, equal to or greater than other.
+func (m Money) Cmp(other Money) int {
+	m.currencyWith(other)
+	switch {
+	case m.Amount < other.Amount:
+		return -1
+	case m.Amount > other.Amount:
+		return 1
+	}
+	return 0
+}
+
+// Min returns the smaller of m and other.
+func (m Money) Min(other Money) Money {
+	if m.Cmp(other) <= 0 {
+		return m
+	}
+	return other
+}
+
+type moneyJSON struct {
+	Amount   string `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// MarshalJSON writes {"amount":"12.34","currency":"USD"}. The amount is a
+// string so clients never parse it into a float by accident.
+func (m Money) MarshalJSON() ([]byte, error) {
+	currency := m.Currency
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+	return json.Marshal(moneyJSON{Amount: Money{Amount: m.Amount, Currency: currency}.String(), Currency: currency})
+}
+
+// UnmarshalJSON reads the object written by MarshalJSON, or a bare number
+// or string in DefaultCurrency. Numbers are parsed from their literal text,
+// never through float64. The database keeps no currency, so any currency
+// other than DefaultCurrency is rejected.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if bytes.Equal(data, []byte("null")) {
+		return nil
+	}
+
+	var value, currency string
+	switch {
+	case len(data) > 0 && data[0] == '{':
+		var object moneyJSON
+		if err := json.Unmarshal(data, &object); err != nil {
+			return err
+		}
+		value, currency = object.Amount, strings.ToUpper(object.Currency)
+	case len(data) > 0 && data[0] == '"':
+		if err := json.Unmarshal(data, &value); err != nil {
+			return err
+		}
+	default:
+		var number json.Number
+		if err := json.Unmarshal(data, &number); err != nil {
+			return err
+		}
+		value = number.String()
+	}
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+	if currency != DefaultCurrency {
+		return fmt.Errorf("unsupported currency %q, amounts must be in %s", currency, DefaultCurrency)
+	}
+
+	parsed, err := ParseMoney(value, currency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// Scan reads a DECIMAL column in DefaultCurrency.
+func (m *Money) Scan(src any) error {
+	var value string
+	switch v := src.(type) {
+	case []byte:
+		value = string(v)
+	case string:
+		value = v
+	case int64:
+		value = strconv.FormatInt(v, 10)
+	case float64:
+		value = strconv.FormatFloat(v, 'f', currencyExponent(DefaultCurrency), 64)
+	case nil:
+		*m = Money{Currency: DefaultCurrency}
+		return nil
+	default:
+		return fmt.Errorf("money: cannot scan %T", src)
+	}
+
+	parsed, err := ParseMoney(value, DefaultCurrency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// Value writes the amount as a decimal string, which MySQL stores exactly.
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
@@ -0,0 +1,192 @@
+package domain
+
+import (
+	"encoding/json"
+	"math/rand"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		value    string
+		currency string
+		amount   int64
+		invalid  bool
+	}{
+		{value: "12.34", currency: "USD", amount: 1234},
+		{value: "0.1", currency: "USD", amount: 10},
+		{value: "-0.5", currency: "USD", amount: -50},
+		{value: ".25", currency: "USD", amount: 25},
+		{value: "10.500", currency: "USD", amount: 1050},
+		{value: "1000", currency: "JPY", amount: 1000},
+		{value: "1.005", currency: "USD", invalid: true},
+		{value: "1.5", currency: "JPY", invalid: true},
+		{value: "1e3", currency: "USD", invalid: true},
+		{value: "", currency: "USD", invalid: true},
+		{value: "-", currency: "USD", invalid: true},
+	}
+
+	for _, test := range tests {
+		m, err := ParseMoney(test.value, test.currency)
+		if test.invalid {
+			if err == nil {
+				t.Errorf("ParseMoney(%q) expected an error, got %v", test.value, m)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseMoney(%q) returned %v", test.value, err)
+			continue
+		}
+		if m.Amount != test.amount || m.Currency != test.currency {
+			t.Errorf("ParseMoney(%q) = %+v, expected %d %s", test.value, m, test.amount, test.currency)
+		}
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	tests := map[string]Money{
+		"12.34": NewMoney(1234, "USD"),
+		"0.05":  NewMoney(5, "USD"),
+		"-0.05": NewMoney(-5, "USD"),
+		"0.00":  NewMoney(0, "USD"),
+		"500":   NewMoney(500, "JPY"),
+	}
+
+	for expected, m := range tests {
+		if m.String() != expected {
+			t.Errorf("expected %q, got %q", expected, m.String())
+		}
+	}
+}
+
+// Summing line totals must give the same result as the decimal arithmetic
+// a customer would do by hand, however many lines there are.
+func TestMoneySumIsExact(t *testing.T) {
+	dime := MustParseMoney("0.1", "USD")
+	var total Money
+	for i := 0; i < 1000; i++ {
+		total = total.Add(dime.Mul(3))
+	}
+	if total != MustParseMoney("300", "USD") {
+		t.Errorf("expected 300.00, got %s", total)
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		var sum Money
+		var cents int64
+		for j := 0; j < 1+rng.Intn(20); j++ {
+			price := rng.Int63n(100000)
+			quantity := 1 + rng.Intn(50)
+			sum = sum.Add(NewMoney(price, "USD").Mul(quantity))
+			cents += price * int64(quantity)
+		}
+		if sum.Amount != cents {
+			t.Fatalf("expected %d cents, got %d", cents, sum.Amount)
+		}
+
+		// the formatted total parses back to the same amount
+		parsed, err := ParseMoney(sum.String(), "USD")
+		if err != nil || parsed != sum {
+			t.Fatalf("round trip of %s gave %v, %v", sum, parsed, err)
+		}
+	}
+}
+
+func TestMoneyMulFraction(t *testing.T) {
+	tests := []struct {
+		amount      int64
+		numerator   int64
+		denominator int64
+		expected    int64
+	}{
+		{amount: 1000, numerator: 825, denominator: 10000, expected: 83},   // 82.5 rounds up
+		{amount: 1000, numerator: 824, denominator: 10000, expected: 82},   // 82.4 rounds down
+		{amount: -1000, numerator: 825, denominator: 10000, expected: -83}, // halves away from zero
+		{amount: 999, numerator: 1, denominator: 3, expected: 333},
+		{amount: 1000, numerator: 1, denominator: -4, expected: -250},
+	}
+
+	for _, test := range tests {
+		got := NewMoney(test.amount, "USD").MulFraction(test.numerator, test.denominator)
+		if got.Amount != test.expected {
+			t.Errorf("%d * %d/%d: expected %d, got %d", test.amount, test.numerator, test.denominator, test.expected, got.Amount)
+		}
+	}
+}
+
+func TestMoneyAllocate(t *testing.T) {
+	parts := NewMoney(100, "USD").Allocate([]int64{1, 1, 1})
+	if parts[0].Amount != 34 || parts[1].Amount != 33 || parts[2].Amount != 33 {
+		t.Errorf("expected 34/33/33, got %v", parts)
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 1000; i++ {
+		total := NewMoney(rng.Int63n(2000000)-1000000, "USD")
+		weights := make([]int64, 1+rng.Intn(10))
+		for j := range weights {
+			weights[j] = rng.Int63n(5000)
+		}
+		weights[0]++
+
+		var sum Money
+		for _, part := range total.Allocate(weights) {
+			sum = sum.Add(part)
+		}
+		if sum != total {
+			t.Fatalf("allocating %s over %v sums to %s", total, weights, sum)
+		}
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	data, err := json.Marshal(NewMoney(1050, "USD"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != `{"amount":"10.50","currency":"USD"}` {
+		t.Errorf("unexpected JSON %s", data)
+	}
+
+	var m Money
+	if err := json.Unmarshal(data, &m); err != nil || m != NewMoney(1050, "USD") {
+		t.Errorf("round trip gave %v, %v", m, err)
+	}
+
+	// bare numbers are read from their literal text, not through float64
+	if err := json.Unmarshal([]byte("0.29"), &m); err != nil || m.Amount != 29 {
+		t.Errorf("expected 29 cents, got %v, %v", m, err)
+	}
+	if err := json.Unmarshal([]byte(`"7.5"`), &m); err != nil || m.Amount != 750 {
+		t.Errorf("expected 750 cents, got %v, %v", m, err)
+	}
+	if err := json.Unmarshal([]byte("0.001"), &m); err == nil {
+		t.Error("expected an error for sub-cent amounts")
+	}
+
+	// the database stores amounts without their currency
+	if err := json.Unmarshal([]byte(`{"amount":"10.50","currency":"EUR"}`), &m); err == nil {
+		t.Errorf("expected an error for a currency other than %s, got %v", DefaultCurrency, m)
+	}
+	if err := json.Unmarshal([]byte(`{"amount":"10.50","currency":"usd"}`), &m); err != nil || m != NewMoney(1050, "USD") {
+		t.Errorf("expected the currency to be case insensitive, got %v, %v", m, err)
+	}
+}
+
+func TestMoneyScan(t *testing.T) {
+	for _, src := range []any{[]byte("19.99"), "19.99", 19.99} {
+		var m Money
+		if err := m.Scan(src); err != nil {
+			t.Fatalf("Scan(%v) returned %v", src, err)
+		}
+		if m != NewMoney(1999, DefaultCurrency) {
+			t.Errorf("Scan(%v) = %v", src, m)
+		}
+		value, _ := m.Value()
+		if value != "19.99" {
+			t.Errorf("expected value 19.99, got %v", value)
+		}
+	}
+}
@@ -1,25 +1,173 @@
 package domain
 
-import "time"
+import (
+	"errors"
+	"time"
+)
+
+const (
+	OrderStatusPending   = "pending"
+	OrderStatusPaid      = "paid"
+	OrderStatusShipped   = "shipped"
+	OrderStatusDelivered = "delivered"
+	OrderStatusCompleted = "completed"
+	OrderStatusCancelled = "cancelled"
+	// Orders that had money given back through a refund.
+	OrderStatusPartiallyRefunded = "partially_refunded"
+	OrderStatusRefunded          = "refunded"
+)
+
+var ErrOrderNotFound = errors.New("order not found")
+
+// ErrOrderStatusConflict is returned when an order's status changed between
+// reading it and writing the transition.
+var ErrOrderStatusConflict = errors.New("order status was changed concurrently")
+
+var (
+	// ErrOrderNotRefundable is returned for orders that weren't paid or were
+	// refunded in full already.
+	ErrOrderNotRefundable = errors.New("order can't be refunded")
+	// ErrInvalidRefund wraps the reason the requested refund lines don't fit
+	// the order.
+	ErrInvalidRefund = errors.New("invalid refund")
+	// ErrRefundConflict is returned when a concurrent refund took some of
+	// the refundable quantity or amount first.
+	ErrRefundConflict = errors.New("order was refunded concurrently")
+)
+
+// A refund is pending while the provider is asked for the money. Pending
+// refunds hold their amount and quantities so no other refund takes them.
+const (
+	RefundStatusPending   = "pending"
+	RefundStatusCompleted = "completed"
+	RefundStatusFailed    = "failed"
+)
 
 type Order struct {
-	ID        int       `json:"id"`
-	UserID    string    `json:"userId"`
-	Total     float64   `json:"total"`
-	Status    string    `json:"status"`
-	Address   string    `json:"address"`
-	CreatedAt time.Time `json:"createdAt"`
+	ID       int    `json:"id"`
+	UserID   string `json:"userId"`
+	Total    Money  `json:"total"`
+	Discount Money  `json:"discount"`
+	Tax      Money  `json:"tax"`
+	// ShippingMethod keeps the method's name as it was when ordering.
+	ShippingMethodID *int   `json:"shippingMethodId"`
+	ShippingMethod   string `json:"shippingMethod"`
+	Shipping         Money  `json:"shipping"`
+	// Refunded is the sum of the refunds, Total stays what was charged.
+	Refunded       Money     `json:"refunded"`
+	Status         string    `json:"status"`
+	Address        string    `json:"address"`
+	BillingAddress string    `json:"billingAddress"`
+	CreatedAt      time.Time `json:"createdAt"`
 }
 
+// OrderItem is a product of an order shipped from one warehouse. A cart line
+// fulfilled by several warehouses becomes an item per warehouse.
 type OrderItem struct {
-	ID        int     `json:"id"`
-	OrderID   int     `json:"orderId"`
-	ProductID int     `json:"productId"`
-	Quantity  int     `json:"quantity"`
-	Price     float64 `json:"price"`
+	ID          int       `json:"id"`
+	OrderID     int       `json:"orderId"`
+	ProductID   int       `json:"productId"`
+	WarehouseID int       `json:"warehouseId"`
+	Quantity    int       `json:"quantity"`
+	Price       Money     `json:"price"`
+	Taxes       []TaxLine `json:"taxes"`
+	// Total is what was charged for the line, after its share of the
+	// discount and with its tax.
+	Total            Money `json:"total"`
+	RefundedQuantity int   `json:"refundedQuantity"`
+}
+
+// OrderLine is an order item joined with the name of the product it refers to.
+type OrderLine struct {
+	OrderItem
+	ProductName string `json:"productName"`
+}
+
+type OrderDetails struct {
+	Order
+	Items []OrderLine `json:"items"`
+}
+
+type OrderFilter struct {
+	UserID string
+	Status string
+	From   *time.Time
+	To     *time.Time
+	Limit  int
+	Offset int
+}
+
+type OrderStatusHistory struct {
+	ID         int       `json:"id"`
+	OrderID    int       `json:"orderId"`
+	FromStatus string    `json:"fromStatus"`
+	ToStatus   string    `json:"toStatus"`
+	ActorID    string    `json:"actorId"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+type OrderStatusPayload struct {
+	Status string `json:"status" validate:"required"`
+}
+
+// Refund gives money back for an order. Items is empty for a refund of the
+// shipping alone.
+type Refund struct {
+	ID        int          `json:"id"`
+	OrderID   int          `json:"orderId"`
+	PaymentID int          `json:"paymentId"`
+	Amount    Money        `json:"amount"`
+	Status    string       `json:"status"`
+	Reason    string       `json:"reason"`
+	Restock   bool         `json:"restock"`
+	ActorID   string       `json:"actorId"`
+	Items     []RefundItem `json:"items"`
+	CreatedAt time.Time    `json:"createdAt"`
+}
+
+type RefundItem struct {
+	OrderItemID int   `json:"orderItemId"`
+	ProductID   int   `json:"productId"`
+	WarehouseID int   `json:"warehouseId"`
+	Quantity    int   `json:"quantity"`
+	Amount      Money `json:"amount"`
+}
+
+// RefundPayload refunds the given items, or everything not refunded yet,
+// shipping included, when Items is empty. Restock puts the refunded
+// quantities back in stock.
+type RefundPayload struct {
+	Items   []RefundItemPayload `json:"items" validate:"dive"`
+	Restock bool                `json:"restock"`
+	Reason  string              `json:"reason" validate:"max=255"`
+}
+
+type RefundItemPayload struct {
+	OrderItemID int `json:"orderItemId" validate:"required"`
+	Quantity    int `json:"quantity" validate:"required,min=1"`
 }
 
 type OrderRepository interface {
 	CreateOrder(order Order) (int, error)
 	CreateOrderItem(orderItem OrderItem) error
+	GetOrderByID(id int) (*Order, error)
+	// LockOrder holds the order until the transaction ends, so what is read
+	// of it and its returns can't change under a check. It must be called
+	// inside a unit of work.
+	LockOrder(id int) error
+	GetOrderItems(orderID int) (*[]OrderItem, error)
+	GetOrders(filter OrderFilter) (*[]Order, int, error)
+	GetOrderLines(orderID int) (*[]OrderLine, error)
+	UpdateOrderStatus(id int, from, to string) error
+	CreateOrderStatusHistory(history OrderStatusHistory) error
+	// CreateRefund writes the refund and adds it to the refunded amount of
+	// the order and the refunded quantities of its items, returning
+	// ErrRefundConflict when that would exceed what was ordered.
+	CreateRefund(refund Refund) (int, error)
+	// CompleteRefund marks a pending refund completed, returning
+	// ErrRefundConflict when it isn't pending anymore.
+	CompleteRefund(id int) error
+	// FailRefund marks a pending refund failed and takes it back off the
+	// refunded amount of the order and the refunded quantities of its items.
+	FailRefund(refund Refund) error
 }
@@ -0,0 +1,33 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrPasswordResetTokenNotFound = errors.New("password reset token not found")
+
+type PasswordResetToken struct {
+	ID        string     `json:"id"`
+	UserID    string     `json:"userId"`
+	TokenHash string     `json:"-"`
+	ExpiresAt time.Time  `json:"expiresAt"`
+	UsedAt    *time.Time `json:"usedAt"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+type ForgotPasswordPayload struct {
+	Email string `json:"email" validate:"required,email"`
+}
+
+type ResetPasswordPayload struct {
+	Token    string `json:"token" validate:"required"`
+	Password string `json:"password" validate:"required,min=6"`
+}
+
+type PasswordResetRepository interface {
+	CreatePasswordResetToken(token PasswordResetToken) error
+	GetPasswordResetTokenByHash(hash string) (*PasswordResetToken, error)
+	// MarkPasswordResetTokenUsed returns false when the token was already used.
+	MarkPasswordResetTokenUsed(id string) (bool, error)
+}
@@ -0,0 +1,83 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	PaymentStatusAuthorized = "authorized"
+	PaymentStatusCaptured   = "captured"
+	PaymentStatusVoided     = "voided"
+	PaymentStatusRefunded   = "refunded"
+)
+
+// PaymentEventCaptured is sent by the provider once the money of a captured
+// payment is secured. Webhook events of other types are acknowledged and
+// ignored.
+const PaymentEventCaptured = "payment.captured"
+
+// PaymentSignatureHeader carries the provider's signature of a webhook body.
+const PaymentSignatureHeader = "X-Payment-Signature"
+
+var (
+	ErrPaymentNotFound = errors.New("payment not found")
+	// ErrPaymentDeclined wraps the reason the provider gave for refusing a
+	// card.
+	ErrPaymentDeclined            = errors.New("payment declined")
+	ErrInvalidWebhookSignature    = errors.New("invalid webhook signature")
+	ErrPaymentStatusConflict      = errors.New("payment status was changed concurrently")
+	ErrPaymentRefundExceedsAmount = errors.New("refund exceeds the captured amount")
+)
+
+// Payment is a charge at the payment provider for an order. Reference is the
+// provider's ID for it.
+type Payment struct {
+	ID        int       `json:"id"`
+	OrderID   int       `json:"orderId"`
+	Provider  string    `json:"provider"`
+	Reference string    `json:"reference"`
+	Amount    Money     `json:"amount"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// PaymentRequest asks the provider to hold Amount on the card Source points
+// to. Source is the token the provider's client library hands out for a
+// card; the fake provider takes plain card numbers.
+type PaymentRequest struct {
+	Amount Money
+	Source string
+}
+
+// PaymentEvent is a verified webhook notification from the provider.
+type PaymentEvent struct {
+	Type      string `json:"type"`
+	Reference string `json:"reference"`
+	Amount    Money  `json:"amount"`
+}
+
+// PaymentProvider is the gateway that moves the money. Authorizations are
+// held until captured or voided; refunds only apply to captured payments.
+type PaymentProvider interface {
+	Name() string
+	// Authorize returns the reference of the hold, or an error wrapping
+	// ErrPaymentDeclined when the card is refused.
+	Authorize(request PaymentRequest) (reference string, err error)
+	Capture(reference string, amount Money) error
+	Void(reference string) error
+	Refund(reference string, amount Money) error
+	// VerifyWebhook checks the signature of a webhook body and decodes the
+	// event it carries, returning ErrInvalidWebhookSignature when the body
+	// wasn't sent by the provider.
+	VerifyWebhook(payload []byte, signature string) (*PaymentEvent, error)
+}
+
+type PaymentRepository interface {
+	CreatePayment(payment Payment) (int, error)
+	GetPaymentByReference(provider, reference string) (*Payment, error)
+	GetPaymentsByOrderID(orderID int) (*[]Payment, error)
+	// UpdatePaymentStatus returns ErrPaymentStatusConflict when the payment
+	// isn't in the from status anymore.
+	UpdatePaymentStatus(id int, from, to string) error
+}
@@ -1,37 +1,134 @@
 package domain
 
-import "time"
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrProductNotFound = errors.New("product not found")
+	// ErrProductVersionConflict is returned when a product was changed since
+	// the version the update was based on.
+	ErrProductVersionConflict = errors.New("product was changed concurrently")
+	// ErrProductStockNotFound is returned when a product has no stock row in
+	// any warehouse, or in the warehouse asked for.
+	ErrProductStockNotFound = errors.New("product stock not found")
+)
 
 type Product struct {
-	ID          int       `json:"id"`
-	Name        string    `json:"name"`
-	Description string    `json:"description"`
-	Image       string    `json:"image"`
-	Price       float64   `json:"price"`
-	Quantity    int       `json:"quantity"`
-	CreatedAt   time.Time `json:"createdAt"`
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Image       string `json:"image"`
+	Category    string `json:"category"`
+	TaxClass    string `json:"taxClass"`
+	Price       Money  `json:"price"`
+	// Quantity is what is available to sell: the stock on hand minus what
+	// running checkouts reserved.
+	Quantity int `json:"quantity"`
+	Reserved int `json:"reserved"`
+	// Weight is in grams and the dimensions of the package in millimetres.
+	Weight    int       `json:"weight"`
+	Length    int       `json:"length"`
+	Width     int       `json:"width"`
+	Height    int       `json:"height"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"createdAt"`
 }
 
+// ProductStock is the stock on hand of a product in the active warehouses,
+// with the stock of every warehouse listed in Warehouses. Available is what
+// is left to sell after the reservations.
 type ProductStock struct {
-	ProductID int `json:"product_id"`
-	Quantity  int `json:"quantity"`
+	ProductID  int              `json:"product_id"`
+	Quantity   int              `json:"quantity"`
+	Reserved   int              `json:"reserved"`
+	Available  int              `json:"available"`
+	Warehouses []WarehouseStock `json:"warehouses"`
 }
 
+// ProductPayload holds a new product or the replacement of one. When Version
+// is sent the replacement only applies to that version of the product.
+// Quantity is the stock of a new product; replacements leave the stock alone,
+// it is set per warehouse.
 type ProductPayload struct {
-	Name        string  `json:"name" validate:"required"`
-	Description string  `json:"description" validate:"required"`
-	Image       string  `json:"image" validate:"required"`
-	Price       float64 `json:"price" validate:"required"`
-	Quantity    int     `json:"quantity" validate:"required"`
+	Name        string `json:"name" validate:"required"`
+	Description string `json:"description" validate:"required"`
+	Image       string `json:"image" validate:"required"`
+	Category    string `json:"category" validate:"max=100"`
+	TaxClass    string `json:"taxClass" validate:"max=32"`
+	Price       Money  `json:"price" validate:"required,gt=0"`
+	Quantity    int    `json:"quantity" validate:"gte=0"`
+	Weight      int    `json:"weight" validate:"gte=0"`
+	Length      int    `json:"length" validate:"gte=0"`
+	Width       int    `json:"width" validate:"gte=0"`
+	Height      int    `json:"height" validate:"gte=0"`
+	Version     *int   `json:"version" validate:"omitempty,min=1"`
+}
+
+// ProductPatchPayload holds a partial product update. Fields left out of the
+// request are kept as they are. When Version is sent the update only applies
+// to that version of the product. Quantity is refused, the stock is set per
+// warehouse.
+type ProductPatchPayload struct {
+	Name        *string `json:"name" validate:"omitempty,min=1"`
+	Description *string `json:"description" validate:"omitempty,min=1"`
+	Image       *string `json:"image" validate:"omitempty,min=1"`
+	Category    *string `json:"category" validate:"omitempty,max=100"`
+	TaxClass    *string `json:"taxClass" validate:"omitempty,min=1,max=32"`
+	Price       *Money  `json:"price" validate:"omitempty,gt=0"`
+	Quantity    *int    `json:"quantity" validate:"omitempty,gte=0"`
+	Weight      *int    `json:"weight" validate:"omitempty,gte=0"`
+	Length      *int    `json:"length" validate:"omitempty,gte=0"`
+	Width       *int    `json:"width" validate:"omitempty,gte=0"`
+	Height      *int    `json:"height" validate:"omitempty,gte=0"`
+	Version     *int    `json:"version" validate:"omitempty,min=1"`
+}
+
+const (
+	ProductSortCreatedAt = "createdAt"
+	ProductSortPrice     = "price"
+	ProductSortName      = "name"
+)
+
+// ProductCursor marks the last product of a page for keyset pagination. Value
+// holds that product's value of the sort column.
+type ProductCursor struct {
+	Value interface{}
+	ID    int
+}
+
+type ProductQuery struct {
+	Limit      int
+	Offset     int
+	Cursor     *ProductCursor
+	SortBy     string
+	Descending bool
+	MinPrice   *Money
+	MaxPrice   *Money
+	InStock    bool
+	Name       string
+}
+
+type ProductPage struct {
+	Products []Product
+	Total    int
+	HasMore  bool
 }
 
 type ProductRepository interface {
-	GetProducts() (*[]Product, error)
+	GetProducts(query ProductQuery) (*ProductPage, error)
 	CreateProduct(product Product) error
 	GetProductByID(id int) (*Product, error)
 	GetProductByIDs(ids []int) (*[]Product, error)
+	// UpdateProduct writes the product if it is still at product.Version,
+	// returning ErrProductVersionConflict otherwise.
 	UpdateProduct(product Product) error
+	DeleteProduct(id int) error
 
 	GetProductStock(productID int) (*ProductStock, error)
-	UpdateProductStock(productID, quantity int) error
+	// UpdateProductStock adds quantity to the stock on hand in the
+	// warehouse, returning ErrInsufficientStock when a decrease would cut
+	// into the reserved stock.
+	UpdateProductStock(productID, warehouseID, quantity int) error
 }
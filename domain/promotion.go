@@ -0,0 +1,89 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrPromotionNotFound  = errors.New("promotion not found")
+	ErrPromotionCodeTaken = errors.New("promotion code is already in use")
+	// ErrPromotionNotApplicable wraps the reason a code can't be used on a
+	// cart, e.g. that it expired or the minimum subtotal isn't met.
+	ErrPromotionNotApplicable = errors.New("promotion can't be applied")
+)
+
+const (
+	PromotionPercentage   = "percentage"    // Percent off the eligible lines
+	PromotionFixedAmount  = "fixed_amount"  // AmountOff the eligible lines
+	PromotionBuyXGetY     = "buy_x_get_y"   // every BuyQuantity+GetQuantity units, GetQuantity are free
+	PromotionFreeShipping = "free_shipping" // no shipping cost
+)
+
+// Promotion is a discount customers unlock with a code at checkout. A
+// promotion without ProductIDs or Categories applies to every product.
+type Promotion struct {
+	ID          int        `json:"id"`
+	Code        string     `json:"code"`
+	Description string     `json:"description"`
+	Type        string     `json:"type"`
+	Percent     int        `json:"percent,omitempty"`
+	AmountOff   Money      `json:"amountOff"`
+	BuyQuantity int        `json:"buyQuantity,omitempty"`
+	GetQuantity int        `json:"getQuantity,omitempty"`
+	MinSubtotal Money      `json:"minSubtotal"`
+	ProductIDs  []int      `json:"productIds"`
+	Categories  []string   `json:"categories"`
+	StartsAt    *time.Time `json:"startsAt"`
+	EndsAt      *time.Time `json:"endsAt"`
+	// UsageLimit caps redemptions across all customers and PerUserLimit
+	// caps them per customer. Nil means unlimited.
+	UsageLimit   *int      `json:"usageLimit"`
+	PerUserLimit *int      `json:"perUserLimit"`
+	TimesUsed    int       `json:"timesUsed"`
+	Active       bool      `json:"active"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+type PromotionPayload struct {
+	Code         string     `json:"code" validate:"required,max=64,alphanum"`
+	Description  string     `json:"description" validate:"max=255"`
+	Type         string     `json:"type" validate:"required,oneof=percentage fixed_amount buy_x_get_y free_shipping"`
+	Percent      int        `json:"percent" validate:"required_if=Type percentage,gte=0,lte=100"`
+	AmountOff    Money      `json:"amountOff" validate:"required_if=Type fixed_amount,gte=0"`
+	BuyQuantity  int        `json:"buyQuantity" validate:"required_if=Type buy_x_get_y,gte=0"`
+	GetQuantity  int        `json:"getQuantity" validate:"required_if=Type buy_x_get_y,gte=0"`
+	MinSubtotal  Money      `json:"minSubtotal" validate:"gte=0"`
+	ProductIDs   []int      `json:"productIds" validate:"dive,gt=0"`
+	Categories   []string   `json:"categories" validate:"dive,required,max=100"`
+	StartsAt     *time.Time `json:"startsAt"`
+	EndsAt       *time.Time `json:"endsAt"`
+	UsageLimit   *int       `json:"usageLimit" validate:"omitempty,gt=0"`
+	PerUserLimit *int       `json:"perUserLimit" validate:"omitempty,gt=0"`
+	Active       *bool      `json:"active"`
+}
+
+// PromotionRedemption records a promotion used by an order.
+type PromotionRedemption struct {
+	PromotionID int       `json:"promotionId"`
+	OrderID     int       `json:"orderId"`
+	UserID      string    `json:"userId"`
+	Code        string    `json:"code"`
+	Discount    Money     `json:"discount"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+type PromotionRepository interface {
+	GetPromotions() (*[]Promotion, error)
+	GetPromotionByID(id int) (*Promotion, error)
+	GetPromotionByCode(code string) (*Promotion, error)
+	CreatePromotion(promotion Promotion) (int, error)
+	UpdatePromotion(promotion Promotion) error
+	DeletePromotion(id int) error
+
+	// CountRedemptions returns how often userID has used the promotion.
+	CountRedemptions(promotionID int, userID string) (int, error)
+	// RedeemPromotion records a use of the promotion, failing with
+	// ErrPromotionNotApplicable once a usage limit is reached.
+	RedeemPromotion(redemption PromotionRedemption) error
+}
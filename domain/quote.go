@@ -0,0 +1,58 @@
+package domain
+
+// Quote is the priced breakdown of a cart. Checkout places orders from the
+// same quote, so the totals shown to the customer are the totals charged.
+type Quote struct {
+	Lines      []QuoteLine        `json:"lines"`
+	Promotions []AppliedPromotion `json:"promotions"`
+	Subtotal   Money              `json:"subtotal"`
+	Discount   Money              `json:"discount"`
+	Tax        Money              `json:"tax"`
+	Shipping   Money              `json:"shipping"`
+	Total      Money              `json:"total"`
+	// ShippingMethod is the method Shipping was priced with, nil when no
+	// method delivers to the address; such a quote can't be ordered.
+	ShippingMethod *ShippingOption `json:"shippingMethod"`
+	// TaxIncluded is set when prices already include Tax, so it isn't
+	// added to the total again.
+	TaxIncluded bool `json:"taxIncluded"`
+}
+
+// AppliedPromotion is a promotion code used by a quote. Discount is taken off
+// the subtotal, or is the shipping cost waived for free shipping.
+type AppliedPromotion struct {
+	PromotionID  int    `json:"promotionId"`
+	Code         string `json:"code"`
+	Description  string `json:"description"`
+	Discount     Money  `json:"discount"`
+	FreeShipping bool   `json:"freeShipping,omitempty"`
+}
+
+type QuoteLine struct {
+	ProductID   int    `json:"productId"`
+	ProductName string `json:"productName"`
+	Quantity    int    `json:"quantity"`
+	UnitPrice   Money  `json:"unitPrice"`
+	LineTotal   Money  `json:"lineTotal"`
+	// Discount is the line's share of the quote discount.
+	Discount Money `json:"discount"`
+	// Taxes apply to the line total less its share of the discount.
+	Taxes     []TaxLine `json:"taxes,omitempty"`
+	Available int       `json:"available"`
+	// Warning explains why the line can't be ordered as it is.
+	Warning string `json:"warning,omitempty"`
+}
+
+// Orderable reports whether the quote has a shipping method and every line
+// of it can be ordered.
+func (q *Quote) Orderable() bool {
+	if q.ShippingMethod == nil {
+		return false
+	}
+	for _, line := range q.Lines {
+		if line.Warning != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,41 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrInsufficientStock is returned when less stock is available to sell
+	// than was asked for.
+	ErrInsufficientStock = errors.New("insufficient stock")
+	// ErrReservationNotFound is returned for reservations that were already
+	// converted or released, by the sweeper for instance.
+	ErrReservationNotFound = errors.New("stock reservation not found")
+)
+
+// StockReservation holds Quantity of a product's stock in a warehouse for a
+// checkout until ExpiresAt. Reserved stock stays on hand but can't be sold to
+// anyone else.
+type StockReservation struct {
+	ID          int       `json:"id"`
+	ProductID   int       `json:"productId"`
+	WarehouseID int       `json:"warehouseId"`
+	Quantity    int       `json:"quantity"`
+	ExpiresAt   time.Time `json:"expiresAt"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+type ReservationRepository interface {
+	// CreateReservation returns ErrInsufficientStock when less than the
+	// reserved quantity is available to sell in the warehouse.
+	CreateReservation(reservation StockReservation) (int, error)
+	// ConvertReservation turns the reservation into a sale, taking its
+	// quantity off the stock on hand.
+	ConvertReservation(id int) error
+	// ReleaseReservation gives the reserved quantity back to sell.
+	ReleaseReservation(id int) error
+	// ReleaseExpiredReservations releases the reservations that expired
+	// before now and returns how many it released.
+	ReleaseExpiredReservations(now time.Time) (int, error)
+}
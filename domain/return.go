@@ -0,0 +1,107 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	ReturnStatusRequested = "requested"
+	ReturnStatusApproved  = "approved"
+	ReturnStatusRejected  = "rejected"
+	ReturnStatusReceived  = "received"
+	ReturnStatusInspected = "inspected"
+	ReturnStatusRefunded  = "refunded"
+)
+
+var (
+	ErrReturnNotFound = errors.New("return not found")
+	// ErrInvalidReturn wraps the reason the requested items can't be
+	// returned.
+	ErrInvalidReturn = errors.New("invalid return")
+	// ErrReturnStatusConflict is returned when a return's status changed
+	// between reading it and writing the transition.
+	ErrReturnStatusConflict = errors.New("return status was changed concurrently")
+)
+
+// Return is a customer's request to send back items of an order. RefundID
+// is set once the items were refunded.
+type Return struct {
+	ID        int          `json:"id"`
+	OrderID   int          `json:"orderId"`
+	UserID    string       `json:"userId"`
+	Status    string       `json:"status"`
+	RefundID  *int         `json:"refundId"`
+	Items     []ReturnItem `json:"items,omitempty"`
+	CreatedAt time.Time    `json:"createdAt"`
+}
+
+type ReturnItem struct {
+	ID          int    `json:"id"`
+	ReturnID    int    `json:"returnId"`
+	OrderItemID int    `json:"orderItemId"`
+	Quantity    int    `json:"quantity"`
+	Reason      string `json:"reason"`
+}
+
+type ReturnDetails struct {
+	Return
+	History []ReturnStatusHistory `json:"history"`
+}
+
+type ReturnFilter struct {
+	UserID string
+	Status string
+	Limit  int
+	Offset int
+}
+
+type ReturnStatusHistory struct {
+	ID         int       `json:"id"`
+	ReturnID   int       `json:"returnId"`
+	FromStatus string    `json:"fromStatus"`
+	ToStatus   string    `json:"toStatus"`
+	ActorID    string    `json:"actorId"`
+	Note       string    `json:"note"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+type ReturnPayload struct {
+	OrderID int                 `json:"orderId" validate:"required"`
+	Items   []ReturnItemPayload `json:"items" validate:"required,min=1,dive"`
+}
+
+type ReturnItemPayload struct {
+	OrderItemID int    `json:"orderItemId" validate:"required"`
+	Quantity    int    `json:"quantity" validate:"required,min=1"`
+	Reason      string `json:"reason" validate:"required,max=255"`
+}
+
+type ReturnStatusPayload struct {
+	Status string `json:"status" validate:"required"`
+	Note   string `json:"note" validate:"max=255"`
+}
+
+// ReturnRefundPayload refunds the returned items, putting them back in
+// stock when Restock is set.
+type ReturnRefundPayload struct {
+	Restock bool `json:"restock"`
+}
+
+type ReturnRepository interface {
+	CreateReturn(ret Return) (int, error)
+	// GetReturnByID returns the return with its items.
+	GetReturnByID(id int) (*Return, error)
+	// GetReturns returns a page of returns without their items, and the
+	// number of returns matching the filter.
+	GetReturns(filter ReturnFilter) (*[]Return, int, error)
+	// GetOpenReturnQuantities sums the quantities per order item of the
+	// order's returns that are neither rejected nor refunded yet.
+	GetOpenReturnQuantities(orderID int) (map[int]int, error)
+	// UpdateReturnStatus returns ErrReturnStatusConflict when the return
+	// isn't in the from status anymore.
+	UpdateReturnStatus(id int, from, to string) error
+	SetReturnRefund(id int, refundID int) error
+	CreateReturnStatusHistory(history ReturnStatusHistory) error
+	GetReturnStatusHistory(returnID int) (*[]ReturnStatusHistory, error)
+}
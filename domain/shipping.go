@@ -0,0 +1,98 @@
+package domain
+
+import "errors"
+
+var (
+	// ErrShippingUnavailable is returned when a shipping method can't
+	// deliver to the address or can't carry the cart.
+	ErrShippingUnavailable     = errors.New("shipping method not available")
+	ErrShippingZoneNotFound    = errors.New("shipping zone not found")
+	ErrShippingMethodNotFound  = errors.New("shipping method not found")
+	ErrShippingZoneInUse       = errors.New("shipping zone is used by shipping methods")
+	ErrShippingAddressRequired = errors.New("a saved shipping address is required to check out")
+)
+
+const (
+	ShippingFlatRate    = "flat_rate"    // Rate per order
+	ShippingWeightBased = "weight_based" // Rate plus PerKg for every started kilogram
+	ShippingFreeOver    = "free_over"    // Rate, or free from a subtotal of FreeOver
+	ShippingLocalPickup = "local_pickup" // collected by the customer, no charge
+)
+
+// ShippingMethod is a way of delivering orders. Methods without a zone are
+// offered everywhere, the others only to addresses inside their zone.
+type ShippingMethod struct {
+	ID       int    `json:"id"`
+	ZoneID   *int   `json:"zoneId"`
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Rate     Money  `json:"rate"`
+	PerKg    Money  `json:"perKg"`
+	FreeOver Money  `json:"freeOver"`
+	// MaxWeight is the heaviest cart in grams the method carries, zero for
+	// no limit.
+	MaxWeight int  `json:"maxWeight"`
+	Active    bool `json:"active"`
+}
+
+// ShippingZone is a set of areas shipping methods can be limited to.
+type ShippingZone struct {
+	ID    int                `json:"id"`
+	Name  string             `json:"name"`
+	Areas []ShippingZoneArea `json:"areas"`
+}
+
+// ShippingZoneArea is a country, or a region of it when Region is set.
+type ShippingZoneArea struct {
+	Country string `json:"country" validate:"required,len=2,alpha"`
+	Region  string `json:"region" validate:"max=100"`
+}
+
+// ShippingZonePayload holds a new shipping zone or the replacement of one.
+type ShippingZonePayload struct {
+	Name  string             `json:"name" validate:"required,max=100"`
+	Areas []ShippingZoneArea `json:"areas" validate:"required,min=1,dive"`
+}
+
+// ShippingMethodPayload holds a new shipping method or the replacement of
+// one. Active defaults to true.
+type ShippingMethodPayload struct {
+	ZoneID    *int   `json:"zoneId" validate:"omitempty,gt=0"`
+	Name      string `json:"name" validate:"required,max=100"`
+	Type      string `json:"type" validate:"required,oneof=flat_rate weight_based free_over local_pickup"`
+	Rate      Money  `json:"rate" validate:"gte=0"`
+	PerKg     Money  `json:"perKg" validate:"gte=0"`
+	FreeOver  Money  `json:"freeOver" validate:"gte=0"`
+	MaxWeight int    `json:"maxWeight" validate:"gte=0"`
+	Active    *bool  `json:"active"`
+}
+
+// ShippingOption is a shipping method priced for a cart.
+type ShippingOption struct {
+	MethodID int    `json:"methodId"`
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Cost     Money  `json:"cost"`
+}
+
+type ShippingRepository interface {
+	// GetShippingMethods returns the active methods that deliver to the
+	// country and region, zone-less ones included.
+	GetShippingMethods(country, region string) (*[]ShippingMethod, error)
+	// GetAllShippingMethods returns every method, inactive ones included.
+	GetAllShippingMethods() (*[]ShippingMethod, error)
+	GetShippingMethodByID(id int) (*ShippingMethod, error)
+	CreateShippingMethod(method ShippingMethod) (int, error)
+	UpdateShippingMethod(method ShippingMethod) error
+	// DeleteShippingMethod deactivates the method, as past orders keep
+	// pointing at it.
+	DeleteShippingMethod(id int) error
+	GetShippingZones() (*[]ShippingZone, error)
+	GetShippingZoneByID(id int) (*ShippingZone, error)
+	CreateShippingZone(zone ShippingZone) (int, error)
+	// UpdateShippingZone replaces the name and the areas of the zone.
+	UpdateShippingZone(zone ShippingZone) error
+	// DeleteShippingZone returns ErrShippingZoneInUse while methods are
+	// limited to the zone.
+	DeleteShippingZone(id int) error
+}
@@ -0,0 +1,57 @@
+package domain
+
+// TaxClassStandard is the tax class of products that don't set one.
+const TaxClassStandard = "standard"
+
+// TaxRate is a row of the tax table. Empty Region and PostalPrefix match any
+// region or postal code of the country; the most specific matching row for
+// a product's tax class wins.
+type TaxRate struct {
+	ID           int    `json:"id"`
+	Country      string `json:"country"`
+	Region       string `json:"region"`
+	PostalPrefix string `json:"postalPrefix"`
+	TaxClass     string `json:"taxClass"`
+	Name         string `json:"name"`
+	// Rate is in basis points, e.g. 825 for 8.25%.
+	Rate int `json:"rate"`
+}
+
+// TaxLine is tax charged on an order item or quote line.
+type TaxLine struct {
+	Name   string `json:"name"`
+	Rate   int    `json:"rate"`
+	Amount Money  `json:"amount"`
+}
+
+// TaxableLine is a line to calculate tax for. Amount is what the customer
+// pays for the line after discounts.
+type TaxableLine struct {
+	ProductID int
+	TaxClass  string
+	Quantity  int
+	Amount    Money
+}
+
+type TaxRequest struct {
+	Address Address
+	Lines   []TaxableLine
+}
+
+// TaxResult holds the tax lines of each requested line, in request order.
+// When Inclusive is set the tax is already part of the line amounts.
+type TaxResult struct {
+	Lines     [][]TaxLine
+	Inclusive bool
+}
+
+// TaxCalculator works out the tax on a cart. Implementations may look rates
+// up locally or call out to a tax service.
+type TaxCalculator interface {
+	CalculateTax(request TaxRequest) (*TaxResult, error)
+}
+
+type TaxRateRepository interface {
+	// GetTaxRates returns every rate of the country, any region or class.
+	GetTaxRates(country string) (*[]TaxRate, error)
+}
@@ -0,0 +1,45 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrRefreshTokenNotFound = errors.New("refresh token not found")
+
+type RefreshToken struct {
+	ID        string     `json:"id"`
+	UserID    string     `json:"userId"`
+	FamilyID  string     `json:"familyId"`
+	TokenHash string     `json:"-"`
+	ExpiresAt time.Time  `json:"expiresAt"`
+	UsedAt    *time.Time `json:"usedAt"`
+	RevokedAt *time.Time `json:"revokedAt"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+type RefreshTokenPayload struct {
+	RefreshToken string `json:"refreshToken" validate:"required"`
+}
+
+type LogoutPayload struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+// TokenDenylist reports access tokens that were revoked before they expired.
+type TokenDenylist interface {
+	IsAccessTokenRevoked(jti string) (bool, error)
+}
+
+type TokenRepository interface {
+	TokenDenylist
+
+	CreateRefreshToken(token RefreshToken) error
+	GetRefreshTokenByHash(hash string) (*RefreshToken, error)
+	// MarkRefreshTokenUsed returns false when the token was already used or
+	// revoked, which means it is being replayed.
+	MarkRefreshTokenUsed(id string) (bool, error)
+	RevokeTokenFamily(familyID string) error
+	RevokeUserRefreshTokens(userID string) error
+	RevokeAccessToken(jti string, expiresAt time.Time) error
+}
@@ -0,0 +1,20 @@
+package domain
+
+// Repositories groups the repositories that take part in a unit of work.
+// Every repository returned shares the same underlying transaction.
+type Repositories interface {
+	Products() ProductRepository
+	Orders() OrderRepository
+	Carts() CartRepository
+	Promotions() PromotionRepository
+	Payments() PaymentRepository
+	Returns() ReturnRepository
+	Reservations() ReservationRepository
+	Warehouses() WarehouseRepository
+}
+
+// UnitOfWork runs fn inside a single transaction. The transaction is
+// committed when fn returns nil and rolled back otherwise.
+type UnitOfWork interface {
+	Do(fn func(repos Repositories) error) error
+}
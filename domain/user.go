@@ -1,6 +1,17 @@
 package domain
 
-import "time"
+import (
+	"errors"
+	"time"
+)
+
+var ErrUserNotFound = errors.New("user not found")
+
+const (
+	RoleCustomer = "customer"
+	RoleStaff    = "staff"
+	RoleAdmin    = "admin"
+)
 
 type User struct {
 	ID        string    `json:"id"`
@@ -9,6 +20,8 @@ type User struct {
 	Email     string    `json:"email"`
 	Password  string    `json:"-"`
 	Address   string    `json:"address"`
+	Role      string    `json:"role"`
+	Verified  bool      `json:"verified"`
 	CreatedAt time.Time `json:"createdAt"`
 }
 
@@ -25,8 +38,33 @@ type LoginUserPayload struct {
 	Password string `json:"password" validate:"required"`
 }
 
+type UpdateProfilePayload struct {
+	FirstName *string `json:"firstName" validate:"omitempty,min=1"`
+	LastName  *string `json:"lastName" validate:"omitempty,min=1"`
+	Address   *string `json:"address" validate:"omitempty,min=1"`
+}
+
+type ChangePasswordPayload struct {
+	CurrentPassword string `json:"currentPassword" validate:"required"`
+	NewPassword     string `json:"newPassword" validate:"required,min=6"`
+}
+
+type DeleteAccountPayload struct {
+	Password string `json:"password" validate:"required"`
+}
+
+type UserRolePayload struct {
+	Role string `json:"role" validate:"required,oneof=customer staff admin"`
+}
+
 type UserRepository interface {
 	GetUserByEmail(email string) (*User, error)
-	GetUserByID(id int) (*User, error)
+	GetUserByID(id string) (*User, error)
+	GetUsers(limit, offset int) (*[]User, int, error)
 	CreateUser(user User) error
+	UpdateUserRole(id string, role string) error
+	UpdatePassword(id string, hashedPassword string) error
+	MarkUserVerified(id string) error
+	UpdateUser(user User) error
+	DeleteUser(id string) error
 }
@@ -0,0 +1,79 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	ErrWarehouseNotFound  = errors.New("warehouse not found")
+	ErrWarehouseCodeTaken = errors.New("warehouse code is already in use")
+)
+
+const (
+	StockAllocationPriority        = "priority"         // warehouses in priority order
+	StockAllocationNearest         = "nearest"          // warehouses closest to the shipping address first
+	StockAllocationSingleWarehouse = "single_warehouse" // as few warehouses as possible
+)
+
+// Warehouse is a place stock is shipped from. Lower priorities are
+// preferred; inactive warehouses keep their stock but don't fulfil orders.
+type Warehouse struct {
+	ID         int       `json:"id"`
+	Code       string    `json:"code"`
+	Name       string    `json:"name"`
+	Country    string    `json:"country"`
+	Region     string    `json:"region"`
+	PostalCode string    `json:"postalCode"`
+	Priority   int       `json:"priority"`
+	Active     bool      `json:"active"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+// WarehouseStock is the stock of a product in one warehouse.
+type WarehouseStock struct {
+	WarehouseID int `json:"warehouseId"`
+	Quantity    int `json:"quantity"`
+	Reserved    int `json:"reserved"`
+	Available   int `json:"available"`
+}
+
+// StockAllocation is the part of a line a warehouse fulfils.
+type StockAllocation struct {
+	ProductID   int
+	WarehouseID int
+	Quantity    int
+}
+
+// WarehousePayload holds a new warehouse or the replacement of one. Active
+// defaults to true.
+type WarehousePayload struct {
+	Code       string `json:"code" validate:"required,max=32"`
+	Name       string `json:"name" validate:"required,max=100"`
+	Country    string `json:"country" validate:"required,len=2,alpha"`
+	Region     string `json:"region" validate:"max=100"`
+	PostalCode string `json:"postalCode" validate:"max=20"`
+	Priority   int    `json:"priority" validate:"gte=0"`
+	Active     *bool  `json:"active"`
+}
+
+// WarehouseStockPayload sets the stock of a product in a warehouse. Like the
+// product quantity, Quantity is what is available to sell there.
+type WarehouseStockPayload struct {
+	Quantity int `json:"quantity" validate:"gte=0"`
+}
+
+type WarehouseRepository interface {
+	CreateWarehouse(warehouse Warehouse) (int, error)
+	// GetWarehouses returns every warehouse in priority order.
+	GetWarehouses() (*[]Warehouse, error)
+	GetWarehouseByID(id int) (*Warehouse, error)
+	GetWarehouseByCode(code string) (*Warehouse, error)
+	UpdateWarehouse(warehouse Warehouse) error
+	// GetWarehouseStock returns the stock of each product per warehouse,
+	// keyed by product ID.
+	GetWarehouseStock(productIDs []int) (map[int][]WarehouseStock, error)
+	// SetWarehouseStock sets the stock available to sell in the warehouse,
+	// keeping the reserved units on hand on top of it.
+	SetWarehouseStock(productID, warehouseID, quantity int) error
+}
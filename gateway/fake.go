@@ -0,0 +1,215 @@
+package gateway
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"ecom/domain"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// fakeCharge is the state the fake provider keeps for an authorization.
+type fakeCharge struct {
+	amount   domain.Money
+	captured domain.Money
+	refunded domain.Money
+	status   string
+}
+
+// FakeProvider is an in-memory gateway for tests and local development. It
+// accepts every card except the decline list and, when given a webhook URL,
+// posts a signed payment.captured event there for every capture. References
+// are numbered in order, after the seed when there is one, so a run can be
+// replayed with the same references.
+type FakeProvider struct {
+	mu         sync.Mutex
+	secret     []byte
+	webhookURL string
+	declines   map[string]bool
+	charges    map[string]*fakeCharge
+	seed       string
+	issued     int
+}
+
+func NewFakeProvider(secret, webhookURL string, declineCards []string) *FakeProvider {
+	declines := make(map[string]bool, len(declineCards))
+	for _, card := range declineCards {
+		declines[normalizeCard(card)] = true
+	}
+	return &FakeProvider{
+		secret:     []byte(secret),
+		webhookURL: webhookURL,
+		declines:   declines,
+		charges:    make(map[string]*fakeCharge),
+	}
+}
+
+func (p *FakeProvider) Name() string {
+	return "fake"
+}
+
+func (p *FakeProvider) Authorize(request domain.PaymentRequest) (string, error) {
+	card := normalizeCard(request.Source)
+	if card == "" || p.declines[card] {
+		return "", fmt.Errorf("%w: card was refused", domain.ErrPaymentDeclined)
+	}
+	if request.Amount.IsNegative() {
+		return "", fmt.Errorf("cannot authorize a negative amount")
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	reference := p.nextReference()
+	p.charges[reference] = &fakeCharge{amount: request.Amount, status: domain.PaymentStatusAuthorized}
+	return reference, nil
+}
+
+func (p *FakeProvider) Capture(reference string, amount domain.Money) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	charge, ok := p.charges[reference]
+	if !ok {
+		return domain.ErrPaymentNotFound
+	}
+	if charge.status != domain.PaymentStatusAuthorized {
+		return fmt.Errorf("cannot capture a %s payment", charge.status)
+	}
+	if amount.Cmp(charge.amount) > 0 {
+		return fmt.Errorf("cannot capture more than the authorized %s", charge.amount)
+	}
+
+	charge.captured = amount
+	charge.refunded = domain.NewMoney(0, amount.Currency)
+	charge.status = domain.PaymentStatusCaptured
+
+	if p.webhookURL != "" {
+		event := domain.PaymentEvent{Type: domain.PaymentEventCaptured, Reference: reference, Amount: amount}
+		go p.deliver(event)
+	}
+
+	return nil
+}
+
+func (p *FakeProvider) Void(reference string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	charge, ok := p.charges[reference]
+	if !ok {
+		return domain.ErrPaymentNotFound
+	}
+	if charge.status != domain.PaymentStatusAuthorized {
+		return fmt.Errorf("cannot void a %s payment", charge.status)
+	}
+
+	charge.status = domain.PaymentStatusVoided
+	return nil
+}
+
+func (p *FakeProvider) Refund(reference string, amount domain.Money) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	charge, ok := p.charges[reference]
+	if !ok {
+		return domain.ErrPaymentNotFound
+	}
+	if charge.status != domain.PaymentStatusCaptured && charge.status != domain.PaymentStatusRefunded {
+		return fmt.Errorf("cannot refund a %s payment", charge.status)
+	}
+	if charge.refunded.Add(amount).Cmp(charge.captured) > 0 {
+		return domain.ErrPaymentRefundExceedsAmount
+	}
+
+	charge.refunded = charge.refunded.Add(amount)
+	if charge.refunded.Cmp(charge.captured) == 0 {
+		charge.status = domain.PaymentStatusRefunded
+	}
+	return nil
+}
+
+func (p *FakeProvider) VerifyWebhook(payload []byte, signature string) (*domain.PaymentEvent, error) {
+	expected, err := hex.DecodeString(signature)
+	if err != nil || !hmac.Equal(expected, p.mac(payload)) {
+		return nil, domain.ErrInvalidWebhookSignature
+	}
+
+	event := new(domain.PaymentEvent)
+	if err := json.Unmarshal(payload, event); err != nil {
+		return nil, err
+	}
+	return event, nil
+}
+
+// Sign returns the signature the fake provider sends along with a webhook
+// body, for tests and for simulating events by hand.
+func (p *FakeProvider) Sign(payload []byte) string {
+	return hex.EncodeToString(p.mac(payload))
+}
+
+// Status returns the provider side status of a payment, or an empty string
+// for an unknown reference.
+func (p *FakeProvider) Status(reference string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if charge, ok := p.charges[reference]; ok {
+		return charge.status
+	}
+	return ""
+}
+
+func (p *FakeProvider) mac(payload []byte) []byte {
+	mac := hmac.New(sha256.New, p.secret)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+func (p *FakeProvider) deliver(event domain.PaymentEvent) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("payment gateway: encoding webhook: %v", err)
+		return
+	}
+
+	request, err := http.NewRequest(http.MethodPost, p.webhookURL, bytes.NewReader(payload))
+	if err != nil {
+		log.Printf("payment gateway: building webhook: %v", err)
+		return
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set(domain.PaymentSignatureHeader, p.Sign(payload))
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		log.Printf("payment gateway: delivering webhook: %v", err)
+		return
+	}
+	response.Body.Close()
+	if response.StatusCode >= 300 {
+		log.Printf("payment gateway: webhook for %s answered %s", event.Reference, response.Status)
+	}
+}
+
+// nextReference must be called with the lock held.
+func (p *FakeProvider) nextReference() string {
+	p.issued++
+	if p.seed == "" {
+		return fmt.Sprintf("fake_%d", p.issued)
+	}
+	return fmt.Sprintf("fake_%s_%d", p.seed, p.issued)
+}
+
+// normalizeCard drops the spaces and dashes card numbers are often typed
+// with.
+func normalizeCard(card string) string {
+	return strings.NewReplacer(" ", "", "-", "").Replace(card)
+}
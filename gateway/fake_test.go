@@ -0,0 +1,140 @@
+package gateway
+
+import (
+	"ecom/domain"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func money(value string) domain.Money {
+	return domain.MustParseMoney(value, domain.DefaultCurrency)
+}
+
+func TestFakeProvider(t *testing.T) {
+	t.Run("should decline the configured cards", func(t *testing.T) {
+		p := NewFakeProvider("secret", "", []string{"4000000000000002"})
+
+		_, err := p.Authorize(domain.PaymentRequest{Amount: money("10"), Source: "4000-0000-0000-0002"})
+		if !errors.Is(err, domain.ErrPaymentDeclined) {
+			t.Errorf("expected ErrPaymentDeclined, got %v", err)
+		}
+
+		if _, err := p.Authorize(domain.PaymentRequest{Amount: money("10"), Source: "4242424242424242"}); err != nil {
+			t.Errorf("expected other cards to be accepted, got %v", err)
+		}
+	})
+
+	t.Run("should capture and refund up to the authorized amount", func(t *testing.T) {
+		p := NewFakeProvider("secret", "", nil)
+		reference, err := p.Authorize(domain.PaymentRequest{Amount: money("10"), Source: "4242424242424242"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := p.Capture(reference, money("10.01")); err == nil {
+			t.Error("expected capturing more than authorized to fail")
+		}
+		if err := p.Capture(reference, money("10")); err != nil {
+			t.Fatal(err)
+		}
+		if err := p.Void(reference); err == nil {
+			t.Error("expected voiding a captured payment to fail")
+		}
+
+		if err := p.Refund(reference, money("4")); err != nil {
+			t.Fatal(err)
+		}
+		if status := p.Status(reference); status != domain.PaymentStatusCaptured {
+			t.Errorf("expected a partial refund to keep the payment captured, got %s", status)
+		}
+		if err := p.Refund(reference, money("6.01")); !errors.Is(err, domain.ErrPaymentRefundExceedsAmount) {
+			t.Errorf("expected ErrPaymentRefundExceedsAmount, got %v", err)
+		}
+		if err := p.Refund(reference, money("6")); err != nil {
+			t.Fatal(err)
+		}
+		if status := p.Status(reference); status != domain.PaymentStatusRefunded {
+			t.Errorf("expected the payment to be refunded, got %s", status)
+		}
+	})
+
+	t.Run("should only verify webhooks signed with the secret", func(t *testing.T) {
+		p := NewFakeProvider("secret", "", nil)
+		payload := []byte(`{"type":"payment.captured","reference":"fake_1"}`)
+
+		event, err := p.VerifyWebhook(payload, p.Sign(payload))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if event.Type != domain.PaymentEventCaptured || event.Reference != "fake_1" {
+			t.Errorf("unexpected event %+v", event)
+		}
+
+		other := NewFakeProvider("other", "", nil)
+		if _, err := p.VerifyWebhook(payload, other.Sign(payload)); !errors.Is(err, domain.ErrInvalidWebhookSignature) {
+			t.Errorf("expected ErrInvalidWebhookSignature, got %v", err)
+		}
+	})
+
+	t.Run("should replay the references of a seed", func(t *testing.T) {
+		authorize := func(seed string) []string {
+			p := NewFakeProvider("secret", "", nil)
+			p.seed = seed
+			var references []string
+			for i := 0; i < 2; i++ {
+				reference, err := p.Authorize(domain.PaymentRequest{Amount: money("10"), Source: "4242424242424242"})
+				if err != nil {
+					t.Fatal(err)
+				}
+				references = append(references, reference)
+			}
+			return references
+		}
+
+		first, again := authorize("run"), authorize("run")
+		if first[0] != "fake_run_1" || first[1] != "fake_run_2" {
+			t.Errorf("unexpected references %v", first)
+		}
+		if again[0] != first[0] || again[1] != first[1] {
+			t.Errorf("expected the same references, got %v and %v", first, again)
+		}
+	})
+
+	t.Run("should post a signed event when a payment is captured", func(t *testing.T) {
+		received := make(chan *domain.PaymentEvent, 1)
+		var p *FakeProvider
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			payload, _ := io.ReadAll(r.Body)
+			event, err := p.VerifyWebhook(payload, r.Header.Get(domain.PaymentSignatureHeader))
+			if err != nil {
+				t.Error(err)
+			}
+			received <- event
+		}))
+		defer server.Close()
+
+		p = NewFakeProvider("secret", server.URL, nil)
+		reference, err := p.Authorize(domain.PaymentRequest{Amount: money("10"), Source: "4242424242424242"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := p.Capture(reference, money("10")); err != nil {
+			t.Fatal(err)
+		}
+
+		select {
+		case event := <-received:
+			if event == nil || event.Reference != reference || event.Amount != money("10") {
+				encoded, _ := json.Marshal(event)
+				t.Errorf("unexpected event %s", encoded)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("expected the webhook to be delivered")
+		}
+	})
+}
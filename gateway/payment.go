@@ -0,0 +1,62 @@
+package gateway
+
+import (
+	"ecom/config"
+	"ecom/domain"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// developmentWebhookSecret signs the webhooks of the fake provider when
+// PAYMENT_WEBHOOK_SECRET is left out in development.
+const developmentWebhookSecret = "secret"
+
+// New builds the payment provider selected by the PAYMENT_PROVIDER setting.
+// Development falls back to the fake provider; anywhere else the provider
+// and a webhook secret of its own must be set, as whoever knows the secret
+// can sign the events that mark orders paid.
+func New(cfg config.Config) (domain.PaymentProvider, error) {
+	provider, secret := cfg.PaymentProvider, cfg.PaymentWebhookSecret
+	if cfg.AppEnv == config.EnvDevelopment {
+		if provider == "" {
+			provider = "fake"
+		}
+		if secret == "" {
+			secret = developmentWebhookSecret
+		}
+	} else {
+		if provider == "" {
+			return nil, errors.New("PAYMENT_PROVIDER must be set outside development")
+		}
+		if secret == "" || secret == developmentWebhookSecret {
+			return nil, errors.New("PAYMENT_WEBHOOK_SECRET must be set to a secret of its own outside development")
+		}
+	}
+
+	switch provider {
+	case "fake":
+		seed := cfg.PaymentFakeSeed
+		if seed == "" {
+			seed = strconv.FormatInt(time.Now().Unix(), 10)
+			log.Printf("payment gateway: fake references are seeded with %s, set PAYMENT_FAKE_SEED to replay them", seed)
+		}
+		fake := NewFakeProvider(secret, cfg.PaymentWebhookURL, splitList(cfg.PaymentDeclineCards))
+		fake.seed = seed
+		return fake, nil
+	}
+	return nil, fmt.Errorf("unknown payment provider %q", provider)
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,39 @@
+package gateway
+
+import (
+	"ecom/config"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	t.Run("should fall back to the fake provider in development", func(t *testing.T) {
+		provider, err := New(config.Config{AppEnv: config.EnvDevelopment})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if provider.Name() != "fake" {
+			t.Errorf("expected the fake provider, got %s", provider.Name())
+		}
+	})
+
+	invalid := map[string]config.Config{
+		"no provider":    {AppEnv: "production", PaymentWebhookSecret: "s3cr3t-of-its-own"},
+		"no secret":      {AppEnv: "production", PaymentProvider: "fake"},
+		"default secret": {AppEnv: "production", PaymentProvider: "fake", PaymentWebhookSecret: developmentWebhookSecret},
+		"unknown":        {AppEnv: "production", PaymentProvider: "cash", PaymentWebhookSecret: "s3cr3t-of-its-own"},
+	}
+	for name, cfg := range invalid {
+		t.Run("should refuse to start with "+name+" provider settings outside development", func(t *testing.T) {
+			if _, err := New(cfg); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+
+	t.Run("should take the provider set outside development", func(t *testing.T) {
+		cfg := config.Config{AppEnv: "production", PaymentProvider: "fake", PaymentWebhookSecret: "s3cr3t-of-its-own", PaymentFakeSeed: "1"}
+		if _, err := New(cfg); err != nil {
+			t.Error(err)
+		}
+	})
+}
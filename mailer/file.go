@@ -0,0 +1,29 @@
+package mailer
+
+import (
+	"ecom/domain"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// FileMailer writes every mail to its own .eml file, which is handy for
+// local development without an SMTP server.
+type FileMailer struct {
+	dir  string
+	from string
+}
+
+func NewFileMailer(dir, from string) *FileMailer {
+	return &FileMailer{dir: dir, from: from}
+}
+
+func (m *FileMailer) Send(mail domain.Mail) error {
+	if err := os.MkdirAll(m.dir, 0o755); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s.eml", time.Now().Format("20060102T150405.000000000"))
+	return os.WriteFile(filepath.Join(m.dir, name), format(m.from, mail), 0o644)
+}
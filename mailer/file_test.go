@@ -0,0 +1,37 @@
+package mailer
+
+import (
+	"ecom/domain"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileMailer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "mail")
+	m := NewFileMailer(dir, "shop@example.com")
+
+	err := m.Send(domain.Mail{To: "john.doe@gmail.com", Subject: "Hello", Body: "line one\nline two"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Fatalf("expected 1 mail file, got %d", len(files))
+	}
+
+	content, err := os.ReadFile(filepath.Join(dir, files[0].Name()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"From: shop@example.com\r\n", "To: john.doe@gmail.com\r\n", "Subject: Hello\r\n", "line one\r\nline two"} {
+		if !strings.Contains(string(content), expected) {
+			t.Errorf("expected mail to contain %q, got %q", expected, content)
+		}
+	}
+}
@@ -0,0 +1,20 @@
+package mailer
+
+import (
+	"ecom/config"
+	"ecom/domain"
+	"fmt"
+)
+
+// New builds the mailer selected by the MAIL_DRIVER setting.
+func New(cfg config.Config) (domain.Mailer, error) {
+	switch cfg.MailDriver {
+	case "smtp":
+		return NewSMTPMailer(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUser, cfg.SMTPPassword, cfg.MailFrom), nil
+	case "file":
+		return NewFileMailer(cfg.MailDir, cfg.MailFrom), nil
+	case "memory":
+		return NewMemoryMailer(), nil
+	}
+	return nil, fmt.Errorf("unknown mail driver %q", cfg.MailDriver)
+}
@@ -0,0 +1,31 @@
+package mailer
+
+import (
+	"ecom/domain"
+	"sync"
+)
+
+// MemoryMailer keeps sent mails in memory so tests can inspect them.
+type MemoryMailer struct {
+	mu    sync.Mutex
+	mails []domain.Mail
+}
+
+func NewMemoryMailer() *MemoryMailer {
+	return &MemoryMailer{}
+}
+
+func (m *MemoryMailer) Send(mail domain.Mail) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.mails = append(m.mails, mail)
+	return nil
+}
+
+func (m *MemoryMailer) Sent() []domain.Mail {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]domain.Mail(nil), m.mails...)
+}
@@ -0,0 +1,145 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"ecom/config"
+	"ecom/domain"
+	"ecom/utils"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+)
+
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// responseRecorder holds back the status and body written by the next
+// handler until the response is stored, so a response that can't be stored
+// is never sent. Headers go straight to the client's header map.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.body.Write(b)
+}
+
+// flush sends the held back response to the client.
+func (r *responseRecorder) flush() {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	r.ResponseWriter.WriteHeader(r.status)
+	r.ResponseWriter.Write(r.body.Bytes())
+}
+
+// Idempotency replays the stored response for requests that repeat an
+// Idempotency-Key already seen for the same user. It must run after
+// JWTMiddleware and only applies to mutating methods of signed-in users;
+// anonymous requests are passed through.
+func Idempotency(store domain.IdempotencyRepository) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get(IdempotencyKeyHeader)
+			if key == "" || r.Method == http.MethodGet || r.Method == http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if len(key) > 255 {
+				utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("idempotency key is too long"))
+				return
+			}
+
+			userID, err := GetUserIDFromContext(r.Context())
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// fingerprint the request so a key can't be reused for a different payload
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				utils.WriteError(w, http.StatusBadRequest, err)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			hash := sha256.Sum256(append([]byte(r.Method+" "+r.URL.Path+"\n"), body...))
+			requestHash := hex.EncodeToString(hash[:])
+
+			existing, reserved, err := store.ReserveIdempotencyKey(domain.IdempotencyRecord{
+				UserID:      userID,
+				Key:         key,
+				RequestHash: requestHash,
+				ExpiresAt:   time.Now().Add(config.ENV.IdempotencyKeyTTL),
+			})
+			if err != nil {
+				utils.WriteError(w, http.StatusInternalServerError, err)
+				return
+			}
+
+			if !reserved {
+				switch {
+				case existing.RequestHash != requestHash:
+					utils.WriteError(w, http.StatusUnprocessableEntity, fmt.Errorf("idempotency key was used for a different request"))
+				case !existing.Completed:
+					utils.WriteError(w, http.StatusConflict, fmt.Errorf("a request with this idempotency key is already in progress"))
+				default:
+					w.Header().Set("Content-Type", "application/json")
+					w.Header().Set("Idempotent-Replayed", "true")
+					w.WriteHeader(existing.StatusCode)
+					w.Write(existing.Body)
+				}
+				return
+			}
+
+			release := func() {
+				if err := store.ReleaseIdempotencyKey(userID, key); err != nil {
+					log.Println("idempotency key release:", err)
+				}
+			}
+
+			// a handler that panics must not leave the key in progress
+			defer func() {
+				if p := recover(); p != nil {
+					release()
+					panic(p)
+				}
+			}()
+
+			recorder := &responseRecorder{ResponseWriter: w}
+			next.ServeHTTP(recorder, r)
+
+			// server errors are not stored so the client can safely retry
+			if recorder.status >= http.StatusInternalServerError || recorder.status == 0 {
+				release()
+				recorder.flush()
+				return
+			}
+
+			// a response that can't be stored is answered with a 500 like
+			// any other server error, so the key is released for a retry
+			if err := store.CompleteIdempotencyKey(userID, key, recorder.status, recorder.body.Bytes()); err != nil {
+				log.Println("idempotency key completion:", err)
+				release()
+				utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("failed to store the response"))
+				return
+			}
+			recorder.flush()
+		})
+	}
+}
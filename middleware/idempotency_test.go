@@ -0,0 +1,254 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"ecom/domain"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+type mockIdempotencyStore struct {
+	mu      sync.Mutex
+	records map[string]*domain.IdempotencyRecord
+
+	completeErr error
+	releaseErr  error
+}
+
+func newMockIdempotencyStore() *mockIdempotencyStore {
+	return &mockIdempotencyStore{records: make(map[string]*domain.IdempotencyRecord)}
+}
+
+func (m *mockIdempotencyStore) ReserveIdempotencyKey(record domain.IdempotencyRecord) (*domain.IdempotencyRecord, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := record.UserID + "/" + record.Key
+	if existing, ok := m.records[id]; ok {
+		copied := *existing
+		return &copied, false, nil
+	}
+	m.records[id] = &record
+	return nil, true, nil
+}
+
+func (m *mockIdempotencyStore) CompleteIdempotencyKey(userID, key string, statusCode int, body []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.completeErr != nil {
+		return m.completeErr
+	}
+	record := m.records[userID+"/"+key]
+	record.StatusCode = statusCode
+	record.Body = body
+	record.Completed = true
+	return nil
+}
+
+func (m *mockIdempotencyStore) ReleaseIdempotencyKey(userID, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.releaseErr != nil {
+		return m.releaseErr
+	}
+	delete(m.records, userID+"/"+key)
+	return nil
+}
+
+func newIdempotentRequest(userID, key, body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPost, "/checkout", bytes.NewBufferString(body))
+	req.Header.Set(IdempotencyKeyHeader, key)
+	return req.WithContext(context.WithValue(req.Context(), userIDKey, userID))
+}
+
+func TestIdempotency(t *testing.T) {
+	t.Run("should replay the stored response for a repeated key", func(t *testing.T) {
+		calls := 0
+		handler := Idempotency(newMockIdempotencyStore())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"orderID":1}`))
+		}))
+
+		for i := 0; i < 2; i++ {
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, newIdempotentRequest("user-1", "key-1", `{"items":[]}`))
+
+			if rr.Code != http.StatusCreated {
+				t.Errorf("expected status code %d, got %d", http.StatusCreated, rr.Code)
+			}
+			if rr.Body.String() != `{"orderID":1}` {
+				t.Errorf("unexpected body %q", rr.Body.String())
+			}
+		}
+
+		if calls != 1 {
+			t.Errorf("expected handler to run once, ran %d times", calls)
+		}
+	})
+
+	t.Run("should pass anonymous requests through", func(t *testing.T) {
+		store := newMockIdempotencyStore()
+		calls := 0
+		handler := Idempotency(store)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(http.StatusOK)
+		}))
+
+		for i := 0; i < 2; i++ {
+			req := httptest.NewRequest(http.MethodPost, "/items", bytes.NewBufferString(`{}`))
+			req.Header.Set(IdempotencyKeyHeader, "key-1")
+			rr := httptest.NewRecorder()
+			handler.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Errorf("expected status code %d, got %d", http.StatusOK, rr.Code)
+			}
+		}
+
+		if calls != 2 || len(store.records) != 0 {
+			t.Errorf("expected both requests to reach the handler unrecorded, got %d calls", calls)
+		}
+	})
+
+	t.Run("should scope keys to the user", func(t *testing.T) {
+		calls := 0
+		handler := Idempotency(newMockIdempotencyStore())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(http.StatusCreated)
+		}))
+
+		handler.ServeHTTP(httptest.NewRecorder(), newIdempotentRequest("user-1", "key-1", "{}"))
+		handler.ServeHTTP(httptest.NewRecorder(), newIdempotentRequest("user-2", "key-1", "{}"))
+
+		if calls != 2 {
+			t.Errorf("expected handler to run twice, ran %d times", calls)
+		}
+	})
+
+	t.Run("should return 409 while the first request is in flight", func(t *testing.T) {
+		started := make(chan struct{})
+		release := make(chan struct{})
+		handler := Idempotency(newMockIdempotencyStore())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-release
+			w.WriteHeader(http.StatusCreated)
+		}))
+
+		done := make(chan struct{})
+		go func() {
+			handler.ServeHTTP(httptest.NewRecorder(), newIdempotentRequest("user-1", "key-1", "{}"))
+			close(done)
+		}()
+		<-started
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, newIdempotentRequest("user-1", "key-1", "{}"))
+		close(release)
+		<-done
+
+		if rr.Code != http.StatusConflict {
+			t.Errorf("expected status code %d, got %d", http.StatusConflict, rr.Code)
+		}
+	})
+
+	t.Run("should return 422 when the key is reused with a different payload", func(t *testing.T) {
+		handler := Idempotency(newMockIdempotencyStore())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusCreated)
+		}))
+
+		handler.ServeHTTP(httptest.NewRecorder(), newIdempotentRequest("user-1", "key-1", `{"a":1}`))
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, newIdempotentRequest("user-1", "key-1", `{"a":2}`))
+
+		if rr.Code != http.StatusUnprocessableEntity {
+			t.Errorf("expected status code %d, got %d", http.StatusUnprocessableEntity, rr.Code)
+		}
+	})
+
+	t.Run("should allow a retry after a server error", func(t *testing.T) {
+		calls := 0
+		handler := Idempotency(newMockIdempotencyStore())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if calls == 1 {
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+			w.WriteHeader(http.StatusCreated)
+		}))
+
+		handler.ServeHTTP(httptest.NewRecorder(), newIdempotentRequest("user-1", "key-1", "{}"))
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, newIdempotentRequest("user-1", "key-1", "{}"))
+
+		if rr.Code != http.StatusCreated {
+			t.Errorf("expected status code %d, got %d", http.StatusCreated, rr.Code)
+		}
+	})
+	t.Run("should return 500 and allow a retry when the response can't be stored", func(t *testing.T) {
+		store := newMockIdempotencyStore()
+		store.completeErr = errors.New("database is down")
+		calls := 0
+		handler := Idempotency(store)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			w.WriteHeader(http.StatusCreated)
+			w.Write([]byte(`{"orderID":1}`))
+		}))
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, newIdempotentRequest("user-1", "key-1", "{}"))
+		if rr.Code != http.StatusInternalServerError {
+			t.Errorf("expected status code %d, got %d", http.StatusInternalServerError, rr.Code)
+		}
+
+		store.completeErr = nil
+		rr = httptest.NewRecorder()
+		handler.ServeHTTP(rr, newIdempotentRequest("user-1", "key-1", "{}"))
+		if rr.Code != http.StatusCreated || calls != 2 {
+			t.Errorf("expected the retry to run with %d, got %d after %d calls", http.StatusCreated, rr.Code, calls)
+		}
+	})
+
+	t.Run("should release the key when the handler panics", func(t *testing.T) {
+		store := newMockIdempotencyStore()
+		handler := Idempotency(store)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("boom")
+		}))
+
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Error("expected the panic to be passed on")
+				}
+			}()
+			handler.ServeHTTP(httptest.NewRecorder(), newIdempotentRequest("user-1", "key-1", "{}"))
+		}()
+
+		if len(store.records) != 0 {
+			t.Errorf("expected the key to be released, got %+v", store.records)
+		}
+	})
+
+	t.Run("should still send the server error when the key can't be released", func(t *testing.T) {
+		store := newMockIdempotencyStore()
+		store.releaseErr = errors.New("database is down")
+		handler := Idempotency(store)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}))
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, newIdempotentRequest("user-1", "key-1", "{}"))
+
+		if rr.Code != http.StatusServiceUnavailable {
+			t.Errorf("expected status code %d, got %d", http.StatusServiceUnavailable, rr.Code)
+		}
+	})
+}
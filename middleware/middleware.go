@@ -3,10 +3,12 @@ package middleware
 import (
 	"context"
 	"ecom/config"
+	"ecom/domain"
 	"ecom/utils"
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
@@ -16,8 +18,24 @@ type contextKey string
 const (
 	userIDKey  contextKey = "userID"
 	addressKey contextKey = "address"
+	roleKey    contextKey = "role"
+	tokenKey   contextKey = "token"
 )
 
+// TokenInfo identifies the access token a request was authenticated with.
+type TokenInfo struct {
+	ID        string
+	ExpiresAt time.Time
+}
+
+var denylist domain.TokenDenylist
+
+// SetTokenDenylist makes JWTMiddleware reject access tokens revoked through
+// the given denylist.
+func SetTokenDenylist(d domain.TokenDenylist) {
+	denylist = d
+}
+
 func JWTMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		authHeader := r.Header.Get("Authorization")
@@ -63,12 +81,54 @@ func JWTMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		// tokens without an ID can't be revoked and were issued before
+		// logout existed; they simply live until they expire
+		tokenInfo := TokenInfo{}
+		if jti, ok := claims["jti"].(string); ok {
+			tokenInfo.ID = jti
+			if denylist != nil {
+				revoked, err := denylist.IsAccessTokenRevoked(jti)
+				if err != nil {
+					utils.WriteError(w, http.StatusInternalServerError, err)
+					return
+				}
+				if revoked {
+					utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("token has been revoked"))
+					return
+				}
+			}
+		}
+		if exp, err := claims.GetExpirationTime(); err == nil && exp != nil {
+			tokenInfo.ExpiresAt = exp.Time
+		}
+
+		// tokens issued before roles existed carry no role claim
+		role, ok := claims["role"].(string)
+		if !ok {
+			role = domain.RoleCustomer
+		}
+
 		ctx := context.WithValue(r.Context(), userIDKey, userID)
 		ctx = context.WithValue(ctx, addressKey, address)
+		ctx = context.WithValue(ctx, roleKey, role)
+		ctx = context.WithValue(ctx, tokenKey, tokenInfo)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// OptionalJWTMiddleware authenticates the request like JWTMiddleware when it
+// carries an Authorization header and lets anonymous requests through.
+func OptionalJWTMiddleware(next http.Handler) http.Handler {
+	authenticated := JWTMiddleware(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		authenticated.ServeHTTP(w, r)
+	})
+}
+
 func GetUserIDFromContext(ctx context.Context) (string, error) {
 	userID, ok := ctx.Value(userIDKey).(string)
 	if !ok {
@@ -84,3 +144,47 @@ func GetAddressFromContext(ctx context.Context) (string, error) {
 	}
 	return address, nil
 }
+
+func GetRoleFromContext(ctx context.Context) (string, error) {
+	role, ok := ctx.Value(roleKey).(string)
+	if !ok {
+		return "", fmt.Errorf("role not found in context")
+	}
+	return role, nil
+}
+
+func GetTokenFromContext(ctx context.Context) (TokenInfo, error) {
+	token, ok := ctx.Value(tokenKey).(TokenInfo)
+	if !ok {
+		return TokenInfo{}, fmt.Errorf("token not found in context")
+	}
+	return token, nil
+}
+
+// RequireRole only lets requests through when the authenticated user has one
+// of the given roles. It must run after JWTMiddleware.
+func RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			role, err := GetRoleFromContext(r.Context())
+			if err != nil {
+				utils.WriteError(w, http.StatusUnauthorized, err)
+				return
+			}
+
+			for _, allowed := range roles {
+				if role == allowed {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			utils.WriteError(w, http.StatusForbidden, fmt.Errorf("permission denied"))
+		})
+	}
+}
+
+// Authorize wraps a single route with JWTMiddleware and RequireRole.
+func Authorize(handler http.HandlerFunc, roles ...string) http.Handler {
+	return JWTMiddleware(RequireRole(roles...)(handler))
+}
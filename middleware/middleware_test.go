@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"context"
+	"ecom/domain"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireRole(t *testing.T) {
+	handler := RequireRole(domain.RoleStaff, domain.RoleAdmin)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	cases := []struct {
+		role   string
+		status int
+	}{
+		{"", http.StatusUnauthorized},
+		{domain.RoleCustomer, http.StatusForbidden},
+		{domain.RoleStaff, http.StatusNoContent},
+		{domain.RoleAdmin, http.StatusNoContent},
+	}
+
+	for _, c := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if c.role != "" {
+			req = req.WithContext(context.WithValue(req.Context(), roleKey, c.role))
+		}
+
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		if rr.Code != c.status {
+			t.Errorf("role %q: expected status code %d, got %d", c.role, c.status, rr.Code)
+		}
+	}
+}
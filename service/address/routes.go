@@ -0,0 +1,203 @@
+package address
+
+import (
+	"ecom/domain"
+	"ecom/middleware"
+	"ecom/utils"
+	"errors"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type Handler struct {
+	store domain.AddressRepository
+}
+
+func NewHandler(store domain.AddressRepository) *Handler {
+	return &Handler{store: store}
+}
+
+func (h *Handler) AddressRoutes(router *mux.Router) {
+	router.HandleFunc("", h.handleGetAddresses).Methods(http.MethodGet)
+	router.HandleFunc("", h.handleCreateAddress).Methods(http.MethodPost)
+	router.HandleFunc("/{id}", h.handleGetAddress).Methods(http.MethodGet)
+	router.HandleFunc("/{id}", h.handleUpdateAddress).Methods(http.MethodPut)
+	router.HandleFunc("/{id}", h.handleDeleteAddress).Methods(http.MethodDelete)
+}
+
+func (h *Handler) handleGetAddresses(w http.ResponseWriter, r *http.Request) {
+	// get the user ID from the context
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	addresses, err := h.store.GetAddresses(userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, addresses)
+}
+
+func (h *Handler) handleGetAddress(w http.ResponseWriter, r *http.Request) {
+	// get the address ID from the URL
+	addressID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid address ID"))
+		return
+	}
+
+	// get the user ID from the context
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	address, err := h.store.GetAddressByID(userID, addressID)
+	if errors.Is(err, domain.ErrAddressNotFound) {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, address)
+}
+
+func (h *Handler) handleCreateAddress(w http.ResponseWriter, r *http.Request) {
+	// get JSON payload
+	var payload domain.AddressPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// validate the payload
+	err := utils.Validate.Struct(payload)
+	if err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", validationErrors))
+		return
+	}
+
+	// get the user ID from the context
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	id, err := h.store.CreateAddress(newAddress(userID, payload))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	address, err := h.store.GetAddressByID(userID, id)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, address)
+}
+
+func (h *Handler) handleUpdateAddress(w http.ResponseWriter, r *http.Request) {
+	// get the address ID from the URL
+	addressID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid address ID"))
+		return
+	}
+
+	// get JSON payload
+	var payload domain.AddressPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// validate the payload
+	err = utils.Validate.Struct(payload)
+	if err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", validationErrors))
+		return
+	}
+
+	// get the user ID from the context
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	address := newAddress(userID, payload)
+	address.ID = addressID
+	err = h.store.UpdateAddress(address)
+	if errors.Is(err, domain.ErrAddressNotFound) {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	updated, err := h.store.GetAddressByID(userID, addressID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, updated)
+}
+
+func (h *Handler) handleDeleteAddress(w http.ResponseWriter, r *http.Request) {
+	// get the address ID from the URL
+	addressID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid address ID"))
+		return
+	}
+
+	// get the user ID from the context
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	err = h.store.DeleteAddress(userID, addressID)
+	if errors.Is(err, domain.ErrAddressNotFound) {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func newAddress(userID string, payload domain.AddressPayload) domain.Address {
+	return domain.Address{
+		UserID:     userID,
+		Line1:      payload.Line1,
+		Line2:      payload.Line2,
+		City:       payload.City,
+		Region:     payload.Region,
+		PostalCode: payload.PostalCode,
+		Country:    strings.ToUpper(payload.Country),
+		Phone:      payload.Phone,
+		IsDefault:  payload.IsDefault,
+	}
+}
@@ -0,0 +1,263 @@
+package address
+
+import (
+	"bytes"
+	"ecom/config"
+	"ecom/domain"
+	"ecom/middleware"
+	"ecom/service/auth"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+type mockAddressStore struct {
+	addresses []domain.Address
+}
+
+func (m *mockAddressStore) GetAddresses(userID string) (*[]domain.Address, error) {
+	addresses := make([]domain.Address, 0)
+	for _, address := range m.addresses {
+		if address.UserID == userID {
+			addresses = append(addresses, address)
+		}
+	}
+	return &addresses, nil
+}
+
+func (m *mockAddressStore) GetAddressByID(userID string, id int) (*domain.Address, error) {
+	for _, address := range m.addresses {
+		if address.ID == id && address.UserID == userID {
+			return &address, nil
+		}
+	}
+	return nil, domain.ErrAddressNotFound
+}
+
+func (m *mockAddressStore) GetDefaultAddress(userID string) (*domain.Address, error) {
+	for _, address := range m.addresses {
+		if address.IsDefault && address.UserID == userID {
+			return &address, nil
+		}
+	}
+	return nil, domain.ErrAddressNotFound
+}
+
+func (m *mockAddressStore) clearDefault(userID string) {
+	for i := range m.addresses {
+		if m.addresses[i].UserID == userID {
+			m.addresses[i].IsDefault = false
+		}
+	}
+}
+
+func (m *mockAddressStore) CreateAddress(address domain.Address) (int, error) {
+	if existing, _ := m.GetAddresses(address.UserID); len(*existing) == 0 {
+		address.IsDefault = true
+	}
+	if address.IsDefault {
+		m.clearDefault(address.UserID)
+	}
+	address.ID = len(m.addresses) + 1
+	m.addresses = append(m.addresses, address)
+	return address.ID, nil
+}
+
+func (m *mockAddressStore) UpdateAddress(address domain.Address) error {
+	for i, existing := range m.addresses {
+		if existing.ID == address.ID && existing.UserID == address.UserID {
+			if address.IsDefault {
+				m.clearDefault(address.UserID)
+			}
+			address.IsDefault = address.IsDefault || existing.IsDefault
+			m.addresses[i] = address
+			return nil
+		}
+	}
+	return domain.ErrAddressNotFound
+}
+
+func (m *mockAddressStore) DeleteAddress(userID string, id int) error {
+	for i, existing := range m.addresses {
+		if existing.ID == id && existing.UserID == userID {
+			m.addresses = append(m.addresses[:i], m.addresses[i+1:]...)
+			return nil
+		}
+	}
+	return domain.ErrAddressNotFound
+}
+
+func newAddressRequest(t *testing.T, method, url, body, userID string) *http.Request {
+	req, err := http.NewRequest(method, url, bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if userID != "" {
+		token, err := auth.NewStore().CreateToken([]byte(config.ENV.JWTSecret), domain.User{ID: userID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	return req
+}
+
+func serveAddressRequest(store *mockAddressStore, req *http.Request) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	router := mux.NewRouter()
+	subrouter := router.PathPrefix("/me/addresses").Subrouter()
+	subrouter.Use(middleware.JWTMiddleware)
+	NewHandler(store).AddressRoutes(subrouter)
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+const addressBody = `{"line1":"1 Main St","city":"Hanoi","postalCode":"100000","country":"vn","phone":"+84 123"}`
+
+func TestHandleCreateAddress(t *testing.T) {
+	t.Run("should return 401 without a token", func(t *testing.T) {
+		rr := serveAddressRequest(&mockAddressStore{}, newAddressRequest(t, http.MethodPost, "/me/addresses", addressBody, ""))
+
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected status code %d, got %d", http.StatusUnauthorized, rr.Code)
+		}
+	})
+
+	t.Run("should return 400 if the payload is invalid", func(t *testing.T) {
+		bodies := []string{
+			`{"city":"Hanoi","postalCode":"100000","country":"VN"}`,
+			`{"line1":"1 Main St","city":"Hanoi","postalCode":"100000","country":"VNM"}`,
+		}
+		for _, body := range bodies {
+			rr := serveAddressRequest(&mockAddressStore{}, newAddressRequest(t, http.MethodPost, "/me/addresses", body, "user-1"))
+
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("%s: expected status code %d, got %d", body, http.StatusBadRequest, rr.Code)
+			}
+		}
+	})
+
+	t.Run("should make the first address the default", func(t *testing.T) {
+		store := &mockAddressStore{}
+		rr := serveAddressRequest(store, newAddressRequest(t, http.MethodPost, "/me/addresses", addressBody, "user-1"))
+
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status code %d, got %d", http.StatusCreated, rr.Code)
+		}
+
+		var address domain.Address
+		if err := json.NewDecoder(rr.Body).Decode(&address); err != nil {
+			t.Fatal(err)
+		}
+		if !address.IsDefault {
+			t.Errorf("expected the first address to be the default")
+		}
+		if address.UserID != "user-1" || address.Country != "VN" {
+			t.Errorf("unexpected address: %+v", address)
+		}
+	})
+
+	t.Run("should move the default to a new default address", func(t *testing.T) {
+		store := &mockAddressStore{addresses: []domain.Address{{ID: 1, UserID: "user-1", IsDefault: true}}}
+		body := `{"line1":"2 Side St","city":"Hanoi","postalCode":"100000","country":"VN","isDefault":true}`
+		rr := serveAddressRequest(store, newAddressRequest(t, http.MethodPost, "/me/addresses", body, "user-1"))
+
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status code %d, got %d", http.StatusCreated, rr.Code)
+		}
+
+		defaultAddress, err := store.GetDefaultAddress("user-1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if defaultAddress.ID != 2 {
+			t.Errorf("expected address 2 to be the default, got %d", defaultAddress.ID)
+		}
+	})
+}
+
+func TestAddressOwnership(t *testing.T) {
+	store := &mockAddressStore{addresses: []domain.Address{{ID: 1, UserID: "user-2", Line1: "1 Main St", IsDefault: true}}}
+
+	requests := []struct {
+		method string
+		body   string
+	}{
+		{http.MethodGet, ""},
+		{http.MethodPut, addressBody},
+		{http.MethodDelete, ""},
+	}
+
+	for _, request := range requests {
+		t.Run(request.method+" should return 404 for another user's address", func(t *testing.T) {
+			rr := serveAddressRequest(store, newAddressRequest(t, request.method, "/me/addresses/1", request.body, "user-1"))
+
+			if rr.Code != http.StatusNotFound {
+				t.Errorf("expected status code %d, got %d", http.StatusNotFound, rr.Code)
+			}
+		})
+	}
+
+	t.Run("should only list the user's own addresses", func(t *testing.T) {
+		rr := serveAddressRequest(store, newAddressRequest(t, http.MethodGet, "/me/addresses", "", "user-1"))
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		var addresses []domain.Address
+		if err := json.NewDecoder(rr.Body).Decode(&addresses); err != nil {
+			t.Fatal(err)
+		}
+		if len(addresses) != 0 {
+			t.Errorf("expected no addresses, got %d", len(addresses))
+		}
+	})
+}
+
+func TestHandleUpdateAddress(t *testing.T) {
+	store := &mockAddressStore{addresses: []domain.Address{{ID: 1, UserID: "user-1", Line1: "Old", IsDefault: true}}}
+
+	rr := serveAddressRequest(store, newAddressRequest(t, http.MethodPut, "/me/addresses/1", addressBody, "user-1"))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	var address domain.Address
+	if err := json.NewDecoder(rr.Body).Decode(&address); err != nil {
+		t.Fatal(err)
+	}
+	if address.Line1 != "1 Main St" {
+		t.Errorf("expected the address to be updated, got %+v", address)
+	}
+	if !address.IsDefault {
+		t.Errorf("expected the address to stay the default")
+	}
+}
+
+func TestHandleDeleteAddress(t *testing.T) {
+	store := &mockAddressStore{addresses: []domain.Address{{ID: 1, UserID: "user-1"}}}
+
+	rr := serveAddressRequest(store, newAddressRequest(t, http.MethodDelete, "/me/addresses/1", "", "user-1"))
+
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("expected status code %d, got %d", http.StatusNoContent, rr.Code)
+	}
+	if len(store.addresses) != 0 {
+		t.Errorf("expected the address to be deleted")
+	}
+}
+
+func TestAddressString(t *testing.T) {
+	address := domain.Address{Line1: "1 Main St", City: "Hanoi", PostalCode: "100000", Country: "VN", Phone: "+84 123"}
+
+	if got := address.String(); got != "1 Main St, Hanoi, 100000, VN (+84 123)" {
+		t.Errorf("unexpected formatted address: %q", got)
+	}
+}
@@ -0,0 +1,200 @@
+package address
+
+import (
+	"database/sql"
+	"ecom/domain"
+	"errors"
+)
+
+const addressColumns = "id, userId, line1, line2, city, region, postalCode, country, phone, isDefault, createdAt"
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanAddress(row scanner) (*domain.Address, error) {
+	address := new(domain.Address)
+	err := row.Scan(
+		&address.ID,
+		&address.UserID,
+		&address.Line1,
+		&address.Line2,
+		&address.City,
+		&address.Region,
+		&address.PostalCode,
+		&address.Country,
+		&address.Phone,
+		&address.IsDefault,
+		&address.CreatedAt,
+	)
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrAddressNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return address, nil
+}
+
+func (s *Store) inTx(fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *Store) GetAddresses(userID string) (*[]domain.Address, error) {
+	rows, err := s.db.Query("SELECT "+addressColumns+" FROM addresses WHERE userId = ? ORDER BY isDefault DESC, createdAt, id", userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	addresses := make([]domain.Address, 0)
+	for rows.Next() {
+		address, err := scanAddress(rows)
+		if err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, *address)
+	}
+
+	return &addresses, rows.Err()
+}
+
+func (s *Store) GetAddressByID(userID string, id int) (*domain.Address, error) {
+	return scanAddress(s.db.QueryRow("SELECT "+addressColumns+" FROM addresses WHERE id = ? AND userId = ?", id, userID))
+}
+
+func (s *Store) GetDefaultAddress(userID string) (*domain.Address, error) {
+	return scanAddress(s.db.QueryRow("SELECT "+addressColumns+" FROM addresses WHERE userId = ? AND isDefault = TRUE", userID))
+}
+
+// CreateAddress inserts the address, making it the default when asked to or
+// when it is the user's first one.
+func (s *Store) CreateAddress(address domain.Address) (int, error) {
+	var id int
+	err := s.inTx(func(tx *sql.Tx) error {
+		// lock the user row so two inserts can't both become the first
+		var userID string
+		if err := tx.QueryRow("SELECT id FROM users WHERE id = ? FOR UPDATE", address.UserID).Scan(&userID); err != nil {
+			return err
+		}
+
+		var count int
+		if err := tx.QueryRow("SELECT COUNT(*) FROM addresses WHERE userId = ?", address.UserID).Scan(&count); err != nil {
+			return err
+		}
+		if count == 0 {
+			address.IsDefault = true
+		}
+
+		if address.IsDefault {
+			if _, err := tx.Exec("UPDATE addresses SET isDefault = FALSE WHERE userId = ?", address.UserID); err != nil {
+				return err
+			}
+		}
+
+		result, err := tx.Exec(
+			"INSERT INTO addresses (userId, line1, line2, city, region, postalCode, country, phone, isDefault) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+			address.UserID,
+			address.Line1,
+			address.Line2,
+			address.City,
+			address.Region,
+			address.PostalCode,
+			address.Country,
+			address.Phone,
+			address.IsDefault,
+		)
+		if err != nil {
+			return err
+		}
+
+		insertID, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		id = int(insertID)
+
+		return nil
+	})
+
+	return id, err
+}
+
+// UpdateAddress replaces the address fields. Clearing the default flag on
+// the current default is ignored so a user with addresses always has one.
+func (s *Store) UpdateAddress(address domain.Address) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		var isDefault bool
+		err := tx.QueryRow("SELECT isDefault FROM addresses WHERE id = ? AND userId = ? FOR UPDATE", address.ID, address.UserID).Scan(&isDefault)
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.ErrAddressNotFound
+		} else if err != nil {
+			return err
+		}
+
+		if address.IsDefault && !isDefault {
+			if _, err := tx.Exec("UPDATE addresses SET isDefault = FALSE WHERE userId = ?", address.UserID); err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.Exec(
+			"UPDATE addresses SET line1 = ?, line2 = ?, city = ?, region = ?, postalCode = ?, country = ?, phone = ?, isDefault = ? WHERE id = ? AND userId = ?",
+			address.Line1,
+			address.Line2,
+			address.City,
+			address.Region,
+			address.PostalCode,
+			address.Country,
+			address.Phone,
+			address.IsDefault || isDefault,
+			address.ID,
+			address.UserID,
+		)
+		return err
+	})
+}
+
+// DeleteAddress removes the address and promotes the oldest remaining one
+// when the default was deleted. Orders keep their own copy of the address.
+func (s *Store) DeleteAddress(userID string, id int) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		var isDefault bool
+		err := tx.QueryRow("SELECT isDefault FROM addresses WHERE id = ? AND userId = ? FOR UPDATE", id, userID).Scan(&isDefault)
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.ErrAddressNotFound
+		} else if err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec("DELETE FROM addresses WHERE id = ? AND userId = ?", id, userID); err != nil {
+			return err
+		}
+
+		if isDefault {
+			_, err := tx.Exec("UPDATE addresses SET isDefault = TRUE WHERE userId = ? ORDER BY createdAt, id LIMIT 1", userID)
+			return err
+		}
+
+		return nil
+	})
+}
@@ -1,7 +1,15 @@
 package auth
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"ecom/config"
+	"ecom/domain"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 	"golang.org/x/crypto/bcrypt"
 	"time"
 )
@@ -13,20 +21,83 @@ func NewStore() *Store {
 	return &Store{}
 }
 
-func (s *Store) CreateToken(secret []byte, userID string, firstName string, lastName string, email string, address string) (string, error) {
-	expiration := time.Now().Add(24 * time.Hour)
+func (s *Store) CreateToken(secret []byte, user domain.User) (string, error) {
+	role := user.Role
+	if role == "" {
+		role = domain.RoleCustomer
+	}
+
+	expiration := time.Now().Add(config.ENV.AccessTokenTTL)
 	claims := jwt.MapClaims{
-		"userID":    userID,
-		"firstName": firstName,
-		"lastName":  lastName,
-		"email":     email,
-		"address":   address,
+		"jti":       uuid.New().String(),
+		"userID":    user.ID,
+		"firstName": user.FirstName,
+		"lastName":  user.LastName,
+		"email":     user.Email,
+		"address":   user.Address,
+		"role":      role,
 		"exp":       expiration.Unix(),
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	return token.SignedString(secret)
 }
 
+func (s *Store) GenerateToken() (string, string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token := base64.RawURLEncoding.EncodeToString(b)
+	return token, s.HashToken(token), nil
+}
+
+// HashToken hashes high-entropy tokens for storage. Unlike passwords they
+// don't need a slow hash, and a plain digest keeps them searchable.
+func (s *Store) HashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+const verifyEmailPurpose = "verify-email"
+
+func (s *Store) CreateVerificationToken(secret []byte, user domain.User) (string, error) {
+	claims := jwt.MapClaims{
+		"sub":     user.ID,
+		"email":   user.Email,
+		"purpose": verifyEmailPurpose,
+		"exp":     time.Now().Add(config.ENV.EmailVerificationTTL).Unix(),
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString(secret)
+}
+
+func (s *Store) ParseVerificationToken(secret []byte, tokenString string) (string, string, error) {
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+		}
+		return secret, nil
+	})
+	if err != nil || !token.Valid {
+		return "", "", fmt.Errorf("invalid verification token")
+	}
+
+	// access tokens are signed with the same secret, so the purpose claim
+	// keeps them from being used as verification tokens
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["purpose"] != verifyEmailPurpose {
+		return "", "", fmt.Errorf("invalid verification token")
+	}
+
+	userID, _ := claims["sub"].(string)
+	email, _ := claims["email"].(string)
+	if userID == "" || email == "" {
+		return "", "", fmt.Errorf("invalid verification token")
+	}
+
+	return userID, email, nil
+}
+
 func (s *Store) HashPassword(password string) (string, error) {
 	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
 	if err != nil {
@@ -1,6 +1,8 @@
 package auth
 
 import (
+	"ecom/config"
+	"ecom/domain"
 	"testing"
 	"time"
 
@@ -17,7 +19,14 @@ func TestCreateToken(t *testing.T) {
 	email := "john.doe@example.com"
 	address := "123 Main St"
 
-	tokenString, err := store.CreateToken(secret, userID, firstName, lastName, email, address)
+	tokenString, err := store.CreateToken(secret, domain.User{
+		ID:        userID,
+		FirstName: firstName,
+		LastName:  lastName,
+		Email:     email,
+		Address:   address,
+		Role:      domain.RoleStaff,
+	})
 	assert.NoError(t, err)
 	assert.NotEmpty(t, tokenString)
 
@@ -34,7 +43,61 @@ func TestCreateToken(t *testing.T) {
 	assert.Equal(t, lastName, claims["lastName"])
 	assert.Equal(t, email, claims["email"])
 	assert.Equal(t, address, claims["address"])
-	assert.WithinDuration(t, time.Now().Add(24*time.Hour), time.Unix(int64(claims["exp"].(float64)), 0), time.Minute)
+	assert.Equal(t, domain.RoleStaff, claims["role"])
+	assert.NotEmpty(t, claims["jti"])
+	assert.WithinDuration(t, time.Now().Add(config.ENV.AccessTokenTTL), time.Unix(int64(claims["exp"].(float64)), 0), time.Minute)
+}
+
+func TestCreateTokenDefaultsToCustomerRole(t *testing.T) {
+	store := NewStore()
+	secret := []byte("mysecret")
+
+	tokenString, err := store.CreateToken(secret, domain.User{ID: "123"})
+	assert.NoError(t, err)
+
+	token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
+		return secret, nil
+	})
+	assert.NoError(t, err)
+
+	claims := token.Claims.(jwt.MapClaims)
+	assert.Equal(t, domain.RoleCustomer, claims["role"])
+}
+
+func TestGenerateToken(t *testing.T) {
+	store := NewStore()
+
+	token, hash, err := store.GenerateToken()
+	assert.NoError(t, err)
+	assert.NotEmpty(t, token)
+	assert.NotEqual(t, token, hash)
+	assert.Equal(t, hash, store.HashToken(token))
+
+	other, _, err := store.GenerateToken()
+	assert.NoError(t, err)
+	assert.NotEqual(t, token, other)
+}
+
+func TestVerificationToken(t *testing.T) {
+	store := NewStore()
+	secret := []byte("mysecret")
+	user := domain.User{ID: "123", Email: "john.doe@example.com"}
+
+	token, err := store.CreateVerificationToken(secret, user)
+	assert.NoError(t, err)
+
+	userID, email, err := store.ParseVerificationToken(secret, token)
+	assert.NoError(t, err)
+	assert.Equal(t, user.ID, userID)
+	assert.Equal(t, user.Email, email)
+
+	_, _, err = store.ParseVerificationToken([]byte("othersecret"), token)
+	assert.Error(t, err)
+
+	accessToken, err := store.CreateToken(secret, user)
+	assert.NoError(t, err)
+	_, _, err = store.ParseVerificationToken(secret, accessToken)
+	assert.Error(t, err, "access tokens must not verify emails")
 }
 
 func TestHashPassword(t *testing.T) {
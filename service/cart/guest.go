@@ -0,0 +1,47 @@
+package cart
+
+import (
+	"ecom/config"
+	"net/http"
+)
+
+const (
+	CartTokenHeader = "X-Cart-Token"
+	CartTokenCookie = "cart_token"
+)
+
+// GuestCartToken returns the guest cart token sent with the request, from
+// the X-Cart-Token header or else the cart_token cookie.
+func GuestCartToken(r *http.Request) string {
+	if token := r.Header.Get(CartTokenHeader); token != "" {
+		return token
+	}
+	if cookie, err := r.Cookie(CartTokenCookie); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+func setGuestCartToken(w http.ResponseWriter, r *http.Request, token string) {
+	w.Header().Set(CartTokenHeader, token)
+	http.SetCookie(w, &http.Cookie{
+		Name:     CartTokenCookie,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(config.ENV.GuestCartTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// ClearGuestCartCookie tells the browser to forget the guest cart token.
+func ClearGuestCartCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     CartTokenCookie,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+	})
+}
@@ -0,0 +1,241 @@
+package cart
+
+import (
+	"ecom/config"
+	"ecom/domain"
+	"ecom/middleware"
+	"ecom/utils"
+	"errors"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// userCart loads the cart of the authenticated user or, for anonymous
+// requests, the guest cart named by the cart token. A new guest cart is only
+// started when create is set; otherwise an empty cart is returned. It writes
+// the error response itself when that fails.
+func (h *Handler) userCart(w http.ResponseWriter, r *http.Request, create bool) (*domain.Cart, bool) {
+	if userID, err := middleware.GetUserIDFromContext(r.Context()); err == nil {
+		cart, err := h.store.GetOrCreateCart(userID)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return nil, false
+		}
+		return cart, true
+	}
+
+	if token := GuestCartToken(r); token != "" {
+		cart, err := h.store.GetGuestCart(h.auth.HashToken(token))
+		if err == nil {
+			return cart, true
+		} else if !errors.Is(err, domain.ErrCartNotFound) {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return nil, false
+		}
+	}
+
+	if !create {
+		return &domain.Cart{}, true
+	}
+
+	// start a guest cart and hand its token to the client
+	token, hash, err := h.auth.GenerateToken()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+
+	cart, err := h.store.CreateGuestCart(hash, time.Now().Add(config.ENV.GuestCartTTL))
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	cart.Token = token
+	setGuestCartToken(w, r, token)
+
+	return cart, true
+}
+
+func (h *Handler) writeCart(w http.ResponseWriter, cart *domain.Cart) {
+	lines, err := h.store.GetCartLines(cart.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	cart.Items = *lines
+
+	utils.WriteJSON(w, http.StatusOK, cart)
+}
+
+// checkStock makes sure the product is still sold and has enough stock for
+// the requested quantity.
+func (h *Handler) checkStock(w http.ResponseWriter, productID, quantity int) bool {
+	product, err := h.productStore.GetProductByID(productID)
+	if errors.Is(err, domain.ErrProductNotFound) {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return false
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return false
+	}
+
+	if quantity > product.Quantity {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("insufficient stock for product %d", productID))
+		return false
+	}
+
+	return true
+}
+
+func cartItemQuantity(items *[]domain.CartItem, productID int) (int, bool) {
+	for _, item := range *items {
+		if item.ProductID == productID {
+			return item.Quantity, true
+		}
+	}
+	return 0, false
+}
+
+func (h *Handler) handleGetCart(w http.ResponseWriter, r *http.Request) {
+	cart, ok := h.userCart(w, r, false)
+	if !ok {
+		return
+	}
+
+	h.writeCart(w, cart)
+}
+
+func (h *Handler) handleAddCartItem(w http.ResponseWriter, r *http.Request) {
+	// get JSON payload
+	var payload domain.CartItemPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// validate the payload
+	err := utils.Validate.Struct(payload)
+	if err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", validationErrors))
+		return
+	}
+
+	cart, ok := h.userCart(w, r, true)
+	if !ok {
+		return
+	}
+
+	// adding a product that is already in the cart adds to its quantity
+	items, err := h.store.GetCartItems(cart.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	existing, _ := cartItemQuantity(items, payload.ProductID)
+	quantity := existing + payload.Quantity
+
+	if !h.checkStock(w, payload.ProductID, quantity) {
+		return
+	}
+
+	if err := h.store.SetCartItem(cart.ID, payload.ProductID, quantity); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.writeCart(w, cart)
+}
+
+func (h *Handler) handleUpdateCartItem(w http.ResponseWriter, r *http.Request) {
+	// get the product ID from the URL
+	productID, err := strconv.Atoi(mux.Vars(r)["productId"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid product ID"))
+		return
+	}
+
+	// get JSON payload
+	var payload domain.CartItemQuantityPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// validate the payload
+	err = utils.Validate.Struct(payload)
+	if err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", validationErrors))
+		return
+	}
+
+	cart, ok := h.userCart(w, r, false)
+	if !ok {
+		return
+	}
+
+	items, err := h.store.GetCartItems(cart.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if _, found := cartItemQuantity(items, productID); !found {
+		utils.WriteError(w, http.StatusNotFound, domain.ErrCartItemNotFound)
+		return
+	}
+
+	if !h.checkStock(w, productID, payload.Quantity) {
+		return
+	}
+
+	if err := h.store.SetCartItem(cart.ID, productID, payload.Quantity); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.writeCart(w, cart)
+}
+
+func (h *Handler) handleRemoveCartItem(w http.ResponseWriter, r *http.Request) {
+	// get the product ID from the URL
+	productID, err := strconv.Atoi(mux.Vars(r)["productId"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid product ID"))
+		return
+	}
+
+	cart, ok := h.userCart(w, r, false)
+	if !ok {
+		return
+	}
+
+	err = h.store.RemoveCartItem(cart.ID, productID)
+	if errors.Is(err, domain.ErrCartItemNotFound) {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.writeCart(w, cart)
+}
+
+func (h *Handler) handleClearCart(w http.ResponseWriter, r *http.Request) {
+	cart, ok := h.userCart(w, r, false)
+	if !ok {
+		return
+	}
+
+	if err := h.store.ClearCart(cart.ID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	h.writeCart(w, cart)
+}
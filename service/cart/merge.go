@@ -0,0 +1,98 @@
+package cart
+
+import (
+	"ecom/domain"
+	"errors"
+)
+
+// Merger moves guest carts into user carts, resolving products present in
+// both with the configured strategy.
+type Merger struct {
+	uow      domain.UnitOfWork
+	auth     domain.AuthService
+	strategy string
+}
+
+func NewMerger(uow domain.UnitOfWork, auth domain.AuthService, strategy string) *Merger {
+	return &Merger{
+		uow:      uow,
+		auth:     auth,
+		strategy: strategy,
+	}
+}
+
+// MergeGuestCart moves the items of the guest cart into the user's cart and
+// deletes the guest cart. Unknown or expired tokens are ignored.
+func (m *Merger) MergeGuestCart(userID, cartToken string) error {
+	return m.uow.Do(func(repos domain.Repositories) error {
+		guest, err := repos.Carts().GetGuestCart(m.auth.HashToken(cartToken))
+		if errors.Is(err, domain.ErrCartNotFound) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		cart, err := repos.Carts().GetOrCreateCart(userID)
+		if err != nil {
+			return err
+		}
+
+		guestLines, err := repos.Carts().GetCartLines(guest.ID)
+		if err != nil {
+			return err
+		}
+		userLines, err := repos.Carts().GetCartLines(cart.ID)
+		if err != nil {
+			return err
+		}
+
+		for _, item := range mergeCartLines(*userLines, *guestLines, m.strategy) {
+			if item.Quantity > 0 {
+				err = repos.Carts().SetCartItem(cart.ID, item.ProductID, item.Quantity)
+			} else {
+				err = repos.Carts().RemoveCartItem(cart.ID, item.ProductID)
+				if errors.Is(err, domain.ErrCartItemNotFound) {
+					err = nil
+				}
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		return repos.Carts().DeleteCart(guest.ID)
+	})
+}
+
+// mergeCartLines returns the new quantity of every product in the guest
+// cart. A quantity of zero means the product has to leave the user's cart.
+func mergeCartLines(userLines, guestLines []domain.CartLine, strategy string) []domain.CartItem {
+	existing := make(map[int]domain.CartLine, len(userLines))
+	for _, line := range userLines {
+		existing[line.ProductID] = line
+	}
+
+	items := make([]domain.CartItem, 0, len(guestLines))
+	for _, guest := range guestLines {
+		user, found := existing[guest.ProductID]
+
+		quantity := guest.Quantity
+		switch strategy {
+		case domain.CartMergeSum:
+			quantity += user.Quantity
+		case domain.CartMergeLatest:
+			if found && user.UpdatedAt.After(guest.UpdatedAt) {
+				quantity = user.Quantity
+			}
+		default:
+			quantity += user.Quantity
+			if quantity > guest.Available {
+				quantity = guest.Available
+			}
+		}
+
+		items = append(items, domain.CartItem{ProductID: guest.ProductID, Quantity: quantity})
+	}
+
+	return items
+}
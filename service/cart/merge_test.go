@@ -0,0 +1,100 @@
+package cart
+
+import (
+	"ecom/domain"
+	"ecom/service/auth"
+	"testing"
+	"time"
+)
+
+func TestMergeCartLines(t *testing.T) {
+	earlier := time.Date(2024, 9, 1, 10, 0, 0, 0, time.UTC)
+	later := earlier.Add(time.Hour)
+
+	userLines := []domain.CartLine{
+		{CartItem: domain.CartItem{ProductID: 1, Quantity: 3}, Available: 4, UpdatedAt: later},
+		{CartItem: domain.CartItem{ProductID: 2, Quantity: 1}, Available: 10, UpdatedAt: earlier},
+		{CartItem: domain.CartItem{ProductID: 4, Quantity: 2}, Available: 0, UpdatedAt: earlier},
+	}
+	guestLines := []domain.CartLine{
+		{CartItem: domain.CartItem{ProductID: 1, Quantity: 2}, Available: 4, UpdatedAt: earlier},
+		{CartItem: domain.CartItem{ProductID: 2, Quantity: 5}, Available: 10, UpdatedAt: later},
+		{CartItem: domain.CartItem{ProductID: 3, Quantity: 1}, Available: 2, UpdatedAt: earlier},
+		{CartItem: domain.CartItem{ProductID: 4, Quantity: 1}, Available: 0, UpdatedAt: later},
+	}
+
+	tests := []struct {
+		strategy string
+		expected map[int]int
+	}{
+		{domain.CartMergeSum, map[int]int{1: 5, 2: 6, 3: 1, 4: 3}},
+		{domain.CartMergeCap, map[int]int{1: 4, 2: 6, 3: 1, 4: 0}},
+		{domain.CartMergeLatest, map[int]int{1: 3, 2: 5, 3: 1, 4: 1}},
+		{"", map[int]int{1: 4, 2: 6, 3: 1, 4: 0}},
+	}
+
+	for _, test := range tests {
+		t.Run("strategy "+test.strategy, func(t *testing.T) {
+			items := mergeCartLines(userLines, guestLines, test.strategy)
+
+			if len(items) != len(test.expected) {
+				t.Fatalf("expected %d items, got %d", len(test.expected), len(items))
+			}
+			for _, item := range items {
+				if item.Quantity != test.expected[item.ProductID] {
+					t.Errorf("product %d: expected quantity %d, got %d", item.ProductID, test.expected[item.ProductID], item.Quantity)
+				}
+			}
+		})
+	}
+}
+
+func TestMergeGuestCart(t *testing.T) {
+	authStore := auth.NewStore()
+
+	t.Run("should move the guest items into the user's cart", func(t *testing.T) {
+		uow := &mockUnitOfWork{committed: mockState{
+			stock: map[int]int{1: 10, 2: 5},
+			cartItems: map[string][]domain.CartItem{
+				"cart-user-1": {{ProductID: 2, Quantity: 4}},
+				"guest-1":     {{ProductID: 1, Quantity: 2}, {ProductID: 2, Quantity: 3}},
+			},
+			guestCarts: map[string]string{authStore.HashToken("guest-token"): "guest-1"},
+		}}
+		merger := NewMerger(uow, authStore, domain.CartMergeCap)
+
+		if err := merger.MergeGuestCart("user-1", "guest-token"); err != nil {
+			t.Fatal(err)
+		}
+
+		quantities := make(map[int]int)
+		for _, item := range uow.committed.cartItems["cart-user-1"] {
+			quantities[item.ProductID] = item.Quantity
+		}
+		if quantities[1] != 2 || quantities[2] != 5 {
+			t.Errorf("unexpected merged cart: %v", quantities)
+		}
+		if len(uow.committed.guestCarts) != 0 {
+			t.Errorf("expected the guest cart to be deleted")
+		}
+	})
+
+	t.Run("should ignore unknown tokens", func(t *testing.T) {
+		uow := &mockUnitOfWork{committed: mockState{
+			cartItems: map[string][]domain.CartItem{
+				"cart-user-1": {{ProductID: 2, Quantity: 4}},
+				"guest-1":     {{ProductID: 1, Quantity: 2}},
+			},
+			guestCarts: map[string]string{authStore.HashToken("guest-token"): "guest-1"},
+		}}
+		merger := NewMerger(uow, authStore, domain.CartMergeCap)
+
+		if err := merger.MergeGuestCart("user-1", "unknown"); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(uow.committed.cartItems["cart-user-1"]) != 1 {
+			t.Errorf("expected the user's cart to be unchanged")
+		}
+	})
+}
@@ -0,0 +1,122 @@
+package cart
+
+import (
+	"ecom/config"
+	"ecom/domain"
+	"ecom/gateway"
+	"net/http"
+	"testing"
+)
+
+func TestCheckoutPayment(t *testing.T) {
+	previous := config.ENV.RequireEmailVerification
+	config.ENV.RequireEmailVerification = false
+	t.Cleanup(func() { config.ENV.RequireEmailVerification = previous })
+
+	items := []domain.CartItem{{ProductID: 1, Quantity: 2}}
+
+	t.Run("should require a payment source", func(t *testing.T) {
+		uow := &mockUnitOfWork{committed: mockState{stock: map[int]int{1: 10}}}
+		products := &mockProductStore{products: []domain.Product{{ID: 1, Name: "Product 1", Price: money("10"), Quantity: 10}}}
+		handler := newCartHandler(uow, products, &mockUserStore{}, &mockAddressStore{})
+
+		rr := serveCartRequest(handler, newCartRequest(t, http.MethodPost, "/checkout", `{"items":[{"productId":1,"quantity":2}]}`))
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+		if len(uow.committed.orders) != 0 {
+			t.Errorf("expected no orders, got %d", len(uow.committed.orders))
+		}
+	})
+
+	t.Run("should return 402 and place nothing when the card is declined", func(t *testing.T) {
+		uow := &mockUnitOfWork{committed: mockState{stock: map[int]int{1: 10}}}
+		products := &mockProductStore{products: []domain.Product{{ID: 1, Name: "Product 1", Price: money("10"), Quantity: 10}}}
+		handler := newCartHandler(uow, products, &mockUserStore{}, newAddressStore("user-1"))
+
+		payload := domain.CartCheckoutPayload{Items: items, PaymentSource: "4000 0000 0000 0002"}
+		rr := serveCartRequest(handler, newCheckoutRequest(t, "user-1", payload))
+
+		if rr.Code != http.StatusPaymentRequired {
+			t.Fatalf("expected status code %d, got %d", http.StatusPaymentRequired, rr.Code)
+		}
+		if len(uow.committed.orders) != 0 || len(uow.committed.payments) != 0 {
+			t.Errorf("expected no orders or payments, got %d and %d", len(uow.committed.orders), len(uow.committed.payments))
+		}
+		if uow.committed.stock[1] != 10 {
+			t.Errorf("expected stock to be untouched, got %d", uow.committed.stock[1])
+		}
+		if len(uow.committed.reservations) != 0 {
+			t.Errorf("expected the reservations to be released, got %v", uow.committed.reservations)
+		}
+	})
+
+	t.Run("should return 409 when the stock is reserved by another checkout", func(t *testing.T) {
+		uow := &mockUnitOfWork{committed: mockState{stock: map[int]int{1: 10}}}
+		products := &mockProductStore{products: []domain.Product{{ID: 1, Name: "Product 1", Price: money("10"), Quantity: 10}}}
+		uow.committed.reservations = map[int]domain.StockReservation{1: {ID: 1, ProductID: 1, Quantity: 9}}
+		uow.committed.lastReservation = 1
+		handler := newCartHandler(uow, products, &mockUserStore{}, newAddressStore("user-1"))
+
+		rr := serveCartRequest(handler, newCheckoutRequest(t, "user-1", domain.CartCheckoutPayload{Items: items}))
+
+		if rr.Code != http.StatusConflict {
+			t.Errorf("expected status code %d, got %d", http.StatusConflict, rr.Code)
+		}
+		if len(uow.committed.orders) != 0 {
+			t.Errorf("expected no orders, got %d", len(uow.committed.orders))
+		}
+	})
+
+	t.Run("should authorize the total and capture it once the order is placed", func(t *testing.T) {
+		uow := &mockUnitOfWork{committed: mockState{stock: map[int]int{1: 10}}}
+		products := &mockProductStore{products: []domain.Product{{ID: 1, Name: "Product 1", Price: money("10"), Quantity: 10}}}
+		handler := newCartHandler(uow, products, &mockUserStore{}, newAddressStore("user-1"))
+
+		rr := serveCartRequest(handler, newCheckoutRequest(t, "user-1", domain.CartCheckoutPayload{Items: items}))
+
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status code %d, got %d", http.StatusCreated, rr.Code)
+		}
+		if status := uow.committed.orders[0].Status; status != domain.OrderStatusPending {
+			t.Errorf("expected the order to wait for the webhook, got %s", status)
+		}
+		if len(uow.committed.payments) != 1 {
+			t.Fatalf("expected 1 payment, got %d", len(uow.committed.payments))
+		}
+		payment := uow.committed.payments[0]
+		if payment.Provider != "fake" || payment.Amount != money("20") {
+			t.Errorf("unexpected payment %+v", payment)
+		}
+		if status := handler.payments.(*gateway.FakeProvider).Status(payment.Reference); status != domain.PaymentStatusCaptured {
+			t.Errorf("expected the payment to be captured, got %q", status)
+		}
+	})
+
+	t.Run("should cancel the order and void the payment when the capture fails", func(t *testing.T) {
+		uow := &mockUnitOfWork{committed: mockState{stock: map[int]int{1: 10}}}
+		products := &mockProductStore{products: []domain.Product{{ID: 1, Name: "Product 1", Price: money("10"), Quantity: 10}}}
+		handler := newCartHandler(uow, products, &mockUserStore{}, newAddressStore("user-1"))
+		payments := &failingCaptures{recordingPayments{FakeProvider: handler.payments.(*gateway.FakeProvider)}}
+		handler.payments = payments
+
+		rr := serveCartRequest(handler, newCheckoutRequest(t, "user-1", domain.CartCheckoutPayload{Items: items}))
+
+		if rr.Code != http.StatusPaymentRequired {
+			t.Fatalf("expected status code %d, got %d", http.StatusPaymentRequired, rr.Code)
+		}
+		if len(uow.committed.orders) != 1 || uow.committed.orders[0].Status != domain.OrderStatusCancelled {
+			t.Fatalf("expected a cancelled order, got %+v", uow.committed.orders)
+		}
+		if status := uow.committed.payments[0].Status; status != domain.PaymentStatusVoided {
+			t.Errorf("expected the payment to be voided, got %s", status)
+		}
+		if status := payments.Status(payments.references[0]); status != domain.PaymentStatusVoided {
+			t.Errorf("expected the provider to void the payment, got %q", status)
+		}
+		if uow.committed.stock[1] != 10 {
+			t.Errorf("expected the stock back, got %d", uow.committed.stock[1])
+		}
+	})
+}
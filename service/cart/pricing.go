@@ -0,0 +1,137 @@
+package cart
+
+import (
+	"ecom/domain"
+	"fmt"
+)
+
+// checkout holds the inputs of a quote or an order.
+type checkout struct {
+	userID   string
+	cartID   string // stored cart being checked out, if any
+	items    []domain.CartItem
+	products map[int]domain.Product
+	shipping domain.Address
+	billing  domain.Address
+
+	promotionCodes   []string
+	shippingMethodID *int
+	paymentSource    string
+}
+
+// pricingStep adds to a quote. Steps run in order and must not write
+// anything, so quoting and checkout can share them.
+type pricingStep func(c *checkout, quote *domain.Quote) error
+
+// pricingSteps is the pipeline shared by quotes and checkout.
+func (h *Handler) pricingSteps() []pricingStep {
+	return []pricingStep{
+		priceLines,
+		h.applyPromotions,
+		h.applyShipping,
+		h.applyTax,
+		totalQuote,
+	}
+}
+
+// quote loads the products of the checkout and runs the pricing pipeline.
+func (h *Handler) quote(c *checkout) (*domain.Quote, error) {
+	productIDs, err := getCartItemsIDs(c.items)
+	if err != nil {
+		return nil, err
+	}
+
+	products, err := h.productStore.GetProductByIDs(productIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	c.products = make(map[int]domain.Product, len(*products))
+	for _, product := range *products {
+		c.products[product.ID] = product
+	}
+
+	quote := &domain.Quote{
+		Lines:      make([]domain.QuoteLine, 0, len(c.items)),
+		Promotions: make([]domain.AppliedPromotion, 0),
+	}
+	for _, step := range h.pricingSteps() {
+		if err := step(c, quote); err != nil {
+			return nil, err
+		}
+	}
+
+	return quote, nil
+}
+
+// priceLines prices every item at the current product price and flags the
+// ones that can't be ordered.
+func priceLines(c *checkout, quote *domain.Quote) error {
+	for _, item := range c.items {
+		line := domain.QuoteLine{ProductID: item.ProductID, Quantity: item.Quantity}
+
+		product, exists := c.products[item.ProductID]
+		if !exists {
+			line.Warning = "product is no longer available"
+			quote.Lines = append(quote.Lines, line)
+			continue
+		}
+
+		line.ProductName = product.Name
+		line.UnitPrice = product.Price
+		line.LineTotal = product.Price.Mul(item.Quantity)
+		line.Available = product.Quantity
+		if item.Quantity > product.Quantity {
+			line.Warning = fmt.Sprintf("only %d left in stock", product.Quantity)
+		}
+
+		quote.Subtotal = quote.Subtotal.Add(line.LineTotal)
+		quote.Lines = append(quote.Lines, line)
+	}
+
+	return nil
+}
+
+// applyTax taxes every line at the shipping address, after spreading the
+// discount over the lines in proportion to their totals.
+func (h *Handler) applyTax(c *checkout, quote *domain.Quote) error {
+	weights := make([]int64, len(quote.Lines))
+	for i, line := range quote.Lines {
+		weights[i] = line.LineTotal.Amount
+	}
+	discounts := quote.Discount.Allocate(weights)
+
+	request := domain.TaxRequest{Address: c.shipping, Lines: make([]domain.TaxableLine, len(quote.Lines))}
+	for i, line := range quote.Lines {
+		quote.Lines[i].Discount = discounts[i]
+		request.Lines[i] = domain.TaxableLine{
+			ProductID: line.ProductID,
+			TaxClass:  c.products[line.ProductID].TaxClass,
+			Quantity:  line.Quantity,
+			Amount:    line.LineTotal.Sub(discounts[i]),
+		}
+	}
+
+	result, err := h.tax.CalculateTax(request)
+	if err != nil {
+		return err
+	}
+
+	quote.TaxIncluded = result.Inclusive
+	for i, taxes := range result.Lines {
+		quote.Lines[i].Taxes = taxes
+		for _, tax := range taxes {
+			quote.Tax = quote.Tax.Add(tax.Amount)
+		}
+	}
+
+	return nil
+}
+
+func totalQuote(c *checkout, quote *domain.Quote) error {
+	quote.Total = quote.Subtotal.Sub(quote.Discount).Add(quote.Shipping)
+	if !quote.TaxIncluded {
+		quote.Total = quote.Total.Add(quote.Tax)
+	}
+	return nil
+}
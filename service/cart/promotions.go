@@ -0,0 +1,153 @@
+package cart
+
+import (
+	"ecom/domain"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// applyPromotions applies the codes of the checkout in order. A code that
+// can't be used fails the whole quote with domain.ErrPromotionNotApplicable
+// rather than being dropped, so the customer never pays more than expected.
+func (h *Handler) applyPromotions(c *checkout, quote *domain.Quote) error {
+	seen := make(map[string]bool, len(c.promotionCodes))
+	for _, code := range c.promotionCodes {
+		code = strings.ToUpper(strings.TrimSpace(code))
+		if seen[code] {
+			continue
+		}
+		seen[code] = true
+
+		promotion, err := h.promotionStore.GetPromotionByCode(code)
+		if errors.Is(err, domain.ErrPromotionNotFound) {
+			return fmt.Errorf("%w: unknown code %s", domain.ErrPromotionNotApplicable, code)
+		} else if err != nil {
+			return err
+		}
+
+		if err := h.checkPromotion(c, quote, promotion); err != nil {
+			return err
+		}
+
+		eligible := eligibleLines(c, quote, promotion)
+		if len(eligible) == 0 {
+			return fmt.Errorf("%w: no items in the cart qualify for code %s", domain.ErrPromotionNotApplicable, code)
+		}
+
+		applied := domain.AppliedPromotion{
+			PromotionID: promotion.ID,
+			Code:        promotion.Code,
+			Description: promotion.Description,
+			Discount:    promotionDiscount(promotion, eligible),
+		}
+		if promotion.Type == domain.PromotionFreeShipping {
+			// applyShipping waives the cost once the method is known
+			applied.FreeShipping = true
+		} else {
+			// stacked codes never take the subtotal below zero
+			applied.Discount = applied.Discount.Min(quote.Subtotal.Sub(quote.Discount))
+			quote.Discount = quote.Discount.Add(applied.Discount)
+		}
+
+		quote.Promotions = append(quote.Promotions, applied)
+	}
+
+	return nil
+}
+
+// checkPromotion returns why the promotion can't be used on the quote, if
+// anything stops it.
+func (h *Handler) checkPromotion(c *checkout, quote *domain.Quote, promotion *domain.Promotion) error {
+	now := time.Now()
+	switch {
+	case !promotion.Active:
+		return fmt.Errorf("%w: code %s is not active", domain.ErrPromotionNotApplicable, promotion.Code)
+	case promotion.StartsAt != nil && now.Before(*promotion.StartsAt):
+		return fmt.Errorf("%w: code %s is not valid yet", domain.ErrPromotionNotApplicable, promotion.Code)
+	case promotion.EndsAt != nil && !now.Before(*promotion.EndsAt):
+		return fmt.Errorf("%w: code %s has expired", domain.ErrPromotionNotApplicable, promotion.Code)
+	case promotion.UsageLimit != nil && promotion.TimesUsed >= *promotion.UsageLimit:
+		return fmt.Errorf("%w: code %s has reached its usage limit", domain.ErrPromotionNotApplicable, promotion.Code)
+	case quote.Subtotal.Cmp(promotion.MinSubtotal) < 0:
+		return fmt.Errorf("%w: code %s needs a subtotal of at least %s", domain.ErrPromotionNotApplicable, promotion.Code, promotion.MinSubtotal)
+	}
+
+	if promotion.PerUserLimit != nil {
+		// guests can't be told apart, so per-user codes need a login
+		if c.userID == "" {
+			return fmt.Errorf("%w: log in to use code %s", domain.ErrPromotionNotApplicable, promotion.Code)
+		}
+
+		used, err := h.promotionStore.CountRedemptions(promotion.ID, c.userID)
+		if err != nil {
+			return err
+		}
+		if used >= *promotion.PerUserLimit {
+			return fmt.Errorf("%w: code %s was already used", domain.ErrPromotionNotApplicable, promotion.Code)
+		}
+	}
+
+	return nil
+}
+
+// eligibleLines returns the priced lines of products the promotion covers.
+func eligibleLines(c *checkout, quote *domain.Quote, promotion *domain.Promotion) []domain.QuoteLine {
+	restricted := len(promotion.ProductIDs) > 0 || len(promotion.Categories) > 0
+
+	lines := make([]domain.QuoteLine, 0, len(quote.Lines))
+	for _, line := range quote.Lines {
+		product, exists := c.products[line.ProductID]
+		if !exists {
+			continue
+		}
+		if restricted && !slices.Contains(promotion.ProductIDs, product.ID) && !containsCategory(promotion.Categories, product.Category) {
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	return lines
+}
+
+// promotionDiscount is the amount the promotion takes off the eligible lines.
+func promotionDiscount(promotion *domain.Promotion, lines []domain.QuoteLine) domain.Money {
+	var eligible domain.Money
+	for _, line := range lines {
+		eligible = eligible.Add(line.LineTotal)
+	}
+
+	switch promotion.Type {
+	case domain.PromotionPercentage:
+		return eligible.MulFraction(int64(promotion.Percent), 100)
+	case domain.PromotionFixedAmount:
+		return promotion.AmountOff.Min(eligible)
+	case domain.PromotionBuyXGetY:
+		var discount domain.Money
+		group := promotion.BuyQuantity + promotion.GetQuantity
+		if group == 0 {
+			return discount
+		}
+		for _, line := range lines {
+			free := line.Quantity / group * promotion.GetQuantity
+			discount = discount.Add(line.UnitPrice.Mul(free))
+		}
+		return discount
+	}
+
+	return domain.Money{}
+}
+
+func containsCategory(categories []string, category string) bool {
+	if category == "" {
+		return false
+	}
+	for _, c := range categories {
+		if strings.EqualFold(c, category) {
+			return true
+		}
+	}
+	return false
+}
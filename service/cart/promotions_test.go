@@ -0,0 +1,212 @@
+package cart
+
+import (
+	"ecom/config"
+	"ecom/domain"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func quoteWithCodes(t *testing.T, handler *Handler, codes ...string) (int, domain.Quote) {
+	payload := domain.CartCheckoutPayload{
+		Items:          []domain.CartItem{{ProductID: 1, Quantity: 3}, {ProductID: 2, Quantity: 4}},
+		PromotionCodes: codes,
+	}
+	marshaled, _ := json.Marshal(payload)
+	rr := serveCartRequest(handler, newCartRequest(t, http.MethodPost, "/quote", string(marshaled)))
+	if rr.Code != http.StatusOK {
+		return rr.Code, domain.Quote{}
+	}
+	return rr.Code, decodeQuote(t, rr)
+}
+
+// newQuoteProductStore returns the catalog quoteWithCodes buys from, with only
+// product 1 in the "shoes" category.
+func newQuoteProductStore() *mockProductStore {
+	return &mockProductStore{products: []domain.Product{
+		{ID: 1, Name: "Product 1", Price: money("10"), Quantity: 10, Category: "shoes"},
+		{ID: 2, Name: "Product 2", Price: money("2.5"), Quantity: 5},
+	}}
+}
+
+func TestPromotionDiscounts(t *testing.T) {
+	limit := func(n int) *int { return &n }
+
+	// the cart is 3 x 10.00 in "shoes" plus 4 x 2.50, a subtotal of 40.00
+	tests := []struct {
+		name      string
+		promotion domain.Promotion
+		discount  domain.Money
+	}{
+		{
+			name:      "percentage off everything",
+			promotion: domain.Promotion{Type: domain.PromotionPercentage, Percent: 15},
+			discount:  money("6"),
+		},
+		{
+			name:      "percentage off one category",
+			promotion: domain.Promotion{Type: domain.PromotionPercentage, Percent: 15, Categories: []string{"Shoes"}},
+			discount:  money("4.5"),
+		},
+		{
+			name:      "fixed amount capped at the eligible lines",
+			promotion: domain.Promotion{Type: domain.PromotionFixedAmount, AmountOff: money("25"), ProductIDs: []int{2}},
+			discount:  money("10"),
+		},
+		{
+			name:      "buy two get one free",
+			promotion: domain.Promotion{Type: domain.PromotionBuyXGetY, BuyQuantity: 2, GetQuantity: 1},
+			discount:  money("12.5"),
+		},
+		{
+			name:      "free shipping",
+			promotion: domain.Promotion{Type: domain.PromotionFreeShipping, UsageLimit: limit(1)},
+			discount:  money("0"),
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			test.promotion.ID = 1
+			test.promotion.Code = "SAVE"
+			test.promotion.Active = true
+			uow := &mockUnitOfWork{committed: mockState{promotions: []domain.Promotion{test.promotion}}}
+			products := newQuoteProductStore()
+			handler := newCartHandler(uow, products, &mockUserStore{}, &mockAddressStore{})
+
+			code, quote := quoteWithCodes(t, handler, "save")
+			if code != http.StatusOK {
+				t.Fatalf("expected status code %d, got %d", http.StatusOK, code)
+			}
+			if quote.Discount.Cmp(test.discount) != 0 {
+				t.Errorf("expected discount %v, got %v", test.discount, quote.Discount)
+			}
+			if quote.Total != money("40").Sub(test.discount) {
+				t.Errorf("expected total %v, got %v", money("40").Sub(test.discount), quote.Total)
+			}
+			if len(quote.Promotions) != 1 || quote.Promotions[0].Code != "SAVE" {
+				t.Errorf("expected the code to be listed, got %+v", quote.Promotions)
+			}
+		})
+	}
+
+	t.Run("should never discount below zero", func(t *testing.T) {
+		uow := &mockUnitOfWork{committed: mockState{
+			promotions: []domain.Promotion{
+				{ID: 1, Code: "HALF", Type: domain.PromotionPercentage, Percent: 50, Active: true},
+				{ID: 2, Code: "BIG", Type: domain.PromotionFixedAmount, AmountOff: money("30"), Active: true},
+			},
+		}}
+		products := newQuoteProductStore()
+		handler := newCartHandler(uow, products, &mockUserStore{}, &mockAddressStore{})
+
+		_, quote := quoteWithCodes(t, handler, "HALF", "BIG")
+		if quote.Discount != money("40") || !quote.Total.IsZero() {
+			t.Errorf("expected the discount to stop at the subtotal, got %v off, %v total", quote.Discount, quote.Total)
+		}
+		if quote.Promotions[1].Discount != money("20") {
+			t.Errorf("expected the second code to take the remaining 20, got %v", quote.Promotions[1].Discount)
+		}
+	})
+}
+
+func TestPromotionRules(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+	one := 1
+
+	tests := []struct {
+		name      string
+		promotion domain.Promotion
+	}{
+		{name: "inactive", promotion: domain.Promotion{}},
+		{name: "not started", promotion: domain.Promotion{Active: true, StartsAt: &future}},
+		{name: "expired", promotion: domain.Promotion{Active: true, EndsAt: &past}},
+		{name: "used up", promotion: domain.Promotion{Active: true, UsageLimit: &one, TimesUsed: 1}},
+		{name: "below the minimum subtotal", promotion: domain.Promotion{Active: true, MinSubtotal: money("50")}},
+		{name: "no eligible products", promotion: domain.Promotion{Active: true, ProductIDs: []int{9}}},
+	}
+
+	for _, test := range tests {
+		t.Run("should reject a promotion that is "+test.name, func(t *testing.T) {
+			test.promotion.ID = 1
+			test.promotion.Code = "SAVE"
+			test.promotion.Type = domain.PromotionPercentage
+			test.promotion.Percent = 10
+			uow := &mockUnitOfWork{committed: mockState{promotions: []domain.Promotion{test.promotion}}}
+			products := newQuoteProductStore()
+			handler := newCartHandler(uow, products, &mockUserStore{}, &mockAddressStore{})
+
+			if code, _ := quoteWithCodes(t, handler, "SAVE"); code != http.StatusBadRequest {
+				t.Errorf("expected status code %d, got %d", http.StatusBadRequest, code)
+			}
+		})
+	}
+
+	t.Run("should reject unknown codes", func(t *testing.T) {
+		uow := &mockUnitOfWork{}
+		products := newQuoteProductStore()
+		handler := newCartHandler(uow, products, &mockUserStore{}, &mockAddressStore{})
+
+		if code, _ := quoteWithCodes(t, handler, "NOPE"); code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, code)
+		}
+	})
+
+	t.Run("should ask guests to log in for per-user codes", func(t *testing.T) {
+		uow := &mockUnitOfWork{committed: mockState{
+			promotions: []domain.Promotion{{ID: 1, Code: "ONCE", Type: domain.PromotionPercentage, Percent: 10, PerUserLimit: &one, Active: true}},
+		}}
+		products := &mockProductStore{products: []domain.Product{{ID: 1, Name: "Product 1", Price: money("10"), Quantity: 10}}}
+		handler := newCartHandler(uow, products, &mockUserStore{}, &mockAddressStore{})
+
+		body := `{"items":[{"productId":1,"quantity":1}],"promotionCodes":["ONCE"]}`
+		rr := serveCartRequest(handler, newGuestRequest(t, http.MethodPost, "/quote", body, ""))
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+}
+
+func TestCheckoutRedeemsPromotions(t *testing.T) {
+	previous := config.ENV.RequireEmailVerification
+	config.ENV.RequireEmailVerification = false
+	t.Cleanup(func() { config.ENV.RequireEmailVerification = previous })
+
+	one := 1
+	uow := &mockUnitOfWork{committed: mockState{
+		stock:      map[int]int{1: 10},
+		promotions: []domain.Promotion{{ID: 1, Code: "ONCE", Type: domain.PromotionFixedAmount, AmountOff: money("5"), PerUserLimit: &one, Active: true}},
+	}}
+	products := &mockProductStore{products: []domain.Product{{ID: 1, Name: "Product 1", Price: money("10"), Quantity: 10}}}
+	handler := newCartHandler(uow, products, &mockUserStore{}, newAddressStore("user-1"))
+	payload := domain.CartCheckoutPayload{
+		Items:          []domain.CartItem{{ProductID: 1, Quantity: 1}},
+		PromotionCodes: []string{"ONCE"},
+	}
+
+	rr := serveCartRequest(handler, newCheckoutRequest(t, "user-1", payload))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected status code %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+
+	order := uow.committed.orders[0]
+	if order.Discount != money("5") || order.Total != money("5") {
+		t.Errorf("expected a 5 discount and a 5 total, got %v and %v", order.Discount, order.Total)
+	}
+	if len(uow.committed.redemptions) != 1 || uow.committed.redemptions[0].OrderID != order.ID {
+		t.Errorf("expected the redemption to be recorded, got %+v", uow.committed.redemptions)
+	}
+
+	// the per-user limit is used up now
+	rr = serveCartRequest(handler, newCheckoutRequest(t, "user-1", payload))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+	}
+	if len(uow.committed.orders) != 1 {
+		t.Errorf("expected no second order, got %d", len(uow.committed.orders))
+	}
+}
@@ -1,9 +1,11 @@
 package cart
 
 import (
+	"ecom/config"
 	"ecom/domain"
 	"ecom/middleware"
 	"ecom/utils"
+	"errors"
 	"fmt"
 	"github.com/go-playground/validator/v10"
 	"github.com/gorilla/mux"
@@ -11,22 +13,45 @@ import (
 )
 
 type Handler struct {
-	orderStore   domain.OrderRepository
-	productStore domain.ProductRepository
+	store          domain.CartRepository
+	uow            domain.UnitOfWork
+	productStore   domain.ProductRepository
+	userStore      domain.UserRepository
+	addressStore   domain.AddressRepository
+	promotionStore domain.PromotionRepository
+	shippingStore  domain.ShippingRepository
+	tax            domain.TaxCalculator
+	payments       domain.PaymentProvider
+	auth           domain.AuthService
 }
 
-func NewHandler(orderStore domain.OrderRepository, productStore domain.ProductRepository) *Handler {
+func NewHandler(store domain.CartRepository, uow domain.UnitOfWork, productStore domain.ProductRepository, userStore domain.UserRepository, addressStore domain.AddressRepository, promotionStore domain.PromotionRepository, shippingStore domain.ShippingRepository, tax domain.TaxCalculator, payments domain.PaymentProvider, auth domain.AuthService) *Handler {
 	return &Handler{
-		orderStore:   orderStore,
-		productStore: productStore,
+		store:          store,
+		uow:            uow,
+		productStore:   productStore,
+		userStore:      userStore,
+		addressStore:   addressStore,
+		promotionStore: promotionStore,
+		shippingStore:  shippingStore,
+		tax:            tax,
+		payments:       payments,
+		auth:           auth,
 	}
 }
 
 func (h *Handler) RegisterRoutes(router *mux.Router) {
-	router.HandleFunc("/checkout", h.handleCheckout).Methods("POST")
+	router.Handle("/checkout", middleware.JWTMiddleware(http.HandlerFunc(h.handleCheckout))).Methods("POST")
+	router.HandleFunc("/quote", h.handleQuote).Methods(http.MethodPost)
+	router.HandleFunc("/shipping-options", h.handleGetShippingOptions).Methods(http.MethodGet)
+	router.HandleFunc("/items", h.handleGetCart).Methods(http.MethodGet)
+	router.HandleFunc("/items", h.handleAddCartItem).Methods(http.MethodPost)
+	router.HandleFunc("/items", h.handleClearCart).Methods(http.MethodDelete)
+	router.HandleFunc("/items/{productId}", h.handleUpdateCartItem).Methods(http.MethodPatch)
+	router.HandleFunc("/items/{productId}", h.handleRemoveCartItem).Methods(http.MethodDelete)
 }
 
-func (h *Handler) handleCheckout(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) handleQuote(w http.ResponseWriter, r *http.Request) {
 	// get JSON payload
 	var payload domain.CartCheckoutPayload
 	if err := utils.ParseJSON(r, &payload); err != nil {
@@ -42,42 +67,212 @@ func (h *Handler) handleCheckout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// get the products from the store
-	productIDs, err := getCartItemsIDs(payload.Items)
-	if err != nil {
+	c, ok := h.newCheckout(w, r, payload)
+	if !ok {
+		return
+	}
+
+	quote, err := h.quote(c)
+	if errors.Is(err, domain.ErrPromotionNotApplicable) || errors.Is(err, domain.ErrShippingUnavailable) {
 		utils.WriteError(w, http.StatusBadRequest, err)
 		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
 	}
 
-	products, err := h.productStore.GetProductByIDs(productIDs)
+	utils.WriteJSON(w, http.StatusOK, quote)
+}
 
+func (h *Handler) handleCheckout(w http.ResponseWriter, r *http.Request) {
+	// get JSON payload
+	var payload domain.CartCheckoutPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// validate the payload
+	err := utils.Validate.Struct(payload)
 	if err != nil {
-		utils.WriteError(w, http.StatusInternalServerError, err)
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", validationErrors))
 		return
 	}
 
-	// get the user ID and address from the context
+	// get the user ID from the context
 	userID, err := middleware.GetUserIDFromContext(r.Context())
 	if err != nil {
 		utils.WriteError(w, http.StatusUnauthorized, err)
 		return
 	}
 
-	address, err := middleware.GetAddressFromContext(r.Context())
-	if err != nil {
-		utils.WriteError(w, http.StatusUnauthorized, err)
+	// only verified accounts can place orders
+	if config.ENV.RequireEmailVerification {
+		user, err := h.userStore.GetUserByID(userID)
+		if err != nil {
+			utils.WriteError(w, http.StatusUnauthorized, err)
+			return
+		}
+		if !user.Verified {
+			utils.WriteError(w, http.StatusForbidden, fmt.Errorf("email address must be verified before checkout"))
+			return
+		}
+	}
+
+	if payload.PaymentSource == "" {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("payment source is required"))
 		return
 	}
 
-	// create the order
-	orderID, totalPrice, err := h.createOrder(userID, address, payload.Items, products)
-	if err != nil {
+	c, ok := h.newCheckout(w, r, payload)
+	if !ok {
+		return
+	}
+
+	// the free-text address of the account has no country to pick the
+	// shipping zone and tax rates by, so orders need an address book entry
+	if c.shipping.ID == 0 {
+		utils.WriteError(w, http.StatusBadRequest, domain.ErrShippingAddressRequired)
+		return
+	}
+
+	// price the cart exactly like a quote
+	quote, err := h.quote(c)
+	if errors.Is(err, domain.ErrPromotionNotApplicable) || errors.Is(err, domain.ErrShippingUnavailable) {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !quote.Orderable() {
+		message := "cart has items that can't be ordered"
+		if quote.ShippingMethod == nil {
+			message = "no shipping method delivers to the address"
+		}
+		utils.WriteJSON(w, http.StatusConflict, map[string]interface{}{
+			"error": message,
+			"quote": quote,
+		})
+		return
+	}
+
+	// charge the card and create the order
+	orderID, err := h.createOrder(c, quote)
+	if errors.Is(err, domain.ErrPaymentDeclined) {
+		utils.WriteError(w, http.StatusPaymentRequired, err)
+		return
+	} else if errors.Is(err, domain.ErrInsufficientStock) || errors.Is(err, domain.ErrReservationNotFound) {
+		// another checkout took the stock since the quote was priced, or the
+		// payment took longer than the reservation lasted
+		utils.WriteError(w, http.StatusConflict, err)
+		return
+	} else if errors.Is(err, domain.ErrPromotionNotApplicable) {
+		// the code ran out between pricing and placing the order
+		utils.WriteError(w, http.StatusConflict, err)
+		return
+	} else if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
 
 	utils.WriteJSON(w, http.StatusCreated, map[string]interface{}{
 		"orderID":    orderID,
-		"totalPrice": totalPrice,
+		"totalPrice": quote.Total,
+		"quote":      quote,
 	})
 }
+
+// newCheckout collects the items and addresses of a quote or checkout
+// request, writing the error response itself when that fails. The stored
+// cart is used unless the items were sent explicitly.
+func (h *Handler) newCheckout(w http.ResponseWriter, r *http.Request, payload domain.CartCheckoutPayload) (*checkout, bool) {
+	c := &checkout{
+		items:            payload.Items,
+		promotionCodes:   payload.PromotionCodes,
+		shippingMethodID: payload.ShippingMethodID,
+		paymentSource:    payload.PaymentSource,
+	}
+	c.userID, _ = middleware.GetUserIDFromContext(r.Context())
+
+	if len(c.items) == 0 {
+		cart, ok := h.userCart(w, r, false)
+		if !ok {
+			return nil, false
+		}
+
+		stored, err := h.store.GetCartItems(cart.ID)
+		if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return nil, false
+		}
+		if len(*stored) == 0 {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("cart is empty"))
+			return nil, false
+		}
+
+		c.items = *stored
+		c.cartID = cart.ID
+	}
+
+	if _, err := getCartItemsIDs(c.items); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return nil, false
+	}
+
+	// guests have no saved addresses
+	if c.userID == "" {
+		if payload.AddressID != nil || payload.BillingAddressID != nil {
+			utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("log in to use saved addresses"))
+			return nil, false
+		}
+		return c, true
+	}
+
+	// pick the shipping and billing addresses
+	shipping, billing, err := h.resolveAddresses(c.userID, payload)
+	if errors.Is(err, domain.ErrAddressNotFound) {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return nil, false
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+	c.shipping = shipping
+	c.billing = billing
+
+	return c, true
+}
+
+// resolveAddresses returns the addresses chosen in the payload. Without an
+// addressId it falls back to the default saved address, and without saved
+// addresses it leaves them empty, so quotes are priced like a guest's and
+// checkout asks for an address.
+func (h *Handler) resolveAddresses(userID string, payload domain.CartCheckoutPayload) (domain.Address, domain.Address, error) {
+	var shipping *domain.Address
+	var err error
+	if payload.AddressID != nil {
+		shipping, err = h.addressStore.GetAddressByID(userID, *payload.AddressID)
+		if err != nil {
+			return domain.Address{}, domain.Address{}, err
+		}
+	} else {
+		shipping, err = h.addressStore.GetDefaultAddress(userID)
+		if errors.Is(err, domain.ErrAddressNotFound) {
+			return domain.Address{}, domain.Address{}, nil
+		} else if err != nil {
+			return domain.Address{}, domain.Address{}, err
+		}
+	}
+
+	billing := shipping
+	if payload.BillingAddressID != nil {
+		billing, err = h.addressStore.GetAddressByID(userID, *payload.BillingAddressID)
+		if err != nil {
+			return domain.Address{}, domain.Address{}, err
+		}
+	}
+
+	return *shipping, *billing, nil
+}
@@ -0,0 +1,630 @@
+package cart
+
+import (
+	"bytes"
+	"ecom/config"
+	"ecom/domain"
+	"ecom/middleware"
+	"ecom/service/auth"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+type mockUserStore struct {
+	domain.UserRepository
+	users map[string]domain.User
+}
+
+func (m *mockUserStore) GetUserByID(id string) (*domain.User, error) {
+	user, ok := m.users[id]
+	if !ok {
+		return nil, domain.ErrUserNotFound
+	}
+	return &user, nil
+}
+
+type mockAddressStore struct {
+	domain.AddressRepository
+	addresses []domain.Address
+}
+
+func (m *mockAddressStore) GetAddressByID(userID string, id int) (*domain.Address, error) {
+	for _, address := range m.addresses {
+		if address.ID == id && address.UserID == userID {
+			return &address, nil
+		}
+	}
+	return nil, domain.ErrAddressNotFound
+}
+
+func (m *mockAddressStore) GetDefaultAddress(userID string) (*domain.Address, error) {
+	for _, address := range m.addresses {
+		if address.IsDefault && address.UserID == userID {
+			return &address, nil
+		}
+	}
+	return nil, domain.ErrAddressNotFound
+}
+
+// newAddressStore saves the default address of the user, which checkout
+// needs.
+func newAddressStore(userID string) *mockAddressStore {
+	return &mockAddressStore{addresses: []domain.Address{{ID: 1, UserID: userID, Line1: "1 Main St", City: "Springfield", Country: "US", IsDefault: true}}}
+}
+
+func newCheckoutRequest(t *testing.T, userID string, payload domain.CartCheckoutPayload) *http.Request {
+	if payload.PaymentSource == "" {
+		payload.PaymentSource = testCard
+	}
+	marshaled, _ := json.Marshal(payload)
+	req, err := http.NewRequest(http.MethodPost, "/checkout", bytes.NewBuffer(marshaled))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := auth.NewStore().CreateToken([]byte(config.ENV.JWTSecret), domain.User{ID: userID, Address: "Address"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+func serveCartRequest(handler *Handler, req *http.Request) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	router := mux.NewRouter()
+	router.Use(middleware.OptionalJWTMiddleware)
+	handler.RegisterRoutes(router)
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestHandleCheckoutEmailVerification(t *testing.T) {
+	users := &mockUserStore{
+		users: map[string]domain.User{
+			"verified":   {ID: "verified", Verified: true},
+			"unverified": {ID: "unverified"},
+		},
+	}
+	payload := domain.CartCheckoutPayload{Items: []domain.CartItem{{ProductID: 1, Quantity: 1}}}
+
+	previous := config.ENV.RequireEmailVerification
+	t.Cleanup(func() { config.ENV.RequireEmailVerification = previous })
+
+	t.Run("should return 403 for unverified accounts", func(t *testing.T) {
+		config.ENV.RequireEmailVerification = true
+		uow := &mockUnitOfWork{}
+		products := &mockProductStore{}
+		handler := newCartHandler(uow, products, users, &mockAddressStore{})
+
+		rr := serveCartRequest(handler, newCheckoutRequest(t, "unverified", payload))
+
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+		if len(uow.committed.orders) != 0 {
+			t.Errorf("expected no orders, got %d", len(uow.committed.orders))
+		}
+	})
+
+	t.Run("should allow verified accounts", func(t *testing.T) {
+		config.ENV.RequireEmailVerification = true
+		uow := &mockUnitOfWork{committed: mockState{stock: map[int]int{1: 10}}}
+		products := &mockProductStore{products: []domain.Product{{ID: 1, Name: "Product 1", Price: money("10"), Quantity: 10}}}
+		handler := newCartHandler(uow, products, users, newAddressStore("verified"))
+
+		rr := serveCartRequest(handler, newCheckoutRequest(t, "verified", payload))
+
+		if rr.Code != http.StatusCreated {
+			t.Errorf("expected status code %d, got %d", http.StatusCreated, rr.Code)
+		}
+	})
+
+	t.Run("should allow unverified accounts when verification is disabled", func(t *testing.T) {
+		config.ENV.RequireEmailVerification = false
+		uow := &mockUnitOfWork{committed: mockState{stock: map[int]int{1: 10}}}
+		products := &mockProductStore{products: []domain.Product{{ID: 1, Name: "Product 1", Price: money("10"), Quantity: 10}}}
+		handler := newCartHandler(uow, products, users, newAddressStore("unverified"))
+
+		rr := serveCartRequest(handler, newCheckoutRequest(t, "unverified", payload))
+
+		if rr.Code != http.StatusCreated {
+			t.Errorf("expected status code %d, got %d", http.StatusCreated, rr.Code)
+		}
+	})
+}
+
+func TestHandleCheckoutAddresses(t *testing.T) {
+	previous := config.ENV.RequireEmailVerification
+	config.ENV.RequireEmailVerification = false
+	t.Cleanup(func() { config.ENV.RequireEmailVerification = previous })
+
+	home := domain.Address{ID: 1, UserID: "user-1", Line1: "1 Home St", City: "Hanoi", PostalCode: "100000", Country: "VN", IsDefault: true}
+	office := domain.Address{ID: 2, UserID: "user-1", Line1: "2 Office Rd", City: "Saigon", PostalCode: "700000", Country: "VN"}
+	other := domain.Address{ID: 3, UserID: "user-2", Line1: "3 Other Ave", City: "Hue", PostalCode: "530000", Country: "VN", IsDefault: true}
+	items := []domain.CartItem{{ProductID: 1, Quantity: 1}}
+
+	one, two, three := 1, 2, 3
+	tests := []struct {
+		name      string
+		addresses []domain.Address
+		payload   domain.CartCheckoutPayload
+		status    int
+		shipping  string
+		billing   string
+	}{
+		{
+			name:    "should return 400 without saved addresses",
+			payload: domain.CartCheckoutPayload{Items: items},
+			status:  http.StatusBadRequest,
+		},
+		{
+			name:      "should use the default address",
+			addresses: []domain.Address{home, office, other},
+			payload:   domain.CartCheckoutPayload{Items: items},
+			status:    http.StatusCreated,
+			shipping:  home.String(),
+			billing:   home.String(),
+		},
+		{
+			name:      "should use the chosen shipping and billing addresses",
+			addresses: []domain.Address{home, office, other},
+			payload:   domain.CartCheckoutPayload{Items: items, AddressID: &two, BillingAddressID: &one},
+			status:    http.StatusCreated,
+			shipping:  office.String(),
+			billing:   home.String(),
+		},
+		{
+			name:      "should return 400 for another user's address",
+			addresses: []domain.Address{home, office, other},
+			payload:   domain.CartCheckoutPayload{Items: items, AddressID: &three},
+			status:    http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			uow := &mockUnitOfWork{committed: mockState{stock: map[int]int{1: 10}}}
+			products := &mockProductStore{products: []domain.Product{{ID: 1, Name: "Product 1", Price: money("10"), Quantity: 10}}}
+			handler := newCartHandler(uow, products, &mockUserStore{}, &mockAddressStore{addresses: test.addresses})
+
+			rr := serveCartRequest(handler, newCheckoutRequest(t, "user-1", test.payload))
+
+			if rr.Code != test.status {
+				t.Fatalf("expected status code %d, got %d", test.status, rr.Code)
+			}
+			if test.status != http.StatusCreated {
+				if len(uow.committed.orders) != 0 {
+					t.Errorf("expected no orders, got %d", len(uow.committed.orders))
+				}
+				return
+			}
+
+			order := uow.committed.orders[0]
+			if order.Address != test.shipping {
+				t.Errorf("expected shipping address %q, got %q", test.shipping, order.Address)
+			}
+			if order.BillingAddress != test.billing {
+				t.Errorf("expected billing address %q, got %q", test.billing, order.BillingAddress)
+			}
+		})
+	}
+}
+
+func newCartRequest(t *testing.T, method, url, body string) *http.Request {
+	req, err := http.NewRequest(method, url, bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := auth.NewStore().CreateToken([]byte(config.ENV.JWTSecret), domain.User{ID: "user-1", Address: "Address"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+func decodeCart(t *testing.T, rr *httptest.ResponseRecorder) domain.Cart {
+	var cart domain.Cart
+	if err := json.NewDecoder(rr.Body).Decode(&cart); err != nil {
+		t.Fatal(err)
+	}
+	return cart
+}
+
+func TestCartItems(t *testing.T) {
+	t.Run("should add to the quantity of a product already in the cart", func(t *testing.T) {
+		uow := &mockUnitOfWork{committed: mockState{stock: map[int]int{1: 10}}}
+		products := &mockProductStore{products: []domain.Product{{ID: 1, Name: "Product 1", Price: money("10"), Quantity: 10}}}
+		handler := newCartHandler(uow, products, &mockUserStore{}, &mockAddressStore{})
+
+		serveCartRequest(handler, newCartRequest(t, http.MethodPost, "/items", `{"productId":1,"quantity":2}`))
+		rr := serveCartRequest(handler, newCartRequest(t, http.MethodPost, "/items", `{"productId":1,"quantity":3}`))
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		cart := decodeCart(t, rr)
+		if len(cart.Items) != 1 || cart.Items[0].Quantity != 5 {
+			t.Errorf("expected one line with quantity 5, got %+v", cart.Items)
+		}
+	})
+
+	t.Run("should reject quantities above the stock", func(t *testing.T) {
+		uow := &mockUnitOfWork{committed: mockState{stock: map[int]int{2: 5}}}
+		products := &mockProductStore{products: []domain.Product{{ID: 2, Name: "Product 2", Price: money("2.5"), Quantity: 5}}}
+		handler := newCartHandler(uow, products, &mockUserStore{}, &mockAddressStore{})
+
+		serveCartRequest(handler, newCartRequest(t, http.MethodPost, "/items", `{"productId":2,"quantity":4}`))
+
+		requests := []*http.Request{
+			newCartRequest(t, http.MethodPost, "/items", `{"productId":2,"quantity":2}`),
+			newCartRequest(t, http.MethodPatch, "/items/2", `{"quantity":6}`),
+		}
+		for _, req := range requests {
+			rr := serveCartRequest(handler, req)
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("%s: expected status code %d, got %d", req.Method, http.StatusBadRequest, rr.Code)
+			}
+		}
+
+		if quantity := uow.committed.cartItems["cart-user-1"][0].Quantity; quantity != 4 {
+			t.Errorf("expected the quantity to stay 4, got %d", quantity)
+		}
+	})
+
+	t.Run("should return 404 for unknown products", func(t *testing.T) {
+		uow := &mockUnitOfWork{}
+		products := &mockProductStore{}
+		handler := newCartHandler(uow, products, &mockUserStore{}, &mockAddressStore{})
+
+		requests := []*http.Request{
+			newCartRequest(t, http.MethodPost, "/items", `{"productId":9,"quantity":1}`),
+			newCartRequest(t, http.MethodPatch, "/items/1", `{"quantity":1}`),
+			newCartRequest(t, http.MethodDelete, "/items/1", ""),
+		}
+		for _, req := range requests {
+			rr := serveCartRequest(handler, req)
+			if rr.Code != http.StatusNotFound {
+				t.Errorf("%s: expected status code %d, got %d", req.Method, http.StatusNotFound, rr.Code)
+			}
+		}
+	})
+
+	t.Run("should update and remove items", func(t *testing.T) {
+		uow := &mockUnitOfWork{committed: mockState{stock: map[int]int{1: 10, 2: 5}}}
+		products := newProductStore()
+		handler := newCartHandler(uow, products, &mockUserStore{}, &mockAddressStore{})
+
+		serveCartRequest(handler, newCartRequest(t, http.MethodPost, "/items", `{"productId":1,"quantity":1}`))
+		serveCartRequest(handler, newCartRequest(t, http.MethodPost, "/items", `{"productId":2,"quantity":1}`))
+
+		rr := serveCartRequest(handler, newCartRequest(t, http.MethodPatch, "/items/1", `{"quantity":7}`))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		rr = serveCartRequest(handler, newCartRequest(t, http.MethodDelete, "/items/2", ""))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		cart := decodeCart(t, rr)
+		if len(cart.Items) != 1 || cart.Items[0].ProductID != 1 || cart.Items[0].Quantity != 7 {
+			t.Errorf("unexpected cart items: %+v", cart.Items)
+		}
+	})
+}
+
+func TestHandleCheckoutStoredCart(t *testing.T) {
+	previous := config.ENV.RequireEmailVerification
+	config.ENV.RequireEmailVerification = false
+	t.Cleanup(func() { config.ENV.RequireEmailVerification = previous })
+
+	t.Run("should return 400 for an empty cart", func(t *testing.T) {
+		uow := &mockUnitOfWork{}
+		products := &mockProductStore{}
+		handler := newCartHandler(uow, products, &mockUserStore{}, &mockAddressStore{})
+
+		rr := serveCartRequest(handler, newCheckoutRequest(t, "user-1", domain.CartCheckoutPayload{}))
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should check out the stored cart and clear it", func(t *testing.T) {
+		uow := &mockUnitOfWork{committed: mockState{stock: map[int]int{1: 10, 2: 5}}}
+		products := newProductStore()
+		uow.committed.cartItems = map[string][]domain.CartItem{
+			"cart-user-1": {{ProductID: 1, Quantity: 2}, {ProductID: 2, Quantity: 1}},
+		}
+		handler := newCartHandler(uow, products, &mockUserStore{}, newAddressStore("user-1"))
+
+		rr := serveCartRequest(handler, newCheckoutRequest(t, "user-1", domain.CartCheckoutPayload{}))
+
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status code %d, got %d", http.StatusCreated, rr.Code)
+		}
+		if len(uow.committed.orderItems) != 2 {
+			t.Errorf("expected 2 order items, got %d", len(uow.committed.orderItems))
+		}
+		if len(uow.committed.cartItems["cart-user-1"]) != 0 {
+			t.Errorf("expected the cart to be cleared")
+		}
+	})
+
+	t.Run("should keep the cart when the order fails", func(t *testing.T) {
+		uow := &mockUnitOfWork{committed: mockState{stock: map[int]int{1: 10}}}
+		products := &mockProductStore{products: []domain.Product{{ID: 1, Name: "Product 1", Price: money("10"), Quantity: 10}}}
+		uow.committed.cartItems = map[string][]domain.CartItem{
+			"cart-user-1": {{ProductID: 1, Quantity: 2}},
+		}
+		uow.failCreateOrder = true
+		handler := newCartHandler(uow, products, &mockUserStore{}, newAddressStore("user-1"))
+
+		rr := serveCartRequest(handler, newCheckoutRequest(t, "user-1", domain.CartCheckoutPayload{}))
+
+		if rr.Code != http.StatusInternalServerError {
+			t.Fatalf("expected status code %d, got %d", http.StatusInternalServerError, rr.Code)
+		}
+		if len(uow.committed.cartItems["cart-user-1"]) != 1 {
+			t.Errorf("expected the cart to be kept")
+		}
+	})
+
+	t.Run("should leave the stored cart alone for explicit items", func(t *testing.T) {
+		uow := &mockUnitOfWork{committed: mockState{stock: map[int]int{1: 10, 2: 5}}}
+		products := newProductStore()
+		uow.committed.cartItems = map[string][]domain.CartItem{
+			"cart-user-1": {{ProductID: 2, Quantity: 1}},
+		}
+		handler := newCartHandler(uow, products, &mockUserStore{}, newAddressStore("user-1"))
+
+		payload := domain.CartCheckoutPayload{Items: []domain.CartItem{{ProductID: 1, Quantity: 1}}}
+		rr := serveCartRequest(handler, newCheckoutRequest(t, "user-1", payload))
+
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status code %d, got %d", http.StatusCreated, rr.Code)
+		}
+		if len(uow.committed.cartItems["cart-user-1"]) != 1 {
+			t.Errorf("expected the stored cart to be kept")
+		}
+	})
+}
+
+func newGuestRequest(t *testing.T, method, url, body, cartToken string) *http.Request {
+	req, err := http.NewRequest(method, url, bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cartToken != "" {
+		req.Header.Set(CartTokenHeader, cartToken)
+	}
+	return req
+}
+
+func TestGuestCart(t *testing.T) {
+	t.Run("should return 401 when guests check out", func(t *testing.T) {
+		uow := &mockUnitOfWork{}
+		products := &mockProductStore{}
+		handler := newCartHandler(uow, products, &mockUserStore{}, &mockAddressStore{})
+
+		rr := serveCartRequest(handler, newGuestRequest(t, http.MethodPost, "/checkout", `{"items":[{"productId":1,"quantity":1}]}`, ""))
+
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected status code %d, got %d", http.StatusUnauthorized, rr.Code)
+		}
+	})
+
+	t.Run("should return an empty cart without starting one", func(t *testing.T) {
+		uow := &mockUnitOfWork{}
+		products := &mockProductStore{}
+		handler := newCartHandler(uow, products, &mockUserStore{}, &mockAddressStore{})
+
+		rr := serveCartRequest(handler, newGuestRequest(t, http.MethodGet, "/items", "", ""))
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if cart := decodeCart(t, rr); len(cart.Items) != 0 {
+			t.Errorf("expected an empty cart, got %+v", cart.Items)
+		}
+		if len(uow.committed.guestCarts) != 0 {
+			t.Errorf("expected no guest cart to be created")
+		}
+	})
+
+	t.Run("should start a guest cart and keep using it through its token", func(t *testing.T) {
+		uow := &mockUnitOfWork{committed: mockState{stock: map[int]int{1: 10, 2: 5}}}
+		products := newProductStore()
+		handler := newCartHandler(uow, products, &mockUserStore{}, &mockAddressStore{})
+
+		rr := serveCartRequest(handler, newGuestRequest(t, http.MethodPost, "/items", `{"productId":1,"quantity":2}`, ""))
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		token := rr.Header().Get(CartTokenHeader)
+		if token == "" {
+			t.Fatal("expected a cart token header")
+		}
+		if cart := decodeCart(t, rr); cart.Token != token {
+			t.Errorf("expected the token in the body, got %q", cart.Token)
+		}
+		cookies := rr.Result().Cookies()
+		if len(cookies) != 1 || cookies[0].Name != CartTokenCookie || cookies[0].Value != token || !cookies[0].HttpOnly {
+			t.Errorf("expected an http-only cart cookie, got %+v", cookies)
+		}
+
+		// the cookie alone identifies the cart too
+		req := newGuestRequest(t, http.MethodPost, "/items", `{"productId":2,"quantity":1}`, "")
+		req.AddCookie(cookies[0])
+		rr = serveCartRequest(handler, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if rr.Header().Get(CartTokenHeader) != "" {
+			t.Errorf("expected the existing cart to be reused")
+		}
+
+		rr = serveCartRequest(handler, newGuestRequest(t, http.MethodGet, "/items", "", token))
+		if cart := decodeCart(t, rr); len(cart.Items) != 2 {
+			t.Errorf("expected 2 items, got %+v", cart.Items)
+		}
+		if len(uow.committed.guestCarts) != 1 {
+			t.Errorf("expected a single guest cart, got %d", len(uow.committed.guestCarts))
+		}
+	})
+
+	t.Run("should start a new cart for unknown tokens", func(t *testing.T) {
+		uow := &mockUnitOfWork{committed: mockState{stock: map[int]int{1: 10}}}
+		products := &mockProductStore{products: []domain.Product{{ID: 1, Name: "Product 1", Price: money("10"), Quantity: 10}}}
+		handler := newCartHandler(uow, products, &mockUserStore{}, &mockAddressStore{})
+
+		rr := serveCartRequest(handler, newGuestRequest(t, http.MethodPost, "/items", `{"productId":1,"quantity":1}`, "expired"))
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if token := rr.Header().Get(CartTokenHeader); token == "" || token == "expired" {
+			t.Errorf("expected a new cart token, got %q", token)
+		}
+	})
+}
+
+func decodeQuote(t *testing.T, rr *httptest.ResponseRecorder) domain.Quote {
+	var quote domain.Quote
+	if err := json.NewDecoder(rr.Body).Decode(&quote); err != nil {
+		t.Fatal(err)
+	}
+	return quote
+}
+
+func TestHandleQuote(t *testing.T) {
+	previous := config.ENV.RequireEmailVerification
+	config.ENV.RequireEmailVerification = false
+	t.Cleanup(func() { config.ENV.RequireEmailVerification = previous })
+
+	t.Run("should itemize the cart without writing anything", func(t *testing.T) {
+		uow := &mockUnitOfWork{committed: mockState{stock: map[int]int{1: 10, 2: 5}}}
+		products := newProductStore()
+		handler := newCartHandler(uow, products, &mockUserStore{}, &mockAddressStore{})
+
+		body := `{"items":[{"productId":1,"quantity":2},{"productId":2,"quantity":4}]}`
+		rr := serveCartRequest(handler, newGuestRequest(t, http.MethodPost, "/quote", body, ""))
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		quote := decodeQuote(t, rr)
+		if len(quote.Lines) != 2 {
+			t.Fatalf("expected 2 lines, got %d", len(quote.Lines))
+		}
+		if quote.Lines[0].LineTotal != money("20") || quote.Lines[1].LineTotal != money("10") {
+			t.Errorf("unexpected line totals: %+v", quote.Lines)
+		}
+		if quote.Subtotal != money("30") || quote.Total != money("30") {
+			t.Errorf("expected subtotal and total 30, got %v and %v", quote.Subtotal, quote.Total)
+		}
+		if uow.committed.stock[1] != 10 || len(uow.committed.orders) != 0 {
+			t.Errorf("expected the quote to leave stock and orders alone")
+		}
+	})
+
+	t.Run("should warn about lines that can't be ordered", func(t *testing.T) {
+		uow := &mockUnitOfWork{committed: mockState{stock: map[int]int{1: 10, 2: 5}}}
+		products := newProductStore()
+		handler := newCartHandler(uow, products, &mockUserStore{}, &mockAddressStore{})
+
+		body := `{"items":[{"productId":1,"quantity":1},{"productId":2,"quantity":6},{"productId":9,"quantity":1}]}`
+		rr := serveCartRequest(handler, newGuestRequest(t, http.MethodPost, "/quote", body, ""))
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		quote := decodeQuote(t, rr)
+		if quote.Lines[0].Warning != "" {
+			t.Errorf("expected no warning for the first line, got %q", quote.Lines[0].Warning)
+		}
+		if quote.Lines[1].Warning != "only 5 left in stock" || quote.Lines[1].Available != 5 {
+			t.Errorf("expected a stock warning, got %+v", quote.Lines[1])
+		}
+		if quote.Lines[2].Warning == "" || !quote.Lines[2].LineTotal.IsZero() {
+			t.Errorf("expected an unpriced, unavailable line, got %+v", quote.Lines[2])
+		}
+	})
+
+	t.Run("should quote the stored cart", func(t *testing.T) {
+		uow := &mockUnitOfWork{committed: mockState{stock: map[int]int{2: 5}}}
+		products := &mockProductStore{products: []domain.Product{{ID: 2, Name: "Product 2", Price: money("2.5"), Quantity: 5}}}
+		uow.committed.cartItems = map[string][]domain.CartItem{"cart-user-1": {{ProductID: 2, Quantity: 2}}}
+		handler := newCartHandler(uow, products, &mockUserStore{}, &mockAddressStore{})
+
+		rr := serveCartRequest(handler, newCartRequest(t, http.MethodPost, "/quote", `{}`))
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if quote := decodeQuote(t, rr); quote.Total != money("5") {
+			t.Errorf("expected total 5, got %v", quote.Total)
+		}
+	})
+
+	t.Run("should return 401 when guests pick a saved address", func(t *testing.T) {
+		uow := &mockUnitOfWork{}
+		products := &mockProductStore{}
+		handler := newCartHandler(uow, products, &mockUserStore{}, &mockAddressStore{})
+
+		body := `{"items":[{"productId":1,"quantity":1}],"addressId":1}`
+		rr := serveCartRequest(handler, newGuestRequest(t, http.MethodPost, "/quote", body, ""))
+
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected status code %d, got %d", http.StatusUnauthorized, rr.Code)
+		}
+	})
+
+	t.Run("should charge the quoted total at checkout", func(t *testing.T) {
+		uow := &mockUnitOfWork{committed: mockState{stock: map[int]int{1: 10, 2: 5}}}
+		products := &mockProductStore{products: []domain.Product{
+			{ID: 1, Name: "Product 1", Price: money("10"), Quantity: 10},
+			{ID: 2, Name: "Product 2", Price: money("0.1"), Quantity: 5},
+		}}
+		handler := newCartHandler(uow, products, &mockUserStore{}, newAddressStore("user-1"))
+
+		payload := domain.CartCheckoutPayload{Items: []domain.CartItem{{ProductID: 1, Quantity: 3}, {ProductID: 2, Quantity: 3}}}
+		marshaled, _ := json.Marshal(payload)
+		quote := decodeQuote(t, serveCartRequest(handler, newCartRequest(t, http.MethodPost, "/quote", string(marshaled))))
+
+		rr := serveCartRequest(handler, newCheckoutRequest(t, "user-1", payload))
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status code %d, got %d", http.StatusCreated, rr.Code)
+		}
+		if total := uow.committed.orders[0].Total; total != quote.Total {
+			t.Errorf("expected the order total %v to match the quote %v", total, quote.Total)
+		}
+	})
+
+	t.Run("should refuse to check out a cart with warnings", func(t *testing.T) {
+		uow := &mockUnitOfWork{committed: mockState{stock: map[int]int{2: 5}}}
+		products := &mockProductStore{products: []domain.Product{{ID: 2, Name: "Product 2", Price: money("2.5"), Quantity: 5}}}
+		handler := newCartHandler(uow, products, &mockUserStore{}, newAddressStore("user-1"))
+
+		payload := domain.CartCheckoutPayload{Items: []domain.CartItem{{ProductID: 2, Quantity: 6}}}
+		rr := serveCartRequest(handler, newCheckoutRequest(t, "user-1", payload))
+
+		if rr.Code != http.StatusConflict {
+			t.Fatalf("expected status code %d, got %d", http.StatusConflict, rr.Code)
+		}
+		if len(uow.committed.orders) != 0 {
+			t.Errorf("expected no orders, got %d", len(uow.committed.orders))
+		}
+	})
+}
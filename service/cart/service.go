@@ -1,8 +1,14 @@
 package cart
 
 import (
+	"ecom/config"
 	"ecom/domain"
+	"ecom/service/inventory"
+	"ecom/service/order"
+	"errors"
 	"fmt"
+	"log"
+	"time"
 )
 
 func getCartItemsIDs(items []domain.CartItem) ([]int, error) {
@@ -16,64 +22,243 @@ func getCartItemsIDs(items []domain.CartItem) ([]int, error) {
 	return productIDs, nil
 }
 
-func (h *Handler) createOrder(userID string, address string, items []domain.CartItem, products *[]domain.Product) (int, float64, error) {
-	// Create a map for products
-	productMap := make(map[int]domain.Product)
-	for _, product := range *products {
-		productMap[product.ID] = product
+// lineCharge is what the customer pays for a quote line, which is what a
+// refund of the whole line gives back.
+func lineCharge(line domain.QuoteLine, taxIncluded bool) domain.Money {
+	charge := line.LineTotal.Sub(line.Discount)
+	if !taxIncluded {
+		for _, tax := range line.Taxes {
+			charge = charge.Add(tax.Amount)
+		}
+	}
+	return charge
+}
+
+// reserveStock holds the stock of every line for the checkout in the
+// warehouses picked by the configured allocation strategy, and returns the
+// reservations of every line at its index. Nothing is held when a line can't
+// be covered. Checkouts that never finish leave their reservations to the
+// sweeper.
+func (h *Handler) reserveStock(c *checkout, quote *domain.Quote) ([][]domain.StockReservation, error) {
+	items := make([]domain.CartItem, len(quote.Lines))
+	productIDs := make([]int, len(quote.Lines))
+	for i, line := range quote.Lines {
+		items[i] = domain.CartItem{ProductID: line.ProductID, Quantity: line.Quantity}
+		productIDs[i] = line.ProductID
 	}
 
-	// Check if the products are available in stock
-	for _, item := range items {
-		product, exists := productMap[item.ProductID]
-		if !exists {
-			return 0, 0, fmt.Errorf("product %d not found", item.ProductID)
+	var reservations [][]domain.StockReservation
+	expiresAt := time.Now().Add(config.ENV.StockReservationTTL)
+	err := h.uow.Do(func(repos domain.Repositories) error {
+		warehouses, err := repos.Warehouses().GetWarehouses()
+		if err != nil {
+			return err
+		}
+		stock, err := repos.Warehouses().GetWarehouseStock(productIDs)
+		if err != nil {
+			return err
+		}
+		allocations, err := inventory.Allocate(config.ENV.StockAllocationStrategy, c.shipping, *warehouses, stock, items)
+		if err != nil {
+			return err
+		}
+
+		reservations = make([][]domain.StockReservation, len(allocations))
+		for i, lineAllocations := range allocations {
+			for _, allocation := range lineAllocations {
+				reservation := domain.StockReservation{
+					ProductID:   allocation.ProductID,
+					WarehouseID: allocation.WarehouseID,
+					Quantity:    allocation.Quantity,
+					ExpiresAt:   expiresAt,
+				}
+				reservation.ID, err = repos.Reservations().CreateReservation(reservation)
+				if err != nil {
+					return fmt.Errorf("product %d: %w", allocation.ProductID, err)
+				}
+				reservations[i] = append(reservations[i], reservation)
+			}
 		}
-		if item.Quantity > product.Quantity {
-			return 0, 0, fmt.Errorf("insufficient stock for product %d", item.ProductID)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reservations, nil
+}
+
+// releaseStock gives back the stock held for a checkout that failed.
+func (h *Handler) releaseStock(reservations [][]domain.StockReservation) {
+	err := h.uow.Do(func(repos domain.Repositories) error {
+		for _, lineReservations := range reservations {
+			for _, reservation := range lineReservations {
+				err := repos.Reservations().ReleaseReservation(reservation.ID)
+				if err != nil && !errors.Is(err, domain.ErrReservationNotFound) {
+					return err
+				}
+			}
 		}
+		return nil
+	})
+	if err != nil {
+		log.Println("stock release:", err)
 	}
+}
 
-	// Calculate the total price
-	var totalPrice float64
-	for _, item := range items {
-		product := productMap[item.ProductID]
-		totalPrice += float64(item.Quantity) * product.Price
+// splitLine turns a quote line into an order item for every warehouse it
+// ships from, sharing the charge and the taxes of the line out by quantity.
+func splitLine(orderID int, line domain.QuoteLine, reservations []domain.StockReservation, taxIncluded bool) []domain.OrderItem {
+	weights := make([]int64, len(reservations))
+	for i, reservation := range reservations {
+		weights[i] = int64(reservation.Quantity)
+	}
+	totals := lineCharge(line, taxIncluded).Allocate(weights)
+	taxes := make([][]domain.Money, len(line.Taxes))
+	for i, tax := range line.Taxes {
+		taxes[i] = tax.Amount.Allocate(weights)
 	}
 
-	// Reduce the stock
-	for _, item := range items {
-		err := h.productStore.UpdateProductStock(item.ProductID, -item.Quantity)
-		if err != nil {
-			return 0, 0, err
+	items := make([]domain.OrderItem, len(reservations))
+	for i, reservation := range reservations {
+		var itemTaxes []domain.TaxLine
+		for j, tax := range line.Taxes {
+			tax.Amount = taxes[j][i]
+			itemTaxes = append(itemTaxes, tax)
+		}
+		items[i] = domain.OrderItem{
+			OrderID:     orderID,
+			ProductID:   line.ProductID,
+			WarehouseID: reservation.WarehouseID,
+			Quantity:    reservation.Quantity,
+			Price:       line.UnitPrice,
+			Taxes:       itemTaxes,
+			Total:       totals[i],
 		}
 	}
+	return items
+}
 
-	// Create the order
-	order := domain.Order{
-		UserID:  userID,
-		Total:   totalPrice,
-		Status:  "pending",
-		Address: address,
+// createOrder reserves the stock, authorizes the payment and places the
+// order for a quote priced from c. The order stays pending until the
+// provider confirms the capture through the payment webhook.
+func (h *Handler) createOrder(c *checkout, quote *domain.Quote) (int, error) {
+	if !quote.Orderable() {
+		return 0, fmt.Errorf("cart has items that can't be ordered")
 	}
-	orderID, err := h.orderStore.CreateOrder(order)
+
+	// hold the stock while the payment is pending, so no other checkout
+	// sells it in the meantime
+	reservations, err := h.reserveStock(c, quote)
 	if err != nil {
-		return 0, 0, err
+		return 0, err
 	}
 
-	// Create the order items
-	for _, item := range items {
-		orderItem := domain.OrderItem{
-			OrderID:   orderID,
-			ProductID: item.ProductID,
-			Quantity:  item.Quantity,
-			Price:     productMap[item.ProductID].Price,
+	// hold the money next, so no order is placed that can't be paid for
+	reference, err := h.payments.Authorize(domain.PaymentRequest{Amount: quote.Total, Source: c.paymentSource})
+	if err != nil {
+		h.releaseStock(reservations)
+		return 0, err
+	}
+
+	// Sell the reserved stock, write the order and empty the stored cart in
+	// a single transaction so a failure at any step leaves nothing behind
+	var orderID int
+	err = h.uow.Do(func(repos domain.Repositories) error {
+		for _, lineReservations := range reservations {
+			for _, reservation := range lineReservations {
+				if err := repos.Reservations().ConvertReservation(reservation.ID); err != nil {
+					return err
+				}
+			}
+		}
+
+		order := domain.Order{
+			UserID:           c.userID,
+			Total:            quote.Total,
+			Discount:         quote.Discount,
+			Tax:              quote.Tax,
+			ShippingMethodID: &quote.ShippingMethod.MethodID,
+			ShippingMethod:   quote.ShippingMethod.Name,
+			Shipping:         quote.Shipping,
+			Status:           domain.OrderStatusPending,
+			Address:          c.shipping.String(),
+			BillingAddress:   c.billing.String(),
 		}
-		err := h.orderStore.CreateOrderItem(orderItem)
+		var err error
+		orderID, err = repos.Orders().CreateOrder(order)
 		if err != nil {
-			return 0, 0, err
+			return err
+		}
+
+		for i, line := range quote.Lines {
+			for _, orderItem := range splitLine(orderID, line, reservations[i], quote.TaxIncluded) {
+				if err := repos.Orders().CreateOrderItem(orderItem); err != nil {
+					return err
+				}
+			}
+		}
+
+		for _, applied := range quote.Promotions {
+			redemption := domain.PromotionRedemption{
+				PromotionID: applied.PromotionID,
+				OrderID:     orderID,
+				UserID:      c.userID,
+				Code:        applied.Code,
+				Discount:    applied.Discount,
+			}
+			if err := repos.Promotions().RedeemPromotion(redemption); err != nil {
+				return err
+			}
+		}
+
+		payment := domain.Payment{
+			OrderID:   orderID,
+			Provider:  h.payments.Name(),
+			Reference: reference,
+			Amount:    quote.Total,
+			Status:    domain.PaymentStatusAuthorized,
+		}
+		if _, err := repos.Payments().CreatePayment(payment); err != nil {
+			return err
 		}
+
+		if c.cartID != "" {
+			return repos.Carts().ClearCart(c.cartID)
+		}
+
+		return nil
+	})
+	if err != nil {
+		// release the hold of an order that was never placed
+		if err := h.payments.Void(reference); err != nil {
+			log.Println("payment void:", err)
+		}
+		h.releaseStock(reservations)
+		return 0, err
+	}
+
+	// don't leave the money held for an order that can't be paid
+	if err := h.payments.Capture(reference, quote.Total); err != nil {
+		log.Println("payment capture:", err)
+		h.cancelOrder(orderID)
+		return 0, fmt.Errorf("%w: the payment could not be captured", domain.ErrPaymentDeclined)
 	}
 
-	return orderID, totalPrice, nil
+	return orderID, nil
+}
+
+// cancelOrder cancels an order whose payment couldn't be captured, putting
+// its items back in stock and voiding the authorization.
+func (h *Handler) cancelOrder(orderID int) {
+	actorID := "payment:" + h.payments.Name()
+	err := h.uow.Do(func(repos domain.Repositories) error {
+		_, err := order.Transition(repos, orderID, domain.OrderStatusCancelled, actorID)
+		return err
+	})
+	if err == nil {
+		err = order.ReleasePayments(h.uow, h.payments, orderID, actorID)
+	}
+	if err != nil {
+		log.Printf("order %d: cancelling after a failed capture: %v", orderID, err)
+	}
 }
@@ -0,0 +1,825 @@
+package cart
+
+import (
+	"ecom/domain"
+	"ecom/gateway"
+	"ecom/service/auth"
+	"ecom/service/tax"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+	"time"
+)
+
+// money parses a test amount in the default currency.
+func money(value string) domain.Money {
+	return domain.MustParseMoney(value, domain.DefaultCurrency)
+}
+
+// mockState is the data held by the mock database.
+type mockState struct {
+	stock      map[int]int
+	orders     []domain.Order
+	orderItems []domain.OrderItem
+	cartItems  map[string][]domain.CartItem
+	guestCarts map[string]string // token hash to cart ID
+
+	promotions  []domain.Promotion
+	redemptions []domain.PromotionRedemption
+
+	payments []domain.Payment
+
+	reservations    map[int]domain.StockReservation
+	lastReservation int
+}
+
+func (s mockState) clone() mockState {
+	stock := make(map[int]int, len(s.stock))
+	for id, quantity := range s.stock {
+		stock[id] = quantity
+	}
+	cartItems := make(map[string][]domain.CartItem, len(s.cartItems))
+	for cartID, items := range s.cartItems {
+		cartItems[cartID] = append([]domain.CartItem(nil), items...)
+	}
+	guestCarts := make(map[string]string, len(s.guestCarts))
+	for hash, cartID := range s.guestCarts {
+		guestCarts[hash] = cartID
+	}
+	reservations := make(map[int]domain.StockReservation, len(s.reservations))
+	for id, reservation := range s.reservations {
+		reservations[id] = reservation
+	}
+	return mockState{
+		stock:      stock,
+		orders:     append([]domain.Order(nil), s.orders...),
+		orderItems: append([]domain.OrderItem(nil), s.orderItems...),
+		cartItems:  cartItems,
+		guestCarts: guestCarts,
+
+		promotions:  append([]domain.Promotion(nil), s.promotions...),
+		redemptions: append([]domain.PromotionRedemption(nil), s.redemptions...),
+
+		payments: append([]domain.Payment(nil), s.payments...),
+
+		reservations:    reservations,
+		lastReservation: s.lastReservation,
+	}
+}
+
+// available is the stock of the product that isn't reserved.
+func (s mockState) available(productID int) int {
+	available := s.stock[productID]
+	for _, reservation := range s.reservations {
+		if reservation.ProductID == productID {
+			available -= reservation.Quantity
+		}
+	}
+	return available
+}
+
+// mockUnitOfWork stages every write on a copy of the committed state and
+// only swaps it in when the unit of work succeeds.
+type mockUnitOfWork struct {
+	committed mockState
+
+	failConversion  int // fail the nth reservation conversion, 1-based
+	failCreateOrder bool
+	failOrderItem   int // fail the nth order item, 1-based
+}
+
+func (m *mockUnitOfWork) Do(fn func(repos domain.Repositories) error) error {
+	staged := &mockRepositories{uow: m, state: m.committed.clone()}
+	if err := fn(staged); err != nil {
+		return err
+	}
+	m.committed = staged.state
+	return nil
+}
+
+type mockRepositories struct {
+	uow         *mockUnitOfWork
+	state       mockState
+	conversions int
+}
+
+func (r *mockRepositories) Products() domain.ProductRepository {
+	return &mockTxProductStore{repos: r}
+}
+
+func (r *mockRepositories) Orders() domain.OrderRepository {
+	return &mockTxOrderStore{repos: r}
+}
+
+func (r *mockRepositories) Carts() domain.CartRepository {
+	return &mockCartStore{state: &r.state}
+}
+
+func (r *mockRepositories) Promotions() domain.PromotionRepository {
+	return &mockPromotionStore{state: &r.state}
+}
+
+func (r *mockRepositories) Payments() domain.PaymentRepository {
+	return &mockPaymentStore{state: &r.state}
+}
+
+func (r *mockRepositories) Returns() domain.ReturnRepository {
+	return nil
+}
+
+func (r *mockRepositories) Reservations() domain.ReservationRepository {
+	return &mockReservationStore{repos: r}
+}
+
+func (r *mockRepositories) Warehouses() domain.WarehouseRepository {
+	return &mockWarehouseStore{state: &r.state}
+}
+
+type mockTxProductStore struct {
+	mockProductStore
+	repos *mockRepositories
+}
+
+func (m *mockTxProductStore) UpdateProductStock(productID, warehouseID, quantity int) error {
+	if m.repos.state.available(productID)+quantity < 0 {
+		return domain.ErrInsufficientStock
+	}
+	m.repos.state.stock[productID] += quantity
+	return nil
+}
+
+type mockReservationStore struct {
+	repos *mockRepositories
+}
+
+func (m *mockReservationStore) CreateReservation(reservation domain.StockReservation) (int, error) {
+	state := &m.repos.state
+	if reservation.Quantity > state.available(reservation.ProductID) {
+		return 0, domain.ErrInsufficientStock
+	}
+	if state.reservations == nil {
+		state.reservations = make(map[int]domain.StockReservation)
+	}
+	state.lastReservation++
+	reservation.ID = state.lastReservation
+	state.reservations[reservation.ID] = reservation
+	return reservation.ID, nil
+}
+
+func (m *mockReservationStore) ConvertReservation(id int) error {
+	m.repos.conversions++
+	if m.repos.conversions == m.repos.uow.failConversion {
+		return errors.New("reservation conversion failed")
+	}
+	reservation, ok := m.repos.state.reservations[id]
+	if !ok {
+		return domain.ErrReservationNotFound
+	}
+	delete(m.repos.state.reservations, id)
+	m.repos.state.stock[reservation.ProductID] -= reservation.Quantity
+	return nil
+}
+
+func (m *mockReservationStore) ReleaseReservation(id int) error {
+	if _, ok := m.repos.state.reservations[id]; !ok {
+		return domain.ErrReservationNotFound
+	}
+	delete(m.repos.state.reservations, id)
+	return nil
+}
+
+func (m *mockReservationStore) ReleaseExpiredReservations(now time.Time) (int, error) {
+	released := 0
+	for id, reservation := range m.repos.state.reservations {
+		if reservation.ExpiresAt.Before(now) {
+			delete(m.repos.state.reservations, id)
+			released++
+		}
+	}
+	return released, nil
+}
+
+// mockWarehouseStore keeps all of the stock in a single warehouse.
+type mockWarehouseStore struct {
+	state *mockState
+}
+
+func (m *mockWarehouseStore) CreateWarehouse(warehouse domain.Warehouse) (int, error) {
+	return 0, errors.New("not implemented")
+}
+
+func (m *mockWarehouseStore) GetWarehouses() (*[]domain.Warehouse, error) {
+	return &[]domain.Warehouse{{ID: 1, Code: "main", Country: "US", Active: true}}, nil
+}
+
+func (m *mockWarehouseStore) GetWarehouseByID(id int) (*domain.Warehouse, error) {
+	return nil, domain.ErrWarehouseNotFound
+}
+
+func (m *mockWarehouseStore) GetWarehouseByCode(code string) (*domain.Warehouse, error) {
+	return nil, domain.ErrWarehouseNotFound
+}
+
+func (m *mockWarehouseStore) UpdateWarehouse(warehouse domain.Warehouse) error {
+	return nil
+}
+
+func (m *mockWarehouseStore) GetWarehouseStock(productIDs []int) (map[int][]domain.WarehouseStock, error) {
+	stock := make(map[int][]domain.WarehouseStock, len(productIDs))
+	for _, productID := range productIDs {
+		available := m.state.available(productID)
+		stock[productID] = []domain.WarehouseStock{{
+			WarehouseID: 1,
+			Quantity:    m.state.stock[productID],
+			Reserved:    m.state.stock[productID] - available,
+			Available:   available,
+		}}
+	}
+	return stock, nil
+}
+
+func (m *mockWarehouseStore) SetWarehouseStock(productID, warehouseID, quantity int) error {
+	return nil
+}
+
+type mockTxOrderStore struct {
+	repos *mockRepositories
+}
+
+func (m *mockTxOrderStore) CreateOrder(order domain.Order) (int, error) {
+	if m.repos.uow.failCreateOrder {
+		return 0, errors.New("create order failed")
+	}
+	order.ID = len(m.repos.state.orders) + 1
+	m.repos.state.orders = append(m.repos.state.orders, order)
+	return order.ID, nil
+}
+
+func (m *mockTxOrderStore) CreateOrderItem(orderItem domain.OrderItem) error {
+	if len(m.repos.state.orderItems)+1 == m.repos.uow.failOrderItem {
+		return errors.New("create order item failed")
+	}
+	m.repos.state.orderItems = append(m.repos.state.orderItems, orderItem)
+	return nil
+}
+
+func (m *mockTxOrderStore) GetOrderByID(id int) (*domain.Order, error) {
+	for _, order := range m.repos.state.orders {
+		if order.ID == id {
+			return &order, nil
+		}
+	}
+	return nil, domain.ErrOrderNotFound
+}
+
+func (m *mockTxOrderStore) LockOrder(id int) error {
+	return nil
+}
+
+func (m *mockTxOrderStore) GetOrderItems(orderID int) (*[]domain.OrderItem, error) {
+	items := make([]domain.OrderItem, 0)
+	for _, item := range m.repos.state.orderItems {
+		if item.OrderID == orderID {
+			items = append(items, item)
+		}
+	}
+	return &items, nil
+}
+
+func (m *mockTxOrderStore) GetOrders(filter domain.OrderFilter) (*[]domain.Order, int, error) {
+	return &m.repos.state.orders, len(m.repos.state.orders), nil
+}
+
+func (m *mockTxOrderStore) GetOrderLines(orderID int) (*[]domain.OrderLine, error) {
+	return &[]domain.OrderLine{}, nil
+}
+
+func (m *mockTxOrderStore) UpdateOrderStatus(id int, from, to string) error {
+	for i := range m.repos.state.orders {
+		if m.repos.state.orders[i].ID == id {
+			if m.repos.state.orders[i].Status != from {
+				return domain.ErrOrderStatusConflict
+			}
+			m.repos.state.orders[i].Status = to
+		}
+	}
+	return nil
+}
+
+func (m *mockTxOrderStore) CreateOrderStatusHistory(history domain.OrderStatusHistory) error {
+	return nil
+}
+
+func (m *mockTxOrderStore) CreateRefund(refund domain.Refund) (int, error) {
+	return 0, nil
+}
+
+func (m *mockTxOrderStore) CompleteRefund(id int) error {
+	return nil
+}
+
+func (m *mockTxOrderStore) FailRefund(refund domain.Refund) error {
+	return nil
+}
+
+// mockCartStore keeps one cart per user, named after the user ID.
+type mockCartStore struct {
+	state *mockState
+}
+
+func (m *mockCartStore) GetOrCreateCart(userID string) (*domain.Cart, error) {
+	if m.state.cartItems == nil {
+		m.state.cartItems = make(map[string][]domain.CartItem)
+	}
+	if _, ok := m.state.cartItems["cart-"+userID]; !ok {
+		m.state.cartItems["cart-"+userID] = []domain.CartItem{}
+	}
+	return &domain.Cart{ID: "cart-" + userID, UserID: userID}, nil
+}
+
+func (m *mockCartStore) CreateGuestCart(tokenHash string, expiresAt time.Time) (*domain.Cart, error) {
+	if m.state.cartItems == nil {
+		m.state.cartItems = make(map[string][]domain.CartItem)
+	}
+	if m.state.guestCarts == nil {
+		m.state.guestCarts = make(map[string]string)
+	}
+	cartID := fmt.Sprintf("guest-%d", len(m.state.guestCarts)+1)
+	m.state.guestCarts[tokenHash] = cartID
+	m.state.cartItems[cartID] = []domain.CartItem{}
+	return &domain.Cart{ID: cartID}, nil
+}
+
+func (m *mockCartStore) GetGuestCart(tokenHash string) (*domain.Cart, error) {
+	cartID, ok := m.state.guestCarts[tokenHash]
+	if !ok {
+		return nil, domain.ErrCartNotFound
+	}
+	return &domain.Cart{ID: cartID}, nil
+}
+
+func (m *mockCartStore) DeleteCart(cartID string) error {
+	for hash, id := range m.state.guestCarts {
+		if id == cartID {
+			delete(m.state.guestCarts, hash)
+		}
+	}
+	delete(m.state.cartItems, cartID)
+	return nil
+}
+
+func (m *mockCartStore) GetCartItems(cartID string) (*[]domain.CartItem, error) {
+	items := append([]domain.CartItem{}, m.state.cartItems[cartID]...)
+	return &items, nil
+}
+
+func (m *mockCartStore) GetCartLines(cartID string) (*[]domain.CartLine, error) {
+	lines := make([]domain.CartLine, 0)
+	for _, item := range m.state.cartItems[cartID] {
+		lines = append(lines, domain.CartLine{CartItem: item, Available: m.state.available(item.ProductID)})
+	}
+	return &lines, nil
+}
+
+func (m *mockCartStore) SetCartItem(cartID string, productID, quantity int) error {
+	items := m.state.cartItems[cartID]
+	for i := range items {
+		if items[i].ProductID == productID {
+			items[i].Quantity = quantity
+			return nil
+		}
+	}
+	m.state.cartItems[cartID] = append(items, domain.CartItem{ProductID: productID, Quantity: quantity})
+	return nil
+}
+
+func (m *mockCartStore) RemoveCartItem(cartID string, productID int) error {
+	items := m.state.cartItems[cartID]
+	for i := range items {
+		if items[i].ProductID == productID {
+			m.state.cartItems[cartID] = append(items[:i], items[i+1:]...)
+			return nil
+		}
+	}
+	return domain.ErrCartItemNotFound
+}
+
+func (m *mockCartStore) ClearCart(cartID string) error {
+	m.state.cartItems[cartID] = []domain.CartItem{}
+	return nil
+}
+
+type mockPromotionStore struct {
+	domain.PromotionRepository
+	state *mockState
+}
+
+func (m *mockPromotionStore) GetPromotionByCode(code string) (*domain.Promotion, error) {
+	for _, promotion := range m.state.promotions {
+		if promotion.Code == code {
+			return &promotion, nil
+		}
+	}
+	return nil, domain.ErrPromotionNotFound
+}
+
+func (m *mockPromotionStore) CountRedemptions(promotionID int, userID string) (int, error) {
+	count := 0
+	for _, redemption := range m.state.redemptions {
+		if redemption.PromotionID == promotionID && redemption.UserID == userID {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *mockPromotionStore) RedeemPromotion(redemption domain.PromotionRedemption) error {
+	for i, promotion := range m.state.promotions {
+		if promotion.ID != redemption.PromotionID {
+			continue
+		}
+		if promotion.UsageLimit != nil && promotion.TimesUsed >= *promotion.UsageLimit {
+			return domain.ErrPromotionNotApplicable
+		}
+		m.state.promotions[i].TimesUsed++
+		m.state.redemptions = append(m.state.redemptions, redemption)
+		return nil
+	}
+	return domain.ErrPromotionNotFound
+}
+
+type mockPaymentStore struct {
+	domain.PaymentRepository
+	state *mockState
+}
+
+func (m *mockPaymentStore) CreatePayment(payment domain.Payment) (int, error) {
+	payment.ID = len(m.state.payments) + 1
+	m.state.payments = append(m.state.payments, payment)
+	return payment.ID, nil
+}
+
+func (m *mockPaymentStore) GetPaymentsByOrderID(orderID int) (*[]domain.Payment, error) {
+	payments := make([]domain.Payment, 0)
+	for _, payment := range m.state.payments {
+		if payment.OrderID == orderID {
+			payments = append(payments, payment)
+		}
+	}
+	return &payments, nil
+}
+
+func (m *mockPaymentStore) UpdatePaymentStatus(id int, from, to string) error {
+	payment := &m.state.payments[id-1]
+	if payment.Status != from {
+		return domain.ErrPaymentStatusConflict
+	}
+	payment.Status = to
+	return nil
+}
+
+// recordingPayments remembers the references the fake provider hands out.
+type recordingPayments struct {
+	*gateway.FakeProvider
+	references []string
+}
+
+func (p *recordingPayments) Authorize(request domain.PaymentRequest) (string, error) {
+	reference, err := p.FakeProvider.Authorize(request)
+	if err == nil {
+		p.references = append(p.references, reference)
+	}
+	return reference, err
+}
+
+// failingCaptures authorizes payments and fails to capture them.
+type failingCaptures struct {
+	recordingPayments
+}
+
+func (p *failingCaptures) Capture(reference string, amount domain.Money) error {
+	return errors.New("capture timed out")
+}
+
+// sweepingPayments lets the sweeper release every reservation while the
+// payment is being authorized.
+type sweepingPayments struct {
+	recordingPayments
+	uow *mockUnitOfWork
+}
+
+func (p *sweepingPayments) Authorize(request domain.PaymentRequest) (string, error) {
+	p.uow.committed.reservations = nil
+	return p.recordingPayments.Authorize(request)
+}
+
+// mockTaxRates is an in-memory tax table.
+type mockTaxRates struct {
+	rates []domain.TaxRate
+}
+
+func (m *mockTaxRates) GetTaxRates(country string) (*[]domain.TaxRate, error) {
+	rates := make([]domain.TaxRate, 0)
+	for _, rate := range m.rates {
+		if rate.Country == country {
+			rates = append(rates, rate)
+		}
+	}
+	return &rates, nil
+}
+
+// mockShippingStore offers free local pickup unless methods are set. Zones
+// are lists of the countries they cover.
+type mockShippingStore struct {
+	domain.ShippingRepository
+	methods []domain.ShippingMethod
+	zones   map[int][]string
+}
+
+func (m *mockShippingStore) GetShippingMethods(country, region string) (*[]domain.ShippingMethod, error) {
+	if m.methods == nil {
+		return &[]domain.ShippingMethod{{ID: 1, Name: "Pickup", Type: domain.ShippingLocalPickup, Active: true}}, nil
+	}
+
+	methods := make([]domain.ShippingMethod, 0)
+	for _, method := range m.methods {
+		if method.ZoneID == nil || slices.Contains(m.zones[*method.ZoneID], country) {
+			methods = append(methods, method)
+		}
+	}
+	return &methods, nil
+}
+
+type mockProductStore struct {
+	products []domain.Product
+}
+
+func (m *mockProductStore) GetProducts(query domain.ProductQuery) (*domain.ProductPage, error) {
+	return &domain.ProductPage{Products: m.products, Total: len(m.products)}, nil
+}
+
+func (m *mockProductStore) CreateProduct(product domain.Product) error {
+	return nil
+}
+
+func (m *mockProductStore) GetProductByID(id int) (*domain.Product, error) {
+	for _, product := range m.products {
+		if product.ID == id {
+			return &product, nil
+		}
+	}
+	return nil, domain.ErrProductNotFound
+}
+
+func (m *mockProductStore) GetProductByIDs(ids []int) (*[]domain.Product, error) {
+	products := make([]domain.Product, 0)
+	for _, id := range ids {
+		if product, err := m.GetProductByID(id); err == nil {
+			products = append(products, *product)
+		}
+	}
+	return &products, nil
+}
+
+func (m *mockProductStore) UpdateProduct(product domain.Product) error {
+	return nil
+}
+
+func (m *mockProductStore) DeleteProduct(id int) error {
+	return nil
+}
+
+func (m *mockProductStore) GetProductStock(productID int) (*domain.ProductStock, error) {
+	return nil, nil
+}
+
+func (m *mockProductStore) UpdateProductStock(productID, warehouseID, quantity int) error {
+	return nil
+}
+
+// Test cards for the fake payment provider.
+const (
+	testCard     = "4242424242424242"
+	declinedCard = "4000000000000002"
+)
+
+// newProductStore returns the two products the multi-line checkout tests buy,
+// priced so the totals stay easy to follow. Pair it with 10 and 5 of stock.
+func newProductStore() *mockProductStore {
+	return &mockProductStore{products: []domain.Product{
+		{ID: 1, Name: "Product 1", Price: money("10"), Quantity: 10},
+		{ID: 2, Name: "Product 2", Price: money("2.5"), Quantity: 5},
+	}}
+}
+
+func newCartHandler(uow *mockUnitOfWork, products *mockProductStore, users domain.UserRepository, addresses domain.AddressRepository) *Handler {
+	payments := gateway.NewFakeProvider("secret", "", []string{declinedCard})
+	return NewHandler(&mockCartStore{state: &uow.committed}, uow, products, users, addresses, &mockPromotionStore{state: &uow.committed}, &mockShippingStore{}, tax.NewTableCalculator(&mockTaxRates{}, false), payments, auth.NewStore())
+}
+
+// priceCheckout quotes items for user-1 the way checkout does.
+func priceCheckout(t *testing.T, handler *Handler, items []domain.CartItem) (*checkout, *domain.Quote) {
+	shipping := domain.Address{Line1: "Address"}
+	c := &checkout{userID: "user-1", items: items, shipping: shipping, billing: shipping, paymentSource: testCard}
+	quote, err := handler.quote(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, quote
+}
+
+func TestCreateOrder(t *testing.T) {
+	items := []domain.CartItem{
+		{ProductID: 1, Quantity: 2},
+		{ProductID: 2, Quantity: 4},
+	}
+
+	t.Run("should persist stock, order and items together", func(t *testing.T) {
+		uow := &mockUnitOfWork{committed: mockState{stock: map[int]int{1: 10, 2: 5}}}
+		products := newProductStore()
+		handler := newCartHandler(uow, products, &mockUserStore{}, &mockAddressStore{})
+
+		orderID, err := handler.createOrder(priceCheckout(t, handler, items))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if orderID != 1 {
+			t.Errorf("expected order ID 1, got %d", orderID)
+		}
+		if total := uow.committed.orders[0].Total; total != money("30") {
+			t.Errorf("expected total 30, got %v", total)
+		}
+		if uow.committed.stock[1] != 8 || uow.committed.stock[2] != 1 {
+			t.Errorf("unexpected stock after checkout: %v", uow.committed.stock)
+		}
+		if len(uow.committed.reservations) != 0 {
+			t.Errorf("expected the reservations to be converted, got %v", uow.committed.reservations)
+		}
+		if len(uow.committed.orders) != 1 {
+			t.Errorf("expected 1 order, got %d", len(uow.committed.orders))
+		}
+		if len(uow.committed.orderItems) != 2 {
+			t.Errorf("expected 2 order items, got %d", len(uow.committed.orderItems))
+		} else if uow.committed.orderItems[0].Total != money("20") || uow.committed.orderItems[1].Total != money("10") {
+			t.Errorf("unexpected order item totals %v and %v", uow.committed.orderItems[0].Total, uow.committed.orderItems[1].Total)
+		}
+		if len(uow.committed.payments) != 1 {
+			t.Fatalf("expected 1 payment, got %d", len(uow.committed.payments))
+		}
+		payment := uow.committed.payments[0]
+		if payment.OrderID != 1 || payment.Amount != money("30") || payment.Status != domain.PaymentStatusAuthorized {
+			t.Errorf("unexpected payment %+v", payment)
+		}
+		if status := handler.payments.(*gateway.FakeProvider).Status(payment.Reference); status != domain.PaymentStatusCaptured {
+			t.Errorf("expected the payment to be captured at the provider, got %q", status)
+		}
+	})
+
+	t.Run("should reject products that are no longer in the catalog", func(t *testing.T) {
+		uow := &mockUnitOfWork{committed: mockState{stock: map[int]int{1: 10, 2: 5}}}
+		// deleted products are not returned by GetProductByIDs
+		products := &mockProductStore{products: []domain.Product{
+			{ID: 1, Name: "Product 1", Price: money("10"), Quantity: 10},
+		}}
+		handler := newCartHandler(uow, products, &mockUserStore{}, &mockAddressStore{})
+
+		_, err := handler.createOrder(priceCheckout(t, handler, items))
+		if err == nil {
+			t.Fatal("expected an error")
+		}
+		if len(uow.committed.orders) != 0 {
+			t.Errorf("expected no orders, got %d", len(uow.committed.orders))
+		}
+	})
+
+	t.Run("should not sell stock reserved by another checkout", func(t *testing.T) {
+		uow := &mockUnitOfWork{committed: mockState{stock: map[int]int{1: 10, 2: 5}}}
+		products := newProductStore()
+		uow.committed.reservations = map[int]domain.StockReservation{1: {ID: 1, ProductID: 2, Quantity: 3}}
+		uow.committed.lastReservation = 1
+		handler := newCartHandler(uow, products, &mockUserStore{}, &mockAddressStore{})
+		payments := &recordingPayments{FakeProvider: handler.payments.(*gateway.FakeProvider)}
+		handler.payments = payments
+
+		_, err := handler.createOrder(priceCheckout(t, handler, items))
+		if !errors.Is(err, domain.ErrInsufficientStock) {
+			t.Fatalf("expected ErrInsufficientStock, got %v", err)
+		}
+
+		if len(payments.references) != 0 {
+			t.Errorf("expected no authorization, got %d", len(payments.references))
+		}
+		if len(uow.committed.reservations) != 1 || len(uow.committed.orders) != 0 {
+			t.Errorf("expected only the other checkout's reservation, got %v", uow.committed.reservations)
+		}
+	})
+
+	t.Run("should place nothing when the reservations expired during payment", func(t *testing.T) {
+		uow := &mockUnitOfWork{committed: mockState{stock: map[int]int{1: 10, 2: 5}}}
+		products := newProductStore()
+		handler := newCartHandler(uow, products, &mockUserStore{}, &mockAddressStore{})
+		payments := &sweepingPayments{recordingPayments: recordingPayments{FakeProvider: handler.payments.(*gateway.FakeProvider)}, uow: uow}
+		handler.payments = payments
+
+		_, err := handler.createOrder(priceCheckout(t, handler, items))
+		if !errors.Is(err, domain.ErrReservationNotFound) {
+			t.Fatalf("expected ErrReservationNotFound, got %v", err)
+		}
+
+		if uow.committed.stock[1] != 10 || uow.committed.stock[2] != 5 || len(uow.committed.orders) != 0 {
+			t.Errorf("expected stock and orders to be untouched")
+		}
+		if status := payments.Status(payments.references[0]); status != domain.PaymentStatusVoided {
+			t.Errorf("expected the authorization to be voided, got %q", status)
+		}
+	})
+
+	failures := []struct {
+		name   string
+		inject func(uow *mockUnitOfWork)
+	}{
+		{"first reservation conversion", func(uow *mockUnitOfWork) { uow.failConversion = 1 }},
+		{"second reservation conversion", func(uow *mockUnitOfWork) { uow.failConversion = 2 }},
+		{"order creation", func(uow *mockUnitOfWork) { uow.failCreateOrder = true }},
+		{"first order item", func(uow *mockUnitOfWork) { uow.failOrderItem = 1 }},
+		{"second order item", func(uow *mockUnitOfWork) { uow.failOrderItem = 2 }},
+	}
+
+	for _, failure := range failures {
+		t.Run("should persist nothing when "+failure.name+" fails", func(t *testing.T) {
+			uow := &mockUnitOfWork{committed: mockState{stock: map[int]int{1: 10, 2: 5}}}
+			products := newProductStore()
+			failure.inject(uow)
+			handler := newCartHandler(uow, products, &mockUserStore{}, &mockAddressStore{})
+			payments := &recordingPayments{FakeProvider: handler.payments.(*gateway.FakeProvider)}
+			handler.payments = payments
+
+			_, err := handler.createOrder(priceCheckout(t, handler, items))
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+
+			if uow.committed.stock[1] != 10 || uow.committed.stock[2] != 5 {
+				t.Errorf("expected stock to be untouched, got %v", uow.committed.stock)
+			}
+			if len(uow.committed.reservations) != 0 {
+				t.Errorf("expected the reservations to be released, got %v", uow.committed.reservations)
+			}
+			if len(uow.committed.orders) != 0 {
+				t.Errorf("expected no orders, got %d", len(uow.committed.orders))
+			}
+			if len(uow.committed.orderItems) != 0 {
+				t.Errorf("expected no order items, got %d", len(uow.committed.orderItems))
+			}
+			if len(uow.committed.payments) != 0 {
+				t.Errorf("expected no payments, got %d", len(uow.committed.payments))
+			}
+			if status := payments.Status(payments.references[0]); status != domain.PaymentStatusVoided {
+				t.Errorf("expected the authorization to be voided, got %q", status)
+			}
+		})
+	}
+}
+
+func TestSplitLine(t *testing.T) {
+	line := domain.QuoteLine{
+		ProductID: 1,
+		Quantity:  3,
+		UnitPrice: money("10"),
+		LineTotal: money("30"),
+		Discount:  money("1"),
+		Taxes:     []domain.TaxLine{{Name: "VAT", Rate: 1000, Amount: money("2.90")}},
+	}
+	reservations := []domain.StockReservation{
+		{ID: 1, ProductID: 1, WarehouseID: 1, Quantity: 2},
+		{ID: 2, ProductID: 1, WarehouseID: 2, Quantity: 1},
+	}
+
+	items := splitLine(7, line, reservations, false)
+	if len(items) != 2 {
+		t.Fatalf("expected 2 order items, got %d", len(items))
+	}
+
+	// 31.90 charged and 2.90 of tax, shared out 2 to 1
+	expected := []struct {
+		warehouseID, quantity int
+		total, tax            string
+	}{
+		{1, 2, "21.27", "1.94"},
+		{2, 1, "10.63", "0.96"},
+	}
+	for i, want := range expected {
+		item := items[i]
+		if item.OrderID != 7 || item.WarehouseID != want.warehouseID || item.Quantity != want.quantity || item.Price != money("10") {
+			t.Errorf("unexpected order item %+v", item)
+		}
+		if item.Total != money(want.total) || item.Taxes[0].Amount != money(want.tax) || item.Taxes[0].Name != "VAT" {
+			t.Errorf("expected total %s and tax %s, got %v and %v", want.total, want.tax, item.Total, item.Taxes[0].Amount)
+		}
+	}
+	if line.Taxes[0].Amount != money("2.90") {
+		t.Errorf("expected the quote line to be left alone, got %v", line.Taxes[0].Amount)
+	}
+}
@@ -0,0 +1,173 @@
+package cart
+
+import (
+	"ecom/domain"
+	"ecom/utils"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// volumetricDivisor turns a package volume in mm³ into its billable weight
+// in grams, the usual 5000 cm³ per kilogram of couriers.
+const volumetricDivisor = 5000
+
+func (h *Handler) handleGetShippingOptions(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	var payload domain.CartCheckoutPayload
+	if value := query.Get("addressId"); value != "" {
+		addressID, err := strconv.Atoi(value)
+		if err != nil {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid address ID"))
+			return
+		}
+		payload.AddressID = &addressID
+	}
+
+	c, ok := h.newCheckout(w, r, payload)
+	if !ok {
+		return
+	}
+
+	// estimate for an address that isn't saved, e.g. one typed in by a guest
+	if country := query.Get("country"); country != "" && payload.AddressID == nil {
+		c.shipping = domain.Address{
+			Country:    strings.ToUpper(country),
+			Region:     query.Get("region"),
+			PostalCode: query.Get("postalCode"),
+		}
+	}
+
+	quote, err := h.quote(c)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	options, err := h.shippingOptions(c, quote)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, options)
+}
+
+// applyShipping prices the chosen shipping method, or the cheapest one when
+// the customer didn't pick any. It runs after the promotions so free
+// shipping codes and free-over thresholds see the discounted subtotal.
+func (h *Handler) applyShipping(c *checkout, quote *domain.Quote) error {
+	options, err := h.shippingOptions(c, quote)
+	if err != nil {
+		return err
+	}
+
+	var chosen *domain.ShippingOption
+	for i := range options {
+		if c.shippingMethodID != nil {
+			if options[i].MethodID == *c.shippingMethodID {
+				chosen = &options[i]
+			}
+		} else if chosen == nil || options[i].Cost.Cmp(chosen.Cost) < 0 {
+			chosen = &options[i]
+		}
+	}
+	if chosen == nil {
+		if c.shippingMethodID != nil {
+			return fmt.Errorf("%w: method %d doesn't deliver this cart to the address", domain.ErrShippingUnavailable, *c.shippingMethodID)
+		}
+		// leaves the quote without a method, so it can't be ordered
+		return nil
+	}
+
+	quote.ShippingMethod = chosen
+	quote.Shipping = chosen.Cost
+	for i := range quote.Promotions {
+		if quote.Promotions[i].FreeShipping {
+			quote.Promotions[i].Discount = quote.Shipping
+			quote.Shipping = domain.Money{}
+		}
+	}
+
+	return nil
+}
+
+// shippingOptions prices every method that can deliver the cart to the
+// shipping address, cheapest first.
+func (h *Handler) shippingOptions(c *checkout, quote *domain.Quote) ([]domain.ShippingOption, error) {
+	methods, err := h.shippingStore.GetShippingMethods(c.shipping.Country, c.shipping.Region)
+	if err != nil {
+		return nil, err
+	}
+
+	weight := cartWeight(c)
+	subtotal := quote.Subtotal.Sub(quote.Discount)
+
+	options := make([]domain.ShippingOption, 0, len(*methods))
+	for _, method := range *methods {
+		cost, ok := shippingCost(method, weight, subtotal)
+		if !ok {
+			continue
+		}
+		options = append(options, domain.ShippingOption{
+			MethodID: method.ID,
+			Name:     method.Name,
+			Type:     method.Type,
+			Cost:     cost,
+		})
+	}
+
+	sort.SliceStable(options, func(i, j int) bool {
+		return options[i].Cost.Cmp(options[j].Cost) < 0
+	})
+
+	return options, nil
+}
+
+// cartWeight is the billable weight of the cart in grams. Each product
+// counts with its actual or its volumetric weight, whichever is higher.
+func cartWeight(c *checkout) int {
+	weight := 0
+	for _, item := range c.items {
+		product, exists := c.products[item.ProductID]
+		if !exists {
+			continue
+		}
+
+		unit := product.Weight
+		if volumetric := product.Length * product.Width * product.Height / volumetricDivisor; volumetric > unit {
+			unit = volumetric
+		}
+		weight += unit * item.Quantity
+	}
+	return weight
+}
+
+// shippingCost prices the method for a cart of the given weight and
+// subtotal, reporting false when the method can't carry it.
+func shippingCost(method domain.ShippingMethod, weight int, subtotal domain.Money) (domain.Money, bool) {
+	if method.MaxWeight > 0 && weight > method.MaxWeight {
+		return domain.Money{}, false
+	}
+
+	switch method.Type {
+	case domain.ShippingFlatRate:
+		return method.Rate, true
+	case domain.ShippingWeightBased:
+		// every started kilogram is charged
+		kilograms := (weight + 999) / 1000
+		return method.Rate.Add(method.PerKg.Mul(kilograms)), true
+	case domain.ShippingFreeOver:
+		if !method.FreeOver.IsZero() && subtotal.Cmp(method.FreeOver) >= 0 {
+			return domain.NewMoney(0, method.Rate.Currency), true
+		}
+		return method.Rate, true
+	case domain.ShippingLocalPickup:
+		return domain.NewMoney(0, method.Rate.Currency), true
+	}
+
+	return domain.Money{}, false
+}
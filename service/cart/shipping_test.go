@@ -0,0 +1,248 @@
+package cart
+
+import (
+	"ecom/config"
+	"ecom/domain"
+	"encoding/json"
+	"net/http"
+	"testing"
+)
+
+func TestShippingCost(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   domain.ShippingMethod
+		weight   int
+		subtotal string
+		cost     string // empty when the method can't be used
+	}{
+		{name: "flat rate", method: domain.ShippingMethod{Type: domain.ShippingFlatRate, Rate: money("4.99")}, weight: 12000, subtotal: "10", cost: "4.99"},
+		{name: "weight based", method: domain.ShippingMethod{Type: domain.ShippingWeightBased, Rate: money("2"), PerKg: money("1.5")}, weight: 2100, subtotal: "10", cost: "6.50"},
+		{name: "weight based under a kilogram", method: domain.ShippingMethod{Type: domain.ShippingWeightBased, Rate: money("2"), PerKg: money("1.5")}, weight: 1, subtotal: "10", cost: "3.50"},
+		{name: "below the free threshold", method: domain.ShippingMethod{Type: domain.ShippingFreeOver, Rate: money("7"), FreeOver: money("50")}, subtotal: "49.99", cost: "7"},
+		{name: "at the free threshold", method: domain.ShippingMethod{Type: domain.ShippingFreeOver, Rate: money("7"), FreeOver: money("50")}, subtotal: "50", cost: "0"},
+		{name: "local pickup", method: domain.ShippingMethod{Type: domain.ShippingLocalPickup}, weight: 50000, subtotal: "10", cost: "0"},
+		{name: "too heavy", method: domain.ShippingMethod{Type: domain.ShippingFlatRate, Rate: money("5"), MaxWeight: 1000}, weight: 1001, subtotal: "10"},
+		{name: "unknown type", method: domain.ShippingMethod{Type: "teleport"}, subtotal: "10"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cost, ok := shippingCost(test.method, test.weight, money(test.subtotal))
+
+			if test.cost == "" {
+				if ok {
+					t.Errorf("expected the method to be unavailable, got %v", cost)
+				}
+				return
+			}
+			if !ok || cost.Cmp(money(test.cost)) != 0 {
+				t.Errorf("expected %s, got %v (%v)", test.cost, cost, ok)
+			}
+		})
+	}
+}
+
+func TestCartWeight(t *testing.T) {
+	c := &checkout{
+		items: []domain.CartItem{{ProductID: 1, Quantity: 2}, {ProductID: 2, Quantity: 1}},
+		products: map[int]domain.Product{
+			1: {ID: 1, Weight: 300, Length: 100, Width: 100, Height: 100}, // 200g volumetric, 300g actual
+			2: {ID: 2, Weight: 100, Length: 500, Width: 400, Height: 100}, // 4000g volumetric
+		},
+	}
+
+	if weight := cartWeight(c); weight != 4600 {
+		t.Errorf("expected 4600g, got %d", weight)
+	}
+}
+
+// newParcelStore returns the one product the shipping tests send, a 1.5kg
+// parcel at 10.00.
+func newParcelStore() *mockProductStore {
+	return &mockProductStore{products: []domain.Product{{ID: 1, Name: "Product 1", Price: money("10"), Quantity: 10, Weight: 1500}}}
+}
+
+func TestHandleGetShippingOptions(t *testing.T) {
+	cart := map[string][]domain.CartItem{"cart-user-1": {{ProductID: 1, Quantity: 2}}}
+	usZone := 1
+	methods := []domain.ShippingMethod{
+		{ID: 1, ZoneID: &usZone, Name: "Ground", Type: domain.ShippingFlatRate, Rate: money("5"), Active: true},
+		{ID: 2, ZoneID: &usZone, Name: "By weight", Type: domain.ShippingWeightBased, Rate: money("1"), PerKg: money("1"), Active: true},
+		{ID: 3, Name: "International", Type: domain.ShippingFreeOver, Rate: money("20"), FreeOver: money("100"), Active: true},
+	}
+	addresses := []domain.Address{
+		{ID: 1, UserID: "user-1", Line1: "1 Main St", City: "Austin", Region: "TX", PostalCode: "78701", Country: "US", IsDefault: true},
+		{ID: 2, UserID: "user-1", Line1: "Unter den Linden 1", City: "Berlin", PostalCode: "10117", Country: "DE"},
+	}
+
+	tests := []struct {
+		name    string
+		url     string
+		methods []int
+		costs   []string
+	}{
+		// 3.0kg by weight is 4.00, cheaper than the 5.00 flat rate
+		{name: "default address", url: "/shipping-options", methods: []int{2, 1, 3}, costs: []string{"4", "5", "20"}},
+		{name: "saved address", url: "/shipping-options?addressId=2", methods: []int{3}, costs: []string{"20"}},
+		{name: "estimate for another country", url: "/shipping-options?country=fr", methods: []int{3}, costs: []string{"20"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			uow := &mockUnitOfWork{committed: mockState{cartItems: cart}}
+			products := newParcelStore()
+			handler := newCartHandler(uow, products, &mockUserStore{}, &mockAddressStore{addresses: addresses})
+			handler.shippingStore = &mockShippingStore{methods: methods, zones: map[int][]string{usZone: {"US"}}}
+
+			rr := serveCartRequest(handler, newCartRequest(t, http.MethodGet, test.url, ""))
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+			}
+
+			var options []domain.ShippingOption
+			if err := json.NewDecoder(rr.Body).Decode(&options); err != nil {
+				t.Fatal(err)
+			}
+			if len(options) != len(test.methods) {
+				t.Fatalf("expected %d options, got %+v", len(test.methods), options)
+			}
+			for i, option := range options {
+				if option.MethodID != test.methods[i] || option.Cost.Cmp(money(test.costs[i])) != 0 {
+					t.Errorf("expected method %d at %s, got %+v", test.methods[i], test.costs[i], option)
+				}
+			}
+		})
+	}
+}
+
+func TestCheckoutShipping(t *testing.T) {
+	previous := config.ENV.RequireEmailVerification
+	config.ENV.RequireEmailVerification = false
+	t.Cleanup(func() { config.ENV.RequireEmailVerification = previous })
+
+	items := []domain.CartItem{{ProductID: 1, Quantity: 2}}
+	methodID := func(id int) *int { return &id }
+	usZone := 1
+	methods := []domain.ShippingMethod{
+		{ID: 1, ZoneID: &usZone, Name: "Ground", Type: domain.ShippingFlatRate, Rate: money("5"), Active: true},
+		{ID: 2, ZoneID: &usZone, Name: "By weight", Type: domain.ShippingWeightBased, Rate: money("1"), PerKg: money("1"), Active: true},
+		{ID: 3, Name: "International", Type: domain.ShippingFreeOver, Rate: money("20"), FreeOver: money("100"), Active: true},
+	}
+	addresses := []domain.Address{
+		{ID: 1, UserID: "user-1", Line1: "1 Main St", City: "Austin", Region: "TX", PostalCode: "78701", Country: "US", IsDefault: true},
+		{ID: 2, UserID: "user-1", Line1: "Unter den Linden 1", City: "Berlin", PostalCode: "10117", Country: "DE"},
+	}
+
+	t.Run("should store the chosen method and add its cost", func(t *testing.T) {
+		uow := &mockUnitOfWork{committed: mockState{stock: map[int]int{1: 10}}}
+		products := newParcelStore()
+		handler := newCartHandler(uow, products, &mockUserStore{}, &mockAddressStore{addresses: addresses})
+		handler.shippingStore = &mockShippingStore{methods: methods, zones: map[int][]string{usZone: {"US"}}}
+
+		rr := serveCartRequest(handler, newCheckoutRequest(t, "user-1", domain.CartCheckoutPayload{Items: items, ShippingMethodID: methodID(1)}))
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status code %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+		}
+
+		order := uow.committed.orders[0]
+		if *order.ShippingMethodID != 1 || order.ShippingMethod != "Ground" || order.Shipping != money("5") {
+			t.Errorf("unexpected shipping on the order: %+v", order)
+		}
+		if order.Total != money("25") {
+			t.Errorf("expected total 25, got %v", order.Total)
+		}
+	})
+
+	t.Run("should default to the cheapest method", func(t *testing.T) {
+		uow := &mockUnitOfWork{committed: mockState{stock: map[int]int{1: 10}}}
+		products := newParcelStore()
+		handler := newCartHandler(uow, products, &mockUserStore{}, &mockAddressStore{addresses: addresses})
+		handler.shippingStore = &mockShippingStore{methods: methods, zones: map[int][]string{usZone: {"US"}}}
+
+		rr := serveCartRequest(handler, newCheckoutRequest(t, "user-1", domain.CartCheckoutPayload{Items: items}))
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status code %d, got %d", http.StatusCreated, rr.Code)
+		}
+		if order := uow.committed.orders[0]; *order.ShippingMethodID != 2 || order.Total != money("24") {
+			t.Errorf("expected weight based shipping, got %+v", order)
+		}
+	})
+
+	t.Run("should waive the cost for free shipping codes", func(t *testing.T) {
+		uow := &mockUnitOfWork{committed: mockState{
+			stock:      map[int]int{1: 10},
+			promotions: []domain.Promotion{{ID: 1, Code: "SHIPFREE", Type: domain.PromotionFreeShipping, Active: true}},
+		}}
+		products := newParcelStore()
+		handler := newCartHandler(uow, products, &mockUserStore{}, &mockAddressStore{addresses: addresses})
+		handler.shippingStore = &mockShippingStore{methods: methods, zones: map[int][]string{usZone: {"US"}}}
+
+		payload := domain.CartCheckoutPayload{Items: items, ShippingMethodID: methodID(1), PromotionCodes: []string{"SHIPFREE"}}
+		rr := serveCartRequest(handler, newCheckoutRequest(t, "user-1", payload))
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status code %d, got %d", http.StatusCreated, rr.Code)
+		}
+		if order := uow.committed.orders[0]; !order.Shipping.IsZero() || order.Total != money("20") {
+			t.Errorf("expected free shipping, got %+v", order)
+		}
+		if redemption := uow.committed.redemptions[0]; redemption.Discount != money("5") {
+			t.Errorf("expected the waived cost to be recorded, got %v", redemption.Discount)
+		}
+	})
+
+	t.Run("should return 400 for a method that doesn't deliver to the address", func(t *testing.T) {
+		uow := &mockUnitOfWork{committed: mockState{stock: map[int]int{1: 10}}}
+		products := newParcelStore()
+		handler := newCartHandler(uow, products, &mockUserStore{}, &mockAddressStore{addresses: addresses})
+		handler.shippingStore = &mockShippingStore{methods: methods, zones: map[int][]string{usZone: {"US"}}}
+
+		payload := domain.CartCheckoutPayload{Items: items, AddressID: methodID(2), ShippingMethodID: methodID(1)}
+		rr := serveCartRequest(handler, newCheckoutRequest(t, "user-1", payload))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+		if len(uow.committed.orders) != 0 {
+			t.Errorf("expected no orders, got %d", len(uow.committed.orders))
+		}
+	})
+
+	t.Run("should return 409 when nothing delivers to the address", func(t *testing.T) {
+		uow := &mockUnitOfWork{committed: mockState{stock: map[int]int{1: 10}}}
+		products := newParcelStore()
+		handler := newCartHandler(uow, products, &mockUserStore{}, &mockAddressStore{addresses: addresses})
+		handler.shippingStore = &mockShippingStore{methods: []domain.ShippingMethod{}}
+
+		rr := serveCartRequest(handler, newCheckoutRequest(t, "user-1", domain.CartCheckoutPayload{Items: items}))
+		if rr.Code != http.StatusConflict {
+			t.Errorf("expected status code %d, got %d", http.StatusConflict, rr.Code)
+		}
+		if len(uow.committed.orders) != 0 {
+			t.Errorf("expected no orders, got %d", len(uow.committed.orders))
+		}
+	})
+
+	t.Run("should check out anywhere with the default method of a fresh install", func(t *testing.T) {
+		uow := &mockUnitOfWork{committed: mockState{stock: map[int]int{1: 10}}}
+		products := newParcelStore()
+		handler := newCartHandler(uow, products, &mockUserStore{}, &mockAddressStore{addresses: addresses})
+		handler.shippingStore = &mockShippingStore{methods: []domain.ShippingMethod{
+			// the only method the add-default-shipping-method migration leaves
+			// on an install without any
+			{ID: 1, Name: "Standard shipping", Type: domain.ShippingFlatRate, Active: true},
+		}}
+
+		for _, addressID := range []int{1, 2} {
+			payload := domain.CartCheckoutPayload{Items: []domain.CartItem{{ProductID: 1, Quantity: 1}}, AddressID: methodID(addressID)}
+			rr := serveCartRequest(handler, newCheckoutRequest(t, "user-1", payload))
+			if rr.Code != http.StatusCreated {
+				t.Fatalf("expected status code %d for address %d, got %d: %s", http.StatusCreated, addressID, rr.Code, rr.Body.String())
+			}
+		}
+		for _, order := range uow.committed.orders {
+			if order.ShippingMethod != "Standard shipping" || !order.Shipping.IsZero() || order.Total != money("10") {
+				t.Errorf("expected free standard shipping, got %+v", order)
+			}
+		}
+	})
+}
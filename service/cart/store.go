@@ -0,0 +1,160 @@
+package cart
+
+import (
+	"database/sql"
+	"ecom/db"
+	"ecom/domain"
+	"errors"
+	"github.com/google/uuid"
+	"time"
+)
+
+type Store struct {
+	db db.Querier
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+// WithTx returns a store whose queries run inside tx.
+func (s *Store) WithTx(tx *sql.Tx) *Store {
+	return &Store{db: tx}
+}
+
+// GetOrCreateCart returns the user's cart, creating an empty one on first use.
+func (s *Store) GetOrCreateCart(userID string) (*domain.Cart, error) {
+	_, err := s.db.Exec("INSERT IGNORE INTO carts (id, userId) VALUES (?, ?)", uuid.New().String(), userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanCart(s.db.QueryRow("SELECT id, COALESCE(userId, ''), createdAt FROM carts WHERE userId = ?", userID))
+}
+
+func scanCart(row *sql.Row) (*domain.Cart, error) {
+	cart := new(domain.Cart)
+	err := row.Scan(
+		&cart.ID,
+		&cart.UserID,
+		&cart.CreatedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrCartNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return cart, nil
+}
+
+func (s *Store) CreateGuestCart(tokenHash string, expiresAt time.Time) (*domain.Cart, error) {
+	cart := &domain.Cart{ID: uuid.New().String(), CreatedAt: time.Now()}
+	_, err := s.db.Exec("INSERT INTO carts (id, tokenHash, expiresAt) VALUES (?, ?, ?)", cart.ID, tokenHash, expiresAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return cart, nil
+}
+
+// GetGuestCart returns the guest cart for the token hash. Expired carts are
+// reported as not found.
+func (s *Store) GetGuestCart(tokenHash string) (*domain.Cart, error) {
+	return scanCart(s.db.QueryRow("SELECT id, COALESCE(userId, ''), createdAt FROM carts WHERE tokenHash = ? AND userId IS NULL AND expiresAt > NOW()", tokenHash))
+}
+
+func (s *Store) DeleteCart(cartID string) error {
+	_, err := s.db.Exec("DELETE FROM carts WHERE id = ?", cartID)
+	return err
+}
+
+func (s *Store) GetCartItems(cartID string) (*[]domain.CartItem, error) {
+	rows, err := s.db.Query("SELECT productId, quantity FROM cart_items WHERE cartId = ? ORDER BY productId", cartID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]domain.CartItem, 0)
+	for rows.Next() {
+		var item domain.CartItem
+		if err := rows.Scan(&item.ProductID, &item.Quantity); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return &items, rows.Err()
+}
+
+func (s *Store) GetCartLines(cartID string) (*[]domain.CartLine, error) {
+	rows, err := s.db.Query(`
+		SELECT ci.productId, ci.quantity, p.name, p.price, COALESCE(ps.available, 0), ci.updatedAt
+		FROM cart_items ci
+		JOIN products p ON p.id = ci.productId
+		LEFT JOIN (
+			SELECT s.product_id, SUM(s.quantity) - SUM(s.reserved) AS available
+			FROM product_stock s
+			JOIN warehouses w ON w.id = s.warehouse_id
+			WHERE w.active
+			GROUP BY s.product_id
+		) ps ON ps.product_id = ci.productId
+		WHERE ci.cartId = ?
+		ORDER BY ci.productId
+	`, cartID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lines := make([]domain.CartLine, 0)
+	for rows.Next() {
+		var line domain.CartLine
+		err := rows.Scan(
+			&line.ProductID,
+			&line.Quantity,
+			&line.ProductName,
+			&line.Price,
+			&line.Available,
+			&line.UpdatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+
+	return &lines, rows.Err()
+}
+
+// SetCartItem adds the product to the cart or replaces its quantity.
+func (s *Store) SetCartItem(cartID string, productID, quantity int) error {
+	_, err := s.db.Exec(`
+		INSERT INTO cart_items (cartId, productId, quantity) VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE quantity = VALUES(quantity)
+	`, cartID, productID, quantity)
+	return err
+}
+
+func (s *Store) RemoveCartItem(cartID string, productID int) error {
+	result, err := s.db.Exec("DELETE FROM cart_items WHERE cartId = ? AND productId = ?", cartID, productID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrCartItemNotFound
+	}
+
+	return nil
+}
+
+func (s *Store) ClearCart(cartID string) error {
+	_, err := s.db.Exec("DELETE FROM cart_items WHERE cartId = ?", cartID)
+	return err
+}
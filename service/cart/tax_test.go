@@ -0,0 +1,90 @@
+package cart
+
+import (
+	"ecom/config"
+	"ecom/domain"
+	"ecom/service/tax"
+	"net/http"
+	"testing"
+)
+
+func TestCheckoutTax(t *testing.T) {
+	previous := config.ENV.RequireEmailVerification
+	config.ENV.RequireEmailVerification = false
+	t.Cleanup(func() { config.ENV.RequireEmailVerification = previous })
+
+	rates := &mockTaxRates{rates: []domain.TaxRate{
+		{Country: "US", Region: "CA", TaxClass: domain.TaxClassStandard, Name: "CA", Rate: 1000},
+		{Country: "US", Region: "CA", TaxClass: "exempt", Name: "CA exempt", Rate: 0},
+	}}
+	addresses := &mockAddressStore{addresses: []domain.Address{
+		{ID: 1, UserID: "user-1", Line1: "1 Main St", City: "Sacramento", Region: "CA", PostalCode: "95814", Country: "US", IsDefault: true},
+	}}
+	payload := domain.CartCheckoutPayload{
+		Items:          []domain.CartItem{{ProductID: 1, Quantity: 3}, {ProductID: 2, Quantity: 4}},
+		PromotionCodes: []string{"TENOFF"},
+	}
+	tenOff := domain.Promotion{ID: 1, Code: "TENOFF", Type: domain.PromotionFixedAmount, AmountOff: money("10"), Active: true}
+
+	t.Run("should tax each item after its share of the discount", func(t *testing.T) {
+		uow := &mockUnitOfWork{committed: mockState{stock: map[int]int{1: 10, 2: 5}}}
+		products := newProductStore()
+		uow.committed.promotions = []domain.Promotion{tenOff}
+		handler := newCartHandler(uow, products, &mockUserStore{}, addresses)
+		handler.tax = tax.NewTableCalculator(rates, false)
+
+		rr := serveCartRequest(handler, newCheckoutRequest(t, "user-1", payload))
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status code %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+		}
+
+		// 30.00 and 10.00 less 7.50 and 2.50 of the discount, taxed at 10%
+		order := uow.committed.orders[0]
+		if order.Tax != money("3") || order.Total != money("33") {
+			t.Errorf("expected tax 3 and total 33, got %v and %v", order.Tax, order.Total)
+		}
+		items := uow.committed.orderItems
+		if len(items[0].Taxes) != 1 || items[0].Taxes[0].Amount != money("2.25") || items[1].Taxes[0].Amount != money("0.75") {
+			t.Errorf("unexpected item taxes %+v", items)
+		}
+		if items[0].Total != money("24.75") || items[1].Total != money("8.25") {
+			t.Errorf("expected item totals with discount and tax of 24.75 and 8.25, got %v and %v", items[0].Total, items[1].Total)
+		}
+	})
+
+	t.Run("should skip exempt products", func(t *testing.T) {
+		uow := &mockUnitOfWork{committed: mockState{stock: map[int]int{1: 10, 2: 5}}}
+		products := &mockProductStore{products: []domain.Product{
+			{ID: 1, Name: "Product 1", Price: money("10"), Quantity: 10},
+			{ID: 2, Name: "Product 2", Price: money("2.5"), Quantity: 5, TaxClass: "exempt"},
+		}}
+		handler := newCartHandler(uow, products, &mockUserStore{}, addresses)
+		handler.tax = tax.NewTableCalculator(rates, false)
+
+		rr := serveCartRequest(handler, newCheckoutRequest(t, "user-1", domain.CartCheckoutPayload{Items: payload.Items}))
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status code %d, got %d", http.StatusCreated, rr.Code)
+		}
+		if order := uow.committed.orders[0]; order.Tax != money("3") || order.Total != money("43") {
+			t.Errorf("expected tax 3 and total 43, got %v and %v", order.Tax, order.Total)
+		}
+		if items := uow.committed.orderItems; len(items[1].Taxes) != 0 {
+			t.Errorf("expected no tax on the exempt item, got %+v", items[1].Taxes)
+		}
+	})
+
+	t.Run("should not add included tax to the total", func(t *testing.T) {
+		uow := &mockUnitOfWork{committed: mockState{stock: map[int]int{1: 10}}}
+		products := &mockProductStore{products: []domain.Product{{ID: 1, Name: "Product 1", Price: money("10"), Quantity: 10}}}
+		handler := newCartHandler(uow, products, &mockUserStore{}, addresses)
+		handler.tax = tax.NewTableCalculator(rates, true)
+
+		rr := serveCartRequest(handler, newCartRequest(t, http.MethodPost, "/quote", `{"items":[{"productId":1,"quantity":10}]}`))
+		quote := decodeQuote(t, rr)
+
+		// 100.00 holds 100/1.1 = 9.0909 of tax
+		if !quote.TaxIncluded || quote.Tax != money("9.09") || quote.Total != money("100") {
+			t.Errorf("expected 9.09 of included tax in a 100 total, got %+v", quote)
+		}
+	})
+}
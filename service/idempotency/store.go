@@ -0,0 +1,75 @@
+package idempotency
+
+import (
+	"database/sql"
+	"ecom/domain"
+	"errors"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// errDuplicateEntry is the MySQL error number of an insert that hits a
+// unique key.
+const errDuplicateEntry = 1062
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) ReserveIdempotencyKey(record domain.IdempotencyRecord) (*domain.IdempotencyRecord, bool, error) {
+	// expired keys can be reused, so clear them out before claiming
+	_, err := s.db.Exec("DELETE FROM idempotency_keys WHERE userId = ? AND `key` = ? AND expiresAt <= NOW()",
+		record.UserID, record.Key)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// only a key that is already there means the key was taken, any other
+	// error is returned as is
+	_, err = s.db.Exec("INSERT INTO idempotency_keys (userId, `key`, requestHash, expiresAt) VALUES (?, ?, ?, ?)",
+		record.UserID, record.Key, record.RequestHash, record.ExpiresAt)
+	if err == nil {
+		return nil, true, nil
+	}
+	var mysqlErr *mysql.MySQLError
+	if !errors.As(err, &mysqlErr) || mysqlErr.Number != errDuplicateEntry {
+		return nil, false, err
+	}
+
+	row := s.db.QueryRow("SELECT userId, `key`, requestHash, statusCode, body, expiresAt, createdAt FROM idempotency_keys WHERE userId = ? AND `key` = ?",
+		record.UserID, record.Key)
+
+	existing := new(domain.IdempotencyRecord)
+	var statusCode sql.NullInt64
+	err = row.Scan(
+		&existing.UserID,
+		&existing.Key,
+		&existing.RequestHash,
+		&statusCode,
+		&existing.Body,
+		&existing.ExpiresAt,
+		&existing.CreatedAt,
+	)
+	if err != nil {
+		return nil, false, err
+	}
+	existing.StatusCode = int(statusCode.Int64)
+	existing.Completed = statusCode.Valid
+
+	return existing, false, nil
+}
+
+func (s *Store) CompleteIdempotencyKey(userID, key string, statusCode int, body []byte) error {
+	_, err := s.db.Exec("UPDATE idempotency_keys SET statusCode = ?, body = ? WHERE userId = ? AND `key` = ?",
+		statusCode, body, userID, key)
+	return err
+}
+
+func (s *Store) ReleaseIdempotencyKey(userID, key string) error {
+	_, err := s.db.Exec("DELETE FROM idempotency_keys WHERE userId = ? AND `key` = ?", userID, key)
+	return err
+}
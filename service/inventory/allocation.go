@@ -0,0 +1,151 @@
+package inventory
+
+import (
+	"ecom/domain"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+type stockKey struct {
+	productID   int
+	warehouseID int
+}
+
+// Allocate decides which warehouses fulfil the items with the strategy and
+// returns the allocations of every item at its index. Only active warehouses
+// are used; unknown strategies fall back to priority order. It returns
+// ErrInsufficientStock when the warehouses together can't cover an item.
+func Allocate(strategy string, address domain.Address, warehouses []domain.Warehouse, stock map[int][]domain.WarehouseStock, items []domain.CartItem) ([][]domain.StockAllocation, error) {
+	candidates := make([]domain.Warehouse, 0, len(warehouses))
+	for _, warehouse := range warehouses {
+		if warehouse.Active {
+			candidates = append(candidates, warehouse)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].Priority != candidates[j].Priority {
+			return candidates[i].Priority < candidates[j].Priority
+		}
+		return candidates[i].ID < candidates[j].ID
+	})
+
+	available := make(map[stockKey]int)
+	for productID, stocks := range stock {
+		for _, warehouseStock := range stocks {
+			available[stockKey{productID, warehouseStock.WarehouseID}] = warehouseStock.Available
+		}
+	}
+
+	switch strategy {
+	case domain.StockAllocationNearest:
+		// the sort is stable, so equally near warehouses stay in priority
+		// order
+		sort.SliceStable(candidates, func(i, j int) bool {
+			return distance(candidates[i], address) < distance(candidates[j], address)
+		})
+	case domain.StockAllocationSingleWarehouse:
+		return allocateFewest(candidates, available, items)
+	}
+	return allocateInOrder(candidates, available, items)
+}
+
+// distance ranks how far the warehouse is from the address without
+// geocoding either: 0 for the same postal area, 1 for the same region, 2 for
+// the same country and 3 for anywhere else.
+func distance(warehouse domain.Warehouse, address domain.Address) int {
+	if !strings.EqualFold(warehouse.Country, address.Country) {
+		return 3
+	}
+	if area := postalArea(address.PostalCode); area != "" && area == postalArea(warehouse.PostalCode) {
+		return 0
+	}
+	if address.Region != "" && strings.EqualFold(warehouse.Region, address.Region) {
+		return 1
+	}
+	return 2
+}
+
+// postalArea is the leading part of a postal code, which groups nearby codes
+// in most countries.
+func postalArea(postalCode string) string {
+	postalCode = strings.ToUpper(strings.ReplaceAll(postalCode, " ", ""))
+	if len(postalCode) < 3 {
+		return postalCode
+	}
+	return postalCode[:3]
+}
+
+// allocateInOrder fills every item from the warehouses in the given order.
+func allocateInOrder(warehouses []domain.Warehouse, available map[stockKey]int, items []domain.CartItem) ([][]domain.StockAllocation, error) {
+	allocations := make([][]domain.StockAllocation, len(items))
+	for i, item := range items {
+		remaining := item.Quantity
+		for _, warehouse := range warehouses {
+			if remaining == 0 {
+				break
+			}
+			key := stockKey{item.ProductID, warehouse.ID}
+			taken := min(remaining, available[key])
+			if taken <= 0 {
+				continue
+			}
+			available[key] -= taken
+			remaining -= taken
+			allocations[i] = append(allocations[i], domain.StockAllocation{ProductID: item.ProductID, WarehouseID: warehouse.ID, Quantity: taken})
+		}
+		if remaining > 0 {
+			return nil, fmt.Errorf("product %d: %w", item.ProductID, domain.ErrInsufficientStock)
+		}
+	}
+	return allocations, nil
+}
+
+// allocateFewest keeps the number of warehouses down by repeatedly taking
+// the one that covers the most of what is left. A warehouse holding the
+// whole order covers everything and ships it alone.
+func allocateFewest(warehouses []domain.Warehouse, available map[stockKey]int, items []domain.CartItem) ([][]domain.StockAllocation, error) {
+	remaining := make([]int, len(items))
+	for i, item := range items {
+		remaining[i] = item.Quantity
+	}
+
+	allocations := make([][]domain.StockAllocation, len(items))
+	candidates := append([]domain.Warehouse(nil), warehouses...)
+	for len(candidates) > 0 {
+		// ties go to the first candidate, the one with the best priority
+		best, bestUnits := -1, 0
+		for c, warehouse := range candidates {
+			units := 0
+			for i, item := range items {
+				units += min(remaining[i], available[stockKey{item.ProductID, warehouse.ID}])
+			}
+			if units > bestUnits {
+				best, bestUnits = c, units
+			}
+		}
+		if best < 0 {
+			break
+		}
+
+		warehouse := candidates[best]
+		for i, item := range items {
+			key := stockKey{item.ProductID, warehouse.ID}
+			taken := min(remaining[i], available[key])
+			if taken <= 0 {
+				continue
+			}
+			available[key] -= taken
+			remaining[i] -= taken
+			allocations[i] = append(allocations[i], domain.StockAllocation{ProductID: item.ProductID, WarehouseID: warehouse.ID, Quantity: taken})
+		}
+		candidates = append(candidates[:best], candidates[best+1:]...)
+	}
+
+	for i, item := range items {
+		if remaining[i] > 0 {
+			return nil, fmt.Errorf("product %d: %w", item.ProductID, domain.ErrInsufficientStock)
+		}
+	}
+	return allocations, nil
+}
@@ -0,0 +1,110 @@
+package inventory
+
+import (
+	"ecom/domain"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// three warehouses: east is preferred, west holds the most stock and south
+// is closed
+var testWarehouses = []domain.Warehouse{
+	{ID: 1, Code: "west", Country: "US", Region: "CA", PostalCode: "94105", Priority: 2, Active: true},
+	{ID: 2, Code: "east", Country: "US", Region: "NY", PostalCode: "10001", Priority: 1, Active: true},
+	{ID: 3, Code: "south", Country: "US", Region: "TX", PostalCode: "73301", Priority: 0, Active: false},
+}
+
+var testStock = map[int][]domain.WarehouseStock{
+	1: {{WarehouseID: 1, Available: 10}, {WarehouseID: 2, Available: 2}, {WarehouseID: 3, Available: 50}},
+	2: {{WarehouseID: 1, Available: 5}, {WarehouseID: 2, Available: 5}},
+}
+
+func TestAllocate(t *testing.T) {
+	items := []domain.CartItem{{ProductID: 1, Quantity: 3}, {ProductID: 2, Quantity: 1}}
+	california := domain.Address{Country: "US", Region: "CA", PostalCode: "94110"}
+
+	tests := []struct {
+		name     string
+		strategy string
+		address  domain.Address
+		expected [][]domain.StockAllocation
+	}{
+		{
+			name:     "priority fills from the preferred warehouse first",
+			strategy: domain.StockAllocationPriority,
+			address:  california,
+			expected: [][]domain.StockAllocation{
+				{{ProductID: 1, WarehouseID: 2, Quantity: 2}, {ProductID: 1, WarehouseID: 1, Quantity: 1}},
+				{{ProductID: 2, WarehouseID: 2, Quantity: 1}},
+			},
+		},
+		{
+			name:     "nearest fills from the warehouse in the postal area first",
+			strategy: domain.StockAllocationNearest,
+			address:  california,
+			expected: [][]domain.StockAllocation{
+				{{ProductID: 1, WarehouseID: 1, Quantity: 3}},
+				{{ProductID: 2, WarehouseID: 1, Quantity: 1}},
+			},
+		},
+		{
+			name:     "nearest falls back to priority for far away addresses",
+			strategy: domain.StockAllocationNearest,
+			address:  domain.Address{Country: "CA", PostalCode: "94105"},
+			expected: [][]domain.StockAllocation{
+				{{ProductID: 1, WarehouseID: 2, Quantity: 2}, {ProductID: 1, WarehouseID: 1, Quantity: 1}},
+				{{ProductID: 2, WarehouseID: 2, Quantity: 1}},
+			},
+		},
+		{
+			name:     "single warehouse prefers one that holds everything",
+			strategy: domain.StockAllocationSingleWarehouse,
+			address:  domain.Address{Country: "US", Region: "NY"},
+			expected: [][]domain.StockAllocation{
+				{{ProductID: 1, WarehouseID: 1, Quantity: 3}},
+				{{ProductID: 2, WarehouseID: 1, Quantity: 1}},
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			allocations, err := Allocate(tc.strategy, tc.address, testWarehouses, testStock, items)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(allocations, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, allocations)
+			}
+		})
+	}
+
+	t.Run("single warehouse splits only what no warehouse holds alone", func(t *testing.T) {
+		items := []domain.CartItem{{ProductID: 1, Quantity: 11}, {ProductID: 2, Quantity: 1}}
+
+		allocations, err := Allocate(domain.StockAllocationSingleWarehouse, california, testWarehouses, testStock, items)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := [][]domain.StockAllocation{
+			{{ProductID: 1, WarehouseID: 1, Quantity: 10}, {ProductID: 1, WarehouseID: 2, Quantity: 1}},
+			{{ProductID: 2, WarehouseID: 1, Quantity: 1}},
+		}
+		if !reflect.DeepEqual(allocations, expected) {
+			t.Errorf("expected %v, got %v", expected, allocations)
+		}
+	})
+
+	t.Run("should not allocate stock of inactive warehouses", func(t *testing.T) {
+		for _, strategy := range []string{domain.StockAllocationPriority, domain.StockAllocationNearest, domain.StockAllocationSingleWarehouse} {
+			items := []domain.CartItem{{ProductID: 1, Quantity: 13}}
+
+			_, err := Allocate(strategy, california, testWarehouses, testStock, items)
+			if !errors.Is(err, domain.ErrInsufficientStock) {
+				t.Errorf("%s: expected ErrInsufficientStock, got %v", strategy, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,170 @@
+package inventory
+
+import (
+	"database/sql"
+	"ecom/db"
+	"ecom/domain"
+	"errors"
+	"time"
+)
+
+type Store struct {
+	db *sql.DB
+	tx *sql.Tx
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+// WithTx returns a store bound to tx. Writes made through it are only
+// persisted once the caller commits tx.
+func (s *Store) WithTx(tx *sql.Tx) *Store {
+	return &Store{db: s.db, tx: tx}
+}
+
+func (s *Store) conn() db.Querier {
+	if s.tx != nil {
+		return s.tx
+	}
+	return s.db
+}
+
+// inTx runs fn in the bound transaction, or in a new one that is committed
+// when fn succeeds.
+func (s *Store) inTx(fn func(tx *sql.Tx) error) error {
+	if s.tx != nil {
+		return fn(s.tx)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (s *Store) CreateReservation(reservation domain.StockReservation) (int, error) {
+	var id int
+	err := s.inTx(func(tx *sql.Tx) error {
+		// the condition makes the check and the hold a single step, so two
+		// checkouts can't both take the last units
+		result, err := tx.Exec("UPDATE product_stock SET reserved = reserved + ? WHERE product_id = ? AND warehouse_id = ? AND quantity >= reserved + ?",
+			reservation.Quantity, reservation.ProductID, reservation.WarehouseID, reservation.Quantity)
+		if err != nil {
+			return err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return domain.ErrInsufficientStock
+		}
+
+		result, err = tx.Exec("INSERT INTO stock_reservations (productId, warehouseId, quantity, expiresAt) VALUES (?, ?, ?, ?)",
+			reservation.ProductID, reservation.WarehouseID, reservation.Quantity, reservation.ExpiresAt)
+		if err != nil {
+			return err
+		}
+		lastID, err := result.LastInsertId()
+		id = int(lastID)
+		return err
+	})
+	return id, err
+}
+
+func (s *Store) ConvertReservation(id int) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		reservation, err := takeReservation(tx, id)
+		if err != nil {
+			return err
+		}
+
+		result, err := tx.Exec("UPDATE product_stock SET quantity = quantity - ?, reserved = reserved - ? WHERE product_id = ? AND warehouse_id = ? AND quantity >= ?",
+			reservation.Quantity, reservation.Quantity, reservation.ProductID, reservation.WarehouseID, reservation.Quantity)
+		if err != nil {
+			return err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return domain.ErrInsufficientStock
+		}
+		return nil
+	})
+}
+
+func (s *Store) ReleaseReservation(id int) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		reservation, err := takeReservation(tx, id)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.Exec("UPDATE product_stock SET reserved = reserved - ? WHERE product_id = ? AND warehouse_id = ?",
+			reservation.Quantity, reservation.ProductID, reservation.WarehouseID)
+		return err
+	})
+}
+
+// takeReservation locks and deletes the reservation, so whichever of a
+// conversion and a release comes second finds it gone.
+func takeReservation(tx *sql.Tx, id int) (*domain.StockReservation, error) {
+	reservation := &domain.StockReservation{ID: id}
+	err := tx.QueryRow("SELECT productId, warehouseId, quantity FROM stock_reservations WHERE id = ? FOR UPDATE", id).
+		Scan(&reservation.ProductID, &reservation.WarehouseID, &reservation.Quantity)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrReservationNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec("DELETE FROM stock_reservations WHERE id = ?", id); err != nil {
+		return nil, err
+	}
+	return reservation, nil
+}
+
+// ReleaseExpiredReservations releases every reservation in a transaction of
+// its own, skipping the ones a checkout converted in the meantime.
+func (s *Store) ReleaseExpiredReservations(now time.Time) (int, error) {
+	rows, err := s.conn().Query("SELECT id FROM stock_reservations WHERE expiresAt < ?", now)
+	if err != nil {
+		return 0, err
+	}
+	ids := make([]int, 0)
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	released := 0
+	for _, id := range ids {
+		err := s.ReleaseReservation(id)
+		if errors.Is(err, domain.ErrReservationNotFound) {
+			continue
+		} else if err != nil {
+			return released, err
+		}
+		released++
+	}
+
+	return released, nil
+}
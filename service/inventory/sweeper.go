@@ -0,0 +1,53 @@
+package inventory
+
+import (
+	"context"
+	"ecom/domain"
+	"log"
+	"time"
+)
+
+// Sweeper gives the stock of abandoned checkouts back to sell by releasing
+// the reservations that expired.
+type Sweeper struct {
+	store    domain.ReservationRepository
+	interval time.Duration
+}
+
+// defaultSweepInterval replaces intervals a ticker can't run on.
+const defaultSweepInterval = time.Minute
+
+// NewSweeper returns a sweeper that runs every interval, or every minute when
+// interval isn't positive.
+func NewSweeper(store domain.ReservationRepository, interval time.Duration) *Sweeper {
+	if interval <= 0 {
+		log.Printf("reservation sweep: invalid interval %s, using %s", interval, defaultSweepInterval)
+		interval = defaultSweepInterval
+	}
+	return &Sweeper{store: store, interval: interval}
+}
+
+// Run sweeps every interval until ctx is done.
+func (s *Sweeper) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.Sweep(now)
+		}
+	}
+}
+
+// Sweep releases the reservations that expired before now. Failures are
+// logged and retried on the next sweep.
+func (s *Sweeper) Sweep(now time.Time) int {
+	released, err := s.store.ReleaseExpiredReservations(now)
+	if err != nil {
+		log.Println("reservation sweep:", err)
+	}
+	return released
+}
@@ -0,0 +1,104 @@
+package inventory
+
+import (
+	"context"
+	"ecom/domain"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type mockReservationStore struct {
+	mu           sync.Mutex
+	reservations []domain.StockReservation
+	err          error
+	sweeps       int
+}
+
+func (m *mockReservationStore) CreateReservation(reservation domain.StockReservation) (int, error) {
+	return 0, nil
+}
+
+func (m *mockReservationStore) ConvertReservation(id int) error {
+	return nil
+}
+
+func (m *mockReservationStore) ReleaseReservation(id int) error {
+	return nil
+}
+
+func (m *mockReservationStore) ReleaseExpiredReservations(now time.Time) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sweeps++
+	if m.err != nil {
+		return 0, m.err
+	}
+	kept := make([]domain.StockReservation, 0)
+	for _, reservation := range m.reservations {
+		if !reservation.ExpiresAt.Before(now) {
+			kept = append(kept, reservation)
+		}
+	}
+	released := len(m.reservations) - len(kept)
+	m.reservations = kept
+	return released, nil
+}
+
+func TestSweeper(t *testing.T) {
+	now := time.Now()
+
+	t.Run("should release only the expired reservations", func(t *testing.T) {
+		store := &mockReservationStore{reservations: []domain.StockReservation{
+			{ID: 1, ProductID: 1, Quantity: 2, ExpiresAt: now.Add(-time.Minute)},
+			{ID: 2, ProductID: 1, Quantity: 1, ExpiresAt: now.Add(time.Minute)},
+		}}
+
+		released := NewSweeper(store, time.Minute).Sweep(now)
+
+		if released != 1 {
+			t.Errorf("expected 1 released reservation, got %d", released)
+		}
+		if len(store.reservations) != 1 || store.reservations[0].ID != 2 {
+			t.Errorf("expected reservation 2 to be kept, got %+v", store.reservations)
+		}
+	})
+
+	t.Run("should fall back to the default interval", func(t *testing.T) {
+		for _, interval := range []time.Duration{0, -time.Second} {
+			if sweeper := NewSweeper(&mockReservationStore{}, interval); sweeper.interval != defaultSweepInterval {
+				t.Errorf("%s: expected %s, got %s", interval, defaultSweepInterval, sweeper.interval)
+			}
+		}
+	})
+
+	t.Run("should keep sweeping after a failure", func(t *testing.T) {
+		store := &mockReservationStore{err: errors.New("connection lost")}
+		ctx, cancel := context.WithCancel(context.Background())
+
+		done := make(chan struct{})
+		go func() {
+			NewSweeper(store, time.Millisecond).Run(ctx)
+			close(done)
+		}()
+
+		deadline := time.Now().Add(time.Second)
+		for {
+			store.mu.Lock()
+			sweeps := store.sweeps
+			store.mu.Unlock()
+			if sweeps >= 2 {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("expected repeated sweeps, got %d", sweeps)
+			}
+			time.Sleep(time.Millisecond)
+		}
+
+		cancel()
+		<-done
+	})
+}
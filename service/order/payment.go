@@ -0,0 +1,46 @@
+package order
+
+import (
+	"ecom/domain"
+)
+
+// ReleasePayments gives back the money of a cancelled order: authorized
+// payments are voided and captured ones refunded in full. The provider is
+// asked outside any transaction and each payment is marked once the provider
+// let go of it.
+func ReleasePayments(uow domain.UnitOfWork, payments domain.PaymentProvider, orderID int, actorID string) error {
+	var held []domain.Payment
+	err := uow.Do(func(repos domain.Repositories) error {
+		found, err := repos.Payments().GetPaymentsByOrderID(orderID)
+		if err != nil {
+			return err
+		}
+		held = *found
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, payment := range held {
+		switch payment.Status {
+		case domain.PaymentStatusAuthorized:
+			if err := payments.Void(payment.Reference); err != nil {
+				return err
+			}
+			err := uow.Do(func(repos domain.Repositories) error {
+				return repos.Payments().UpdatePaymentStatus(payment.ID, domain.PaymentStatusAuthorized, domain.PaymentStatusVoided)
+			})
+			if err != nil {
+				return err
+			}
+		case domain.PaymentStatusCaptured:
+			payload := domain.RefundPayload{Reason: "order cancelled"}
+			if _, err := Refund(uow, payments, orderID, payload, actorID, RefundHooks{}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
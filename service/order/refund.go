@@ -0,0 +1,241 @@
+package order
+
+import (
+	"ecom/domain"
+	"fmt"
+	"log"
+)
+
+// RefundHooks let the caller write alongside a refund, in the transaction
+// of the step they belong to. Either may be nil.
+type RefundHooks struct {
+	// Started runs when the refund is written as pending.
+	Started func(repos domain.Repositories, refund *domain.Refund) error
+	// Failed runs when the provider rejected the refund.
+	Failed func(repos domain.Repositories, refund *domain.Refund) error
+}
+
+// Refund gives money back for the items in the payload, or for everything
+// not refunded yet, and moves the order to partially_refunded or refunded.
+// Cancelled orders stay cancelled and are never restocked again, as
+// cancelling put their items back in stock already.
+// The provider is never asked inside a transaction: the refund is committed
+// as pending first, holding its amount and quantities, and completed once
+// the provider paid it out. A refund the provider rejects is marked failed
+// and gives back what it held.
+func Refund(uow domain.UnitOfWork, payments domain.PaymentProvider, orderID int, payload domain.RefundPayload, actorID string, hooks RefundHooks) (*domain.Refund, error) {
+	var refund *domain.Refund
+	var payment *domain.Payment
+	err := uow.Do(func(repos domain.Repositories) error {
+		var err error
+		refund, payment, err = startRefund(repos, orderID, payload, actorID)
+		if err != nil {
+			return err
+		}
+		if hooks.Started != nil {
+			return hooks.Started(repos, refund)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := payments.Refund(payment.Reference, refund.Amount); err != nil {
+		failErr := uow.Do(func(repos domain.Repositories) error {
+			if err := repos.Orders().FailRefund(*refund); err != nil {
+				return err
+			}
+			if hooks.Failed != nil {
+				return hooks.Failed(repos, refund)
+			}
+			return nil
+		})
+		if failErr != nil {
+			log.Printf("failed refund %d: %v", refund.ID, failErr)
+		}
+		return nil, err
+	}
+
+	err = uow.Do(func(repos domain.Repositories) error {
+		return completeRefund(repos, refund, payment, actorID)
+	})
+	if err != nil {
+		// the pending refund keeps holding the amount, so it isn't paid twice
+		log.Printf("refund %d: %v", refund.ID, err)
+		return nil, fmt.Errorf("refund %d was paid out but could not be completed", refund.ID)
+	}
+
+	return refund, nil
+}
+
+// startRefund checks the order can be refunded and writes the refund as
+// pending. It must be called inside a unit of work.
+func startRefund(repos domain.Repositories, orderID int, payload domain.RefundPayload, actorID string) (*domain.Refund, *domain.Payment, error) {
+	order, err := repos.Orders().GetOrderByID(orderID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cancelled := order.Status == domain.OrderStatusCancelled
+	if !cancelled && order.Status != domain.OrderStatusPartiallyRefunded && !CanTransition(order.Status, domain.OrderStatusRefunded) {
+		return nil, nil, fmt.Errorf("%w: order is %s", domain.ErrOrderNotRefundable, order.Status)
+	}
+	if order.Refunded.Cmp(order.Total) >= 0 {
+		return nil, nil, fmt.Errorf("%w: order was refunded in full", domain.ErrOrderNotRefundable)
+	}
+	if cancelled {
+		payload.Restock = false
+	}
+
+	items, err := repos.Orders().GetOrderItems(order.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	refund, err := planRefund(order, *items, payload)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	payment, err := capturedPayment(repos, order.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	refund.PaymentID = payment.ID
+	refund.ActorID = actorID
+	refund.Status = domain.RefundStatusPending
+
+	refund.ID, err = repos.Orders().CreateRefund(*refund)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return refund, payment, nil
+}
+
+// completeRefund marks the refund paid out, restocks its items and moves
+// the order on. It must be called inside a unit of work.
+func completeRefund(repos domain.Repositories, refund *domain.Refund, payment *domain.Payment, actorID string) error {
+	if err := repos.Orders().CompleteRefund(refund.ID); err != nil {
+		return err
+	}
+	refund.Status = domain.RefundStatusCompleted
+
+	// the order may have been cancelled, and restocked, while the provider
+	// was paying out
+	order, err := repos.Orders().GetOrderByID(refund.OrderID)
+	if err != nil {
+		return err
+	}
+	cancelled := order.Status == domain.OrderStatusCancelled
+
+	if refund.Restock && !cancelled {
+		for _, item := range refund.Items {
+			if err := repos.Products().UpdateProductStock(item.ProductID, item.WarehouseID, item.Quantity); err != nil {
+				return err
+			}
+		}
+	}
+
+	// the refunded amount of the order includes this refund since it started
+	status := domain.OrderStatusPartiallyRefunded
+	if order.Refunded.Cmp(order.Total) >= 0 {
+		status = domain.OrderStatusRefunded
+		err := repos.Payments().UpdatePaymentStatus(payment.ID, domain.PaymentStatusCaptured, domain.PaymentStatusRefunded)
+		if err != nil {
+			return err
+		}
+	}
+	if status != order.Status && !cancelled {
+		if _, err := Transition(repos, order.ID, status, actorID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// planRefund prices the refund. A refund of everything gives back what is
+// left of the order total, shipping included; other refunds give back the
+// share of each line's charge for the quantity refunded.
+func planRefund(order *domain.Order, items []domain.OrderItem, payload domain.RefundPayload) (*domain.Refund, error) {
+	refund := &domain.Refund{
+		OrderID: order.ID,
+		Amount:  domain.NewMoney(0, order.Total.Currency),
+		Reason:  payload.Reason,
+		Restock: payload.Restock,
+		Items:   make([]domain.RefundItem, 0),
+	}
+	remaining := order.Total.Sub(order.Refunded)
+
+	if len(payload.Items) == 0 {
+		for _, item := range items {
+			if quantity := item.Quantity - item.RefundedQuantity; quantity > 0 {
+				refund.Items = append(refund.Items, refundItem(item, quantity))
+			}
+		}
+		refund.Amount = remaining
+	} else {
+		byID := make(map[int]domain.OrderItem, len(items))
+		for _, item := range items {
+			byID[item.ID] = item
+		}
+
+		seen := make(map[int]bool, len(payload.Items))
+		for _, requested := range payload.Items {
+			item, ok := byID[requested.OrderItemID]
+			if !ok {
+				return nil, fmt.Errorf("%w: order item %d is not part of the order", domain.ErrInvalidRefund, requested.OrderItemID)
+			}
+			if seen[item.ID] {
+				return nil, fmt.Errorf("%w: order item %d is listed twice", domain.ErrInvalidRefund, item.ID)
+			}
+			seen[item.ID] = true
+
+			if left := item.Quantity - item.RefundedQuantity; requested.Quantity > left {
+				return nil, fmt.Errorf("%w: only %d of order item %d can be refunded", domain.ErrInvalidRefund, left, item.ID)
+			}
+
+			line := refundItem(item, requested.Quantity)
+			refund.Items = append(refund.Items, line)
+			refund.Amount = refund.Amount.Add(line.Amount)
+		}
+		refund.Amount = refund.Amount.Min(remaining)
+	}
+
+	if refund.Amount.IsZero() || refund.Amount.IsNegative() {
+		return nil, fmt.Errorf("%w: nothing left to refund", domain.ErrInvalidRefund)
+	}
+
+	return refund, nil
+}
+
+// refundItem prices the refund of quantity more units of the item. The
+// amount is the difference of the cumulative shares, so refunding a line
+// bit by bit adds up to exactly its total.
+func refundItem(item domain.OrderItem, quantity int) domain.RefundItem {
+	before := item.Total.MulFraction(int64(item.RefundedQuantity), int64(item.Quantity))
+	after := item.Total.MulFraction(int64(item.RefundedQuantity+quantity), int64(item.Quantity))
+	return domain.RefundItem{
+		OrderItemID: item.ID,
+		ProductID:   item.ProductID,
+		WarehouseID: item.WarehouseID,
+		Quantity:    quantity,
+		Amount:      after.Sub(before),
+	}
+}
+
+// capturedPayment returns the payment of the order refunds are paid from.
+func capturedPayment(repos domain.Repositories, orderID int) (*domain.Payment, error) {
+	payments, err := repos.Payments().GetPaymentsByOrderID(orderID)
+	if err != nil {
+		return nil, err
+	}
+	for _, payment := range *payments {
+		if payment.Status == domain.PaymentStatusCaptured {
+			return &payment, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: order has no captured payment", domain.ErrOrderNotRefundable)
+}
@@ -0,0 +1,373 @@
+package order
+
+import (
+	"bytes"
+	"ecom/domain"
+	"ecom/gateway"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+// newRefundOrders returns a store holding order 1 of two lines and 5.00
+// shipping in status.
+func newRefundOrders(status string) *mockOrderStore {
+	return &mockOrderStore{
+		orders: map[int]*domain.Order{1: {ID: 1, UserID: "user-1", Total: money("35"), Shipping: money("5"), Status: status}},
+		items: map[int][]domain.OrderItem{1: {
+			{ID: 1, OrderID: 1, ProductID: 7, Quantity: 2, Price: money("10"), Total: money("20")},
+			{ID: 2, OrderID: 1, ProductID: 8, Quantity: 3, Price: money("4"), Total: money("10")},
+		}},
+	}
+}
+
+// capturePayment captures amount at provider and returns the payment of
+// order 1 that holds it.
+func capturePayment(t *testing.T, provider *gateway.FakeProvider, amount domain.Money) domain.Payment {
+	reference, err := provider.Authorize(domain.PaymentRequest{Amount: amount, Source: "4242424242424242"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := provider.Capture(reference, amount); err != nil {
+		t.Fatal(err)
+	}
+	return domain.Payment{ID: 1, OrderID: 1, Provider: "fake", Reference: reference, Amount: amount, Status: domain.PaymentStatusCaptured}
+}
+
+// mockRefundProvider fails refunds with err and records whether one was
+// asked for inside a transaction.
+type mockRefundProvider struct {
+	*gateway.FakeProvider
+	uow        *mockUnitOfWork
+	err        error
+	calledInTx bool
+}
+
+func (m *mockRefundProvider) Refund(reference string, amount domain.Money) error {
+	m.calledInTx = m.calledInTx || m.uow.inTx
+	if m.err != nil {
+		return m.err
+	}
+	return m.FakeProvider.Refund(reference, amount)
+}
+
+func newRefundRequest(t *testing.T, orderID string, role string, payload domain.RefundPayload) *http.Request {
+	marshaled, _ := json.Marshal(payload)
+	req, err := http.NewRequest(http.MethodPost, "/orders/"+orderID+"/refunds", bytes.NewBuffer(marshaled))
+	if err != nil {
+		t.Fatal(err)
+	}
+	authorize(t, req, "staff-1", role)
+	return req
+}
+
+func TestRefundItem(t *testing.T) {
+	item := domain.OrderItem{ID: 2, ProductID: 8, Quantity: 3, Total: money("10")}
+
+	var total domain.Money
+	for _, expected := range []string{"3.33", "3.34", "3.33"} {
+		refunded := refundItem(item, 1)
+		if refunded.Amount != money(expected) {
+			t.Errorf("expected %s, got %v", expected, refunded.Amount)
+		}
+		total = total.Add(refunded.Amount)
+		item.RefundedQuantity++
+	}
+
+	if total != money("10") {
+		t.Errorf("expected the refunds to add up to 10, got %v", total)
+	}
+}
+
+func TestHandleCreateRefund(t *testing.T) {
+	partial := domain.RefundPayload{
+		Items:   []domain.RefundItemPayload{{OrderItemID: 1, Quantity: 1}},
+		Restock: true,
+		Reason:  "damaged",
+	}
+
+	t.Run("should return 403 for customers", func(t *testing.T) {
+		handler := newOrderHandler(&mockOrderStore{}, &mockProductStore{})
+
+		rr := serveOrderRequest(handler, newRefundRequest(t, "1", domain.RoleCustomer, partial))
+
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+	})
+
+	t.Run("should refund part of a line and restock it", func(t *testing.T) {
+		provider := gateway.NewFakeProvider("secret", "", nil)
+		orders := newRefundOrders(domain.OrderStatusShipped)
+		uow := &mockUnitOfWork{
+			orders:   orders,
+			products: &mockProductStore{stock: map[int]int{7: 3}},
+			payments: &mockPaymentStore{payments: []domain.Payment{capturePayment(t, provider, money("35"))}},
+		}
+		handler := NewHandler(orders, uow, provider)
+
+		rr := serveOrderRequest(handler, newRefundRequest(t, "1", domain.RoleStaff, partial))
+
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status code %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body)
+		}
+		var refund domain.Refund
+		if err := json.NewDecoder(rr.Body).Decode(&refund); err != nil {
+			t.Fatal(err)
+		}
+		if refund.Amount != money("10") || len(refund.Items) != 1 || refund.ActorID != "staff-1" {
+			t.Errorf("unexpected refund %+v", refund)
+		}
+
+		order := uow.orders.orders[1]
+		if order.Status != domain.OrderStatusPartiallyRefunded || order.Refunded != money("10") {
+			t.Errorf("expected the order to be partially refunded by 10, got %s and %v", order.Status, order.Refunded)
+		}
+		if uow.orders.items[1][0].RefundedQuantity != 1 {
+			t.Errorf("expected 1 unit to be refunded, got %d", uow.orders.items[1][0].RefundedQuantity)
+		}
+		if uow.products.stock[7] != 4 {
+			t.Errorf("expected the unit back in stock, got %d", uow.products.stock[7])
+		}
+		if status := provider.Status(uow.payments.payments[0].Reference); status != domain.PaymentStatusCaptured {
+			t.Errorf("expected the payment to stay captured, got %s", status)
+		}
+	})
+
+	t.Run("should refund everything left, shipping included", func(t *testing.T) {
+		provider := gateway.NewFakeProvider("secret", "", nil)
+		orders := newRefundOrders(domain.OrderStatusDelivered)
+		uow := &mockUnitOfWork{
+			orders:   orders,
+			products: &mockProductStore{stock: map[int]int{7: 3}},
+			payments: &mockPaymentStore{payments: []domain.Payment{capturePayment(t, provider, money("35"))}},
+		}
+		handler := NewHandler(orders, uow, provider)
+
+		rr := serveOrderRequest(handler, newRefundRequest(t, "1", domain.RoleStaff, partial))
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status code %d, got %d", http.StatusCreated, rr.Code)
+		}
+		rr = serveOrderRequest(handler, newRefundRequest(t, "1", domain.RoleAdmin, domain.RefundPayload{}))
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status code %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body)
+		}
+
+		var refund domain.Refund
+		if err := json.NewDecoder(rr.Body).Decode(&refund); err != nil {
+			t.Fatal(err)
+		}
+		if refund.Amount != money("25") || len(refund.Items) != 2 || refund.Restock {
+			t.Errorf("unexpected refund %+v", refund)
+		}
+
+		order := uow.orders.orders[1]
+		if order.Status != domain.OrderStatusRefunded || order.Refunded != order.Total {
+			t.Errorf("expected the order to be refunded in full, got %s and %v", order.Status, order.Refunded)
+		}
+		payment := uow.payments.payments[0]
+		if payment.Status != domain.PaymentStatusRefunded || provider.Status(payment.Reference) != domain.PaymentStatusRefunded {
+			t.Errorf("expected the payment to be refunded, got %s", payment.Status)
+		}
+		if uow.products.stock[7] != 4 {
+			t.Errorf("expected only the restocked refund to change stock, got %d", uow.products.stock[7])
+		}
+
+		rr = serveOrderRequest(handler, newRefundRequest(t, "1", domain.RoleAdmin, domain.RefundPayload{}))
+		if rr.Code != http.StatusConflict {
+			t.Errorf("expected a refunded order to return %d, got %d", http.StatusConflict, rr.Code)
+		}
+	})
+
+	t.Run("should return 400 for lines that can't be refunded", func(t *testing.T) {
+		payloads := map[string]domain.RefundPayload{
+			"unknown item":  {Items: []domain.RefundItemPayload{{OrderItemID: 9, Quantity: 1}}},
+			"too many":      {Items: []domain.RefundItemPayload{{OrderItemID: 1, Quantity: 3}}},
+			"listed twice":  {Items: []domain.RefundItemPayload{{OrderItemID: 1, Quantity: 1}, {OrderItemID: 1, Quantity: 1}}},
+			"zero quantity": {Items: []domain.RefundItemPayload{{OrderItemID: 1}}},
+		}
+		for name, payload := range payloads {
+			orders := newRefundOrders(domain.OrderStatusPaid)
+			uow := &mockUnitOfWork{orders: orders, products: &mockProductStore{}, payments: &mockPaymentStore{}}
+			handler := NewHandler(orders, uow, gateway.NewFakeProvider("secret", "", nil))
+
+			rr := serveOrderRequest(handler, newRefundRequest(t, "1", domain.RoleStaff, payload))
+
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("%s: expected status code %d, got %d", name, http.StatusBadRequest, rr.Code)
+			}
+			if len(uow.orders.refunds) != 0 {
+				t.Errorf("%s: expected no refunds, got %d", name, len(uow.orders.refunds))
+			}
+		}
+	})
+
+	t.Run("should return 409 for orders that weren't paid", func(t *testing.T) {
+		handler := newOrderHandler(newRefundOrders(domain.OrderStatusPending), &mockProductStore{})
+
+		rr := serveOrderRequest(handler, newRefundRequest(t, "1", domain.RoleStaff, partial))
+
+		if rr.Code != http.StatusConflict {
+			t.Errorf("expected status code %d, got %d", http.StatusConflict, rr.Code)
+		}
+	})
+
+	t.Run("should return 404 for an unknown order", func(t *testing.T) {
+		handler := newOrderHandler(&mockOrderStore{}, &mockProductStore{})
+
+		rr := serveOrderRequest(handler, newRefundRequest(t, "1", domain.RoleStaff, partial))
+
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code %d, got %d", http.StatusNotFound, rr.Code)
+		}
+	})
+
+	refunded := map[string]string{
+		domain.OrderStatusCancelled: domain.OrderStatusCancelled,
+		domain.OrderStatusCompleted: domain.OrderStatusPartiallyRefunded,
+	}
+	for status, expected := range refunded {
+		t.Run("should not ship a "+status+" order after a partial refund", func(t *testing.T) {
+			provider := gateway.NewFakeProvider("secret", "", nil)
+			orders := newRefundOrders(status)
+			uow := &mockUnitOfWork{
+				orders:   orders,
+				products: &mockProductStore{},
+				payments: &mockPaymentStore{payments: []domain.Payment{capturePayment(t, provider, money("35"))}},
+			}
+			handler := NewHandler(orders, uow, provider)
+
+			rr := serveOrderRequest(handler, newRefundRequest(t, "1", domain.RoleStaff, domain.RefundPayload{Items: partial.Items}))
+			if rr.Code != http.StatusCreated {
+				t.Fatalf("expected status code %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body)
+			}
+
+			for _, next := range []string{domain.OrderStatusShipped, domain.OrderStatusDelivered, domain.OrderStatusCompleted} {
+				rr = serveOrderRequest(handler, newStatusRequest(t, "1", next))
+				if rr.Code != http.StatusConflict {
+					t.Errorf("expected moving to %s to return %d, got %d", next, http.StatusConflict, rr.Code)
+				}
+			}
+			if order := uow.orders.orders[1]; order.Status != expected {
+				t.Errorf("expected the order to be %s, got %s", expected, order.Status)
+			}
+		})
+	}
+
+	t.Run("should not restock a cancelled order again", func(t *testing.T) {
+		provider := gateway.NewFakeProvider("secret", "", nil)
+		orders := newRefundOrders(domain.OrderStatusCancelled)
+		uow := &mockUnitOfWork{
+			orders:   orders,
+			products: &mockProductStore{stock: map[int]int{7: 3}},
+			payments: &mockPaymentStore{payments: []domain.Payment{capturePayment(t, provider, money("35"))}},
+		}
+		handler := NewHandler(orders, uow, provider)
+
+		rr := serveOrderRequest(handler, newRefundRequest(t, "1", domain.RoleStaff, partial))
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status code %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body)
+		}
+		rr = serveOrderRequest(handler, newRefundRequest(t, "1", domain.RoleStaff, domain.RefundPayload{Restock: true}))
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status code %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body)
+		}
+
+		if uow.products.stock[7] != 3 || uow.products.stock[8] != 0 {
+			t.Errorf("expected the stock put back by the cancellation to stay, got %v", uow.products.stock)
+		}
+		order := uow.orders.orders[1]
+		if order.Status != domain.OrderStatusCancelled || order.Refunded != order.Total {
+			t.Errorf("expected a cancelled order refunded in full, got %s and %v", order.Status, order.Refunded)
+		}
+		if payment := uow.payments.payments[0]; payment.Status != domain.PaymentStatusRefunded {
+			t.Errorf("expected the payment to be refunded, got %s", payment.Status)
+		}
+
+		rr = serveOrderRequest(handler, newRefundRequest(t, "1", domain.RoleStaff, domain.RefundPayload{}))
+		if rr.Code != http.StatusConflict {
+			t.Errorf("expected a cancelled order refunded in full to return %d, got %d", http.StatusConflict, rr.Code)
+		}
+	})
+
+	t.Run("should ask the provider outside the transaction", func(t *testing.T) {
+		fake := gateway.NewFakeProvider("secret", "", nil)
+		orders := newRefundOrders(domain.OrderStatusShipped)
+		uow := &mockUnitOfWork{
+			orders:   orders,
+			products: &mockProductStore{stock: map[int]int{7: 3}},
+			payments: &mockPaymentStore{payments: []domain.Payment{capturePayment(t, fake, money("35"))}},
+		}
+		handler := NewHandler(orders, uow, fake)
+		provider := &mockRefundProvider{FakeProvider: fake, uow: uow}
+		handler.payments = provider
+
+		rr := serveOrderRequest(handler, newRefundRequest(t, "1", domain.RoleStaff, partial))
+
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status code %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body)
+		}
+		if provider.calledInTx {
+			t.Error("expected the provider to be asked after the pending refund was committed")
+		}
+		if refund := uow.orders.refunds[0]; refund.Status != domain.RefundStatusCompleted {
+			t.Errorf("expected the refund to be completed, got %s", refund.Status)
+		}
+	})
+
+	t.Run("should give back what a refund the provider rejects held", func(t *testing.T) {
+		fake := gateway.NewFakeProvider("secret", "", nil)
+		orders := newRefundOrders(domain.OrderStatusShipped)
+		uow := &mockUnitOfWork{
+			orders:   orders,
+			products: &mockProductStore{stock: map[int]int{7: 3}},
+			payments: &mockPaymentStore{payments: []domain.Payment{capturePayment(t, fake, money("35"))}},
+		}
+		handler := NewHandler(orders, uow, fake)
+		handler.payments = &mockRefundProvider{FakeProvider: fake, uow: uow, err: errors.New("card closed")}
+
+		rr := serveOrderRequest(handler, newRefundRequest(t, "1", domain.RoleStaff, partial))
+
+		if rr.Code != http.StatusInternalServerError {
+			t.Fatalf("expected status code %d, got %d", http.StatusInternalServerError, rr.Code)
+		}
+		if refund := uow.orders.refunds[0]; refund.Status != domain.RefundStatusFailed {
+			t.Errorf("expected the refund to be failed, got %s", refund.Status)
+		}
+		order := uow.orders.orders[1]
+		if order.Status != domain.OrderStatusShipped || !order.Refunded.IsZero() {
+			t.Errorf("expected the order to stay shipped with nothing refunded, got %s and %v", order.Status, order.Refunded)
+		}
+		if uow.orders.items[1][0].RefundedQuantity != 0 || uow.products.stock[7] != 3 {
+			t.Errorf("expected the refunded unit to be released and not restocked, got %+v", uow.orders.items[1][0])
+		}
+
+		// the released amount can be refunded again
+		handler.payments = fake
+		rr = serveOrderRequest(handler, newRefundRequest(t, "1", domain.RoleStaff, partial))
+		if rr.Code != http.StatusCreated {
+			t.Errorf("expected status code %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body)
+		}
+	})
+
+	t.Run("should return 500 when the order can't be read", func(t *testing.T) {
+		handler := newOrderHandler(&mockOrderStore{getErr: errors.New("database is down")}, &mockProductStore{})
+
+		rr := serveOrderRequest(handler, newRefundRequest(t, "1", domain.RoleStaff, partial))
+
+		if rr.Code != http.StatusInternalServerError {
+			t.Errorf("expected status code %d, got %d", http.StatusInternalServerError, rr.Code)
+		}
+	})
+
+	t.Run("should not set refund statuses by hand", func(t *testing.T) {
+		handler := newOrderHandler(&mockOrderStore{}, &mockProductStore{})
+
+		rr := serveOrderRequest(handler, newStatusRequest(t, "1", domain.OrderStatusRefunded))
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+}
@@ -0,0 +1,303 @@
+package order
+
+import (
+	"ecom/domain"
+	"ecom/middleware"
+	"ecom/utils"
+	"errors"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultOrdersLimit = 20
+	maxOrdersLimit     = 100
+)
+
+type Handler struct {
+	store    domain.OrderRepository
+	uow      domain.UnitOfWork
+	payments domain.PaymentProvider
+}
+
+func NewHandler(store domain.OrderRepository, uow domain.UnitOfWork, payments domain.PaymentProvider) *Handler {
+	return &Handler{
+		store:    store,
+		uow:      uow,
+		payments: payments,
+	}
+}
+
+func (h *Handler) OrderRoutes(router *mux.Router) {
+	router.HandleFunc("", h.handleGetOrders).Methods(http.MethodGet)
+	router.HandleFunc("/{id}", h.handleGetOrderByID).Methods(http.MethodGet)
+	router.Handle("/{id}/status", middleware.RequireRole(domain.RoleStaff, domain.RoleAdmin)(http.HandlerFunc(h.handleUpdateOrderStatus))).Methods(http.MethodPatch)
+	router.Handle("/{id}/refunds", middleware.RequireRole(domain.RoleStaff, domain.RoleAdmin)(http.HandlerFunc(h.handleCreateRefund))).Methods(http.MethodPost)
+}
+
+func (h *Handler) handleGetOrders(w http.ResponseWriter, r *http.Request) {
+	// get the user ID from the context
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	// build the filter from the query string
+	filter, err := parseOrderFilter(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	filter.UserID = userID
+
+	// get the orders from the store
+	orders, total, err := h.store.GetOrders(filter)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"orders": orders,
+		"total":  total,
+		"limit":  filter.Limit,
+		"offset": filter.Offset,
+	})
+}
+
+func (h *Handler) handleGetOrderByID(w http.ResponseWriter, r *http.Request) {
+	// get the order ID from the URL
+	orderID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid order ID"))
+		return
+	}
+
+	// get the user ID from the context
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	// get the order from the store, hiding orders of other users
+	order, err := h.store.GetOrderByID(orderID)
+	if errors.Is(err, domain.ErrOrderNotFound) || (err == nil && order.UserID != userID) {
+		utils.WriteError(w, http.StatusNotFound, domain.ErrOrderNotFound)
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	lines, err := h.store.GetOrderLines(order.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, domain.OrderDetails{Order: *order, Items: *lines})
+}
+
+func (h *Handler) handleUpdateOrderStatus(w http.ResponseWriter, r *http.Request) {
+	// get the order ID from the URL
+	orderID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid order ID"))
+		return
+	}
+
+	// get JSON payload
+	var payload domain.OrderStatusPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// validate the payload
+	err = utils.Validate.Struct(payload)
+	if err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", validationErrors))
+		return
+	}
+
+	if !isKnownStatus(payload.Status) {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("unknown order status %s", payload.Status))
+		return
+	}
+
+	// refund statuses follow the money, which only the refunds endpoint moves
+	if isRefundStatus(payload.Status) {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("orders are refunded through the refunds endpoint"))
+		return
+	}
+
+	// get the acting user from the context
+	actorID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	// make sure the order exists
+	current, err := h.store.GetOrderByID(orderID)
+	if errors.Is(err, domain.ErrOrderNotFound) {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if !CanTransition(current.Status, payload.Status) {
+		utils.WriteError(w, http.StatusConflict, fmt.Errorf("cannot change order status from %s to %s", current.Status, payload.Status))
+		return
+	}
+
+	// apply the transition
+	var order *domain.Order
+	err = h.uow.Do(func(repos domain.Repositories) error {
+		order, err = Transition(repos, orderID, payload.Status, actorID)
+		return err
+	})
+	if errors.Is(err, domain.ErrOrderStatusConflict) {
+		utils.WriteError(w, http.StatusConflict, err)
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// give the money back once the cancellation is committed
+	if order.Status == domain.OrderStatusCancelled {
+		if err := ReleasePayments(h.uow, h.payments, order.ID, actorID); err != nil {
+			log.Printf("order %d: releasing payments: %v", order.ID, err)
+			utils.WriteError(w, http.StatusInternalServerError, fmt.Errorf("order was cancelled but its payment could not be released"))
+			return
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, order)
+}
+
+func (h *Handler) handleCreateRefund(w http.ResponseWriter, r *http.Request) {
+	// get the order ID from the URL
+	orderID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid order ID"))
+		return
+	}
+
+	// get JSON payload
+	var payload domain.RefundPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// validate the payload
+	err = utils.Validate.Struct(payload)
+	if err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", validationErrors))
+		return
+	}
+
+	// get the acting user from the context
+	actorID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	// make sure the order exists
+	if _, err := h.store.GetOrderByID(orderID); errors.Is(err, domain.ErrOrderNotFound) {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// refund it
+	refund, err := Refund(h.uow, h.payments, orderID, payload, actorID, RefundHooks{})
+	if errors.Is(err, domain.ErrInvalidRefund) {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	} else if errors.Is(err, domain.ErrOrderNotRefundable) || errors.Is(err, domain.ErrRefundConflict) ||
+		errors.Is(err, domain.ErrOrderStatusConflict) || errors.Is(err, domain.ErrPaymentStatusConflict) {
+		utils.WriteError(w, http.StatusConflict, err)
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, refund)
+}
+
+func parseOrderFilter(r *http.Request) (domain.OrderFilter, error) {
+	query := r.URL.Query()
+	filter := domain.OrderFilter{Limit: defaultOrdersLimit}
+
+	if limit := query.Get("limit"); limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil || value < 1 || value > maxOrdersLimit {
+			return filter, fmt.Errorf("limit must be between 1 and %d", maxOrdersLimit)
+		}
+		filter.Limit = value
+	}
+
+	if offset := query.Get("offset"); offset != "" {
+		value, err := strconv.Atoi(offset)
+		if err != nil || value < 0 {
+			return filter, fmt.Errorf("invalid offset")
+		}
+		filter.Offset = value
+	}
+
+	if status := query.Get("status"); status != "" {
+		if !isKnownStatus(status) {
+			return filter, fmt.Errorf("unknown order status %s", status)
+		}
+		filter.Status = status
+	}
+
+	if from := query.Get("from"); from != "" {
+		value, _, err := parseDate(from)
+		if err != nil {
+			return filter, fmt.Errorf("invalid from date")
+		}
+		filter.From = &value
+	}
+
+	if to := query.Get("to"); to != "" {
+		value, dateOnly, err := parseDate(to)
+		if err != nil {
+			return filter, fmt.Errorf("invalid to date")
+		}
+		// a bare date includes the whole day
+		if dateOnly {
+			value = value.AddDate(0, 0, 1)
+		}
+		filter.To = &value
+	}
+
+	return filter, nil
+}
+
+// parseDate accepts either an RFC 3339 timestamp or a YYYY-MM-DD date.
+func parseDate(value string) (time.Time, bool, error) {
+	if t, err := time.Parse(time.DateOnly, value); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	return t, false, err
+}
@@ -0,0 +1,644 @@
+package order
+
+import (
+	"bytes"
+	"ecom/config"
+	"ecom/domain"
+	"ecom/gateway"
+	"ecom/middleware"
+	"ecom/service/auth"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// money parses a test amount in the default currency.
+func money(value string) domain.Money {
+	return domain.MustParseMoney(value, domain.DefaultCurrency)
+}
+
+type mockOrderStore struct {
+	orders     map[int]*domain.Order
+	items      map[int][]domain.OrderItem
+	history    []domain.OrderStatusHistory
+	refunds    []domain.Refund
+	lastFilter domain.OrderFilter
+	getErr     error // returned by GetOrderByID when set
+}
+
+func (m *mockOrderStore) CreateOrder(order domain.Order) (int, error) {
+	order.ID = len(m.orders) + 1
+	m.orders[order.ID] = &order
+	return order.ID, nil
+}
+
+func (m *mockOrderStore) CreateOrderItem(orderItem domain.OrderItem) error {
+	m.items[orderItem.OrderID] = append(m.items[orderItem.OrderID], orderItem)
+	return nil
+}
+
+func (m *mockOrderStore) GetOrderByID(id int) (*domain.Order, error) {
+	if m.getErr != nil {
+		return nil, m.getErr
+	}
+	order, ok := m.orders[id]
+	if !ok {
+		return nil, domain.ErrOrderNotFound
+	}
+	copied := *order
+	return &copied, nil
+}
+
+func (m *mockOrderStore) LockOrder(id int) error {
+	return nil
+}
+
+func (m *mockOrderStore) GetOrderItems(orderID int) (*[]domain.OrderItem, error) {
+	items := m.items[orderID]
+	return &items, nil
+}
+
+func (m *mockOrderStore) GetOrders(filter domain.OrderFilter) (*[]domain.Order, int, error) {
+	m.lastFilter = filter
+
+	matched := make([]domain.Order, 0)
+	for id := 1; id <= len(m.orders); id++ {
+		order, ok := m.orders[id]
+		if !ok || order.UserID != filter.UserID {
+			continue
+		}
+		if filter.Status != "" && order.Status != filter.Status {
+			continue
+		}
+		matched = append(matched, *order)
+	}
+
+	total := len(matched)
+	if filter.Offset < len(matched) {
+		matched = matched[filter.Offset:]
+	} else {
+		matched = matched[:0]
+	}
+	if len(matched) > filter.Limit {
+		matched = matched[:filter.Limit]
+	}
+	return &matched, total, nil
+}
+
+func (m *mockOrderStore) GetOrderLines(orderID int) (*[]domain.OrderLine, error) {
+	lines := make([]domain.OrderLine, 0)
+	for _, item := range m.items[orderID] {
+		lines = append(lines, domain.OrderLine{OrderItem: item, ProductName: fmt.Sprintf("Product %d", item.ProductID)})
+	}
+	return &lines, nil
+}
+
+func (m *mockOrderStore) UpdateOrderStatus(id int, from, to string) error {
+	order := m.orders[id]
+	if order.Status != from {
+		return domain.ErrOrderStatusConflict
+	}
+	order.Status = to
+	return nil
+}
+
+func (m *mockOrderStore) CreateOrderStatusHistory(history domain.OrderStatusHistory) error {
+	m.history = append(m.history, history)
+	return nil
+}
+
+func (m *mockOrderStore) CreateRefund(refund domain.Refund) (int, error) {
+	order := m.orders[refund.OrderID]
+	if order.Refunded.Add(refund.Amount).Cmp(order.Total) > 0 {
+		return 0, domain.ErrRefundConflict
+	}
+	items := m.items[refund.OrderID]
+	for _, refunded := range refund.Items {
+		for i := range items {
+			if items[i].ID == refunded.OrderItemID {
+				if items[i].RefundedQuantity+refunded.Quantity > items[i].Quantity {
+					return 0, domain.ErrRefundConflict
+				}
+				items[i].RefundedQuantity += refunded.Quantity
+			}
+		}
+	}
+	order.Refunded = order.Refunded.Add(refund.Amount)
+	m.refunds = append(m.refunds, refund)
+	return len(m.refunds), nil
+}
+
+func (m *mockOrderStore) CompleteRefund(id int) error {
+	if m.refunds[id-1].Status != domain.RefundStatusPending {
+		return domain.ErrRefundConflict
+	}
+	m.refunds[id-1].Status = domain.RefundStatusCompleted
+	return nil
+}
+
+func (m *mockOrderStore) FailRefund(refund domain.Refund) error {
+	if m.refunds[refund.ID-1].Status != domain.RefundStatusPending {
+		return domain.ErrRefundConflict
+	}
+	m.refunds[refund.ID-1].Status = domain.RefundStatusFailed
+	order := m.orders[refund.OrderID]
+	order.Refunded = order.Refunded.Sub(refund.Amount)
+	items := m.items[refund.OrderID]
+	for _, refunded := range refund.Items {
+		for i := range items {
+			if items[i].ID == refunded.OrderItemID {
+				items[i].RefundedQuantity -= refunded.Quantity
+			}
+		}
+	}
+	return nil
+}
+
+type mockPaymentStore struct {
+	domain.PaymentRepository
+	payments []domain.Payment
+}
+
+func (m *mockPaymentStore) GetPaymentsByOrderID(orderID int) (*[]domain.Payment, error) {
+	payments := make([]domain.Payment, 0)
+	for _, payment := range m.payments {
+		if payment.OrderID == orderID {
+			payments = append(payments, payment)
+		}
+	}
+	return &payments, nil
+}
+
+func (m *mockPaymentStore) UpdatePaymentStatus(id int, from, to string) error {
+	for i := range m.payments {
+		if m.payments[i].ID == id {
+			if m.payments[i].Status != from {
+				return domain.ErrPaymentStatusConflict
+			}
+			m.payments[i].Status = to
+			return nil
+		}
+	}
+	return domain.ErrPaymentNotFound
+}
+
+type mockProductStore struct {
+	stock map[int]int
+}
+
+func (m *mockProductStore) GetProducts(query domain.ProductQuery) (*domain.ProductPage, error) {
+	return &domain.ProductPage{}, nil
+}
+
+func (m *mockProductStore) CreateProduct(product domain.Product) error {
+	return nil
+}
+
+func (m *mockProductStore) GetProductByID(id int) (*domain.Product, error) {
+	return nil, errors.New("product not found")
+}
+
+func (m *mockProductStore) GetProductByIDs(ids []int) (*[]domain.Product, error) {
+	return &[]domain.Product{}, nil
+}
+
+func (m *mockProductStore) UpdateProduct(product domain.Product) error {
+	return nil
+}
+
+func (m *mockProductStore) DeleteProduct(id int) error {
+	return nil
+}
+
+func (m *mockProductStore) GetProductStock(productID int) (*domain.ProductStock, error) {
+	return &domain.ProductStock{ProductID: productID, Quantity: m.stock[productID]}, nil
+}
+
+func (m *mockProductStore) UpdateProductStock(productID, warehouseID, quantity int) error {
+	m.stock[productID] += quantity
+	return nil
+}
+
+type mockUnitOfWork struct {
+	orders   *mockOrderStore
+	products *mockProductStore
+	payments *mockPaymentStore
+	inTx     bool // set while Do runs
+}
+
+func (m *mockUnitOfWork) Products() domain.ProductRepository {
+	return m.products
+}
+
+func (m *mockUnitOfWork) Orders() domain.OrderRepository {
+	return m.orders
+}
+
+func (m *mockUnitOfWork) Carts() domain.CartRepository {
+	return nil
+}
+
+func (m *mockUnitOfWork) Promotions() domain.PromotionRepository {
+	return nil
+}
+
+func (m *mockUnitOfWork) Payments() domain.PaymentRepository {
+	return m.payments
+}
+
+func (m *mockUnitOfWork) Returns() domain.ReturnRepository {
+	return nil
+}
+
+func (m *mockUnitOfWork) Reservations() domain.ReservationRepository {
+	return nil
+}
+
+func (m *mockUnitOfWork) Warehouses() domain.WarehouseRepository {
+	return nil
+}
+
+func (m *mockUnitOfWork) Do(fn func(repos domain.Repositories) error) error {
+	m.inTx = true
+	defer func() { m.inTx = false }()
+	return fn(m)
+}
+
+func newStatusRequest(t *testing.T, orderID string, status string) *http.Request {
+	marshaled, _ := json.Marshal(domain.OrderStatusPayload{Status: status})
+	req, err := http.NewRequest(http.MethodPatch, "/orders/"+orderID+"/status", bytes.NewBuffer(marshaled))
+	if err != nil {
+		t.Fatal(err)
+	}
+	authorize(t, req, "admin-1", domain.RoleAdmin)
+	return req
+}
+
+func newGetRequest(t *testing.T, url string, userID string) *http.Request {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authorize(t, req, userID, domain.RoleCustomer)
+	return req
+}
+
+func authorize(t *testing.T, req *http.Request, userID string, role string) {
+	token, err := auth.NewStore().CreateToken([]byte(config.ENV.JWTSecret), domain.User{ID: userID, Address: "Test Address", Role: role})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+}
+
+func serveOrderRequest(handler *Handler, req *http.Request) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	router := mux.NewRouter()
+	subrouter := router.PathPrefix("/orders").Subrouter()
+	subrouter.Use(middleware.JWTMiddleware)
+	handler.OrderRoutes(subrouter)
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+// newOrderStore returns a store holding order 1 of user-1 for 20.00 in status,
+// made of items.
+func newOrderStore(status string, items ...domain.OrderItem) *mockOrderStore {
+	return &mockOrderStore{
+		orders: map[int]*domain.Order{1: {ID: 1, UserID: "user-1", Total: money("20"), Status: status}},
+		items:  map[int][]domain.OrderItem{1: items},
+	}
+}
+
+// newOrderHandler returns a handler whose unit of work runs on orders and
+// products, with no payments.
+func newOrderHandler(orders *mockOrderStore, products *mockProductStore) *Handler {
+	uow := &mockUnitOfWork{orders: orders, products: products, payments: &mockPaymentStore{}}
+	return NewHandler(orders, uow, gateway.NewFakeProvider("secret", "", nil))
+}
+
+func TestHandleGetOrders(t *testing.T) {
+	// the handler only reads, so the subtests share it
+	orders := &mockOrderStore{orders: map[int]*domain.Order{
+		1: {ID: 1, UserID: "user-1", Status: domain.OrderStatusPending},
+		2: {ID: 2, UserID: "user-2", Status: domain.OrderStatusPending},
+		3: {ID: 3, UserID: "user-1", Status: domain.OrderStatusCancelled},
+	}}
+	handler := newOrderHandler(orders, &mockProductStore{})
+
+	t.Run("should return 401 without a token", func(t *testing.T) {
+		req, _ := http.NewRequest(http.MethodGet, "/orders", nil)
+
+		rr := serveOrderRequest(handler, req)
+
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected status code %d, got %d", http.StatusUnauthorized, rr.Code)
+		}
+	})
+
+	t.Run("should only return orders of the authenticated user", func(t *testing.T) {
+		rr := serveOrderRequest(handler, newGetRequest(t, "/orders", "user-1"))
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		var response struct {
+			Orders []domain.Order `json:"orders"`
+			Total  int            `json:"total"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		if response.Total != 2 || len(response.Orders) != 2 {
+			t.Errorf("expected 2 orders, got %d (total %d)", len(response.Orders), response.Total)
+		}
+		for _, order := range response.Orders {
+			if order.UserID != "user-1" {
+				t.Errorf("got order %d of user %s", order.ID, order.UserID)
+			}
+		}
+	})
+
+	t.Run("should pass status, date range and pagination to the store", func(t *testing.T) {
+		rr := serveOrderRequest(handler, newGetRequest(t, "/orders?status=cancelled&from=2024-09-01&to=2024-09-30&limit=5&offset=10", "user-1"))
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		filter := orders.lastFilter
+		if filter.UserID != "user-1" || filter.Status != domain.OrderStatusCancelled || filter.Limit != 5 || filter.Offset != 10 {
+			t.Errorf("unexpected filter %+v", filter)
+		}
+		if filter.From == nil || filter.From.Format(time.DateOnly) != "2024-09-01" {
+			t.Errorf("unexpected from date %v", filter.From)
+		}
+		if filter.To == nil || filter.To.Format(time.DateOnly) != "2024-10-01" {
+			t.Errorf("expected the to date to include the whole day, got %v", filter.To)
+		}
+	})
+
+	t.Run("should return 400 for invalid query parameters", func(t *testing.T) {
+		for _, query := range []string{"limit=0", "limit=1000", "offset=-1", "status=lost", "from=yesterday"} {
+			rr := serveOrderRequest(handler, newGetRequest(t, "/orders?"+query, "user-1"))
+
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("%s: expected status code %d, got %d", query, http.StatusBadRequest, rr.Code)
+			}
+		}
+	})
+}
+
+func TestHandleGetOrderByID(t *testing.T) {
+	orders := &mockOrderStore{
+		orders: map[int]*domain.Order{1: {ID: 1, UserID: "user-1", Status: domain.OrderStatusPending}},
+		items:  map[int][]domain.OrderItem{1: {{ID: 1, OrderID: 1, ProductID: 7, Quantity: 2}}},
+	}
+	handler := newOrderHandler(orders, &mockProductStore{})
+
+	t.Run("should return the order with its items", func(t *testing.T) {
+		rr := serveOrderRequest(handler, newGetRequest(t, "/orders/1", "user-1"))
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		var order domain.OrderDetails
+		if err := json.NewDecoder(rr.Body).Decode(&order); err != nil {
+			t.Fatal(err)
+		}
+		if order.ID != 1 || len(order.Items) != 1 {
+			t.Fatalf("unexpected order %+v", order)
+		}
+		if order.Items[0].ProductName != "Product 7" {
+			t.Errorf("expected product name Product 7, got %s", order.Items[0].ProductName)
+		}
+	})
+
+	t.Run("should return 404 for an order of another user", func(t *testing.T) {
+		rr := serveOrderRequest(handler, newGetRequest(t, "/orders/1", "user-2"))
+
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code %d, got %d", http.StatusNotFound, rr.Code)
+		}
+	})
+}
+
+func TestHandleUpdateOrderStatus(t *testing.T) {
+	twoOfProduct7 := domain.OrderItem{ID: 1, OrderID: 1, ProductID: 7, Quantity: 2}
+
+	t.Run("should return 403 for customers", func(t *testing.T) {
+		orders := newOrderStore(domain.OrderStatusPaid)
+		handler := newOrderHandler(orders, &mockProductStore{})
+		req := newStatusRequest(t, "1", domain.OrderStatusShipped)
+		authorize(t, req, "user-1", domain.RoleCustomer)
+
+		rr := serveOrderRequest(handler, req)
+
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+		if orders.orders[1].Status != domain.OrderStatusPaid {
+			t.Errorf("expected status to stay paid, got %s", orders.orders[1].Status)
+		}
+	})
+
+	t.Run("should allow staff", func(t *testing.T) {
+		handler := newOrderHandler(newOrderStore(domain.OrderStatusPaid), &mockProductStore{})
+		req := newStatusRequest(t, "1", domain.OrderStatusShipped)
+		authorize(t, req, "staff-1", domain.RoleStaff)
+
+		rr := serveOrderRequest(handler, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+	})
+
+	t.Run("should return 400 for an unknown status", func(t *testing.T) {
+		handler := newOrderHandler(&mockOrderStore{}, &mockProductStore{})
+
+		rr := serveOrderRequest(handler, newStatusRequest(t, "1", "lost"))
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should return 404 if the order does not exist", func(t *testing.T) {
+		handler := newOrderHandler(&mockOrderStore{}, &mockProductStore{})
+
+		rr := serveOrderRequest(handler, newStatusRequest(t, "1", domain.OrderStatusPaid))
+
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code %d, got %d", http.StatusNotFound, rr.Code)
+		}
+	})
+
+	t.Run("should return 500 when the order can't be read", func(t *testing.T) {
+		handler := newOrderHandler(&mockOrderStore{getErr: errors.New("database is down")}, &mockProductStore{})
+
+		rr := serveOrderRequest(handler, newStatusRequest(t, "1", domain.OrderStatusPaid))
+
+		if rr.Code != http.StatusInternalServerError {
+			t.Errorf("expected status code %d, got %d", http.StatusInternalServerError, rr.Code)
+		}
+	})
+
+	t.Run("should return 409 for an illegal transition", func(t *testing.T) {
+		orders := newOrderStore(domain.OrderStatusPending)
+		handler := newOrderHandler(orders, &mockProductStore{})
+
+		rr := serveOrderRequest(handler, newStatusRequest(t, "1", domain.OrderStatusShipped))
+
+		if rr.Code != http.StatusConflict {
+			t.Errorf("expected status code %d, got %d", http.StatusConflict, rr.Code)
+		}
+		if orders.orders[1].Status != domain.OrderStatusPending {
+			t.Errorf("expected status to stay pending, got %s", orders.orders[1].Status)
+		}
+		if len(orders.history) != 0 {
+			t.Errorf("expected no history, got %d entries", len(orders.history))
+		}
+	})
+
+	t.Run("should move the order and record the transition", func(t *testing.T) {
+		orders := newOrderStore(domain.OrderStatusPaid, twoOfProduct7)
+		products := &mockProductStore{stock: map[int]int{7: 3}}
+		handler := newOrderHandler(orders, products)
+
+		rr := serveOrderRequest(handler, newStatusRequest(t, "1", domain.OrderStatusShipped))
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if orders.orders[1].Status != domain.OrderStatusShipped {
+			t.Errorf("expected status shipped, got %s", orders.orders[1].Status)
+		}
+		if len(orders.history) != 1 {
+			t.Fatalf("expected 1 history entry, got %d", len(orders.history))
+		}
+		entry := orders.history[0]
+		if entry.FromStatus != domain.OrderStatusPaid || entry.ToStatus != domain.OrderStatusShipped || entry.ActorID != "admin-1" {
+			t.Errorf("unexpected history entry %+v", entry)
+		}
+		if products.stock[7] != 3 {
+			t.Errorf("expected stock to be untouched, got %d", products.stock[7])
+		}
+	})
+
+	t.Run("should return stock when the order is cancelled", func(t *testing.T) {
+		orders := newOrderStore(domain.OrderStatusPending, twoOfProduct7)
+		products := &mockProductStore{stock: map[int]int{7: 3}}
+		handler := newOrderHandler(orders, products)
+
+		rr := serveOrderRequest(handler, newStatusRequest(t, "1", domain.OrderStatusCancelled))
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if orders.orders[1].Status != domain.OrderStatusCancelled {
+			t.Errorf("expected status cancelled, got %s", orders.orders[1].Status)
+		}
+		if products.stock[7] != 5 {
+			t.Errorf("expected stock 5 after cancellation, got %d", products.stock[7])
+		}
+	})
+
+	t.Run("should void the authorization when the order is cancelled", func(t *testing.T) {
+		orders := newOrderStore(domain.OrderStatusPending)
+		provider := gateway.NewFakeProvider("secret", "", nil)
+		reference, err := provider.Authorize(domain.PaymentRequest{Amount: money("20"), Source: "4242424242424242"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		uow := &mockUnitOfWork{
+			orders:   orders,
+			products: &mockProductStore{},
+			payments: &mockPaymentStore{payments: []domain.Payment{
+				{ID: 1, OrderID: 1, Provider: "fake", Reference: reference, Amount: money("20"), Status: domain.PaymentStatusAuthorized},
+			}},
+		}
+		handler := NewHandler(orders, uow, provider)
+
+		rr := serveOrderRequest(handler, newStatusRequest(t, "1", domain.OrderStatusCancelled))
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body)
+		}
+		if status := uow.payments.payments[0].Status; status != domain.PaymentStatusVoided {
+			t.Errorf("expected the payment to be voided, got %s", status)
+		}
+		if status := provider.Status(reference); status != domain.PaymentStatusVoided {
+			t.Errorf("expected the provider to void the payment, got %s", status)
+		}
+	})
+
+	t.Run("should refund the capture when the order is cancelled", func(t *testing.T) {
+		provider := gateway.NewFakeProvider("secret", "", nil)
+		orders := newRefundOrders(domain.OrderStatusPaid)
+		uow := &mockUnitOfWork{
+			orders:   orders,
+			products: &mockProductStore{stock: map[int]int{7: 3}},
+			payments: &mockPaymentStore{payments: []domain.Payment{capturePayment(t, provider, money("35"))}},
+		}
+		handler := NewHandler(orders, uow, provider)
+
+		rr := serveOrderRequest(handler, newStatusRequest(t, "1", domain.OrderStatusCancelled))
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body)
+		}
+		order := uow.orders.orders[1]
+		if order.Status != domain.OrderStatusCancelled || order.Refunded != order.Total {
+			t.Errorf("expected a cancelled order refunded in full, got %s and %v", order.Status, order.Refunded)
+		}
+		payment := uow.payments.payments[0]
+		if payment.Status != domain.PaymentStatusRefunded || provider.Status(payment.Reference) != domain.PaymentStatusRefunded {
+			t.Errorf("expected the payment to be refunded, got %s", payment.Status)
+		}
+		if uow.products.stock[7] != 5 || uow.products.stock[8] != 3 {
+			t.Errorf("expected the items to be restocked once, got %v", uow.products.stock)
+		}
+	})
+}
+
+func TestCanTransition(t *testing.T) {
+	allowed := [][2]string{
+		{domain.OrderStatusPending, domain.OrderStatusPaid},
+		{domain.OrderStatusPending, domain.OrderStatusCancelled},
+		{domain.OrderStatusPaid, domain.OrderStatusShipped},
+		{domain.OrderStatusPaid, domain.OrderStatusCancelled},
+		{domain.OrderStatusShipped, domain.OrderStatusDelivered},
+		{domain.OrderStatusDelivered, domain.OrderStatusCompleted},
+	}
+	for _, pair := range allowed {
+		if !CanTransition(pair[0], pair[1]) {
+			t.Errorf("expected %s -> %s to be allowed", pair[0], pair[1])
+		}
+	}
+
+	rejected := [][2]string{
+		{domain.OrderStatusPending, domain.OrderStatusShipped},
+		{domain.OrderStatusShipped, domain.OrderStatusCancelled},
+		{domain.OrderStatusCancelled, domain.OrderStatusPending},
+		{domain.OrderStatusCompleted, domain.OrderStatusCancelled},
+		// partially refunded orders never move back into fulfilment, as
+		// they may have been cancelled or completed before the refund
+		{domain.OrderStatusPartiallyRefunded, domain.OrderStatusShipped},
+		{domain.OrderStatusPartiallyRefunded, domain.OrderStatusDelivered},
+		{domain.OrderStatusPartiallyRefunded, domain.OrderStatusCompleted},
+	}
+	for _, pair := range rejected {
+		if CanTransition(pair[0], pair[1]) {
+			t.Errorf("expected %s -> %s to be rejected", pair[0], pair[1])
+		}
+	}
+}
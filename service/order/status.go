@@ -0,0 +1,86 @@
+package order
+
+import (
+	"ecom/domain"
+	"fmt"
+)
+
+// transitions lists the statuses an order may move to from each status.
+// Paid orders can be refunded at any point, the refund statuses are only
+// reached through Refund. A partially refunded order could have been
+// completed before, so it only moves on to refunded. Cancelled orders stay
+// cancelled when their money is given back.
+var transitions = map[string][]string{
+	domain.OrderStatusPending:           {domain.OrderStatusPaid, domain.OrderStatusCancelled},
+	domain.OrderStatusPaid:              {domain.OrderStatusShipped, domain.OrderStatusCancelled, domain.OrderStatusPartiallyRefunded, domain.OrderStatusRefunded},
+	domain.OrderStatusShipped:           {domain.OrderStatusDelivered, domain.OrderStatusPartiallyRefunded, domain.OrderStatusRefunded},
+	domain.OrderStatusDelivered:         {domain.OrderStatusCompleted, domain.OrderStatusPartiallyRefunded, domain.OrderStatusRefunded},
+	domain.OrderStatusCompleted:         {domain.OrderStatusPartiallyRefunded, domain.OrderStatusRefunded},
+	domain.OrderStatusPartiallyRefunded: {domain.OrderStatusRefunded},
+}
+
+func isKnownStatus(status string) bool {
+	switch status {
+	case domain.OrderStatusPending, domain.OrderStatusPaid, domain.OrderStatusShipped,
+		domain.OrderStatusDelivered, domain.OrderStatusCompleted, domain.OrderStatusCancelled,
+		domain.OrderStatusPartiallyRefunded, domain.OrderStatusRefunded:
+		return true
+	}
+	return false
+}
+
+func isRefundStatus(status string) bool {
+	return status == domain.OrderStatusPartiallyRefunded || status == domain.OrderStatusRefunded
+}
+
+func CanTransition(from, to string) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Transition moves the order to the given status and records it in the
+// order history. Cancelling an order puts its items back in stock. It must
+// be called inside a unit of work so all of this is applied atomically.
+func Transition(repos domain.Repositories, orderID int, to string, actorID string) (*domain.Order, error) {
+	order, err := repos.Orders().GetOrderByID(orderID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !CanTransition(order.Status, to) {
+		return nil, fmt.Errorf("cannot change order status from %s to %s", order.Status, to)
+	}
+
+	if err := repos.Orders().UpdateOrderStatus(order.ID, order.Status, to); err != nil {
+		return nil, err
+	}
+
+	err = repos.Orders().CreateOrderStatusHistory(domain.OrderStatusHistory{
+		OrderID:    order.ID,
+		FromStatus: order.Status,
+		ToStatus:   to,
+		ActorID:    actorID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if to == domain.OrderStatusCancelled {
+		items, err := repos.Orders().GetOrderItems(order.ID)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range *items {
+			if err := repos.Products().UpdateProductStock(item.ProductID, item.WarehouseID, item.Quantity); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	order.Status = to
+	return order, nil
+}
@@ -2,20 +2,29 @@ package order
 
 import (
 	"database/sql"
+	"ecom/db"
 	"ecom/domain"
+	"errors"
+	"fmt"
+	"strings"
 )
 
 type Store struct {
-	db *sql.DB
+	db db.Querier
 }
 
 func NewStore(db *sql.DB) *Store {
 	return &Store{db: db}
 }
 
+// WithTx returns a store whose queries run inside tx.
+func (s *Store) WithTx(tx *sql.Tx) *Store {
+	return &Store{db: tx}
+}
+
 func (s *Store) CreateOrder(order domain.Order) (int, error) {
-	result, err := s.db.Exec("INSERT INTO orders (userId, total, status, address) VALUES (?, ?, ?, ?)",
-		order.UserID, order.Total, order.Status, order.Address)
+	result, err := s.db.Exec("INSERT INTO orders (userId, total, discount, tax, shippingMethodId, shippingMethod, shipping, status, address, billingAddress) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		order.UserID, order.Total, order.Discount, order.Tax, order.ShippingMethodID, order.ShippingMethod, order.Shipping, order.Status, order.Address, order.BillingAddress)
 	if err != nil {
 		return 0, err
 	}
@@ -28,8 +37,365 @@ func (s *Store) CreateOrder(order domain.Order) (int, error) {
 	return int(id), nil
 }
 
+// CreateOrderItem writes the item along with its tax lines. Call it inside a
+// unit of work so a failed tax line doesn't leave the item behind.
 func (s *Store) CreateOrderItem(orderItem domain.OrderItem) error {
-	_, err := s.db.Exec("INSERT INTO order_items (orderId, productId, quantity, price) VALUES (?, ?, ?, ?)",
-		orderItem.OrderID, orderItem.ProductID, orderItem.Quantity, orderItem.Price)
+	result, err := s.db.Exec("INSERT INTO order_items (orderId, productId, warehouseId, quantity, price, total) VALUES (?, ?, ?, ?, ?, ?)",
+		orderItem.OrderID, orderItem.ProductID, orderItem.WarehouseID, orderItem.Quantity, orderItem.Price, orderItem.Total)
+	if err != nil {
+		return err
+	}
+
+	if len(orderItem.Taxes) == 0 {
+		return nil
+	}
+
+	itemID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	for _, tax := range orderItem.Taxes {
+		_, err := s.db.Exec("INSERT INTO order_item_taxes (orderItemId, name, rate, amount) VALUES (?, ?, ?, ?)",
+			itemID, tax.Name, tax.Rate, tax.Amount)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Store) GetOrderByID(id int) (*domain.Order, error) {
+	row := s.db.QueryRow("SELECT id, userId, total, discount, tax, shippingMethodId, shippingMethod, shipping, refunded, status, address, COALESCE(billingAddress, ''), createdAt FROM orders WHERE id = ?", id)
+
+	order := new(domain.Order)
+	var shippingMethodID sql.NullInt64
+	err := row.Scan(
+		&order.ID,
+		&order.UserID,
+		&order.Total,
+		&order.Discount,
+		&order.Tax,
+		&shippingMethodID,
+		&order.ShippingMethod,
+		&order.Shipping,
+		&order.Refunded,
+		&order.Status,
+		&order.Address,
+		&order.BillingAddress,
+		&order.CreatedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrOrderNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	order.ShippingMethodID = nullableID(shippingMethodID)
+
+	return order, nil
+}
+
+func nullableID(id sql.NullInt64) *int {
+	if !id.Valid {
+		return nil
+	}
+	value := int(id.Int64)
+	return &value
+}
+
+func (s *Store) LockOrder(id int) error {
+	var locked int
+	err := s.db.QueryRow("SELECT id FROM orders WHERE id = ? FOR UPDATE", id).Scan(&locked)
+	if errors.Is(err, sql.ErrNoRows) {
+		return domain.ErrOrderNotFound
+	}
 	return err
 }
+
+func (s *Store) GetOrderItems(orderID int) (*[]domain.OrderItem, error) {
+	rows, err := s.db.Query("SELECT id, orderId, productId, warehouseId, quantity, price, total, refundedQuantity FROM order_items WHERE orderId = ?", orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := make([]domain.OrderItem, 0)
+	for rows.Next() {
+		var item domain.OrderItem
+		err := rows.Scan(
+			&item.ID,
+			&item.OrderID,
+			&item.ProductID,
+			&item.WarehouseID,
+			&item.Quantity,
+			&item.Price,
+			&item.Total,
+			&item.RefundedQuantity,
+		)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+
+	return &items, rows.Err()
+}
+
+func (s *Store) UpdateOrderStatus(id int, from, to string) error {
+	// only move the order if nobody else has moved it since it was read
+	result, err := s.db.Exec("UPDATE orders SET status = ? WHERE id = ? AND status = ?", to, id, from)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrOrderStatusConflict
+	}
+
+	return nil
+}
+
+func (s *Store) CreateOrderStatusHistory(history domain.OrderStatusHistory) error {
+	_, err := s.db.Exec("INSERT INTO order_status_history (orderId, fromStatus, toStatus, actorId) VALUES (?, ?, ?, ?)",
+		history.OrderID, history.FromStatus, history.ToStatus, history.ActorID)
+	return err
+}
+
+func (s *Store) CreateRefund(refund domain.Refund) (int, error) {
+	// the conditional updates lock the order and its items, so concurrent
+	// refunds can't give back more than was charged
+	result, err := s.db.Exec("UPDATE orders SET refunded = refunded + ? WHERE id = ? AND refunded + ? <= total",
+		refund.Amount, refund.OrderID, refund.Amount)
+	if err != nil {
+		return 0, err
+	}
+	if err := requireAffected(result); err != nil {
+		return 0, err
+	}
+
+	for _, item := range refund.Items {
+		result, err := s.db.Exec("UPDATE order_items SET refundedQuantity = refundedQuantity + ? WHERE id = ? AND orderId = ? AND refundedQuantity + ? <= quantity",
+			item.Quantity, item.OrderItemID, refund.OrderID, item.Quantity)
+		if err != nil {
+			return 0, err
+		}
+		if err := requireAffected(result); err != nil {
+			return 0, err
+		}
+	}
+
+	result, err = s.db.Exec("INSERT INTO refunds (orderId, paymentId, amount, status, reason, restock, actorId) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		refund.OrderID, refund.PaymentID, refund.Amount, refund.Status, refund.Reason, refund.Restock, refund.ActorID)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, item := range refund.Items {
+		_, err := s.db.Exec("INSERT INTO refund_items (refundId, orderItemId, quantity, amount) VALUES (?, ?, ?, ?)",
+			id, item.OrderItemID, item.Quantity, item.Amount)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return int(id), nil
+}
+
+func (s *Store) CompleteRefund(id int) error {
+	result, err := s.db.Exec("UPDATE refunds SET status = ? WHERE id = ? AND status = ?",
+		domain.RefundStatusCompleted, id, domain.RefundStatusPending)
+	if err != nil {
+		return err
+	}
+	return requireAffected(result)
+}
+
+func (s *Store) FailRefund(refund domain.Refund) error {
+	// only a pending refund holds anything to give back
+	result, err := s.db.Exec("UPDATE refunds SET status = ? WHERE id = ? AND status = ?",
+		domain.RefundStatusFailed, refund.ID, domain.RefundStatusPending)
+	if err != nil {
+		return err
+	}
+	if err := requireAffected(result); err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec("UPDATE orders SET refunded = refunded - ? WHERE id = ?", refund.Amount, refund.OrderID)
+	if err != nil {
+		return err
+	}
+
+	for _, item := range refund.Items {
+		_, err := s.db.Exec("UPDATE order_items SET refundedQuantity = refundedQuantity - ? WHERE id = ? AND orderId = ?",
+			item.Quantity, item.OrderItemID, refund.OrderID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func requireAffected(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrRefundConflict
+	}
+	return nil
+}
+
+func (s *Store) GetOrders(filter domain.OrderFilter) (*[]domain.Order, int, error) {
+	conditions := []string{"userId = ?"}
+	args := []interface{}{filter.UserID}
+	if filter.Status != "" {
+		conditions = append(conditions, "status = ?")
+		args = append(args, filter.Status)
+	}
+	if filter.From != nil {
+		conditions = append(conditions, "createdAt >= ?")
+		args = append(args, *filter.From)
+	}
+	if filter.To != nil {
+		conditions = append(conditions, "createdAt < ?")
+		args = append(args, *filter.To)
+	}
+	where := strings.Join(conditions, " AND ")
+
+	var total int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM orders WHERE "+where, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := fmt.Sprintf(`
+		SELECT id, userId, total, discount, tax, shippingMethodId, shippingMethod, shipping, refunded, status, address, COALESCE(billingAddress, ''), createdAt
+		FROM orders
+		WHERE %s
+		ORDER BY createdAt DESC, id DESC
+		LIMIT ? OFFSET ?
+	`, where)
+
+	rows, err := s.db.Query(query, append(args, filter.Limit, filter.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	orders := make([]domain.Order, 0)
+	for rows.Next() {
+		var order domain.Order
+		var shippingMethodID sql.NullInt64
+		err := rows.Scan(
+			&order.ID,
+			&order.UserID,
+			&order.Total,
+			&order.Discount,
+			&order.Tax,
+			&shippingMethodID,
+			&order.ShippingMethod,
+			&order.Shipping,
+			&order.Refunded,
+			&order.Status,
+			&order.Address,
+			&order.BillingAddress,
+			&order.CreatedAt,
+		)
+		if err != nil {
+			return nil, 0, err
+		}
+		order.ShippingMethodID = nullableID(shippingMethodID)
+		orders = append(orders, order)
+	}
+
+	return &orders, total, rows.Err()
+}
+
+func (s *Store) GetOrderLines(orderID int) (*[]domain.OrderLine, error) {
+	rows, err := s.db.Query(`
+		SELECT oi.id, oi.orderId, oi.productId, oi.warehouseId, oi.quantity, oi.price, oi.total, oi.refundedQuantity, p.name
+		FROM order_items oi
+		JOIN products p ON p.id = oi.productId
+		WHERE oi.orderId = ?
+		ORDER BY oi.id
+	`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lines := make([]domain.OrderLine, 0)
+	for rows.Next() {
+		line := domain.OrderLine{OrderItem: domain.OrderItem{Taxes: make([]domain.TaxLine, 0)}}
+		err := rows.Scan(
+			&line.ID,
+			&line.OrderID,
+			&line.ProductID,
+			&line.WarehouseID,
+			&line.Quantity,
+			&line.Price,
+			&line.Total,
+			&line.RefundedQuantity,
+			&line.ProductName,
+		)
+		if err != nil {
+			return nil, err
+		}
+		lines = append(lines, line)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if err := s.attachTaxes(orderID, lines); err != nil {
+		return nil, err
+	}
+
+	return &lines, nil
+}
+
+// attachTaxes loads the tax lines of the order's items into lines.
+func (s *Store) attachTaxes(orderID int, lines []domain.OrderLine) error {
+	rows, err := s.db.Query(`
+		SELECT t.orderItemId, t.name, t.rate, t.amount
+		FROM order_item_taxes t
+		JOIN order_items oi ON oi.id = t.orderItemId
+		WHERE oi.orderId = ?
+		ORDER BY t.id
+	`, orderID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	byItem := make(map[int]int, len(lines))
+	for i, line := range lines {
+		byItem[line.ID] = i
+	}
+
+	for rows.Next() {
+		var itemID int
+		var tax domain.TaxLine
+		if err := rows.Scan(&itemID, &tax.Name, &tax.Rate, &tax.Amount); err != nil {
+			return err
+		}
+		if i, ok := byItem[itemID]; ok {
+			lines[i].Taxes = append(lines[i].Taxes, tax)
+		}
+	}
+
+	return rows.Err()
+}
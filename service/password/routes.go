@@ -0,0 +1,171 @@
+package password
+
+import (
+	"ecom/config"
+	"ecom/domain"
+	"ecom/utils"
+	"errors"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+type Handler struct {
+	store  domain.PasswordResetRepository
+	users  domain.UserRepository
+	tokens domain.TokenRepository
+	auth   domain.AuthService
+	mailer domain.Mailer
+
+	// sending tracks the reset links being sent in the background
+	sending sync.WaitGroup
+}
+
+func NewHandler(store domain.PasswordResetRepository, users domain.UserRepository, tokens domain.TokenRepository, auth domain.AuthService, mailer domain.Mailer) *Handler {
+	return &Handler{
+		store:  store,
+		users:  users,
+		tokens: tokens,
+		auth:   auth,
+		mailer: mailer,
+	}
+}
+
+func (h *Handler) PasswordRoutes(router *mux.Router) {
+	router.HandleFunc("/password/forgot", h.handleForgotPassword).Methods(http.MethodPost)
+	router.HandleFunc("/password/reset", h.handleResetPassword).Methods(http.MethodPost)
+}
+
+func (h *Handler) handleForgotPassword(w http.ResponseWriter, r *http.Request) {
+	// get JSON payload
+	var payload domain.ForgotPasswordPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// validate the payload
+	err := utils.Validate.Struct(payload)
+	if err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", validationErrors))
+		return
+	}
+
+	// the link is sent in the background so neither the response nor the
+	// time it takes tell whether the email is registered, and failures are
+	// only logged
+	h.sending.Add(1)
+	go func() {
+		defer h.sending.Done()
+		if err := h.sendResetLink(payload.Email); err != nil {
+			log.Println("password reset:", err)
+		}
+	}()
+
+	utils.WriteJSON(w, http.StatusAccepted, map[string]string{"message": "if the email is registered, a reset link has been sent"})
+}
+
+func (h *Handler) sendResetLink(email string) error {
+	user, err := h.users.GetUserByEmail(email)
+	if errors.Is(err, domain.ErrUserNotFound) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	token, hash, err := h.auth.GenerateToken()
+	if err != nil {
+		return err
+	}
+
+	err = h.store.CreatePasswordResetToken(domain.PasswordResetToken{
+		ID:        uuid.New().String(),
+		UserID:    user.ID,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(config.ENV.PasswordResetTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	// the frontend serves the form that posts the token to /password/reset
+	link := fmt.Sprintf("%s/reset-password?token=%s", config.ENV.FrontendURL, url.QueryEscape(token))
+	return h.mailer.Send(domain.Mail{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\nUse the link below to choose a new password. It expires in %s.\n\n%s\n\nIf you didn't ask for this, you can ignore this email.\n",
+			user.FirstName, config.ENV.PasswordResetTTL, link),
+	})
+}
+
+func (h *Handler) handleResetPassword(w http.ResponseWriter, r *http.Request) {
+	// get JSON payload
+	var payload domain.ResetPasswordPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// validate the payload
+	err := utils.Validate.Struct(payload)
+	if err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", validationErrors))
+		return
+	}
+
+	invalidToken := fmt.Errorf("invalid or expired reset token")
+
+	// look up the reset token
+	stored, err := h.store.GetPasswordResetTokenByHash(h.auth.HashToken(payload.Token))
+	if errors.Is(err, domain.ErrPasswordResetTokenNotFound) {
+		utils.WriteError(w, http.StatusBadRequest, invalidToken)
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if stored.UsedAt != nil || time.Now().After(stored.ExpiresAt) {
+		utils.WriteError(w, http.StatusBadRequest, invalidToken)
+		return
+	}
+
+	// claim the token so it can't be used twice
+	claimed, err := h.store.MarkPasswordResetTokenUsed(stored.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !claimed {
+		utils.WriteError(w, http.StatusBadRequest, invalidToken)
+		return
+	}
+
+	// hash and store the new password
+	hashedPassword, err := h.auth.HashPassword(payload.Password)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := h.users.UpdatePassword(stored.UserID, hashedPassword); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// sign out every session that may have used the old password
+	if err := h.tokens.RevokeUserRefreshTokens(stored.UserID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "password has been reset"})
+}
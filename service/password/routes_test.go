@@ -0,0 +1,263 @@
+package password
+
+import (
+	"bytes"
+	"ecom/config"
+	"ecom/domain"
+	"ecom/mailer"
+	"ecom/service/auth"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type mockPasswordResetStore struct {
+	tokens map[string]*domain.PasswordResetToken
+}
+
+func (m *mockPasswordResetStore) CreatePasswordResetToken(token domain.PasswordResetToken) error {
+	m.tokens[token.TokenHash] = &token
+	return nil
+}
+
+func (m *mockPasswordResetStore) GetPasswordResetTokenByHash(hash string) (*domain.PasswordResetToken, error) {
+	token, ok := m.tokens[hash]
+	if !ok {
+		return nil, domain.ErrPasswordResetTokenNotFound
+	}
+	copied := *token
+	return &copied, nil
+}
+
+func (m *mockPasswordResetStore) MarkPasswordResetTokenUsed(id string) (bool, error) {
+	for _, token := range m.tokens {
+		if token.ID == id {
+			if token.UsedAt != nil {
+				return false, nil
+			}
+			now := time.Now()
+			token.UsedAt = &now
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type mockUserStore struct {
+	domain.UserRepository
+	user *domain.User
+}
+
+func (m *mockUserStore) GetUserByEmail(email string) (*domain.User, error) {
+	if email == m.user.Email {
+		return m.user, nil
+	}
+	return nil, domain.ErrUserNotFound
+}
+
+func (m *mockUserStore) UpdatePassword(id string, hashedPassword string) error {
+	m.user.Password = hashedPassword
+	return nil
+}
+
+type mockTokenStore struct {
+	domain.TokenRepository
+	revokedUsers []string
+}
+
+func (m *mockTokenStore) RevokeUserRefreshTokens(userID string) error {
+	m.revokedUsers = append(m.revokedUsers, userID)
+	return nil
+}
+
+// newUserStore returns a store holding John, whose password is "old".
+func newUserStore() *mockUserStore {
+	return &mockUserStore{user: &domain.User{ID: "1", FirstName: "John", Email: "john.doe@gmail.com", Password: "old"}}
+}
+
+// newResetStore returns a store without reset tokens.
+func newResetStore() *mockPasswordResetStore {
+	return &mockPasswordResetStore{tokens: make(map[string]*domain.PasswordResetToken)}
+}
+
+func servePost(t *testing.T, router *mux.Router, url string, payload any) *httptest.ResponseRecorder {
+	marshaled, _ := json.Marshal(payload)
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewBuffer(marshaled))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+var tokenPattern = regexp.MustCompile(`token=(\S+)`)
+
+// requestReset runs the forgot password flow and returns the emailed token.
+func requestReset(t *testing.T, router *mux.Router, handler *Handler, memory *mailer.MemoryMailer) string {
+	rr := servePost(t, router, "/password/forgot", domain.ForgotPasswordPayload{Email: "john.doe@gmail.com"})
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("expected status code %d, got %d", http.StatusAccepted, rr.Code)
+	}
+	handler.sending.Wait()
+
+	sent := memory.Sent()
+	if len(sent) == 0 {
+		t.Fatal("expected a reset email")
+	}
+	match := tokenPattern.FindStringSubmatch(sent[len(sent)-1].Body)
+	if match == nil {
+		t.Fatal("expected the email to contain a reset link")
+	}
+	token, err := url.QueryUnescape(match[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+func TestHandleForgotPassword(t *testing.T) {
+	store := newResetStore()
+	users := newUserStore()
+	memory := mailer.NewMemoryMailer()
+	handler := NewHandler(store, users, &mockTokenStore{}, auth.NewStore(), memory)
+	router := mux.NewRouter()
+	handler.PasswordRoutes(router)
+
+	known := servePost(t, router, "/password/forgot", domain.ForgotPasswordPayload{Email: "john.doe@gmail.com"})
+	unknown := servePost(t, router, "/password/forgot", domain.ForgotPasswordPayload{Email: "nobody@gmail.com"})
+
+	if known.Code != http.StatusAccepted || unknown.Code != http.StatusAccepted {
+		t.Errorf("expected status code %d for both, got %d and %d", http.StatusAccepted, known.Code, unknown.Code)
+	}
+	if known.Body.String() != unknown.Body.String() {
+		t.Errorf("expected identical responses, got %q and %q", known.Body.String(), unknown.Body.String())
+	}
+	handler.sending.Wait()
+
+	sent := memory.Sent()
+	if len(sent) != 1 || sent[0].To != "john.doe@gmail.com" {
+		t.Fatalf("expected a single email to the registered user, got %+v", sent)
+	}
+	if !strings.Contains(sent[0].Body, config.ENV.FrontendURL+"/reset-password?token=") {
+		t.Errorf("expected the link to point at the frontend reset form, got %q", sent[0].Body)
+	}
+
+	for _, stored := range store.tokens {
+		if tokenPattern.FindStringSubmatch(sent[0].Body)[1] == stored.TokenHash {
+			t.Errorf("expected only the token hash to be stored")
+		}
+	}
+}
+
+// blockingMailer holds every send until it is released.
+type blockingMailer struct {
+	release chan struct{}
+}
+
+func (m *blockingMailer) Send(mail domain.Mail) error {
+	<-m.release
+	return nil
+}
+
+func TestHandleForgotPasswordInBackground(t *testing.T) {
+	store := newResetStore()
+	users := newUserStore()
+	blocking := &blockingMailer{release: make(chan struct{})}
+	handler := NewHandler(store, users, &mockTokenStore{}, auth.NewStore(), blocking)
+	router := mux.NewRouter()
+	handler.PasswordRoutes(router)
+
+	rr := servePost(t, router, "/password/forgot", domain.ForgotPasswordPayload{Email: "john.doe@gmail.com"})
+	close(blocking.release)
+	handler.sending.Wait()
+
+	if rr.Code != http.StatusAccepted {
+		t.Errorf("expected status code %d before the email was sent, got %d", http.StatusAccepted, rr.Code)
+	}
+}
+
+func TestHandleResetPassword(t *testing.T) {
+	t.Run("should set the new password and sign out other sessions", func(t *testing.T) {
+		users := newUserStore()
+		tokens := &mockTokenStore{}
+		memory := mailer.NewMemoryMailer()
+		handler := NewHandler(newResetStore(), users, tokens, auth.NewStore(), memory)
+		router := mux.NewRouter()
+		handler.PasswordRoutes(router)
+		token := requestReset(t, router, handler, memory)
+
+		rr := servePost(t, router, "/password/reset", domain.ResetPasswordPayload{Token: token, Password: "new-password"})
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if err := auth.NewStore().ComparePassword(users.user.Password, "new-password"); err != nil {
+			t.Errorf("expected the password to be re-hashed: %v", err)
+		}
+		if len(tokens.revokedUsers) != 1 || tokens.revokedUsers[0] != "1" {
+			t.Errorf("expected the user's refresh tokens to be revoked")
+		}
+	})
+
+	t.Run("should only accept a token once", func(t *testing.T) {
+		memory := mailer.NewMemoryMailer()
+		handler := NewHandler(newResetStore(), newUserStore(), &mockTokenStore{}, auth.NewStore(), memory)
+		router := mux.NewRouter()
+		handler.PasswordRoutes(router)
+		token := requestReset(t, router, handler, memory)
+
+		servePost(t, router, "/password/reset", domain.ResetPasswordPayload{Token: token, Password: "new-password"})
+		rr := servePost(t, router, "/password/reset", domain.ResetPasswordPayload{Token: token, Password: "other-password"})
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should reject expired and unknown tokens", func(t *testing.T) {
+		store := newResetStore()
+		users := newUserStore()
+		memory := mailer.NewMemoryMailer()
+		handler := NewHandler(store, users, &mockTokenStore{}, auth.NewStore(), memory)
+		router := mux.NewRouter()
+		handler.PasswordRoutes(router)
+		token := requestReset(t, router, handler, memory)
+		for _, stored := range store.tokens {
+			stored.ExpiresAt = time.Now().Add(-time.Minute)
+		}
+
+		for _, candidate := range []string{token, "unknown"} {
+			rr := servePost(t, router, "/password/reset", domain.ResetPasswordPayload{Token: candidate, Password: "new-password"})
+
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+			}
+		}
+		if users.user.Password != "old" {
+			t.Errorf("expected the password to be unchanged")
+		}
+	})
+
+	t.Run("should return 400 for a short password", func(t *testing.T) {
+		memory := mailer.NewMemoryMailer()
+		handler := NewHandler(newResetStore(), newUserStore(), &mockTokenStore{}, auth.NewStore(), memory)
+		router := mux.NewRouter()
+		handler.PasswordRoutes(router)
+		token := requestReset(t, router, handler, memory)
+
+		rr := servePost(t, router, "/password/reset", domain.ResetPasswordPayload{Token: token, Password: "123"})
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+}
@@ -0,0 +1,56 @@
+package password
+
+import (
+	"database/sql"
+	"ecom/domain"
+	"errors"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) CreatePasswordResetToken(token domain.PasswordResetToken) error {
+	_, err := s.db.Exec("INSERT INTO password_reset_tokens (id, userId, tokenHash, expiresAt) VALUES (?, ?, ?, ?)",
+		token.ID, token.UserID, token.TokenHash, token.ExpiresAt)
+	return err
+}
+
+func (s *Store) GetPasswordResetTokenByHash(hash string) (*domain.PasswordResetToken, error) {
+	row := s.db.QueryRow("SELECT id, userId, tokenHash, expiresAt, usedAt, createdAt FROM password_reset_tokens WHERE tokenHash = ?", hash)
+
+	token := new(domain.PasswordResetToken)
+	err := row.Scan(
+		&token.ID,
+		&token.UserID,
+		&token.TokenHash,
+		&token.ExpiresAt,
+		&token.UsedAt,
+		&token.CreatedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrPasswordResetTokenNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+func (s *Store) MarkPasswordResetTokenUsed(id string) (bool, error) {
+	result, err := s.db.Exec("UPDATE password_reset_tokens SET usedAt = NOW() WHERE id = ? AND usedAt IS NULL", id)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected == 1, nil
+}
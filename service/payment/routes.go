@@ -0,0 +1,114 @@
+package payment
+
+import (
+	"ecom/domain"
+	"ecom/service/order"
+	"ecom/utils"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// maxWebhookSize bounds the webhook bodies read into memory.
+const maxWebhookSize = 64 << 10
+
+type Handler struct {
+	uow      domain.UnitOfWork
+	provider domain.PaymentProvider
+}
+
+func NewHandler(uow domain.UnitOfWork, provider domain.PaymentProvider) *Handler {
+	return &Handler{uow: uow, provider: provider}
+}
+
+func (h *Handler) PaymentRoutes(router *mux.Router) {
+	router.HandleFunc("/payments/webhook", h.handleWebhook).Methods(http.MethodPost)
+}
+
+func (h *Handler) handleWebhook(w http.ResponseWriter, r *http.Request) {
+	// the signature covers the raw body, so read it as is
+	payload, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxWebhookSize))
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	event, err := h.provider.VerifyWebhook(payload, r.Header.Get(domain.PaymentSignatureHeader))
+	if errors.Is(err, domain.ErrInvalidWebhookSignature) {
+		utils.WriteError(w, http.StatusUnauthorized, err)
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid event: %v", err))
+		return
+	}
+
+	if event.Type != domain.PaymentEventCaptured {
+		utils.WriteJSON(w, http.StatusOK, map[string]bool{"received": true})
+		return
+	}
+
+	var orderID int
+	err = h.uow.Do(func(repos domain.Repositories) error {
+		orderID, err = h.capture(repos, event)
+		return err
+	})
+	if err == nil && orderID != 0 {
+		// the order was cancelled while the capture was underway, give the
+		// money back now that the capture is recorded
+		err = order.ReleasePayments(h.uow, h.provider, orderID, "payment:"+h.provider.Name())
+	}
+	if errors.Is(err, domain.ErrPaymentNotFound) {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if errors.Is(err, domain.ErrPaymentStatusConflict) || errors.Is(err, domain.ErrOrderStatusConflict) ||
+		errors.Is(err, domain.ErrRefundConflict) || errors.Is(err, domain.ErrOrderNotRefundable) {
+		// the provider retries, by then the concurrent change is visible
+		utils.WriteError(w, http.StatusConflict, err)
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]bool{"received": true})
+}
+
+// capture records a captured payment and marks its order as paid. Providers
+// deliver events at least once, so an event seen before changes nothing. It
+// returns the ID of the order when the order was cancelled and the captured
+// money has to go back, also when a previous delivery couldn't do it.
+func (h *Handler) capture(repos domain.Repositories, event *domain.PaymentEvent) (int, error) {
+	payment, err := repos.Payments().GetPaymentByReference(h.provider.Name(), event.Reference)
+	if err != nil {
+		return 0, err
+	}
+	if payment.Status != domain.PaymentStatusAuthorized && payment.Status != domain.PaymentStatusCaptured {
+		return 0, nil
+	}
+
+	if payment.Status == domain.PaymentStatusAuthorized {
+		err = repos.Payments().UpdatePaymentStatus(payment.ID, domain.PaymentStatusAuthorized, domain.PaymentStatusCaptured)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	current, err := repos.Orders().GetOrderByID(payment.OrderID)
+	if err != nil {
+		return 0, err
+	}
+	if current.Status == domain.OrderStatusCancelled {
+		log.Printf("payment webhook: order %d is cancelled, refunding the capture", current.ID)
+		return current.ID, nil
+	}
+	if payment.Status == domain.PaymentStatusCaptured || !order.CanTransition(current.Status, domain.OrderStatusPaid) {
+		return 0, nil
+	}
+
+	_, err = order.Transition(repos, payment.OrderID, domain.OrderStatusPaid, "payment:"+h.provider.Name())
+	return 0, err
+}
@@ -0,0 +1,277 @@
+package payment
+
+import (
+	"bytes"
+	"ecom/domain"
+	"ecom/gateway"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// money parses a test amount in the default currency.
+func money(value string) domain.Money {
+	return domain.MustParseMoney(value, domain.DefaultCurrency)
+}
+
+type mockPaymentStore struct {
+	payments map[int]*domain.Payment
+}
+
+func (m *mockPaymentStore) CreatePayment(payment domain.Payment) (int, error) {
+	payment.ID = len(m.payments) + 1
+	m.payments[payment.ID] = &payment
+	return payment.ID, nil
+}
+
+func (m *mockPaymentStore) GetPaymentByReference(provider, reference string) (*domain.Payment, error) {
+	for _, payment := range m.payments {
+		if payment.Provider == provider && payment.Reference == reference {
+			copied := *payment
+			return &copied, nil
+		}
+	}
+	return nil, domain.ErrPaymentNotFound
+}
+
+func (m *mockPaymentStore) GetPaymentsByOrderID(orderID int) (*[]domain.Payment, error) {
+	payments := make([]domain.Payment, 0)
+	for _, payment := range m.payments {
+		if payment.OrderID == orderID {
+			payments = append(payments, *payment)
+		}
+	}
+	return &payments, nil
+}
+
+func (m *mockPaymentStore) UpdatePaymentStatus(id int, from, to string) error {
+	payment := m.payments[id]
+	if payment.Status != from {
+		return domain.ErrPaymentStatusConflict
+	}
+	payment.Status = to
+	return nil
+}
+
+type mockOrderStore struct {
+	domain.OrderRepository
+	orders  map[int]*domain.Order
+	history []domain.OrderStatusHistory
+	refunds []domain.Refund
+}
+
+func (m *mockOrderStore) GetOrderByID(id int) (*domain.Order, error) {
+	order, ok := m.orders[id]
+	if !ok {
+		return nil, domain.ErrOrderNotFound
+	}
+	copied := *order
+	return &copied, nil
+}
+
+func (m *mockOrderStore) UpdateOrderStatus(id int, from, to string) error {
+	order := m.orders[id]
+	if order.Status != from {
+		return domain.ErrOrderStatusConflict
+	}
+	order.Status = to
+	return nil
+}
+
+func (m *mockOrderStore) CreateOrderStatusHistory(history domain.OrderStatusHistory) error {
+	m.history = append(m.history, history)
+	return nil
+}
+
+func (m *mockOrderStore) GetOrderItems(orderID int) (*[]domain.OrderItem, error) {
+	return &[]domain.OrderItem{}, nil
+}
+
+func (m *mockOrderStore) CreateRefund(refund domain.Refund) (int, error) {
+	order := m.orders[refund.OrderID]
+	order.Refunded = order.Refunded.Add(refund.Amount)
+	m.refunds = append(m.refunds, refund)
+	return len(m.refunds), nil
+}
+
+func (m *mockOrderStore) CompleteRefund(id int) error {
+	m.refunds[id-1].Status = domain.RefundStatusCompleted
+	return nil
+}
+
+type mockUnitOfWork struct {
+	orders   *mockOrderStore
+	payments *mockPaymentStore
+}
+
+func (m *mockUnitOfWork) Products() domain.ProductRepository {
+	return nil
+}
+
+func (m *mockUnitOfWork) Orders() domain.OrderRepository {
+	return m.orders
+}
+
+func (m *mockUnitOfWork) Carts() domain.CartRepository {
+	return nil
+}
+
+func (m *mockUnitOfWork) Promotions() domain.PromotionRepository {
+	return nil
+}
+
+func (m *mockUnitOfWork) Payments() domain.PaymentRepository {
+	return m.payments
+}
+
+func (m *mockUnitOfWork) Returns() domain.ReturnRepository {
+	return nil
+}
+
+func (m *mockUnitOfWork) Reservations() domain.ReservationRepository {
+	return nil
+}
+
+func (m *mockUnitOfWork) Warehouses() domain.WarehouseRepository {
+	return nil
+}
+
+func (m *mockUnitOfWork) Do(fn func(repos domain.Repositories) error) error {
+	return fn(m)
+}
+
+// newAuthorizedOrder returns a unit of work holding order 1 of 20.00 in status
+// and the payment authorized for it under reference.
+func newAuthorizedOrder(status, reference string) *mockUnitOfWork {
+	return &mockUnitOfWork{
+		orders: &mockOrderStore{orders: map[int]*domain.Order{1: {ID: 1, Total: money("20"), Status: status}}},
+		payments: &mockPaymentStore{payments: map[int]*domain.Payment{
+			1: {ID: 1, OrderID: 1, Provider: "fake", Reference: reference, Amount: money("20"), Status: domain.PaymentStatusAuthorized},
+		}},
+	}
+}
+
+func serveWebhook(t *testing.T, handler *Handler, payload, signature string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest(http.MethodPost, "/payments/webhook", bytes.NewBufferString(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set(domain.PaymentSignatureHeader, signature)
+
+	rr := httptest.NewRecorder()
+	router := mux.NewRouter()
+	handler.PaymentRoutes(router)
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestHandleWebhook(t *testing.T) {
+	captured := `{"type":"payment.captured","reference":"fake_1","amount":{"amount":"20.00","currency":"USD"}}`
+
+	t.Run("should reject events with a bad signature", func(t *testing.T) {
+		provider := gateway.NewFakeProvider("secret", "", nil)
+		uow := newAuthorizedOrder(domain.OrderStatusPending, "fake_1")
+		handler := NewHandler(uow, provider)
+
+		rr := serveWebhook(t, handler, captured, "deadbeef")
+
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected status code %d, got %d", http.StatusUnauthorized, rr.Code)
+		}
+		if status := uow.orders.orders[1].Status; status != domain.OrderStatusPending {
+			t.Errorf("expected the order to stay pending, got %s", status)
+		}
+	})
+
+	t.Run("should mark the order paid once", func(t *testing.T) {
+		provider := gateway.NewFakeProvider("secret", "", nil)
+		uow := newAuthorizedOrder(domain.OrderStatusPending, "fake_1")
+		handler := NewHandler(uow, provider)
+
+		for i := 0; i < 2; i++ {
+			rr := serveWebhook(t, handler, captured, provider.Sign([]byte(captured)))
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body)
+			}
+		}
+
+		if status := uow.orders.orders[1].Status; status != domain.OrderStatusPaid {
+			t.Errorf("expected the order to be paid, got %s", status)
+		}
+		if status := uow.payments.payments[1].Status; status != domain.PaymentStatusCaptured {
+			t.Errorf("expected the payment to be captured, got %s", status)
+		}
+		if len(uow.orders.history) != 1 || uow.orders.history[0].ActorID != "payment:fake" {
+			t.Errorf("expected one history entry by the provider, got %+v", uow.orders.history)
+		}
+	})
+
+	t.Run("should refund a capture of a cancelled order", func(t *testing.T) {
+		provider := gateway.NewFakeProvider("secret", "", nil)
+		reference, err := provider.Authorize(domain.PaymentRequest{Amount: money("20"), Source: "4242424242424242"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := provider.Capture(reference, money("20")); err != nil {
+			t.Fatal(err)
+		}
+		uow := newAuthorizedOrder(domain.OrderStatusCancelled, reference)
+		handler := NewHandler(uow, provider)
+		payload := `{"type":"payment.captured","reference":"` + reference + `"}`
+
+		for i := 0; i < 2; i++ {
+			rr := serveWebhook(t, handler, payload, provider.Sign([]byte(payload)))
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body)
+			}
+		}
+
+		order := uow.orders.orders[1]
+		if order.Status != domain.OrderStatusCancelled || order.Refunded != money("20") {
+			t.Errorf("expected the order to stay cancelled and be refunded, got %s and %v", order.Status, order.Refunded)
+		}
+		if status := uow.payments.payments[1].Status; status != domain.PaymentStatusRefunded {
+			t.Errorf("expected the payment to be refunded, got %s", status)
+		}
+		if status := provider.Status(reference); status != domain.PaymentStatusRefunded {
+			t.Errorf("expected the provider to refund the payment, got %s", status)
+		}
+		if len(uow.orders.refunds) != 1 {
+			t.Errorf("expected one refund, got %d", len(uow.orders.refunds))
+		}
+	})
+
+	t.Run("should return 404 for unknown payments", func(t *testing.T) {
+		provider := gateway.NewFakeProvider("secret", "", nil)
+		uow := &mockUnitOfWork{orders: &mockOrderStore{}, payments: &mockPaymentStore{}}
+		handler := NewHandler(uow, provider)
+		payload := `{"type":"payment.captured","reference":"fake_2"}`
+
+		rr := serveWebhook(t, handler, payload, provider.Sign([]byte(payload)))
+
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code %d, got %d", http.StatusNotFound, rr.Code)
+		}
+	})
+
+	t.Run("should acknowledge other events", func(t *testing.T) {
+		provider := gateway.NewFakeProvider("secret", "", nil)
+		uow := &mockUnitOfWork{
+			orders:   &mockOrderStore{orders: map[int]*domain.Order{1: {ID: 1, Status: domain.OrderStatusPending}}},
+			payments: &mockPaymentStore{},
+		}
+		handler := NewHandler(uow, provider)
+		payload := `{"type":"payment.refunded","reference":"fake_1"}`
+
+		rr := serveWebhook(t, handler, payload, provider.Sign([]byte(payload)))
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if status := uow.orders.orders[1].Status; status != domain.OrderStatusPending {
+			t.Errorf("expected the order to stay pending, got %s", status)
+		}
+	})
+}
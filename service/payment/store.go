@@ -0,0 +1,107 @@
+package payment
+
+import (
+	"database/sql"
+	"ecom/db"
+	"ecom/domain"
+	"errors"
+)
+
+type Store struct {
+	db db.Querier
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+// WithTx returns a store whose queries run inside tx.
+func (s *Store) WithTx(tx *sql.Tx) *Store {
+	return &Store{db: tx}
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanPayment(row scanner) (*domain.Payment, error) {
+	payment := new(domain.Payment)
+	err := row.Scan(
+		&payment.ID,
+		&payment.OrderID,
+		&payment.Provider,
+		&payment.Reference,
+		&payment.Amount,
+		&payment.Status,
+		&payment.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	return payment, nil
+}
+
+func (s *Store) CreatePayment(payment domain.Payment) (int, error) {
+	result, err := s.db.Exec("INSERT INTO payments (orderId, provider, reference, amount, status) VALUES (?, ?, ?, ?, ?)",
+		payment.OrderID, payment.Provider, payment.Reference, payment.Amount, payment.Status)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+func (s *Store) GetPaymentByReference(provider, reference string) (*domain.Payment, error) {
+	row := s.db.QueryRow("SELECT id, orderId, provider, reference, amount, status, createdAt FROM payments WHERE provider = ? AND reference = ?", provider, reference)
+
+	payment, err := scanPayment(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrPaymentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return payment, nil
+}
+
+func (s *Store) GetPaymentsByOrderID(orderID int) (*[]domain.Payment, error) {
+	rows, err := s.db.Query("SELECT id, orderId, provider, reference, amount, status, createdAt FROM payments WHERE orderId = ? ORDER BY id", orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	payments := make([]domain.Payment, 0)
+	for rows.Next() {
+		payment, err := scanPayment(rows)
+		if err != nil {
+			return nil, err
+		}
+		payments = append(payments, *payment)
+	}
+
+	return &payments, rows.Err()
+}
+
+func (s *Store) UpdatePaymentStatus(id int, from, to string) error {
+	result, err := s.db.Exec("UPDATE payments SET status = ? WHERE id = ? AND status = ?", to, id, from)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrPaymentStatusConflict
+	}
+
+	return nil
+}
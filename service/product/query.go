@@ -0,0 +1,199 @@
+package product
+
+import (
+	"ecom/domain"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultProductsLimit = 20
+	maxProductsLimit     = 100
+)
+
+// cursor is the decoded form of the opaque cursor handed to clients. It
+// remembers the sort it was created for so it can't be replayed against a
+// different ordering.
+type cursor struct {
+	SortBy     string `json:"s"`
+	Descending bool   `json:"d"`
+	Value      string `json:"v"`
+	ID         int    `json:"id"`
+}
+
+func parseProductQuery(r *http.Request) (domain.ProductQuery, error) {
+	params := r.URL.Query()
+	query := domain.ProductQuery{
+		Limit:  defaultProductsLimit,
+		SortBy: domain.ProductSortCreatedAt,
+	}
+
+	if limit := params.Get("limit"); limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil || value < 1 || value > maxProductsLimit {
+			return query, fmt.Errorf("limit must be between 1 and %d", maxProductsLimit)
+		}
+		query.Limit = value
+	}
+
+	if offset := params.Get("offset"); offset != "" {
+		value, err := strconv.Atoi(offset)
+		if err != nil || value < 0 {
+			return query, fmt.Errorf("invalid offset")
+		}
+		query.Offset = value
+	}
+
+	// sort is a column name, prefixed with "-" for descending order
+	if sort := params.Get("sort"); sort != "" {
+		query.Descending = strings.HasPrefix(sort, "-")
+		query.SortBy = strings.TrimPrefix(sort, "-")
+		switch query.SortBy {
+		case domain.ProductSortCreatedAt, domain.ProductSortPrice, domain.ProductSortName:
+		default:
+			return query, fmt.Errorf("sort must be one of createdAt, price or name")
+		}
+	}
+
+	if minPrice := params.Get("minPrice"); minPrice != "" {
+		value, err := domain.ParseMoney(minPrice, domain.DefaultCurrency)
+		if err != nil || value.IsNegative() {
+			return query, fmt.Errorf("invalid minPrice")
+		}
+		query.MinPrice = &value
+	}
+
+	if maxPrice := params.Get("maxPrice"); maxPrice != "" {
+		value, err := domain.ParseMoney(maxPrice, domain.DefaultCurrency)
+		if err != nil || value.IsNegative() {
+			return query, fmt.Errorf("invalid maxPrice")
+		}
+		query.MaxPrice = &value
+	}
+
+	if query.MinPrice != nil && query.MaxPrice != nil && query.MinPrice.Cmp(*query.MaxPrice) > 0 {
+		return query, fmt.Errorf("minPrice must not be greater than maxPrice")
+	}
+
+	if inStock := params.Get("inStock"); inStock != "" {
+		value, err := strconv.ParseBool(inStock)
+		if err != nil {
+			return query, fmt.Errorf("invalid inStock")
+		}
+		query.InStock = value
+	}
+
+	query.Name = strings.TrimSpace(params.Get("name"))
+
+	if encoded := params.Get("cursor"); encoded != "" {
+		if query.Offset != 0 {
+			return query, fmt.Errorf("cursor and offset cannot be combined")
+		}
+		c, err := decodeCursor(encoded, query.SortBy, query.Descending)
+		if err != nil {
+			return query, err
+		}
+		query.Cursor = c
+	}
+
+	return query, nil
+}
+
+func encodeCursor(product domain.Product, sortBy string, descending bool) string {
+	c := cursor{SortBy: sortBy, Descending: descending, ID: product.ID}
+	switch sortBy {
+	case domain.ProductSortPrice:
+		c.Value = product.Price.String()
+	case domain.ProductSortName:
+		c.Value = product.Name
+	default:
+		c.Value = product.CreatedAt.Format(time.RFC3339Nano)
+	}
+
+	marshaled, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(marshaled)
+}
+
+func decodeCursor(encoded string, sortBy string, descending bool) (*domain.ProductCursor, error) {
+	invalid := fmt.Errorf("invalid cursor")
+
+	decoded, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, invalid
+	}
+
+	var c cursor
+	if err := json.Unmarshal(decoded, &c); err != nil {
+		return nil, invalid
+	}
+
+	if c.SortBy != sortBy || c.Descending != descending {
+		return nil, fmt.Errorf("cursor does not match the requested sort")
+	}
+
+	var value interface{}
+	switch sortBy {
+	case domain.ProductSortPrice:
+		value, err = domain.ParseMoney(c.Value, domain.DefaultCurrency)
+	case domain.ProductSortName:
+		value = c.Value
+	default:
+		value, err = time.Parse(time.RFC3339Nano, c.Value)
+	}
+	if err != nil {
+		return nil, invalid
+	}
+
+	return &domain.ProductCursor{Value: value, ID: c.ID}, nil
+}
+
+// pageLinks builds the RFC 8288 Link header for a page of products. Cursor
+// requests get a cursor-based next link, all others offset-based links.
+func pageLinks(requestURL *url.URL, query domain.ProductQuery, page *domain.ProductPage, nextCursor string) string {
+	link := func(rel string, set map[string]string) string {
+		u := *requestURL
+		params := u.Query()
+		for key, value := range set {
+			if value == "" {
+				params.Del(key)
+			} else {
+				params.Set(key, value)
+			}
+		}
+		u.RawQuery = params.Encode()
+		return fmt.Sprintf("<%s>; rel=\"%s\"", u.RequestURI(), rel)
+	}
+
+	limit := strconv.Itoa(query.Limit)
+	links := []string{link("first", map[string]string{"cursor": "", "offset": "", "limit": limit})}
+
+	if query.Cursor != nil {
+		if page.HasMore {
+			links = append(links, link("next", map[string]string{"cursor": nextCursor, "limit": limit}))
+		}
+		return strings.Join(links, ", ")
+	}
+
+	if page.HasMore {
+		links = append(links, link("next", map[string]string{"offset": strconv.Itoa(query.Offset + query.Limit), "limit": limit}))
+	}
+	if query.Offset > 0 {
+		prev := query.Offset - query.Limit
+		if prev < 0 {
+			prev = 0
+		}
+		links = append(links, link("prev", map[string]string{"offset": strconv.Itoa(prev), "limit": limit}))
+	}
+	if page.Total > 0 {
+		last := (page.Total - 1) / query.Limit * query.Limit
+		links = append(links, link("last", map[string]string{"offset": strconv.Itoa(last), "limit": limit}))
+	}
+
+	return strings.Join(links, ", ")
+}
@@ -2,7 +2,9 @@ package product
 
 import (
 	"ecom/domain"
+	"ecom/middleware"
 	"ecom/utils"
+	"errors"
 	"fmt"
 	"github.com/gorilla/mux"
 	"net/http"
@@ -21,18 +23,48 @@ func NewHandler(store domain.ProductRepository) *Handler {
 
 func (h *Handler) ProductRoutes(router *mux.Router) {
 	router.HandleFunc("/products", h.handleGetProducts).Methods(http.MethodGet)
-	router.HandleFunc("/products", h.handleCreateProduct).Methods(http.MethodPost)
 	router.HandleFunc("/products/{id}", h.handleGetProductByID).Methods(http.MethodGet)
+
+	// catalog writes are reserved for staff
+	router.Handle("/products", middleware.Authorize(h.handleCreateProduct, domain.RoleStaff, domain.RoleAdmin)).Methods(http.MethodPost)
+	router.Handle("/products/{id}", middleware.Authorize(h.handleReplaceProduct, domain.RoleStaff, domain.RoleAdmin)).Methods(http.MethodPut)
+	router.Handle("/products/{id}", middleware.Authorize(h.handlePatchProduct, domain.RoleStaff, domain.RoleAdmin)).Methods(http.MethodPatch)
+	router.Handle("/products/{id}", middleware.Authorize(h.handleDeleteProduct, domain.RoleStaff, domain.RoleAdmin)).Methods(http.MethodDelete)
+
+	// the stock per warehouse is for staff eyes only
+	router.Handle("/products/{id}/stock", middleware.Authorize(h.handleGetProductStock, domain.RoleStaff, domain.RoleAdmin)).Methods(http.MethodGet)
 }
 
 func (h *Handler) handleGetProducts(w http.ResponseWriter, r *http.Request) {
-	products, err := h.store.GetProducts()
+	// parse pagination, sorting and filters
+	query, err := parseProductQuery(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	page, err := h.store.GetProducts(query)
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	utils.WriteJSON(w, http.StatusOK, products)
+	var nextCursor string
+	if page.HasMore && len(page.Products) > 0 {
+		nextCursor = encodeCursor(page.Products[len(page.Products)-1], query.SortBy, query.Descending)
+	}
+
+	w.Header().Set("Link", pageLinks(r.URL, query, page, nextCursor))
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"products": page.Products,
+		"page": map[string]interface{}{
+			"limit":      query.Limit,
+			"offset":     query.Offset,
+			"total":      page.Total,
+			"hasMore":    page.HasMore,
+			"nextCursor": nextCursor,
+		},
+	})
 }
 
 func (h *Handler) handleCreateProduct(w http.ResponseWriter, r *http.Request) {
@@ -55,8 +87,14 @@ func (h *Handler) handleCreateProduct(w http.ResponseWriter, r *http.Request) {
 		Name:        payload.Name,
 		Description: payload.Description,
 		Image:       payload.Image,
+		Category:    payload.Category,
+		TaxClass:    payload.TaxClass,
 		Price:       payload.Price,
 		Quantity:    payload.Quantity,
+		Weight:      payload.Weight,
+		Length:      payload.Length,
+		Width:       payload.Width,
+		Height:      payload.Height,
 	})
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
@@ -84,10 +122,203 @@ func (h *Handler) handleGetProductByID(w http.ResponseWriter, r *http.Request) {
 
 	// get the product from the store
 	product, err := h.store.GetProductByID(productID)
+	if errors.Is(err, domain.ErrProductNotFound) {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, product)
+}
+
+func (h *Handler) handleReplaceProduct(w http.ResponseWriter, r *http.Request) {
+	// get the product ID from the URL
+	productID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid product ID"))
+		return
+	}
+
+	// get JSON payload
+	var payload domain.ProductPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// validate the payload
+	err = utils.Validate.Struct(payload)
 	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// make sure the product exists
+	product, err := h.store.GetProductByID(productID)
+	if errors.Is(err, domain.ErrProductNotFound) {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
 
+	product.Name = payload.Name
+	product.Description = payload.Description
+	product.Image = payload.Image
+	product.Category = payload.Category
+	product.TaxClass = payload.TaxClass
+	product.Price = payload.Price
+	product.Weight = payload.Weight
+	product.Length = payload.Length
+	product.Width = payload.Width
+	product.Height = payload.Height
+	if payload.Version != nil {
+		product.Version = *payload.Version
+	}
+
+	h.updateProduct(w, product)
+}
+
+func (h *Handler) handlePatchProduct(w http.ResponseWriter, r *http.Request) {
+	// get the product ID from the URL
+	productID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid product ID"))
+		return
+	}
+
+	// get JSON payload
+	var payload domain.ProductPatchPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// validate the payload
+	err = utils.Validate.Struct(payload)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	if payload.Quantity != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("stock is set per warehouse at /warehouses/{id}/stock/{productId}"))
+		return
+	}
+
+	// get the current product from the store
+	product, err := h.store.GetProductByID(productID)
+	if errors.Is(err, domain.ErrProductNotFound) {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// apply the fields that were sent
+	if payload.Name != nil {
+		product.Name = *payload.Name
+	}
+	if payload.Description != nil {
+		product.Description = *payload.Description
+	}
+	if payload.Image != nil {
+		product.Image = *payload.Image
+	}
+	if payload.Category != nil {
+		product.Category = *payload.Category
+	}
+	if payload.TaxClass != nil {
+		product.TaxClass = *payload.TaxClass
+	}
+	if payload.Price != nil {
+		product.Price = *payload.Price
+	}
+	if payload.Weight != nil {
+		product.Weight = *payload.Weight
+	}
+	if payload.Length != nil {
+		product.Length = *payload.Length
+	}
+	if payload.Width != nil {
+		product.Width = *payload.Width
+	}
+	if payload.Height != nil {
+		product.Height = *payload.Height
+	}
+	if payload.Version != nil {
+		product.Version = *payload.Version
+	}
+
+	h.updateProduct(w, product)
+}
+
+func (h *Handler) updateProduct(w http.ResponseWriter, product *domain.Product) {
+	err := h.store.UpdateProduct(*product)
+	if errors.Is(err, domain.ErrProductNotFound) {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if errors.Is(err, domain.ErrProductVersionConflict) {
+		// someone else updated the product since it was read
+		utils.WriteError(w, http.StatusConflict, err)
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	product.Version++
+
 	utils.WriteJSON(w, http.StatusOK, product)
 }
+
+func (h *Handler) handleGetProductStock(w http.ResponseWriter, r *http.Request) {
+	// get the product ID from the URL
+	productID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid product ID"))
+		return
+	}
+
+	// make sure the product exists
+	if _, err := h.store.GetProductByID(productID); errors.Is(err, domain.ErrProductNotFound) {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	stock, err := h.store.GetProductStock(productID)
+	if errors.Is(err, domain.ErrProductStockNotFound) {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, stock)
+}
+
+func (h *Handler) handleDeleteProduct(w http.ResponseWriter, r *http.Request) {
+	// get the product ID from the URL
+	productID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid product ID"))
+		return
+	}
+
+	err = h.store.DeleteProduct(productID)
+	if errors.Is(err, domain.ErrProductNotFound) {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -2,21 +2,55 @@ package product
 
 import (
 	"bytes"
+	"ecom/config"
 	"ecom/domain"
+	"ecom/service/auth"
 	"encoding/json"
-	"errors"
+	"fmt"
 	"github.com/gorilla/mux"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
+// money parses a test amount in the default currency.
+func money(value string) domain.Money {
+	return domain.MustParseMoney(value, domain.DefaultCurrency)
+}
+
 type mockProductStore struct {
-	products []domain.Product
+	products  []domain.Product
+	stock     map[int]*domain.ProductStock
+	lastQuery domain.ProductQuery
 }
 
-func (m *mockProductStore) GetProducts() (*[]domain.Product, error) {
-	return &m.products, nil
+// GetProducts pages through the products in ID order and ignores filters,
+// which are covered by the store itself.
+func (m *mockProductStore) GetProducts(query domain.ProductQuery) (*domain.ProductPage, error) {
+	m.lastQuery = query
+
+	start := query.Offset
+	if query.Cursor != nil {
+		start = 0
+		for start < len(m.products) && m.products[start].ID <= query.Cursor.ID {
+			start++
+		}
+	}
+	if start > len(m.products) {
+		start = len(m.products)
+	}
+
+	end := start + query.Limit
+	if end > len(m.products) {
+		end = len(m.products)
+	}
+
+	return &domain.ProductPage{
+		Products: m.products[start:end],
+		Total:    len(m.products),
+		HasMore:  end < len(m.products),
+	}, nil
 }
 
 func (m *mockProductStore) CreateProduct(product domain.Product) error {
@@ -30,7 +64,7 @@ func (m *mockProductStore) GetProductByID(id int) (*domain.Product, error) {
 			return &product, nil
 		}
 	}
-	return nil, errors.New("product not found")
+	return nil, domain.ErrProductNotFound
 }
 
 func (m *mockProductStore) GetProductByIDs(ids []int) (*[]domain.Product, error) {
@@ -38,14 +72,38 @@ func (m *mockProductStore) GetProductByIDs(ids []int) (*[]domain.Product, error)
 }
 
 func (m *mockProductStore) UpdateProduct(product domain.Product) error {
-	return nil
+	for i := range m.products {
+		if m.products[i].ID == product.ID {
+			if m.products[i].Version != product.Version {
+				return domain.ErrProductVersionConflict
+			}
+			product.Version++
+			m.products[i] = product
+			return nil
+		}
+	}
+	return domain.ErrProductNotFound
+}
+
+func (m *mockProductStore) DeleteProduct(id int) error {
+	for i := range m.products {
+		if m.products[i].ID == id {
+			m.products = append(m.products[:i], m.products[i+1:]...)
+			return nil
+		}
+	}
+	return domain.ErrProductNotFound
 }
 
 func (m *mockProductStore) GetProductStock(productID int) (*domain.ProductStock, error) {
-	return nil, nil
+	stock, ok := m.stock[productID]
+	if !ok {
+		return nil, domain.ErrProductStockNotFound
+	}
+	return stock, nil
 }
 
-func (m *mockProductStore) UpdateProductStock(productID, quantity int) error {
+func (m *mockProductStore) UpdateProductStock(productID, warehouseID, quantity int) error {
 	return nil
 }
 
@@ -73,16 +131,153 @@ func TestHandleGetProducts(t *testing.T) {
 		t.Errorf("expected status code %d, got %d", http.StatusOK, rr.Code)
 	}
 
-	var products []domain.Product
-	if err := json.NewDecoder(rr.Body).Decode(&products); err != nil {
+	var response productsResponse
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
 		t.Fatal(err)
 	}
 
-	if len(products) != 2 {
-		t.Errorf("expected 2 products, got %d", len(products))
+	if len(response.Products) != 2 {
+		t.Errorf("expected 2 products, got %d", len(response.Products))
 	}
 }
 
+type productsResponse struct {
+	Products []domain.Product `json:"products"`
+	Page     struct {
+		Limit      int    `json:"limit"`
+		Offset     int    `json:"offset"`
+		Total      int    `json:"total"`
+		HasMore    bool   `json:"hasMore"`
+		NextCursor string `json:"nextCursor"`
+	} `json:"page"`
+}
+
+func TestHandleGetProductsPagination(t *testing.T) {
+	newHandler := func() (*Handler, *mockProductStore) {
+		store := &mockProductStore{}
+		for id := 1; id <= 5; id++ {
+			store.products = append(store.products, domain.Product{ID: id, Name: fmt.Sprintf("Product %d", id)})
+		}
+		return NewHandler(store), store
+	}
+
+	serve := func(handler *Handler, url string) *httptest.ResponseRecorder {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+		router.HandleFunc("/products", handler.handleGetProducts)
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	t.Run("should pass sorting and filters to the store", func(t *testing.T) {
+		handler, store := newHandler()
+
+		rr := serve(handler, "/products?sort=-price&minPrice=1.5&maxPrice=20&inStock=true&name=shirt&limit=10")
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		query := store.lastQuery
+		if query.SortBy != domain.ProductSortPrice || !query.Descending {
+			t.Errorf("expected descending price sort, got %s (descending %v)", query.SortBy, query.Descending)
+		}
+		if query.MinPrice == nil || *query.MinPrice != money("1.5") || query.MaxPrice == nil || *query.MaxPrice != money("20") {
+			t.Errorf("unexpected price range %v - %v", query.MinPrice, query.MaxPrice)
+		}
+		if !query.InStock || query.Name != "shirt" || query.Limit != 10 {
+			t.Errorf("unexpected query %+v", query)
+		}
+	})
+
+	t.Run("should return page metadata and offset links", func(t *testing.T) {
+		handler, _ := newHandler()
+
+		rr := serve(handler, "/products?limit=2&offset=2")
+
+		var response productsResponse
+		if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		if len(response.Products) != 2 || response.Products[0].ID != 3 {
+			t.Fatalf("unexpected page %+v", response.Products)
+		}
+		if response.Page.Total != 5 || !response.Page.HasMore || response.Page.Offset != 2 {
+			t.Errorf("unexpected page metadata %+v", response.Page)
+		}
+
+		link := rr.Header().Get("Link")
+		for _, expected := range []string{
+			`</products?limit=2&offset=4>; rel="next"`,
+			`</products?limit=2&offset=0>; rel="prev"`,
+			`</products?limit=2&offset=4>; rel="last"`,
+			`</products?limit=2>; rel="first"`,
+		} {
+			if !strings.Contains(link, expected) {
+				t.Errorf("expected Link header to contain %s, got %s", expected, link)
+			}
+		}
+	})
+
+	t.Run("should walk through all products with cursors", func(t *testing.T) {
+		handler, _ := newHandler()
+
+		var ids []int
+		url := "/products?limit=2"
+		for i := 0; i < 5 && url != ""; i++ {
+			rr := serve(handler, url)
+			if rr.Code != http.StatusOK {
+				t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+			}
+
+			var response productsResponse
+			if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+				t.Fatal(err)
+			}
+			for _, product := range response.Products {
+				ids = append(ids, product.ID)
+			}
+
+			url = ""
+			if response.Page.HasMore {
+				url = "/products?limit=2&cursor=" + response.Page.NextCursor
+			}
+		}
+
+		if fmt.Sprint(ids) != "[1 2 3 4 5]" {
+			t.Errorf("expected every product once, got %v", ids)
+		}
+	})
+
+	t.Run("should return 400 for invalid parameters", func(t *testing.T) {
+		handler, _ := newHandler()
+		cursor := encodeCursor(domain.Product{ID: 1, Price: money("10")}, domain.ProductSortPrice, false)
+
+		for _, query := range []string{
+			"limit=0",
+			"limit=101",
+			"offset=-1",
+			"sort=stock",
+			"minPrice=abc",
+			"minPrice=10&maxPrice=5",
+			"inStock=maybe",
+			"cursor=not-a-cursor",
+			"cursor=" + cursor + "&sort=name",
+			"cursor=" + cursor + "&sort=price&offset=2",
+		} {
+			rr := serve(handler, "/products?"+query)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("%s: expected status code %d, got %d", query, http.StatusBadRequest, rr.Code)
+			}
+		}
+	})
+}
+
 func TestHandleCreateProduct(t *testing.T) {
 	store := &mockProductStore{}
 	handler := NewHandler(store)
@@ -91,7 +286,7 @@ func TestHandleCreateProduct(t *testing.T) {
 		Name:        "New Product",
 		Description: "New Product Description",
 		Image:       "image.png",
-		Price:       10.0,
+		Price:       money("10.0"),
 		Quantity:    5,
 	}
 
@@ -148,3 +343,422 @@ func TestHandleGetProductByID(t *testing.T) {
 		t.Errorf("expected product ID 1, got %d", product.ID)
 	}
 }
+
+func TestUpdateProductWithReadVersion(t *testing.T) {
+	bodies := map[string]string{
+		http.MethodPut:   `{"name":"Renamed","description":"Description","image":"image.png","price":10,"quantity":5,"version":%d}`,
+		http.MethodPatch: `{"name":"Renamed","version":%d}`,
+	}
+	for method, body := range bodies {
+		t.Run(method+" should accept the version returned by GET", func(t *testing.T) {
+			store := &mockProductStore{
+				products: []domain.Product{
+					{ID: 1, Name: "Product 1", Description: "Description", Image: "image.png", Price: money("10"), Quantity: 5, Version: 3},
+				},
+			}
+			handler := NewHandler(store)
+
+			router := mux.NewRouter()
+			router.HandleFunc("/products/{id}", handler.handleGetProductByID).Methods(http.MethodGet)
+			router.HandleFunc("/products/{id}", handler.handleReplaceProduct).Methods(http.MethodPut)
+			router.HandleFunc("/products/{id}", handler.handlePatchProduct).Methods(http.MethodPatch)
+
+			req, err := http.NewRequest(http.MethodGet, "/products/1", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			var product domain.Product
+			if err := json.NewDecoder(rr.Body).Decode(&product); err != nil {
+				t.Fatal(err)
+			}
+			if product.Version != 3 {
+				t.Fatalf("expected GET to return the stored version 3, got %d", product.Version)
+			}
+
+			req, err = http.NewRequest(method, "/products/1", bytes.NewBufferString(fmt.Sprintf(body, product.Version)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			rr = httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusOK {
+				t.Errorf("expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body)
+			}
+			if updated := store.products[0]; updated.Name != "Renamed" || updated.Version != 4 {
+				t.Errorf("unexpected product after update: %+v", updated)
+			}
+		})
+	}
+}
+
+func TestHandleReplaceProduct(t *testing.T) {
+	newStore := func() *mockProductStore {
+		return &mockProductStore{
+			products: []domain.Product{
+				{ID: 1, Name: "Product 1", Description: "Description", Image: "image.png", Price: money("10"), Quantity: 5},
+			},
+		}
+	}
+
+	t.Run("should replace every field of the product but the stock", func(t *testing.T) {
+		store := newStore()
+		handler := NewHandler(store)
+
+		payload := domain.ProductPayload{
+			Name:        "Renamed",
+			Description: "New Description",
+			Image:       "new.png",
+			Price:       money("12.5"),
+			Quantity:    0,
+		}
+		marshaled, _ := json.Marshal(payload)
+		req, err := http.NewRequest(http.MethodPut, "/products/1", bytes.NewBuffer(marshaled))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+		router.HandleFunc("/products/{id}", handler.handleReplaceProduct)
+
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		product := store.products[0]
+		if product.Name != "Renamed" || product.Image != "new.png" || product.Price != money("12.5") || product.Quantity != 5 {
+			t.Errorf("unexpected product after update: %+v", product)
+		}
+	})
+
+	t.Run("should return 400 if a field is missing", func(t *testing.T) {
+		handler := NewHandler(newStore())
+
+		req, err := http.NewRequest(http.MethodPut, "/products/1", bytes.NewBufferString(`{"name":"Renamed"}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+		router.HandleFunc("/products/{id}", handler.handleReplaceProduct)
+
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should return 404 if the product does not exist", func(t *testing.T) {
+		handler := NewHandler(newStore())
+
+		payload := domain.ProductPayload{Name: "Name", Description: "Description", Image: "image.png", Price: money("1"), Quantity: 1}
+		marshaled, _ := json.Marshal(payload)
+		req, err := http.NewRequest(http.MethodPut, "/products/2", bytes.NewBuffer(marshaled))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+		router.HandleFunc("/products/{id}", handler.handleReplaceProduct)
+
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code %d, got %d", http.StatusNotFound, rr.Code)
+		}
+	})
+}
+
+func TestHandlePatchProduct(t *testing.T) {
+	newStore := func() *mockProductStore {
+		return &mockProductStore{
+			products: []domain.Product{
+				{ID: 1, Name: "Product 1", Description: "Description", Image: "image.png", Price: money("10"), Quantity: 5},
+			},
+		}
+	}
+
+	t.Run("should only update the fields that were sent", func(t *testing.T) {
+		store := newStore()
+		handler := NewHandler(store)
+
+		req, err := http.NewRequest(http.MethodPatch, "/products/1", bytes.NewBufferString(`{"price":7.5}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+		router.HandleFunc("/products/{id}", handler.handlePatchProduct)
+
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		product := store.products[0]
+		if product.Name != "Product 1" || product.Description != "Description" || product.Image != "image.png" {
+			t.Errorf("expected untouched fields to be kept, got %+v", product)
+		}
+		if product.Price != money("7.5") || product.Quantity != 5 {
+			t.Errorf("expected price 7.5 and quantity 5, got %v and %d", product.Price, product.Quantity)
+		}
+	})
+
+	t.Run("should leave the stock to the warehouses", func(t *testing.T) {
+		store := newStore()
+		handler := NewHandler(store)
+
+		req, err := http.NewRequest(http.MethodPatch, "/products/1", bytes.NewBufferString(`{"quantity":0}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+		router.HandleFunc("/products/{id}", handler.handlePatchProduct)
+
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+		if quantity := store.products[0].Quantity; quantity != 5 {
+			t.Errorf("expected quantity 5, got %d", quantity)
+		}
+	})
+
+	t.Run("should only update the version it was based on", func(t *testing.T) {
+		store := newStore()
+		store.products[0].Version = 3
+		handler := NewHandler(store)
+
+		for _, tc := range []struct {
+			body     string
+			expected int
+			version  int
+		}{
+			{`{"name":"Stale","version":2}`, http.StatusConflict, 3},
+			{`{"name":"Current","version":3}`, http.StatusOK, 4},
+			{`{"name":"Latest"}`, http.StatusOK, 5},
+		} {
+			req, err := http.NewRequest(http.MethodPatch, "/products/1", bytes.NewBufferString(tc.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			router := mux.NewRouter()
+			router.HandleFunc("/products/{id}", handler.handlePatchProduct)
+
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != tc.expected {
+				t.Errorf("%s: expected status code %d, got %d", tc.body, tc.expected, rr.Code)
+			}
+			if version := store.products[0].Version; version != tc.version {
+				t.Errorf("%s: expected version %d, got %d", tc.body, tc.version, version)
+			}
+		}
+		if name := store.products[0].Name; name != "Latest" {
+			t.Errorf("expected name Latest, got %s", name)
+		}
+	})
+
+	t.Run("should return 400 for invalid values", func(t *testing.T) {
+		handler := NewHandler(newStore())
+
+		for _, body := range []string{`{"name":""}`, `{"price":-1}`, `{"quantity":-2}`} {
+			req, err := http.NewRequest(http.MethodPatch, "/products/1", bytes.NewBufferString(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rr := httptest.NewRecorder()
+			router := mux.NewRouter()
+			router.HandleFunc("/products/{id}", handler.handlePatchProduct)
+
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("%s: expected status code %d, got %d", body, http.StatusBadRequest, rr.Code)
+			}
+		}
+	})
+}
+
+func TestHandleDeleteProduct(t *testing.T) {
+	store := &mockProductStore{
+		products: []domain.Product{
+			{ID: 1, Name: "Product 1"},
+		},
+	}
+	handler := NewHandler(store)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/products/{id}", handler.handleDeleteProduct)
+
+	req, err := http.NewRequest(http.MethodDelete, "/products/1", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("expected status code %d, got %d", http.StatusNoContent, rr.Code)
+	}
+
+	if len(store.products) != 0 {
+		t.Errorf("expected the product to be hidden, got %d products", len(store.products))
+	}
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected status code %d on second delete, got %d", http.StatusNotFound, rr.Code)
+	}
+}
+
+func TestHandleGetProductStock(t *testing.T) {
+	store := &mockProductStore{
+		products: []domain.Product{
+			{ID: 1, Name: "Product 1"},
+			{ID: 2, Name: "Product 2"},
+		},
+		stock: map[int]*domain.ProductStock{1: {ProductID: 1, Quantity: 5, Available: 5}},
+	}
+	handler := NewHandler(store)
+
+	router := mux.NewRouter()
+	router.HandleFunc("/products/{id}/stock", handler.handleGetProductStock)
+
+	t.Run("should return the stock of the product", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/products/1/stock", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		var stock domain.ProductStock
+		if err := json.NewDecoder(rr.Body).Decode(&stock); err != nil {
+			t.Fatal(err)
+		}
+		if stock.Quantity != 5 {
+			t.Errorf("expected quantity 5, got %d", stock.Quantity)
+		}
+	})
+
+	t.Run("should return 404 for a product without stock", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodGet, "/products/2/stock", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code %d, got %d", http.StatusNotFound, rr.Code)
+		}
+	})
+}
+
+func TestProtectedProductRoutes(t *testing.T) {
+	routes := []struct {
+		method string
+		url    string
+		body   string
+		status int
+	}{
+		{http.MethodPost, "/products", `{"name":"New","description":"New","image":"new.png","price":1,"quantity":1}`, http.StatusCreated},
+		{http.MethodPut, "/products/1", `{"name":"New","description":"New","image":"new.png","price":1,"quantity":1}`, http.StatusOK},
+		{http.MethodPatch, "/products/1", `{"price":2}`, http.StatusOK},
+		{http.MethodDelete, "/products/1", "", http.StatusNoContent},
+	}
+
+	serve := func(t *testing.T, method, url, body, role string) *httptest.ResponseRecorder {
+		store := &mockProductStore{
+			products: []domain.Product{
+				{ID: 1, Name: "Product 1", Description: "Description", Image: "image.png", Price: money("10"), Quantity: 5},
+			},
+		}
+		handler := NewHandler(store)
+		router := mux.NewRouter()
+		handler.ProductRoutes(router)
+
+		req, err := http.NewRequest(method, url, bytes.NewBufferString(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if role != "" {
+			token, err := auth.NewStore().CreateToken([]byte(config.ENV.JWTSecret), domain.User{ID: "user-1", Role: role})
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	for _, route := range routes {
+		name := route.method + " " + route.url
+
+		t.Run(name+" should return 401 without a token", func(t *testing.T) {
+			rr := serve(t, route.method, route.url, route.body, "")
+
+			if rr.Code != http.StatusUnauthorized {
+				t.Errorf("expected status code %d, got %d", http.StatusUnauthorized, rr.Code)
+			}
+		})
+
+		t.Run(name+" should return 403 for customers", func(t *testing.T) {
+			rr := serve(t, route.method, route.url, route.body, domain.RoleCustomer)
+
+			if rr.Code != http.StatusForbidden {
+				t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+			}
+		})
+
+		for _, role := range []string{domain.RoleStaff, domain.RoleAdmin} {
+			t.Run(name+" should be allowed for "+role, func(t *testing.T) {
+				rr := serve(t, route.method, route.url, route.body, role)
+
+				if rr.Code != route.status {
+					t.Errorf("expected status code %d, got %d", route.status, rr.Code)
+				}
+			})
+		}
+	}
+
+	t.Run("reads should stay public", func(t *testing.T) {
+		for _, url := range []string{"/products", "/products/1"} {
+			rr := serve(t, http.MethodGet, url, "", "")
+
+			if rr.Code != http.StatusOK {
+				t.Errorf("%s: expected status code %d, got %d", url, http.StatusOK, rr.Code)
+			}
+		}
+	})
+}
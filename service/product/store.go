@@ -2,28 +2,130 @@ package product
 
 import (
 	"database/sql"
+	"ecom/db"
 	"ecom/domain"
 	"errors"
 	"fmt"
 	"strings"
-	"sync"
 )
 
 type Store struct {
 	db *sql.DB
-	mu sync.Mutex
+	tx *sql.Tx
 }
 
 func NewStore(db *sql.DB) *Store {
 	return &Store{db: db}
 }
 
-func (s *Store) GetProducts() (*[]domain.Product, error) {
-	rows, err := s.db.Query(`
-        SELECT p.id, p.name, p.description, p.image, p.price, p.createdAt, ps.quantity
-        FROM products p
-        LEFT JOIN product_stock ps ON p.id = ps.product_id
-    `)
+// WithTx returns a store bound to tx. Writes made through it are only
+// persisted once the caller commits tx.
+func (s *Store) WithTx(tx *sql.Tx) *Store {
+	return &Store{db: s.db, tx: tx}
+}
+
+func (s *Store) conn() db.Querier {
+	if s.tx != nil {
+		return s.tx
+	}
+	return s.db
+}
+
+// inTx runs fn in the bound transaction, or in a new one that is committed
+// when fn succeeds.
+func (s *Store) inTx(fn func(tx *sql.Tx) error) error {
+	if s.tx != nil {
+		return fn(s.tx)
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// stockTotals sums the stock of the active warehouses per product, the
+// stock that can be shipped.
+const stockTotals = `(
+	SELECT ps.product_id, SUM(ps.quantity) AS quantity, SUM(ps.reserved) AS reserved
+	FROM product_stock ps
+	JOIN warehouses w ON w.id = ps.warehouse_id
+	WHERE w.active
+	GROUP BY ps.product_id
+)`
+
+// sortColumns maps the sort keys accepted by GetProducts to their columns.
+var sortColumns = map[string]string{
+	domain.ProductSortCreatedAt: "p.createdAt",
+	domain.ProductSortPrice:     "p.price",
+	domain.ProductSortName:      "p.name",
+}
+
+func (s *Store) GetProducts(query domain.ProductQuery) (*domain.ProductPage, error) {
+	column, ok := sortColumns[query.SortBy]
+	if !ok {
+		return nil, fmt.Errorf("unsupported sort %q", query.SortBy)
+	}
+
+	conditions := []string{"p.deletedAt IS NULL"}
+	args := make([]interface{}, 0)
+	if query.MinPrice != nil {
+		conditions = append(conditions, "p.price >= ?")
+		args = append(args, *query.MinPrice)
+	}
+	if query.MaxPrice != nil {
+		conditions = append(conditions, "p.price <= ?")
+		args = append(args, *query.MaxPrice)
+	}
+	if query.InStock {
+		conditions = append(conditions, "COALESCE(ps.quantity - ps.reserved, 0) > 0")
+	}
+	if query.Name != "" {
+		conditions = append(conditions, "p.name LIKE ?")
+		args = append(args, "%"+escapeLike(query.Name)+"%")
+	}
+
+	var total int
+	err := s.conn().QueryRow(`
+		SELECT COUNT(*)
+		FROM products p
+		LEFT JOIN `+stockTotals+` ps ON p.id = ps.product_id
+		WHERE `+strings.Join(conditions, " AND "), args...).Scan(&total)
+	if err != nil {
+		return nil, err
+	}
+
+	direction, comparison := "ASC", ">"
+	if query.Descending {
+		direction, comparison = "DESC", "<"
+	}
+
+	// keyset pagination continues right after the cursor, using the ID to
+	// break ties between equal sort values
+	if query.Cursor != nil {
+		conditions = append(conditions, fmt.Sprintf("(%s %s ? OR (%s = ? AND p.id %s ?))", column, comparison, column, comparison))
+		args = append(args, query.Cursor.Value, query.Cursor.Value, query.Cursor.ID)
+	}
+
+	// fetch one extra row to find out whether there is a next page
+	sqlQuery := fmt.Sprintf(`
+		SELECT p.id, p.name, p.description, p.image, p.category, p.taxClass, p.weight, p.length, p.width, p.height, p.price, p.version, p.createdAt, COALESCE(ps.quantity - ps.reserved, 0), COALESCE(ps.reserved, 0)
+		FROM products p
+		LEFT JOIN `+stockTotals+` ps ON p.id = ps.product_id
+		WHERE %s
+		ORDER BY %s %s, p.id %s
+		LIMIT ? OFFSET ?
+	`, strings.Join(conditions, " AND "), column, direction, direction)
+	args = append(args, query.Limit+1, query.Offset)
+
+	rows, err := s.conn().Query(sqlQuery, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -37,25 +139,46 @@ func (s *Store) GetProducts() (*[]domain.Product, error) {
 			&product.Name,
 			&product.Description,
 			&product.Image,
+			&product.Category,
+			&product.TaxClass,
+			&product.Weight,
+			&product.Length,
+			&product.Width,
+			&product.Height,
 			&product.Price,
+			&product.Version,
 			&product.CreatedAt,
 			&product.Quantity,
+			&product.Reserved,
 		)
 		if err != nil {
 			return nil, err
 		}
 		products = append(products, product)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
-	return &products, nil
+	page := &domain.ProductPage{Products: products, Total: total}
+	if len(products) > query.Limit {
+		page.Products = products[:query.Limit]
+		page.HasMore = true
+	}
+
+	return page, nil
+}
+
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(value)
 }
 
 func (s *Store) GetProductByID(id int) (*domain.Product, error) {
-	row := s.db.QueryRow(`
-		SELECT p.id, p.name, p.description, p.image, p.price, p.createdAt, ps.quantity
+	row := s.conn().QueryRow(`
+		SELECT p.id, p.name, p.description, p.image, p.category, p.taxClass, p.weight, p.length, p.width, p.height, p.price, p.version, p.createdAt, COALESCE(ps.quantity - ps.reserved, 0), COALESCE(ps.reserved, 0)
 		FROM products p
-		LEFT JOIN product_stock ps ON p.id = ps.product_id
-		WHERE p.id = ?
+		LEFT JOIN `+stockTotals+` ps ON p.id = ps.product_id
+		WHERE p.id = ? AND p.deletedAt IS NULL
 	`, id)
 
 	product := new(domain.Product)
@@ -64,11 +187,21 @@ func (s *Store) GetProductByID(id int) (*domain.Product, error) {
 		&product.Name,
 		&product.Description,
 		&product.Image,
+		&product.Category,
+		&product.TaxClass,
+		&product.Weight,
+		&product.Length,
+		&product.Width,
+		&product.Height,
 		&product.Price,
+		&product.Version,
 		&product.CreatedAt,
 		&product.Quantity,
+		&product.Reserved,
 	)
-	if err != nil {
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrProductNotFound
+	} else if err != nil {
 		return nil, err
 	}
 
@@ -89,13 +222,13 @@ func (s *Store) GetProductByIDs(ids []int) (*[]domain.Product, error) {
 	}
 
 	query := fmt.Sprintf(`
-		SELECT p.id, p.name, p.description, p.image, p.price, p.createdAt, ps.quantity
+		SELECT p.id, p.name, p.description, p.image, p.category, p.taxClass, p.weight, p.length, p.width, p.height, p.price, p.version, p.createdAt, COALESCE(ps.quantity - ps.reserved, 0), COALESCE(ps.reserved, 0)
 		FROM products p
-		LEFT JOIN product_stock ps ON p.id = ps.product_id
-		WHERE p.id IN (%s)
+		LEFT JOIN `+stockTotals+` ps ON p.id = ps.product_id
+		WHERE p.id IN (%s) AND p.deletedAt IS NULL
 	`, strings.Join(placeholders, ","))
 
-	rows, err := s.db.Query(query, args...)
+	rows, err := s.conn().Query(query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -109,9 +242,17 @@ func (s *Store) GetProductByIDs(ids []int) (*[]domain.Product, error) {
 			&product.Name,
 			&product.Description,
 			&product.Image,
+			&product.Category,
+			&product.TaxClass,
+			&product.Weight,
+			&product.Length,
+			&product.Width,
+			&product.Height,
 			&product.Price,
+			&product.Version,
 			&product.CreatedAt,
 			&product.Quantity,
+			&product.Reserved,
 		)
 		if err != nil {
 			return nil, err
@@ -122,113 +263,177 @@ func (s *Store) GetProductByIDs(ids []int) (*[]domain.Product, error) {
 	return &products, nil
 }
 
-func (s *Store) CreateProduct(product domain.Product) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	tx, err := s.db.Begin()
-	if err != nil {
-		return err
-	}
-
-	_, err = tx.Exec(`
-		INSERT INTO products (name, description, image, price)
-		VALUES (?, ?, ?, ?)
-	`, product.Name, product.Description, product.Image, product.Price)
-	if err != nil {
-		tx.Rollback()
-		return err
+func taxClass(product domain.Product) string {
+	if product.TaxClass == "" {
+		return domain.TaxClassStandard
 	}
+	return product.TaxClass
+}
 
-	_, err = tx.Exec(`
-		INSERT INTO product_stock (product_id, quantity)
-		VALUES (LAST_INSERT_ID(), ?)
-	`, product.Quantity)
-	if err != nil {
-		tx.Rollback()
-		return err
-	}
+func (s *Store) CreateProduct(product domain.Product) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`
+			INSERT INTO products (name, description, image, category, taxClass, weight, length, width, height, price)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, product.Name, product.Description, product.Image, product.Category, taxClass(product),
+			product.Weight, product.Length, product.Width, product.Height, product.Price)
+		if err != nil {
+			return err
+		}
 
-	return tx.Commit()
+		// new stock goes to the preferred warehouse
+		result, err := tx.Exec(`
+			INSERT INTO product_stock (product_id, warehouse_id, quantity)
+			SELECT LAST_INSERT_ID(), id, ?
+			FROM warehouses
+			WHERE active
+			ORDER BY priority, id
+			LIMIT 1
+		`, product.Quantity)
+		if err != nil {
+			return err
+		}
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return fmt.Errorf("no active warehouse: %w", domain.ErrWarehouseNotFound)
+		}
+		return nil
+	})
 }
 
 func (s *Store) UpdateProduct(product domain.Product) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+	return s.inTx(func(tx *sql.Tx) error {
+		// the version check makes concurrent updates of the same product
+		// fail instead of overwriting each other
+		result, err := tx.Exec(`
+			UPDATE products
+			SET name = ?, description = ?, image = ?, category = ?, taxClass = ?,
+				weight = ?, length = ?, width = ?, height = ?, price = ?, version = version + 1
+			WHERE id = ? AND version = ? AND deletedAt IS NULL
+		`, product.Name, product.Description, product.Image, product.Category, taxClass(product),
+			product.Weight, product.Length, product.Width, product.Height, product.Price, product.ID, product.Version)
+		if err != nil {
+			return err
+		}
 
-	tx, err := s.db.Begin()
-	if err != nil {
-		return err
-	}
+		// bumping the version changes the row, so no affected row means a
+		// missing product or a different version
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			var exists bool
+			err = tx.QueryRow("SELECT EXISTS(SELECT 1 FROM products WHERE id = ? AND deletedAt IS NULL)", product.ID).Scan(&exists)
+			if err != nil {
+				return err
+			}
+			if !exists {
+				return domain.ErrProductNotFound
+			}
+			return domain.ErrProductVersionConflict
+		}
 
-	_, err = tx.Exec(`
-		UPDATE products
-		SET name = ?, description = ?, image = ?, price = ?
-		WHERE id = ?
-	`, product.Name, product.Description, product.Image, product.Price, product.ID)
+		// the stock is set per warehouse, never from the product
+		return nil
+	})
+}
+
+// DeleteProduct soft-deletes the product so order items referencing it stay
+// valid while it disappears from the catalog and checkout.
+func (s *Store) DeleteProduct(id int) error {
+	result, err := s.conn().Exec("UPDATE products SET deletedAt = NOW() WHERE id = ? AND deletedAt IS NULL", id)
 	if err != nil {
-		tx.Rollback()
 		return err
 	}
 
-	_, err = tx.Exec(`
-		UPDATE product_stock
-		SET quantity = ?
-		WHERE product_id = ?
-	`, product.Quantity, product.ID)
+	affected, err := result.RowsAffected()
 	if err != nil {
-		tx.Rollback()
 		return err
 	}
+	if affected == 0 {
+		return domain.ErrProductNotFound
+	}
 
-	return tx.Commit()
+	return nil
 }
 
+// GetProductStock lists the stock of the product per warehouse and adds up
+// the stock of the active ones.
 func (s *Store) GetProductStock(productID int) (*domain.ProductStock, error) {
-	row := s.db.QueryRow("SELECT product_id, quantity FROM product_stock WHERE product_id = ?", productID)
+	rows, err := s.conn().Query(`
+		SELECT ps.warehouse_id, ps.quantity, ps.reserved, w.active
+		FROM product_stock ps
+		JOIN warehouses w ON w.id = ps.warehouse_id
+		WHERE ps.product_id = ?
+		ORDER BY w.priority, w.id
+	`, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-	stock := new(domain.ProductStock)
-	err := row.Scan(&stock.ProductID, &stock.Quantity)
-	if errors.Is(err, sql.ErrNoRows) {
-		return nil, fmt.Errorf("product stock not found")
-	} else if err != nil {
+	stock := &domain.ProductStock{ProductID: productID, Warehouses: make([]domain.WarehouseStock, 0)}
+	for rows.Next() {
+		var warehouse domain.WarehouseStock
+		var active bool
+		if err := rows.Scan(&warehouse.WarehouseID, &warehouse.Quantity, &warehouse.Reserved, &active); err != nil {
+			return nil, err
+		}
+		warehouse.Available = warehouse.Quantity - warehouse.Reserved
+		stock.Warehouses = append(stock.Warehouses, warehouse)
+
+		if active {
+			stock.Quantity += warehouse.Quantity
+			stock.Reserved += warehouse.Reserved
+			stock.Available += warehouse.Available
+		}
+	}
+	if err := rows.Err(); err != nil {
 		return nil, err
 	}
+	if len(stock.Warehouses) == 0 {
+		return nil, domain.ErrProductStockNotFound
+	}
 
 	return stock, nil
 }
 
-func (s *Store) UpdateProductStock(productID, quantity int) error {
-	s.mu.Lock()
-	defer s.mu.Unlock()
-
-	tx, err := s.db.Begin()
+// UpdateProductStock changes the stock in a single conditional UPDATE, so
+// concurrent decreases can't take the stock below what is reserved.
+func (s *Store) UpdateProductStock(productID, warehouseID, quantity int) error {
+	result, err := s.conn().Exec(`
+		UPDATE product_stock
+		SET quantity = CAST(quantity AS SIGNED) + ?
+		WHERE product_id = ? AND warehouse_id = ? AND CAST(quantity AS SIGNED) + ? >= reserved
+	`, quantity, productID, warehouseID, quantity)
 	if err != nil {
 		return err
 	}
 
-	defer func() {
-		if p := recover(); p != nil {
-			tx.Rollback()
-			panic(p)
-		} else if err != nil {
-			tx.Rollback()
-		} else {
-			err = tx.Commit()
-		}
-	}()
-
-	var currentQuantity int
-	err = tx.QueryRow("SELECT quantity FROM product_stock WHERE product_id = ?", productID).Scan(&currentQuantity)
+	affected, err := result.RowsAffected()
 	if err != nil {
 		return err
 	}
-
-	newQuantity := currentQuantity + quantity
-	if newQuantity < 0 {
-		return fmt.Errorf("insufficient stock")
+	if affected > 0 {
+		return nil
 	}
 
-	_, err = tx.Exec("UPDATE product_stock SET quantity = ? WHERE product_id = ?", newQuantity, productID)
-	return err
+	// tell a missing stock row apart, and a zero change that left the row
+	// untouched
+	var exists bool
+	err = s.conn().QueryRow("SELECT EXISTS(SELECT 1 FROM product_stock WHERE product_id = ? AND warehouse_id = ?)", productID, warehouseID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return domain.ErrProductStockNotFound
+	}
+	if quantity == 0 {
+		return nil
+	}
+	return domain.ErrInsufficientStock
 }
@@ -0,0 +1,155 @@
+package product
+
+import (
+	"database/sql"
+	"ecom/db"
+	"ecom/domain"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// newTestStore connects to the migrated database in TEST_DB_DSN, skipping
+// the test when it isn't set.
+func newTestStore(t *testing.T) (*Store, *sql.DB) {
+	dsn := os.Getenv("TEST_DB_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DB_DSN is not set")
+	}
+
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.ParseTime = true
+
+	conn, err := db.NewMySQLStorage(*cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return NewStore(conn), conn
+}
+
+// createTestProduct stores a product with the given stock and removes it
+// when the test is done.
+func createTestProduct(t *testing.T, store *Store, conn *sql.DB, quantity int) *domain.Product {
+	name := "concurrency test " + t.Name()
+	err := store.CreateProduct(domain.Product{Name: name, Description: "Description", Image: "image.png", Price: money("10"), Quantity: quantity})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var id int
+	if err := conn.QueryRow("SELECT id FROM products WHERE name = ? ORDER BY id DESC LIMIT 1", name).Scan(&id); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Exec("DELETE FROM product_stock WHERE product_id = ?", id)
+		conn.Exec("DELETE FROM products WHERE id = ?", id)
+	})
+
+	product, err := store.GetProductByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return product
+}
+
+func TestStoreConcurrency(t *testing.T) {
+	store, conn := newTestStore(t)
+
+	// reserved units are held for pending checkouts and never sold
+	for _, reserved := range []int{0, 5} {
+		t.Run(fmt.Sprintf("should not oversell a product with %d reserved under concurrent checkouts", reserved), func(t *testing.T) {
+			const stock, buyers = 20, 100
+			product := createTestProduct(t, store, conn, stock)
+			productStock, err := store.GetProductStock(product.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			warehouseID := productStock.Warehouses[0].WarehouseID
+			_, err = conn.Exec("UPDATE product_stock SET reserved = ? WHERE product_id = ? AND warehouse_id = ?", reserved, product.ID, warehouseID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var mu sync.Mutex
+			sold := 0
+			var wg sync.WaitGroup
+			for i := 0; i < buyers; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					err := store.UpdateProductStock(product.ID, warehouseID, -1)
+					if errors.Is(err, domain.ErrInsufficientStock) {
+						return
+					} else if err != nil {
+						t.Error(err)
+						return
+					}
+					mu.Lock()
+					sold++
+					mu.Unlock()
+				}()
+			}
+			wg.Wait()
+
+			if sold != stock-reserved {
+				t.Errorf("expected %d units sold, got %d", stock-reserved, sold)
+			}
+			remaining, err := store.GetProductStock(product.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if remaining.Quantity != reserved || remaining.Available != 0 {
+				t.Errorf("expected only the %d reserved units left, got %+v", reserved, remaining)
+			}
+		})
+	}
+
+	t.Run("should let only one of concurrent updates of a version win", func(t *testing.T) {
+		const writers = 10
+		product := createTestProduct(t, store, conn, 5)
+
+		var mu sync.Mutex
+		updated, conflicts := 0, 0
+		var wg sync.WaitGroup
+		for i := 0; i < writers; i++ {
+			wg.Add(1)
+			go func(price int64) {
+				defer wg.Done()
+				update := *product
+				update.Price = domain.NewMoney(price, domain.DefaultCurrency)
+				err := store.UpdateProduct(update)
+
+				mu.Lock()
+				defer mu.Unlock()
+				if errors.Is(err, domain.ErrProductVersionConflict) {
+					conflicts++
+				} else if err != nil {
+					t.Error(err)
+				} else {
+					updated++
+				}
+			}(int64(1000 + i))
+		}
+		wg.Wait()
+
+		if updated != 1 || conflicts != writers-1 {
+			t.Errorf("expected 1 update and %d conflicts, got %d and %d", writers-1, updated, conflicts)
+		}
+		current, err := store.GetProductByID(product.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if current.Version != product.Version+1 {
+			t.Errorf("expected version %d, got %d", product.Version+1, current.Version)
+		}
+	})
+}
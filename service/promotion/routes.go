@@ -0,0 +1,203 @@
+package promotion
+
+import (
+	"ecom/domain"
+	"ecom/middleware"
+	"ecom/utils"
+	"errors"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type Handler struct {
+	store domain.PromotionRepository
+}
+
+func NewHandler(store domain.PromotionRepository) *Handler {
+	return &Handler{store: store}
+}
+
+func (h *Handler) PromotionRoutes(router *mux.Router) {
+	// promotions are managed by staff, customers only ever send codes
+	router.Handle("/promotions", middleware.Authorize(h.handleGetPromotions, domain.RoleStaff, domain.RoleAdmin)).Methods(http.MethodGet)
+	router.Handle("/promotions", middleware.Authorize(h.handleCreatePromotion, domain.RoleStaff, domain.RoleAdmin)).Methods(http.MethodPost)
+	router.Handle("/promotions/{id}", middleware.Authorize(h.handleGetPromotion, domain.RoleStaff, domain.RoleAdmin)).Methods(http.MethodGet)
+	router.Handle("/promotions/{id}", middleware.Authorize(h.handleUpdatePromotion, domain.RoleStaff, domain.RoleAdmin)).Methods(http.MethodPut)
+	router.Handle("/promotions/{id}", middleware.Authorize(h.handleDeletePromotion, domain.RoleStaff, domain.RoleAdmin)).Methods(http.MethodDelete)
+}
+
+func (h *Handler) handleGetPromotions(w http.ResponseWriter, r *http.Request) {
+	promotions, err := h.store.GetPromotions()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, promotions)
+}
+
+func (h *Handler) handleGetPromotion(w http.ResponseWriter, r *http.Request) {
+	// get the promotion ID from the URL
+	promotionID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid promotion ID"))
+		return
+	}
+
+	promotion, err := h.store.GetPromotionByID(promotionID)
+	if errors.Is(err, domain.ErrPromotionNotFound) {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, promotion)
+}
+
+func (h *Handler) handleCreatePromotion(w http.ResponseWriter, r *http.Request) {
+	// get JSON payload
+	var payload domain.PromotionPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	promotion, ok := h.parsePromotion(w, payload, 0)
+	if !ok {
+		return
+	}
+
+	id, err := h.store.CreatePromotion(promotion)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	created, err := h.store.GetPromotionByID(id)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, created)
+}
+
+func (h *Handler) handleUpdatePromotion(w http.ResponseWriter, r *http.Request) {
+	// get the promotion ID from the URL
+	promotionID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid promotion ID"))
+		return
+	}
+
+	// get JSON payload
+	var payload domain.PromotionPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// make sure the promotion exists
+	if _, err := h.store.GetPromotionByID(promotionID); errors.Is(err, domain.ErrPromotionNotFound) {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	promotion, ok := h.parsePromotion(w, payload, promotionID)
+	if !ok {
+		return
+	}
+	promotion.ID = promotionID
+
+	if err := h.store.UpdatePromotion(promotion); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	updated, err := h.store.GetPromotionByID(promotionID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, updated)
+}
+
+func (h *Handler) handleDeletePromotion(w http.ResponseWriter, r *http.Request) {
+	// get the promotion ID from the URL
+	promotionID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid promotion ID"))
+		return
+	}
+
+	err = h.store.DeletePromotion(promotionID)
+	if errors.Is(err, domain.ErrPromotionNotFound) {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// parsePromotion validates the payload of the promotion with the given ID,
+// zero for a new one, writing the error response itself when it's invalid.
+func (h *Handler) parsePromotion(w http.ResponseWriter, payload domain.PromotionPayload, promotionID int) (domain.Promotion, bool) {
+	// validate the payload
+	err := utils.Validate.Struct(payload)
+	if err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", validationErrors))
+		return domain.Promotion{}, false
+	}
+	if payload.StartsAt != nil && payload.EndsAt != nil && !payload.EndsAt.After(*payload.StartsAt) {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("endsAt must be after startsAt"))
+		return domain.Promotion{}, false
+	}
+
+	// codes are matched case-insensitively, so store them upper case
+	code := strings.ToUpper(payload.Code)
+	existing, err := h.store.GetPromotionByCode(code)
+	if err == nil && existing.ID != promotionID {
+		utils.WriteError(w, http.StatusConflict, domain.ErrPromotionCodeTaken)
+		return domain.Promotion{}, false
+	} else if err != nil && !errors.Is(err, domain.ErrPromotionNotFound) {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return domain.Promotion{}, false
+	}
+
+	active := true
+	if payload.Active != nil {
+		active = *payload.Active
+	}
+
+	return domain.Promotion{
+		Code:         code,
+		Description:  payload.Description,
+		Type:         payload.Type,
+		Percent:      payload.Percent,
+		AmountOff:    payload.AmountOff,
+		BuyQuantity:  payload.BuyQuantity,
+		GetQuantity:  payload.GetQuantity,
+		MinSubtotal:  payload.MinSubtotal,
+		ProductIDs:   payload.ProductIDs,
+		Categories:   payload.Categories,
+		StartsAt:     payload.StartsAt,
+		EndsAt:       payload.EndsAt,
+		UsageLimit:   payload.UsageLimit,
+		PerUserLimit: payload.PerUserLimit,
+		Active:       active,
+	}, true
+}
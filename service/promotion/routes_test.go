@@ -0,0 +1,193 @@
+package promotion
+
+import (
+	"bytes"
+	"ecom/config"
+	"ecom/domain"
+	"ecom/service/auth"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type mockPromotionStore struct {
+	domain.PromotionRepository
+	promotions []domain.Promotion
+}
+
+func (m *mockPromotionStore) GetPromotions() (*[]domain.Promotion, error) {
+	return &m.promotions, nil
+}
+
+func (m *mockPromotionStore) GetPromotionByID(id int) (*domain.Promotion, error) {
+	for _, promotion := range m.promotions {
+		if promotion.ID == id {
+			return &promotion, nil
+		}
+	}
+	return nil, domain.ErrPromotionNotFound
+}
+
+func (m *mockPromotionStore) GetPromotionByCode(code string) (*domain.Promotion, error) {
+	for _, promotion := range m.promotions {
+		if promotion.Code == code {
+			return &promotion, nil
+		}
+	}
+	return nil, domain.ErrPromotionNotFound
+}
+
+func (m *mockPromotionStore) CreatePromotion(promotion domain.Promotion) (int, error) {
+	promotion.ID = len(m.promotions) + 1
+	m.promotions = append(m.promotions, promotion)
+	return promotion.ID, nil
+}
+
+func (m *mockPromotionStore) UpdatePromotion(promotion domain.Promotion) error {
+	for i := range m.promotions {
+		if m.promotions[i].ID == promotion.ID {
+			m.promotions[i] = promotion
+		}
+	}
+	return nil
+}
+
+func (m *mockPromotionStore) DeletePromotion(id int) error {
+	for i, promotion := range m.promotions {
+		if promotion.ID == id {
+			m.promotions = append(m.promotions[:i], m.promotions[i+1:]...)
+			return nil
+		}
+	}
+	return domain.ErrPromotionNotFound
+}
+
+func servePromotionRequest(t *testing.T, store *mockPromotionStore, method, url, body, role string) *httptest.ResponseRecorder {
+	router := mux.NewRouter()
+	NewHandler(store).PromotionRoutes(router)
+
+	req, err := http.NewRequest(method, url, bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role != "" {
+		token, err := auth.NewStore().CreateToken([]byte(config.ENV.JWTSecret), domain.User{ID: "user-1", Role: role})
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestHandleCreatePromotion(t *testing.T) {
+	t.Run("should create an active promotion with an upper case code", func(t *testing.T) {
+		store := &mockPromotionStore{}
+
+		body := `{"code":"summer10","type":"percentage","percent":10,"categories":["shoes"],"minSubtotal":"20.00"}`
+		rr := servePromotionRequest(t, store, http.MethodPost, "/promotions", body, domain.RoleStaff)
+
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status code %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+		}
+
+		var promotion domain.Promotion
+		if err := json.NewDecoder(rr.Body).Decode(&promotion); err != nil {
+			t.Fatal(err)
+		}
+		if promotion.Code != "SUMMER10" || !promotion.Active || promotion.MinSubtotal != domain.MustParseMoney("20", domain.DefaultCurrency) {
+			t.Errorf("unexpected promotion %+v", promotion)
+		}
+	})
+
+	invalid := map[string]string{
+		"unknown type":              `{"code":"X","type":"mystery"}`,
+		"percentage without amount": `{"code":"X","type":"percentage"}`,
+		"percentage above 100":      `{"code":"X","type":"percentage","percent":120}`,
+		"buy x get y without y":     `{"code":"X","type":"buy_x_get_y","buyQuantity":2}`,
+		"window ending first":       `{"code":"X","type":"free_shipping","startsAt":"2024-10-02T00:00:00Z","endsAt":"2024-10-01T00:00:00Z"}`,
+		"code with spaces":          `{"code":"SAVE 10","type":"free_shipping"}`,
+	}
+	for name, body := range invalid {
+		t.Run("should reject a "+name, func(t *testing.T) {
+			rr := servePromotionRequest(t, &mockPromotionStore{}, http.MethodPost, "/promotions", body, domain.RoleAdmin)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+			}
+		})
+	}
+
+	t.Run("should return 409 for a code in use", func(t *testing.T) {
+		store := &mockPromotionStore{promotions: []domain.Promotion{{ID: 1, Code: "SAVE"}}}
+
+		rr := servePromotionRequest(t, store, http.MethodPost, "/promotions", `{"code":"save","type":"free_shipping"}`, domain.RoleAdmin)
+
+		if rr.Code != http.StatusConflict {
+			t.Errorf("expected status code %d, got %d", http.StatusConflict, rr.Code)
+		}
+	})
+}
+
+func TestHandleUpdatePromotion(t *testing.T) {
+	t.Run("should replace the promotion and keep its own code", func(t *testing.T) {
+		store := &mockPromotionStore{promotions: []domain.Promotion{{ID: 1, Code: "SAVE", Type: domain.PromotionFreeShipping, Active: true}}}
+
+		body := `{"code":"SAVE","type":"fixed_amount","amountOff":5,"active":false}`
+		rr := servePromotionRequest(t, store, http.MethodPut, "/promotions/1", body, domain.RoleAdmin)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+		if updated := store.promotions[0]; updated.Type != domain.PromotionFixedAmount || updated.Active {
+			t.Errorf("unexpected promotion %+v", updated)
+		}
+	})
+
+	t.Run("should return 404 for an unknown promotion", func(t *testing.T) {
+		rr := servePromotionRequest(t, &mockPromotionStore{}, http.MethodPut, "/promotions/9", `{"code":"SAVE","type":"free_shipping"}`, domain.RoleAdmin)
+
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code %d, got %d", http.StatusNotFound, rr.Code)
+		}
+	})
+}
+
+func TestHandleDeletePromotion(t *testing.T) {
+	store := &mockPromotionStore{promotions: []domain.Promotion{{ID: 1, Code: "SAVE"}}}
+
+	rr := servePromotionRequest(t, store, http.MethodDelete, "/promotions/1", "", domain.RoleAdmin)
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("expected status code %d, got %d", http.StatusNoContent, rr.Code)
+	}
+
+	rr = servePromotionRequest(t, store, http.MethodDelete, "/promotions/1", "", domain.RoleAdmin)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected status code %d on second delete, got %d", http.StatusNotFound, rr.Code)
+	}
+}
+
+func TestProtectedPromotionRoutes(t *testing.T) {
+	for _, url := range []string{"/promotions", "/promotions/1"} {
+		t.Run(url+" should return 401 without a token", func(t *testing.T) {
+			rr := servePromotionRequest(t, &mockPromotionStore{}, http.MethodGet, url, "", "")
+
+			if rr.Code != http.StatusUnauthorized {
+				t.Errorf("expected status code %d, got %d", http.StatusUnauthorized, rr.Code)
+			}
+		})
+
+		t.Run(url+" should return 403 for customers", func(t *testing.T) {
+			rr := servePromotionRequest(t, &mockPromotionStore{}, http.MethodGet, url, "", domain.RoleCustomer)
+
+			if rr.Code != http.StatusForbidden {
+				t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,246 @@
+package promotion
+
+import (
+	"database/sql"
+	"ecom/db"
+	"ecom/domain"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+const promotionColumns = `id, code, description, type, percent, amountOff, buyQuantity, getQuantity, minSubtotal,
+	productIds, categories, startsAt, endsAt, usageLimit, perUserLimit, timesUsed, active, createdAt`
+
+type Store struct {
+	db db.Querier
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+// WithTx returns a store whose queries run inside tx.
+func (s *Store) WithTx(tx *sql.Tx) *Store {
+	return &Store{db: tx}
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanPromotion(row scanner) (*domain.Promotion, error) {
+	promotion := new(domain.Promotion)
+	var productIDs, categories []byte
+	var usageLimit, perUserLimit sql.NullInt64
+	var startsAt, endsAt sql.NullTime
+	err := row.Scan(
+		&promotion.ID,
+		&promotion.Code,
+		&promotion.Description,
+		&promotion.Type,
+		&promotion.Percent,
+		&promotion.AmountOff,
+		&promotion.BuyQuantity,
+		&promotion.GetQuantity,
+		&promotion.MinSubtotal,
+		&productIDs,
+		&categories,
+		&startsAt,
+		&endsAt,
+		&usageLimit,
+		&perUserLimit,
+		&promotion.TimesUsed,
+		&promotion.Active,
+		&promotion.CreatedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrPromotionNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(productIDs, &promotion.ProductIDs); err != nil {
+		return nil, fmt.Errorf("promotion %d: %w", promotion.ID, err)
+	}
+	if err := json.Unmarshal(categories, &promotion.Categories); err != nil {
+		return nil, fmt.Errorf("promotion %d: %w", promotion.ID, err)
+	}
+	if startsAt.Valid {
+		promotion.StartsAt = &startsAt.Time
+	}
+	if endsAt.Valid {
+		promotion.EndsAt = &endsAt.Time
+	}
+	if usageLimit.Valid {
+		limit := int(usageLimit.Int64)
+		promotion.UsageLimit = &limit
+	}
+	if perUserLimit.Valid {
+		limit := int(perUserLimit.Int64)
+		promotion.PerUserLimit = &limit
+	}
+
+	return promotion, nil
+}
+
+// eligibility encodes the product and category lists for their JSON columns.
+func eligibility(promotion domain.Promotion) ([]byte, []byte, error) {
+	productIDs := promotion.ProductIDs
+	if productIDs == nil {
+		productIDs = []int{}
+	}
+	categories := promotion.Categories
+	if categories == nil {
+		categories = []string{}
+	}
+
+	encodedProductIDs, err := json.Marshal(productIDs)
+	if err != nil {
+		return nil, nil, err
+	}
+	encodedCategories, err := json.Marshal(categories)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return encodedProductIDs, encodedCategories, nil
+}
+
+func (s *Store) GetPromotions() (*[]domain.Promotion, error) {
+	rows, err := s.db.Query("SELECT " + promotionColumns + " FROM promotions WHERE deletedAt IS NULL ORDER BY createdAt DESC, id DESC")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	promotions := make([]domain.Promotion, 0)
+	for rows.Next() {
+		promotion, err := scanPromotion(rows)
+		if err != nil {
+			return nil, err
+		}
+		promotions = append(promotions, *promotion)
+	}
+
+	return &promotions, rows.Err()
+}
+
+func (s *Store) GetPromotionByID(id int) (*domain.Promotion, error) {
+	row := s.db.QueryRow("SELECT "+promotionColumns+" FROM promotions WHERE id = ? AND deletedAt IS NULL", id)
+	return scanPromotion(row)
+}
+
+func (s *Store) GetPromotionByCode(code string) (*domain.Promotion, error) {
+	row := s.db.QueryRow("SELECT "+promotionColumns+" FROM promotions WHERE code = ? AND deletedAt IS NULL", code)
+	return scanPromotion(row)
+}
+
+func (s *Store) CreatePromotion(promotion domain.Promotion) (int, error) {
+	productIDs, categories, err := eligibility(promotion)
+	if err != nil {
+		return 0, err
+	}
+
+	result, err := s.db.Exec(`
+		INSERT INTO promotions (code, description, type, percent, amountOff, buyQuantity, getQuantity, minSubtotal,
+			productIds, categories, startsAt, endsAt, usageLimit, perUserLimit, active)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, promotion.Code, promotion.Description, promotion.Type, promotion.Percent, promotion.AmountOff,
+		promotion.BuyQuantity, promotion.GetQuantity, promotion.MinSubtotal, productIDs, categories,
+		promotion.StartsAt, promotion.EndsAt, promotion.UsageLimit, promotion.PerUserLimit, promotion.Active)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+func (s *Store) UpdatePromotion(promotion domain.Promotion) error {
+	productIDs, categories, err := eligibility(promotion)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.Exec(`
+		UPDATE promotions
+		SET code = ?, description = ?, type = ?, percent = ?, amountOff = ?, buyQuantity = ?, getQuantity = ?,
+			minSubtotal = ?, productIds = ?, categories = ?, startsAt = ?, endsAt = ?, usageLimit = ?,
+			perUserLimit = ?, active = ?
+		WHERE id = ? AND deletedAt IS NULL
+	`, promotion.Code, promotion.Description, promotion.Type, promotion.Percent, promotion.AmountOff,
+		promotion.BuyQuantity, promotion.GetQuantity, promotion.MinSubtotal, productIDs, categories,
+		promotion.StartsAt, promotion.EndsAt, promotion.UsageLimit, promotion.PerUserLimit, promotion.Active,
+		promotion.ID)
+	return err
+}
+
+// DeletePromotion soft-deletes the promotion so the redemptions of past
+// orders keep pointing at it.
+func (s *Store) DeletePromotion(id int) error {
+	result, err := s.db.Exec("UPDATE promotions SET deletedAt = NOW() WHERE id = ? AND deletedAt IS NULL", id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrPromotionNotFound
+	}
+
+	return nil
+}
+
+func (s *Store) CountRedemptions(promotionID int, userID string) (int, error) {
+	var count int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM promotion_redemptions WHERE promotionId = ? AND userId = ?", promotionID, userID).Scan(&count)
+	return count, err
+}
+
+func (s *Store) RedeemPromotion(redemption domain.PromotionRedemption) error {
+	// the conditional update enforces the global limit and locks the
+	// promotion row, so concurrent checkouts check the per-user limit in turn
+	result, err := s.db.Exec(`
+		UPDATE promotions
+		SET timesUsed = timesUsed + 1
+		WHERE id = ? AND deletedAt IS NULL AND (usageLimit IS NULL OR timesUsed < usageLimit)
+	`, redemption.PromotionID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return fmt.Errorf("%w: code %s has reached its usage limit", domain.ErrPromotionNotApplicable, redemption.Code)
+	}
+
+	var perUserLimit sql.NullInt64
+	err = s.db.QueryRow("SELECT perUserLimit FROM promotions WHERE id = ?", redemption.PromotionID).Scan(&perUserLimit)
+	if err != nil {
+		return err
+	}
+	if perUserLimit.Valid {
+		count, err := s.CountRedemptions(redemption.PromotionID, redemption.UserID)
+		if err != nil {
+			return err
+		}
+		if int64(count) >= perUserLimit.Int64 {
+			return fmt.Errorf("%w: code %s was already used", domain.ErrPromotionNotApplicable, redemption.Code)
+		}
+	}
+
+	_, err = s.db.Exec("INSERT INTO promotion_redemptions (promotionId, orderId, userId, code, discount) VALUES (?, ?, ?, ?, ?)",
+		redemption.PromotionID, redemption.OrderID, redemption.UserID, redemption.Code, redemption.Discount)
+	return err
+}
@@ -0,0 +1,430 @@
+package returns
+
+import (
+	"ecom/domain"
+	"ecom/middleware"
+	"ecom/service/order"
+	"ecom/utils"
+	"errors"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultReturnsLimit = 20
+	maxReturnsLimit     = 100
+)
+
+type Handler struct {
+	store      domain.ReturnRepository
+	orderStore domain.OrderRepository
+	uow        domain.UnitOfWork
+	payments   domain.PaymentProvider
+}
+
+func NewHandler(store domain.ReturnRepository, orderStore domain.OrderRepository, uow domain.UnitOfWork, payments domain.PaymentProvider) *Handler {
+	return &Handler{
+		store:      store,
+		orderStore: orderStore,
+		uow:        uow,
+		payments:   payments,
+	}
+}
+
+func (h *Handler) ReturnRoutes(router *mux.Router) {
+	// customers open and follow their own returns
+	router.Handle("/me/returns", middleware.JWTMiddleware(http.HandlerFunc(h.handleCreateReturn))).Methods(http.MethodPost)
+	router.Handle("/me/returns", middleware.JWTMiddleware(http.HandlerFunc(h.handleGetMyReturns))).Methods(http.MethodGet)
+	router.Handle("/me/returns/{id}", middleware.JWTMiddleware(http.HandlerFunc(h.handleGetMyReturn))).Methods(http.MethodGet)
+
+	// staff work through the returns of every customer
+	router.Handle("/returns", middleware.Authorize(h.handleGetReturns, domain.RoleStaff, domain.RoleAdmin)).Methods(http.MethodGet)
+	router.Handle("/returns/{id}", middleware.Authorize(h.handleGetReturn, domain.RoleStaff, domain.RoleAdmin)).Methods(http.MethodGet)
+	router.Handle("/returns/{id}/status", middleware.Authorize(h.handleUpdateReturnStatus, domain.RoleStaff, domain.RoleAdmin)).Methods(http.MethodPatch)
+	router.Handle("/returns/{id}/refund", middleware.Authorize(h.handleRefundReturn, domain.RoleStaff, domain.RoleAdmin)).Methods(http.MethodPost)
+}
+
+func (h *Handler) handleCreateReturn(w http.ResponseWriter, r *http.Request) {
+	// get JSON payload
+	var payload domain.ReturnPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// validate the payload
+	if err := utils.Validate.Struct(payload); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", validationErrors))
+		return
+	}
+
+	// get the user ID from the context
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	// get the order, hiding orders of other users
+	current, err := h.orderStore.GetOrderByID(payload.OrderID)
+	if errors.Is(err, domain.ErrOrderNotFound) || (err == nil && current.UserID != userID) {
+		utils.WriteError(w, http.StatusNotFound, domain.ErrOrderNotFound)
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !isReturnable(current.Status) {
+		utils.WriteError(w, http.StatusConflict, fmt.Errorf("items of a %s order can't be returned", current.Status))
+		return
+	}
+
+	var ret *domain.Return
+	err = h.uow.Do(func(repos domain.Repositories) error {
+		ret, err = openReturn(repos, current, payload)
+		return err
+	})
+	if errors.Is(err, domain.ErrInvalidReturn) {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, ret)
+}
+
+// openReturn checks the items against what is left of the order, net of
+// refunds and of the other open returns, and writes the return. The order
+// stays locked until the return is written, so concurrent returns of the
+// same order are checked one after the other.
+func openReturn(repos domain.Repositories, current *domain.Order, payload domain.ReturnPayload) (*domain.Return, error) {
+	if err := repos.Orders().LockOrder(current.ID); err != nil {
+		return nil, err
+	}
+
+	items, err := repos.Orders().GetOrderItems(current.ID)
+	if err != nil {
+		return nil, err
+	}
+	byID := make(map[int]domain.OrderItem, len(*items))
+	for _, item := range *items {
+		byID[item.ID] = item
+	}
+
+	open, err := repos.Returns().GetOpenReturnQuantities(current.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &domain.Return{
+		OrderID: current.ID,
+		UserID:  current.UserID,
+		Status:  domain.ReturnStatusRequested,
+		Items:   make([]domain.ReturnItem, 0, len(payload.Items)),
+	}
+	seen := make(map[int]bool, len(payload.Items))
+	for _, requested := range payload.Items {
+		item, ok := byID[requested.OrderItemID]
+		if !ok {
+			return nil, fmt.Errorf("%w: order item %d is not part of the order", domain.ErrInvalidReturn, requested.OrderItemID)
+		}
+		if seen[item.ID] {
+			return nil, fmt.Errorf("%w: order item %d is listed twice", domain.ErrInvalidReturn, item.ID)
+		}
+		seen[item.ID] = true
+
+		if left := item.Quantity - item.RefundedQuantity - open[item.ID]; requested.Quantity > left {
+			return nil, fmt.Errorf("%w: only %d of order item %d can be returned", domain.ErrInvalidReturn, left, item.ID)
+		}
+
+		ret.Items = append(ret.Items, domain.ReturnItem{
+			OrderItemID: item.ID,
+			Quantity:    requested.Quantity,
+			Reason:      requested.Reason,
+		})
+	}
+
+	ret.ID, err = repos.Returns().CreateReturn(*ret)
+	if err != nil {
+		return nil, err
+	}
+	for i := range ret.Items {
+		ret.Items[i].ReturnID = ret.ID
+	}
+
+	return ret, nil
+}
+
+func (h *Handler) handleGetMyReturns(w http.ResponseWriter, r *http.Request) {
+	// get the user ID from the context
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	filter, err := parseReturnFilter(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+	filter.UserID = userID
+
+	h.writeReturns(w, filter)
+}
+
+func (h *Handler) handleGetReturns(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseReturnFilter(r)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	h.writeReturns(w, filter)
+}
+
+func (h *Handler) writeReturns(w http.ResponseWriter, filter domain.ReturnFilter) {
+	returns, total, err := h.store.GetReturns(filter)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"returns": returns,
+		"total":   total,
+		"limit":   filter.Limit,
+		"offset":  filter.Offset,
+	})
+}
+
+func (h *Handler) handleGetMyReturn(w http.ResponseWriter, r *http.Request) {
+	// get the user ID from the context
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	h.writeReturn(w, r, userID)
+}
+
+func (h *Handler) handleGetReturn(w http.ResponseWriter, r *http.Request) {
+	h.writeReturn(w, r, "")
+}
+
+// writeReturn writes the return with its history. Returns of other users
+// than userID are hidden unless userID is empty.
+func (h *Handler) writeReturn(w http.ResponseWriter, r *http.Request, userID string) {
+	// get the return ID from the URL
+	returnID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid return ID"))
+		return
+	}
+
+	ret, err := h.store.GetReturnByID(returnID)
+	if errors.Is(err, domain.ErrReturnNotFound) || (err == nil && userID != "" && ret.UserID != userID) {
+		utils.WriteError(w, http.StatusNotFound, domain.ErrReturnNotFound)
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	history, err := h.store.GetReturnStatusHistory(ret.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, domain.ReturnDetails{Return: *ret, History: *history})
+}
+
+func (h *Handler) handleUpdateReturnStatus(w http.ResponseWriter, r *http.Request) {
+	// get the return ID from the URL
+	returnID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid return ID"))
+		return
+	}
+
+	// get JSON payload
+	var payload domain.ReturnStatusPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// validate the payload
+	if err := utils.Validate.Struct(payload); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", validationErrors))
+		return
+	}
+
+	if !isKnownStatus(payload.Status) {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("unknown return status %s", payload.Status))
+		return
+	}
+	if payload.Status == domain.ReturnStatusRefunded {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("returns are refunded through the refund endpoint"))
+		return
+	}
+
+	// get the acting user from the context
+	actorID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	// make sure the return exists
+	current, err := h.store.GetReturnByID(returnID)
+	if errors.Is(err, domain.ErrReturnNotFound) {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if !CanTransition(current.Status, payload.Status) {
+		utils.WriteError(w, http.StatusConflict, fmt.Errorf("cannot change return status from %s to %s", current.Status, payload.Status))
+		return
+	}
+
+	// apply the transition
+	var ret *domain.Return
+	err = h.uow.Do(func(repos domain.Repositories) error {
+		ret, err = Transition(repos, returnID, payload.Status, actorID, payload.Note)
+		return err
+	})
+	if errors.Is(err, domain.ErrReturnStatusConflict) {
+		utils.WriteError(w, http.StatusConflict, err)
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, ret)
+}
+
+func (h *Handler) handleRefundReturn(w http.ResponseWriter, r *http.Request) {
+	// get the return ID from the URL
+	returnID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid return ID"))
+		return
+	}
+
+	// get JSON payload
+	var payload domain.ReturnRefundPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// get the acting user from the context
+	actorID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	// make sure the return exists and was inspected
+	current, err := h.store.GetReturnByID(returnID)
+	if errors.Is(err, domain.ErrReturnNotFound) {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !CanTransition(current.Status, domain.ReturnStatusRefunded) {
+		utils.WriteError(w, http.StatusConflict, fmt.Errorf("a %s return can't be refunded", current.Status))
+		return
+	}
+
+	// close the return together with the pending refund, so it's refunded
+	// once, and open it again if the provider rejects the refund
+	var ret *domain.Return
+	refund, err := order.Refund(h.uow, h.payments, current.OrderID, refundPayload(current, payload), actorID, order.RefundHooks{
+		Started: func(repos domain.Repositories, refund *domain.Refund) error {
+			var err error
+			ret, err = Transition(repos, current.ID, domain.ReturnStatusRefunded, actorID, "")
+			if err != nil {
+				return err
+			}
+			return repos.Returns().SetReturnRefund(current.ID, refund.ID)
+		},
+		Failed: func(repos domain.Repositories, refund *domain.Refund) error {
+			return reopenReturn(repos, current.ID, actorID)
+		},
+	})
+	if errors.Is(err, domain.ErrInvalidRefund) || errors.Is(err, domain.ErrOrderNotRefundable) ||
+		errors.Is(err, domain.ErrRefundConflict) || errors.Is(err, domain.ErrReturnStatusConflict) ||
+		errors.Is(err, domain.ErrOrderStatusConflict) || errors.Is(err, domain.ErrPaymentStatusConflict) {
+		utils.WriteError(w, http.StatusConflict, err)
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	ret.RefundID = &refund.ID
+
+	utils.WriteJSON(w, http.StatusCreated, map[string]interface{}{
+		"return": ret,
+		"refund": refund,
+	})
+}
+
+// refundPayload refunds exactly the returned quantities.
+func refundPayload(ret *domain.Return, payload domain.ReturnRefundPayload) domain.RefundPayload {
+	refund := domain.RefundPayload{
+		Items:   make([]domain.RefundItemPayload, len(ret.Items)),
+		Restock: payload.Restock,
+		Reason:  fmt.Sprintf("return %d", ret.ID),
+	}
+	for i, item := range ret.Items {
+		refund.Items[i] = domain.RefundItemPayload{OrderItemID: item.OrderItemID, Quantity: item.Quantity}
+	}
+	return refund
+}
+
+func parseReturnFilter(r *http.Request) (domain.ReturnFilter, error) {
+	query := r.URL.Query()
+	filter := domain.ReturnFilter{Limit: defaultReturnsLimit}
+
+	if limit := query.Get("limit"); limit != "" {
+		value, err := strconv.Atoi(limit)
+		if err != nil || value < 1 || value > maxReturnsLimit {
+			return filter, fmt.Errorf("limit must be between 1 and %d", maxReturnsLimit)
+		}
+		filter.Limit = value
+	}
+
+	if offset := query.Get("offset"); offset != "" {
+		value, err := strconv.Atoi(offset)
+		if err != nil || value < 0 {
+			return filter, fmt.Errorf("invalid offset")
+		}
+		filter.Offset = value
+	}
+
+	if status := query.Get("status"); status != "" {
+		if !isKnownStatus(status) {
+			return filter, fmt.Errorf("unknown return status %s", status)
+		}
+		filter.Status = status
+	}
+
+	return filter, nil
+}
@@ -0,0 +1,547 @@
+package returns
+
+import (
+	"bytes"
+	"ecom/config"
+	"ecom/domain"
+	"ecom/gateway"
+	"ecom/service/auth"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// money parses a test amount in the default currency.
+func money(value string) domain.Money {
+	return domain.MustParseMoney(value, domain.DefaultCurrency)
+}
+
+type mockReturnStore struct {
+	returns map[int]*domain.Return
+	history []domain.ReturnStatusHistory
+}
+
+func (m *mockReturnStore) CreateReturn(ret domain.Return) (int, error) {
+	ret.ID = len(m.returns) + 1
+	m.returns[ret.ID] = &ret
+	return ret.ID, nil
+}
+
+func (m *mockReturnStore) GetReturnByID(id int) (*domain.Return, error) {
+	ret, ok := m.returns[id]
+	if !ok {
+		return nil, domain.ErrReturnNotFound
+	}
+	copied := *ret
+	return &copied, nil
+}
+
+func (m *mockReturnStore) GetReturns(filter domain.ReturnFilter) (*[]domain.Return, int, error) {
+	returns := make([]domain.Return, 0)
+	for id := 1; id <= len(m.returns); id++ {
+		ret := m.returns[id]
+		if (filter.UserID == "" || ret.UserID == filter.UserID) && (filter.Status == "" || ret.Status == filter.Status) {
+			returns = append(returns, *ret)
+		}
+	}
+	return &returns, len(returns), nil
+}
+
+func (m *mockReturnStore) GetOpenReturnQuantities(orderID int) (map[int]int, error) {
+	quantities := make(map[int]int)
+	for _, ret := range m.returns {
+		if ret.OrderID != orderID || ret.Status == domain.ReturnStatusRejected || ret.Status == domain.ReturnStatusRefunded {
+			continue
+		}
+		for _, item := range ret.Items {
+			quantities[item.OrderItemID] += item.Quantity
+		}
+	}
+	return quantities, nil
+}
+
+func (m *mockReturnStore) UpdateReturnStatus(id int, from, to string) error {
+	ret := m.returns[id]
+	if ret.Status != from {
+		return domain.ErrReturnStatusConflict
+	}
+	ret.Status = to
+	return nil
+}
+
+func (m *mockReturnStore) SetReturnRefund(id int, refundID int) error {
+	m.returns[id].RefundID = &refundID
+	return nil
+}
+
+func (m *mockReturnStore) CreateReturnStatusHistory(history domain.ReturnStatusHistory) error {
+	m.history = append(m.history, history)
+	return nil
+}
+
+func (m *mockReturnStore) GetReturnStatusHistory(returnID int) (*[]domain.ReturnStatusHistory, error) {
+	history := make([]domain.ReturnStatusHistory, 0)
+	for _, entry := range m.history {
+		if entry.ReturnID == returnID {
+			history = append(history, entry)
+		}
+	}
+	return &history, nil
+}
+
+type mockOrderStore struct {
+	domain.OrderRepository
+	orders  map[int]*domain.Order
+	items   map[int][]domain.OrderItem
+	refunds []domain.Refund
+	locked  []int
+}
+
+func (m *mockOrderStore) GetOrderByID(id int) (*domain.Order, error) {
+	order, ok := m.orders[id]
+	if !ok {
+		return nil, domain.ErrOrderNotFound
+	}
+	copied := *order
+	return &copied, nil
+}
+
+func (m *mockOrderStore) LockOrder(id int) error {
+	m.locked = append(m.locked, id)
+	return nil
+}
+
+func (m *mockOrderStore) GetOrderItems(orderID int) (*[]domain.OrderItem, error) {
+	items := append([]domain.OrderItem(nil), m.items[orderID]...)
+	return &items, nil
+}
+
+func (m *mockOrderStore) UpdateOrderStatus(id int, from, to string) error {
+	order := m.orders[id]
+	if order.Status != from {
+		return domain.ErrOrderStatusConflict
+	}
+	order.Status = to
+	return nil
+}
+
+func (m *mockOrderStore) CreateOrderStatusHistory(history domain.OrderStatusHistory) error {
+	return nil
+}
+
+func (m *mockOrderStore) CreateRefund(refund domain.Refund) (int, error) {
+	order := m.orders[refund.OrderID]
+	order.Refunded = order.Refunded.Add(refund.Amount)
+	items := m.items[refund.OrderID]
+	for _, refunded := range refund.Items {
+		for i := range items {
+			if items[i].ID == refunded.OrderItemID {
+				items[i].RefundedQuantity += refunded.Quantity
+			}
+		}
+	}
+	m.refunds = append(m.refunds, refund)
+	return len(m.refunds), nil
+}
+
+func (m *mockOrderStore) CompleteRefund(id int) error {
+	if m.refunds[id-1].Status != domain.RefundStatusPending {
+		return domain.ErrRefundConflict
+	}
+	m.refunds[id-1].Status = domain.RefundStatusCompleted
+	return nil
+}
+
+func (m *mockOrderStore) FailRefund(refund domain.Refund) error {
+	if m.refunds[refund.ID-1].Status != domain.RefundStatusPending {
+		return domain.ErrRefundConflict
+	}
+	m.refunds[refund.ID-1].Status = domain.RefundStatusFailed
+	order := m.orders[refund.OrderID]
+	order.Refunded = order.Refunded.Sub(refund.Amount)
+	items := m.items[refund.OrderID]
+	for _, refunded := range refund.Items {
+		for i := range items {
+			if items[i].ID == refunded.OrderItemID {
+				items[i].RefundedQuantity -= refunded.Quantity
+			}
+		}
+	}
+	return nil
+}
+
+type mockPaymentStore struct {
+	domain.PaymentRepository
+	payments []domain.Payment
+}
+
+func (m *mockPaymentStore) GetPaymentsByOrderID(orderID int) (*[]domain.Payment, error) {
+	payments := append([]domain.Payment(nil), m.payments...)
+	return &payments, nil
+}
+
+type mockProductStore struct {
+	domain.ProductRepository
+	stock map[int]int
+}
+
+func (m *mockProductStore) UpdateProductStock(productID, warehouseID, quantity int) error {
+	m.stock[productID] += quantity
+	return nil
+}
+
+type mockUnitOfWork struct {
+	returns  *mockReturnStore
+	orders   *mockOrderStore
+	payments *mockPaymentStore
+	products *mockProductStore
+}
+
+func (m *mockUnitOfWork) Products() domain.ProductRepository {
+	return m.products
+}
+
+func (m *mockUnitOfWork) Orders() domain.OrderRepository {
+	return m.orders
+}
+
+func (m *mockUnitOfWork) Carts() domain.CartRepository {
+	return nil
+}
+
+func (m *mockUnitOfWork) Promotions() domain.PromotionRepository {
+	return nil
+}
+
+func (m *mockUnitOfWork) Payments() domain.PaymentRepository {
+	return m.payments
+}
+
+func (m *mockUnitOfWork) Returns() domain.ReturnRepository {
+	return m.returns
+}
+
+func (m *mockUnitOfWork) Reservations() domain.ReservationRepository {
+	return nil
+}
+
+func (m *mockUnitOfWork) Warehouses() domain.WarehouseRepository {
+	return nil
+}
+
+func (m *mockUnitOfWork) Do(fn func(repos domain.Repositories) error) error {
+	return fn(m)
+}
+
+func newReturnRequest(t *testing.T, method, url, userID, role string, payload any) *http.Request {
+	var body bytes.Buffer
+	if payload != nil {
+		if err := json.NewEncoder(&body).Encode(payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req, err := http.NewRequest(method, url, &body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := auth.NewStore().CreateToken([]byte(config.ENV.JWTSecret), domain.User{ID: userID, Role: role})
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+func serveReturnRequest(handler *Handler, req *http.Request) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	router := mux.NewRouter()
+	handler.ReturnRoutes(router)
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+// newDeliveredOrders returns a store holding the delivered order 1 of user-1,
+// 2 of product 7 and 1 of product 8 for 30.00.
+func newDeliveredOrders() *mockOrderStore {
+	return &mockOrderStore{
+		orders: map[int]*domain.Order{1: {ID: 1, UserID: "user-1", Total: money("30"), Status: domain.OrderStatusDelivered}},
+		items: map[int][]domain.OrderItem{1: {
+			{ID: 1, OrderID: 1, ProductID: 7, Quantity: 2, Price: money("10"), Total: money("20")},
+			{ID: 2, OrderID: 1, ProductID: 8, Quantity: 1, Price: money("10"), Total: money("10")},
+		}},
+	}
+}
+
+// newRequestedReturns returns a store holding return 1 of one unit of order
+// item 1, as the customer requested it.
+func newRequestedReturns() *mockReturnStore {
+	return &mockReturnStore{returns: map[int]*domain.Return{
+		1: {ID: 1, OrderID: 1, UserID: "user-1", Status: domain.ReturnStatusRequested, Items: []domain.ReturnItem{
+			{ID: 1, ReturnID: 1, OrderItemID: 1, Quantity: 1, Reason: "too small"},
+		}},
+	}}
+}
+
+// newReturnHandler returns a handler on the stores of uow and a fake provider.
+func newReturnHandler(uow *mockUnitOfWork) *Handler {
+	return NewHandler(uow.returns, uow.orders, uow, gateway.NewFakeProvider("secret", "", nil))
+}
+
+func TestHandleCreateReturn(t *testing.T) {
+	payload := domain.ReturnPayload{
+		OrderID: 1,
+		Items:   []domain.ReturnItemPayload{{OrderItemID: 1, Quantity: 1, Reason: "too small"}},
+	}
+
+	t.Run("should open a return for the customer's order", func(t *testing.T) {
+		uow := &mockUnitOfWork{returns: &mockReturnStore{returns: map[int]*domain.Return{}}, orders: newDeliveredOrders()}
+		handler := newReturnHandler(uow)
+
+		rr := serveReturnRequest(handler, newReturnRequest(t, http.MethodPost, "/me/returns", "user-1", domain.RoleCustomer, payload))
+
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status code %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body)
+		}
+		ret := uow.returns.returns[1]
+		if ret == nil || ret.Status != domain.ReturnStatusRequested || ret.UserID != "user-1" || len(ret.Items) != 1 {
+			t.Errorf("unexpected return %+v", ret)
+		}
+		if locked := uow.orders.locked; len(locked) != 1 || locked[0] != 1 {
+			t.Errorf("expected the order to be locked while the return is checked, got %v", locked)
+		}
+	})
+
+	t.Run("should return 404 for orders of other users", func(t *testing.T) {
+		uow := &mockUnitOfWork{returns: &mockReturnStore{returns: map[int]*domain.Return{}}, orders: newDeliveredOrders()}
+		handler := newReturnHandler(uow)
+
+		rr := serveReturnRequest(handler, newReturnRequest(t, http.MethodPost, "/me/returns", "user-2", domain.RoleCustomer, payload))
+
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code %d, got %d", http.StatusNotFound, rr.Code)
+		}
+	})
+
+	t.Run("should return 409 for orders that weren't shipped", func(t *testing.T) {
+		uow := &mockUnitOfWork{returns: &mockReturnStore{returns: map[int]*domain.Return{}}, orders: newDeliveredOrders()}
+		uow.orders.orders[2] = &domain.Order{ID: 2, UserID: "user-1", Status: domain.OrderStatusPending}
+		handler := newReturnHandler(uow)
+
+		pending := domain.ReturnPayload{OrderID: 2, Items: payload.Items}
+		rr := serveReturnRequest(handler, newReturnRequest(t, http.MethodPost, "/me/returns", "user-1", domain.RoleCustomer, pending))
+
+		if rr.Code != http.StatusConflict {
+			t.Errorf("expected status code %d, got %d", http.StatusConflict, rr.Code)
+		}
+	})
+
+	t.Run("should not return more than is left after open returns", func(t *testing.T) {
+		uow := &mockUnitOfWork{returns: &mockReturnStore{returns: map[int]*domain.Return{}}, orders: newDeliveredOrders()}
+		handler := newReturnHandler(uow)
+
+		for _, expected := range []int{http.StatusCreated, http.StatusCreated, http.StatusBadRequest} {
+			rr := serveReturnRequest(handler, newReturnRequest(t, http.MethodPost, "/me/returns", "user-1", domain.RoleCustomer, payload))
+			if rr.Code != expected {
+				t.Fatalf("expected status code %d, got %d", expected, rr.Code)
+			}
+		}
+
+		// a rejected return frees its quantity again
+		uow.returns.returns[1].Status = domain.ReturnStatusRejected
+		rr := serveReturnRequest(handler, newReturnRequest(t, http.MethodPost, "/me/returns", "user-1", domain.RoleCustomer, payload))
+		if rr.Code != http.StatusCreated {
+			t.Errorf("expected status code %d, got %d", http.StatusCreated, rr.Code)
+		}
+	})
+
+	t.Run("should return 400 for invalid items", func(t *testing.T) {
+		payloads := map[string]domain.ReturnPayload{
+			"no items":     {OrderID: 1},
+			"no reason":    {OrderID: 1, Items: []domain.ReturnItemPayload{{OrderItemID: 1, Quantity: 1}}},
+			"unknown item": {OrderID: 1, Items: []domain.ReturnItemPayload{{OrderItemID: 9, Quantity: 1, Reason: "broken"}}},
+			"listed twice": {OrderID: 1, Items: []domain.ReturnItemPayload{{OrderItemID: 2, Quantity: 1, Reason: "a"}, {OrderItemID: 2, Quantity: 1, Reason: "b"}}},
+		}
+		for name, payload := range payloads {
+			uow := &mockUnitOfWork{returns: &mockReturnStore{returns: map[int]*domain.Return{}}, orders: newDeliveredOrders()}
+			handler := newReturnHandler(uow)
+
+			rr := serveReturnRequest(handler, newReturnRequest(t, http.MethodPost, "/me/returns", "user-1", domain.RoleCustomer, payload))
+
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("%s: expected status code %d, got %d", name, http.StatusBadRequest, rr.Code)
+			}
+			if len(uow.returns.returns) != 0 {
+				t.Errorf("%s: expected no returns, got %d", name, len(uow.returns.returns))
+			}
+		}
+	})
+}
+
+func TestReturnWorkflow(t *testing.T) {
+	setStatus := func(handler *Handler, t *testing.T, status string) *httptest.ResponseRecorder {
+		payload := domain.ReturnStatusPayload{Status: status, Note: "checked"}
+		return serveReturnRequest(handler, newReturnRequest(t, http.MethodPatch, "/returns/1/status", "staff-1", domain.RoleStaff, payload))
+	}
+
+	t.Run("should refund and restock an inspected return", func(t *testing.T) {
+		provider := gateway.NewFakeProvider("secret", "", nil)
+		reference, err := provider.Authorize(domain.PaymentRequest{Amount: money("30"), Source: "4242424242424242"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := provider.Capture(reference, money("30")); err != nil {
+			t.Fatal(err)
+		}
+		uow := &mockUnitOfWork{
+			returns: newRequestedReturns(),
+			orders:  newDeliveredOrders(),
+			payments: &mockPaymentStore{payments: []domain.Payment{
+				{ID: 1, OrderID: 1, Provider: "fake", Reference: reference, Amount: money("30"), Status: domain.PaymentStatusCaptured},
+			}},
+			products: &mockProductStore{stock: map[int]int{7: 0}},
+		}
+		handler := NewHandler(uow.returns, uow.orders, uow, provider)
+
+		for _, status := range []string{domain.ReturnStatusApproved, domain.ReturnStatusReceived, domain.ReturnStatusInspected} {
+			if rr := setStatus(handler, t, status); rr.Code != http.StatusOK {
+				t.Fatalf("%s: expected status code %d, got %d: %s", status, http.StatusOK, rr.Code, rr.Body)
+			}
+		}
+
+		payload := domain.ReturnRefundPayload{Restock: true}
+		rr := serveReturnRequest(handler, newReturnRequest(t, http.MethodPost, "/returns/1/refund", "staff-1", domain.RoleStaff, payload))
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status code %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body)
+		}
+
+		ret := uow.returns.returns[1]
+		if ret.Status != domain.ReturnStatusRefunded || ret.RefundID == nil {
+			t.Errorf("expected the return to be refunded, got %+v", ret)
+		}
+		if len(uow.returns.history) != 4 || uow.returns.history[0].Note != "checked" {
+			t.Errorf("expected 4 history entries, got %+v", uow.returns.history)
+		}
+		if len(uow.orders.refunds) != 1 || uow.orders.refunds[0].Amount != money("10") {
+			t.Errorf("expected a refund of 10, got %+v", uow.orders.refunds)
+		}
+		if status := uow.orders.orders[1].Status; status != domain.OrderStatusPartiallyRefunded {
+			t.Errorf("expected the order to be partially refunded, got %s", status)
+		}
+		if uow.products.stock[7] != 1 {
+			t.Errorf("expected the returned unit back in stock, got %d", uow.products.stock[7])
+		}
+
+		// the customer sees the return with its history
+		rr = serveReturnRequest(handler, newReturnRequest(t, http.MethodGet, "/me/returns/1", "user-1", domain.RoleCustomer, nil))
+		var details domain.ReturnDetails
+		if err := json.NewDecoder(rr.Body).Decode(&details); err != nil {
+			t.Fatal(err)
+		}
+		if details.Status != domain.ReturnStatusRefunded || len(details.History) != 4 {
+			t.Errorf("unexpected return details %+v", details)
+		}
+	})
+
+	t.Run("should reopen the return when the provider rejects the refund", func(t *testing.T) {
+		uow := &mockUnitOfWork{
+			returns: newRequestedReturns(),
+			orders:  newDeliveredOrders(),
+			// the provider doesn't know the payment
+			payments: &mockPaymentStore{payments: []domain.Payment{
+				{ID: 1, OrderID: 1, Provider: "fake", Reference: "unknown", Amount: money("30"), Status: domain.PaymentStatusCaptured},
+			}},
+			products: &mockProductStore{stock: map[int]int{7: 0}},
+		}
+		handler := newReturnHandler(uow)
+
+		for _, status := range []string{domain.ReturnStatusApproved, domain.ReturnStatusReceived, domain.ReturnStatusInspected} {
+			if rr := setStatus(handler, t, status); rr.Code != http.StatusOK {
+				t.Fatalf("%s: expected status code %d, got %d: %s", status, http.StatusOK, rr.Code, rr.Body)
+			}
+		}
+		payload := domain.ReturnRefundPayload{Restock: true}
+		rr := serveReturnRequest(handler, newReturnRequest(t, http.MethodPost, "/returns/1/refund", "staff-1", domain.RoleStaff, payload))
+
+		if rr.Code != http.StatusInternalServerError {
+			t.Fatalf("expected status code %d, got %d", http.StatusInternalServerError, rr.Code)
+		}
+		if status := uow.returns.returns[1].Status; status != domain.ReturnStatusInspected {
+			t.Errorf("expected the return to be inspected again, got %s", status)
+		}
+		if len(uow.orders.refunds) != 1 || uow.orders.refunds[0].Status != domain.RefundStatusFailed {
+			t.Errorf("expected a failed refund, got %+v", uow.orders.refunds)
+		}
+		if order := uow.orders.orders[1]; order.Status != domain.OrderStatusDelivered || !order.Refunded.IsZero() {
+			t.Errorf("expected the order to stay delivered with nothing refunded, got %s and %v", order.Status, order.Refunded)
+		}
+		if uow.products.stock[7] != 0 {
+			t.Errorf("expected no restock, got %d", uow.products.stock[7])
+		}
+	})
+
+	t.Run("should only refund inspected returns", func(t *testing.T) {
+		uow := &mockUnitOfWork{returns: newRequestedReturns(), orders: newDeliveredOrders()}
+		handler := newReturnHandler(uow)
+
+		rr := serveReturnRequest(handler, newReturnRequest(t, http.MethodPost, "/returns/1/refund", "staff-1", domain.RoleStaff, domain.ReturnRefundPayload{}))
+
+		if rr.Code != http.StatusConflict {
+			t.Errorf("expected status code %d, got %d", http.StatusConflict, rr.Code)
+		}
+		if len(uow.orders.refunds) != 0 {
+			t.Errorf("expected no refunds, got %d", len(uow.orders.refunds))
+		}
+	})
+
+	t.Run("should reject skipped or manual refund statuses", func(t *testing.T) {
+		uow := &mockUnitOfWork{returns: newRequestedReturns()}
+		handler := newReturnHandler(uow)
+
+		if rr := setStatus(handler, t, domain.ReturnStatusReceived); rr.Code != http.StatusConflict {
+			t.Errorf("expected status code %d, got %d", http.StatusConflict, rr.Code)
+		}
+		if rr := setStatus(handler, t, domain.ReturnStatusRefunded); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+		if rr := setStatus(handler, t, domain.ReturnStatusRejected); rr.Code != http.StatusOK {
+			t.Errorf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+	})
+
+	t.Run("should keep staff endpoints from customers", func(t *testing.T) {
+		uow := &mockUnitOfWork{returns: newRequestedReturns()}
+		handler := newReturnHandler(uow)
+
+		payload := domain.ReturnStatusPayload{Status: domain.ReturnStatusApproved}
+		rr := serveReturnRequest(handler, newReturnRequest(t, http.MethodPatch, "/returns/1/status", "user-1", domain.RoleCustomer, payload))
+
+		if rr.Code != http.StatusForbidden {
+			t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+		}
+	})
+
+	t.Run("should hide returns of other users", func(t *testing.T) {
+		uow := &mockUnitOfWork{returns: newRequestedReturns()}
+		handler := newReturnHandler(uow)
+
+		rr := serveReturnRequest(handler, newReturnRequest(t, http.MethodGet, "/me/returns/1", "user-2", domain.RoleCustomer, nil))
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code %d, got %d", http.StatusNotFound, rr.Code)
+		}
+
+		rr = serveReturnRequest(handler, newReturnRequest(t, http.MethodGet, "/me/returns", "user-2", domain.RoleCustomer, nil))
+		var response struct {
+			Total int `json:"total"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		if response.Total != 0 {
+			t.Errorf("expected no returns for user-2, got %d", response.Total)
+		}
+	})
+}
@@ -0,0 +1,93 @@
+package returns
+
+import (
+	"ecom/domain"
+	"fmt"
+)
+
+// transitions lists the statuses a return may move to from each status.
+// Refunded is only reached through the refund endpoint.
+var transitions = map[string][]string{
+	domain.ReturnStatusRequested: {domain.ReturnStatusApproved, domain.ReturnStatusRejected},
+	domain.ReturnStatusApproved:  {domain.ReturnStatusReceived, domain.ReturnStatusRejected},
+	domain.ReturnStatusReceived:  {domain.ReturnStatusInspected},
+	domain.ReturnStatusInspected: {domain.ReturnStatusRefunded, domain.ReturnStatusRejected},
+}
+
+func isKnownStatus(status string) bool {
+	switch status {
+	case domain.ReturnStatusRequested, domain.ReturnStatusApproved, domain.ReturnStatusRejected,
+		domain.ReturnStatusReceived, domain.ReturnStatusInspected, domain.ReturnStatusRefunded:
+		return true
+	}
+	return false
+}
+
+// isReturnable reports whether the items of an order in the given status
+// have reached the customer and can be sent back.
+func isReturnable(orderStatus string) bool {
+	switch orderStatus {
+	case domain.OrderStatusShipped, domain.OrderStatusDelivered, domain.OrderStatusCompleted,
+		domain.OrderStatusPartiallyRefunded:
+		return true
+	}
+	return false
+}
+
+func CanTransition(from, to string) bool {
+	for _, next := range transitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Transition moves the return to the given status and records it in the
+// return history. It must be called inside a unit of work.
+func Transition(repos domain.Repositories, returnID int, to string, actorID string, note string) (*domain.Return, error) {
+	ret, err := repos.Returns().GetReturnByID(returnID)
+	if err != nil {
+		return nil, err
+	}
+
+	if !CanTransition(ret.Status, to) {
+		return nil, fmt.Errorf("cannot change return status from %s to %s", ret.Status, to)
+	}
+
+	if err := repos.Returns().UpdateReturnStatus(ret.ID, ret.Status, to); err != nil {
+		return nil, err
+	}
+
+	err = repos.Returns().CreateReturnStatusHistory(domain.ReturnStatusHistory{
+		ReturnID:   ret.ID,
+		FromStatus: ret.Status,
+		ToStatus:   to,
+		ActorID:    actorID,
+		Note:       note,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	ret.Status = to
+	return ret, nil
+}
+
+// reopenReturn moves a return closed by a refund the provider rejected back
+// to inspected, so it can be refunded again. It must be called inside a
+// unit of work.
+func reopenReturn(repos domain.Repositories, returnID int, actorID string) error {
+	err := repos.Returns().UpdateReturnStatus(returnID, domain.ReturnStatusRefunded, domain.ReturnStatusInspected)
+	if err != nil {
+		return err
+	}
+
+	return repos.Returns().CreateReturnStatusHistory(domain.ReturnStatusHistory{
+		ReturnID:   returnID,
+		FromStatus: domain.ReturnStatusRefunded,
+		ToStatus:   domain.ReturnStatusInspected,
+		ActorID:    actorID,
+		Note:       "refund failed",
+	})
+}
@@ -0,0 +1,240 @@
+package returns
+
+import (
+	"database/sql"
+	"ecom/db"
+	"ecom/domain"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+type Store struct {
+	db db.Querier
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+// WithTx returns a store whose queries run inside tx.
+func (s *Store) WithTx(tx *sql.Tx) *Store {
+	return &Store{db: tx}
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanReturn(row scanner) (*domain.Return, error) {
+	ret := new(domain.Return)
+	var refundID sql.NullInt64
+	err := row.Scan(
+		&ret.ID,
+		&ret.OrderID,
+		&ret.UserID,
+		&ret.Status,
+		&refundID,
+		&ret.CreatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if refundID.Valid {
+		id := int(refundID.Int64)
+		ret.RefundID = &id
+	}
+	return ret, nil
+}
+
+// CreateReturn writes the return along with its items. Call it inside a unit
+// of work so a failed item doesn't leave the return behind.
+func (s *Store) CreateReturn(ret domain.Return) (int, error) {
+	result, err := s.db.Exec("INSERT INTO return_requests (orderId, userId, status) VALUES (?, ?, ?)",
+		ret.OrderID, ret.UserID, ret.Status)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	for _, item := range ret.Items {
+		_, err := s.db.Exec("INSERT INTO return_items (returnId, orderItemId, quantity, reason) VALUES (?, ?, ?, ?)",
+			id, item.OrderItemID, item.Quantity, item.Reason)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return int(id), nil
+}
+
+func (s *Store) GetReturnByID(id int) (*domain.Return, error) {
+	row := s.db.QueryRow("SELECT id, orderId, userId, status, refundId, createdAt FROM return_requests WHERE id = ?", id)
+
+	ret, err := scanReturn(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrReturnNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query("SELECT id, returnId, orderItemId, quantity, reason FROM return_items WHERE returnId = ? ORDER BY id", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ret.Items = make([]domain.ReturnItem, 0)
+	for rows.Next() {
+		var item domain.ReturnItem
+		err := rows.Scan(
+			&item.ID,
+			&item.ReturnID,
+			&item.OrderItemID,
+			&item.Quantity,
+			&item.Reason,
+		)
+		if err != nil {
+			return nil, err
+		}
+		ret.Items = append(ret.Items, item)
+	}
+
+	return ret, rows.Err()
+}
+
+func (s *Store) GetReturns(filter domain.ReturnFilter) (*[]domain.Return, int, error) {
+	// staff list the returns of every user
+	var conditions []string
+	var args []interface{}
+	if filter.UserID != "" {
+		conditions = append(conditions, "userId = ?")
+		args = append(args, filter.UserID)
+	}
+	if filter.Status != "" {
+		conditions = append(conditions, "status = ?")
+		args = append(args, filter.Status)
+	}
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	var total int
+	err := s.db.QueryRow("SELECT COUNT(*) FROM return_requests "+where, args...).Scan(&total)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	query := fmt.Sprintf(`
+		SELECT id, orderId, userId, status, refundId, createdAt
+		FROM return_requests
+		%s
+		ORDER BY createdAt DESC, id DESC
+		LIMIT ? OFFSET ?
+	`, where)
+
+	rows, err := s.db.Query(query, append(args, filter.Limit, filter.Offset)...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	returns := make([]domain.Return, 0)
+	for rows.Next() {
+		ret, err := scanReturn(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		returns = append(returns, *ret)
+	}
+
+	return &returns, total, rows.Err()
+}
+
+func (s *Store) GetOpenReturnQuantities(orderID int) (map[int]int, error) {
+	rows, err := s.db.Query(`
+		SELECT ri.orderItemId, SUM(ri.quantity)
+		FROM return_items ri
+		JOIN return_requests r ON r.id = ri.returnId
+		WHERE r.orderId = ? AND r.status NOT IN (?, ?)
+		GROUP BY ri.orderItemId
+	`, orderID, domain.ReturnStatusRejected, domain.ReturnStatusRefunded)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	quantities := make(map[int]int)
+	for rows.Next() {
+		var orderItemID, quantity int
+		if err := rows.Scan(&orderItemID, &quantity); err != nil {
+			return nil, err
+		}
+		quantities[orderItemID] = quantity
+	}
+
+	return quantities, rows.Err()
+}
+
+func (s *Store) UpdateReturnStatus(id int, from, to string) error {
+	// only move the return if nobody else has moved it since it was read
+	result, err := s.db.Exec("UPDATE return_requests SET status = ? WHERE id = ? AND status = ?", to, id, from)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrReturnStatusConflict
+	}
+
+	return nil
+}
+
+func (s *Store) SetReturnRefund(id int, refundID int) error {
+	_, err := s.db.Exec("UPDATE return_requests SET refundId = ? WHERE id = ?", refundID, id)
+	return err
+}
+
+func (s *Store) CreateReturnStatusHistory(history domain.ReturnStatusHistory) error {
+	_, err := s.db.Exec("INSERT INTO return_status_history (returnId, fromStatus, toStatus, actorId, note) VALUES (?, ?, ?, ?, ?)",
+		history.ReturnID, history.FromStatus, history.ToStatus, history.ActorID, history.Note)
+	return err
+}
+
+func (s *Store) GetReturnStatusHistory(returnID int) (*[]domain.ReturnStatusHistory, error) {
+	rows, err := s.db.Query("SELECT id, returnId, fromStatus, toStatus, actorId, note, createdAt FROM return_status_history WHERE returnId = ? ORDER BY id", returnID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := make([]domain.ReturnStatusHistory, 0)
+	for rows.Next() {
+		var entry domain.ReturnStatusHistory
+		err := rows.Scan(
+			&entry.ID,
+			&entry.ReturnID,
+			&entry.FromStatus,
+			&entry.ToStatus,
+			&entry.ActorID,
+			&entry.Note,
+			&entry.CreatedAt,
+		)
+		if err != nil {
+			return nil, err
+		}
+		history = append(history, entry)
+	}
+
+	return &history, rows.Err()
+}
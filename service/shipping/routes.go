@@ -0,0 +1,348 @@
+package shipping
+
+import (
+	"ecom/domain"
+	"ecom/middleware"
+	"ecom/utils"
+	"errors"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type Handler struct {
+	store domain.ShippingRepository
+}
+
+func NewHandler(store domain.ShippingRepository) *Handler {
+	return &Handler{store: store}
+}
+
+func (h *Handler) ShippingRoutes(router *mux.Router) {
+	// customers see the methods priced for their cart under /cart/shipping-options
+	router.Handle("/shipping/zones", middleware.Authorize(h.handleGetZones, domain.RoleStaff, domain.RoleAdmin)).Methods(http.MethodGet)
+	router.Handle("/shipping/zones", middleware.Authorize(h.handleCreateZone, domain.RoleStaff, domain.RoleAdmin)).Methods(http.MethodPost)
+	router.Handle("/shipping/zones/{id}", middleware.Authorize(h.handleGetZone, domain.RoleStaff, domain.RoleAdmin)).Methods(http.MethodGet)
+	router.Handle("/shipping/zones/{id}", middleware.Authorize(h.handleUpdateZone, domain.RoleStaff, domain.RoleAdmin)).Methods(http.MethodPut)
+	router.Handle("/shipping/zones/{id}", middleware.Authorize(h.handleDeleteZone, domain.RoleStaff, domain.RoleAdmin)).Methods(http.MethodDelete)
+	router.Handle("/shipping/methods", middleware.Authorize(h.handleGetMethods, domain.RoleStaff, domain.RoleAdmin)).Methods(http.MethodGet)
+	router.Handle("/shipping/methods", middleware.Authorize(h.handleCreateMethod, domain.RoleStaff, domain.RoleAdmin)).Methods(http.MethodPost)
+	router.Handle("/shipping/methods/{id}", middleware.Authorize(h.handleGetMethod, domain.RoleStaff, domain.RoleAdmin)).Methods(http.MethodGet)
+	router.Handle("/shipping/methods/{id}", middleware.Authorize(h.handleUpdateMethod, domain.RoleStaff, domain.RoleAdmin)).Methods(http.MethodPut)
+	router.Handle("/shipping/methods/{id}", middleware.Authorize(h.handleDeleteMethod, domain.RoleStaff, domain.RoleAdmin)).Methods(http.MethodDelete)
+}
+
+func (h *Handler) handleGetZones(w http.ResponseWriter, r *http.Request) {
+	zones, err := h.store.GetShippingZones()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, zones)
+}
+
+func (h *Handler) handleGetZone(w http.ResponseWriter, r *http.Request) {
+	// get the zone ID from the URL
+	zoneID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid shipping zone ID"))
+		return
+	}
+
+	zone, err := h.store.GetShippingZoneByID(zoneID)
+	if errors.Is(err, domain.ErrShippingZoneNotFound) {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, zone)
+}
+
+func (h *Handler) handleCreateZone(w http.ResponseWriter, r *http.Request) {
+	// get JSON payload
+	var payload domain.ShippingZonePayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	zone, ok := parseZone(w, payload)
+	if !ok {
+		return
+	}
+
+	id, err := h.store.CreateShippingZone(zone)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	created, err := h.store.GetShippingZoneByID(id)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, created)
+}
+
+func (h *Handler) handleUpdateZone(w http.ResponseWriter, r *http.Request) {
+	// get the zone ID from the URL
+	zoneID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid shipping zone ID"))
+		return
+	}
+
+	// get JSON payload
+	var payload domain.ShippingZonePayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// make sure the zone exists
+	if _, err := h.store.GetShippingZoneByID(zoneID); errors.Is(err, domain.ErrShippingZoneNotFound) {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	zone, ok := parseZone(w, payload)
+	if !ok {
+		return
+	}
+	zone.ID = zoneID
+
+	if err := h.store.UpdateShippingZone(zone); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	updated, err := h.store.GetShippingZoneByID(zoneID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, updated)
+}
+
+func (h *Handler) handleDeleteZone(w http.ResponseWriter, r *http.Request) {
+	// get the zone ID from the URL
+	zoneID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid shipping zone ID"))
+		return
+	}
+
+	err = h.store.DeleteShippingZone(zoneID)
+	if errors.Is(err, domain.ErrShippingZoneNotFound) {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if errors.Is(err, domain.ErrShippingZoneInUse) {
+		utils.WriteError(w, http.StatusConflict, err)
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) handleGetMethods(w http.ResponseWriter, r *http.Request) {
+	methods, err := h.store.GetAllShippingMethods()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, methods)
+}
+
+func (h *Handler) handleGetMethod(w http.ResponseWriter, r *http.Request) {
+	// get the method ID from the URL
+	methodID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid shipping method ID"))
+		return
+	}
+
+	method, err := h.store.GetShippingMethodByID(methodID)
+	if errors.Is(err, domain.ErrShippingMethodNotFound) {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, method)
+}
+
+func (h *Handler) handleCreateMethod(w http.ResponseWriter, r *http.Request) {
+	// get JSON payload
+	var payload domain.ShippingMethodPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	method, ok := h.parseMethod(w, payload)
+	if !ok {
+		return
+	}
+
+	id, err := h.store.CreateShippingMethod(method)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	created, err := h.store.GetShippingMethodByID(id)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, created)
+}
+
+func (h *Handler) handleUpdateMethod(w http.ResponseWriter, r *http.Request) {
+	// get the method ID from the URL
+	methodID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid shipping method ID"))
+		return
+	}
+
+	// get JSON payload
+	var payload domain.ShippingMethodPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// make sure the method exists
+	if _, err := h.store.GetShippingMethodByID(methodID); errors.Is(err, domain.ErrShippingMethodNotFound) {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	method, ok := h.parseMethod(w, payload)
+	if !ok {
+		return
+	}
+	method.ID = methodID
+
+	if err := h.store.UpdateShippingMethod(method); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	updated, err := h.store.GetShippingMethodByID(methodID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, updated)
+}
+
+func (h *Handler) handleDeleteMethod(w http.ResponseWriter, r *http.Request) {
+	// get the method ID from the URL
+	methodID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid shipping method ID"))
+		return
+	}
+
+	err = h.store.DeleteShippingMethod(methodID)
+	if errors.Is(err, domain.ErrShippingMethodNotFound) {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// parseZone validates the payload of a zone, writing the error response
+// itself when it's invalid.
+func parseZone(w http.ResponseWriter, payload domain.ShippingZonePayload) (domain.ShippingZone, bool) {
+	// validate the payload
+	err := utils.Validate.Struct(payload)
+	if err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", validationErrors))
+		return domain.ShippingZone{}, false
+	}
+
+	areas := make([]domain.ShippingZoneArea, 0, len(payload.Areas))
+	seen := make(map[domain.ShippingZoneArea]bool, len(payload.Areas))
+	for _, area := range payload.Areas {
+		area.Country = strings.ToUpper(area.Country)
+		if seen[area] {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("area %s %s is listed twice", area.Country, area.Region))
+			return domain.ShippingZone{}, false
+		}
+		seen[area] = true
+		areas = append(areas, area)
+	}
+
+	return domain.ShippingZone{Name: payload.Name, Areas: areas}, true
+}
+
+// parseMethod validates the payload of a method, writing the error response
+// itself when it's invalid.
+func (h *Handler) parseMethod(w http.ResponseWriter, payload domain.ShippingMethodPayload) (domain.ShippingMethod, bool) {
+	// validate the payload
+	err := utils.Validate.Struct(payload)
+	if err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", validationErrors))
+		return domain.ShippingMethod{}, false
+	}
+
+	// the zone is part of the payload, so an unknown one is a bad request
+	if payload.ZoneID != nil {
+		if _, err := h.store.GetShippingZoneByID(*payload.ZoneID); errors.Is(err, domain.ErrShippingZoneNotFound) {
+			utils.WriteError(w, http.StatusBadRequest, err)
+			return domain.ShippingMethod{}, false
+		} else if err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return domain.ShippingMethod{}, false
+		}
+	}
+
+	active := true
+	if payload.Active != nil {
+		active = *payload.Active
+	}
+
+	return domain.ShippingMethod{
+		ZoneID:    payload.ZoneID,
+		Name:      payload.Name,
+		Type:      payload.Type,
+		Rate:      payload.Rate,
+		PerKg:     payload.PerKg,
+		FreeOver:  payload.FreeOver,
+		MaxWeight: payload.MaxWeight,
+		Active:    active,
+	}, true
+}
@@ -0,0 +1,319 @@
+package shipping
+
+import (
+	"bytes"
+	"ecom/config"
+	"ecom/domain"
+	"ecom/service/auth"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type mockShippingStore struct {
+	domain.ShippingRepository
+	zones   []domain.ShippingZone
+	methods []domain.ShippingMethod
+}
+
+func (m *mockShippingStore) GetShippingZones() (*[]domain.ShippingZone, error) {
+	return &m.zones, nil
+}
+
+func (m *mockShippingStore) GetShippingZoneByID(id int) (*domain.ShippingZone, error) {
+	for _, zone := range m.zones {
+		if zone.ID == id {
+			return &zone, nil
+		}
+	}
+	return nil, domain.ErrShippingZoneNotFound
+}
+
+func (m *mockShippingStore) CreateShippingZone(zone domain.ShippingZone) (int, error) {
+	zone.ID = len(m.zones) + 1
+	m.zones = append(m.zones, zone)
+	return zone.ID, nil
+}
+
+func (m *mockShippingStore) UpdateShippingZone(zone domain.ShippingZone) error {
+	for i := range m.zones {
+		if m.zones[i].ID == zone.ID {
+			m.zones[i] = zone
+		}
+	}
+	return nil
+}
+
+func (m *mockShippingStore) DeleteShippingZone(id int) error {
+	if _, err := m.GetShippingZoneByID(id); err != nil {
+		return err
+	}
+	for _, method := range m.methods {
+		if method.ZoneID != nil && *method.ZoneID == id {
+			return domain.ErrShippingZoneInUse
+		}
+	}
+	for i := range m.zones {
+		if m.zones[i].ID == id {
+			m.zones = append(m.zones[:i], m.zones[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (m *mockShippingStore) GetShippingMethodByID(id int) (*domain.ShippingMethod, error) {
+	for _, method := range m.methods {
+		if method.ID == id {
+			return &method, nil
+		}
+	}
+	return nil, domain.ErrShippingMethodNotFound
+}
+
+func (m *mockShippingStore) CreateShippingMethod(method domain.ShippingMethod) (int, error) {
+	method.ID = len(m.methods) + 1
+	m.methods = append(m.methods, method)
+	return method.ID, nil
+}
+
+func (m *mockShippingStore) UpdateShippingMethod(method domain.ShippingMethod) error {
+	for i := range m.methods {
+		if m.methods[i].ID == method.ID {
+			m.methods[i] = method
+		}
+	}
+	return nil
+}
+
+func (m *mockShippingStore) DeleteShippingMethod(id int) error {
+	for i := range m.methods {
+		if m.methods[i].ID == id {
+			m.methods[i].Active = false
+			return nil
+		}
+	}
+	return domain.ErrShippingMethodNotFound
+}
+
+func serveShippingRequest(t *testing.T, store *mockShippingStore, method, url, body, role string) *httptest.ResponseRecorder {
+	router := mux.NewRouter()
+	NewHandler(store).ShippingRoutes(router)
+
+	req, err := http.NewRequest(method, url, bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role != "" {
+		token, err := auth.NewStore().CreateToken([]byte(config.ENV.JWTSecret), domain.User{ID: "user-1", Role: role})
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestHandleCreateZone(t *testing.T) {
+	t.Run("should create a zone with upper case countries", func(t *testing.T) {
+		store := &mockShippingStore{}
+
+		body := `{"name":"West coast","areas":[{"country":"us","region":"CA"},{"country":"ca"}]}`
+		rr := serveShippingRequest(t, store, http.MethodPost, "/shipping/zones", body, domain.RoleStaff)
+
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status code %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+		}
+
+		var zone domain.ShippingZone
+		if err := json.NewDecoder(rr.Body).Decode(&zone); err != nil {
+			t.Fatal(err)
+		}
+		if zone.ID != 1 || len(zone.Areas) != 2 || zone.Areas[0] != (domain.ShippingZoneArea{Country: "US", Region: "CA"}) || zone.Areas[1].Country != "CA" {
+			t.Errorf("unexpected zone %+v", zone)
+		}
+	})
+
+	invalid := map[string]string{
+		"zone without areas": `{"name":"Nowhere","areas":[]}`,
+		"long country":       `{"name":"US","areas":[{"country":"USA"}]}`,
+		"duplicate area":     `{"name":"US","areas":[{"country":"US"},{"country":"us"}]}`,
+	}
+	for name, body := range invalid {
+		t.Run("should reject a "+name, func(t *testing.T) {
+			rr := serveShippingRequest(t, &mockShippingStore{}, http.MethodPost, "/shipping/zones", body, domain.RoleAdmin)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+			}
+		})
+	}
+}
+
+func TestHandleUpdateZone(t *testing.T) {
+	t.Run("should replace the areas of the zone", func(t *testing.T) {
+		store := &mockShippingStore{zones: []domain.ShippingZone{{ID: 1, Name: "US", Areas: []domain.ShippingZoneArea{{Country: "US"}}}}}
+
+		rr := serveShippingRequest(t, store, http.MethodPut, "/shipping/zones/1", `{"name":"Canada","areas":[{"country":"CA"}]}`, domain.RoleStaff)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+		if updated := store.zones[0]; updated.Name != "Canada" || len(updated.Areas) != 1 || updated.Areas[0].Country != "CA" {
+			t.Errorf("unexpected zone %+v", updated)
+		}
+	})
+
+	t.Run("should return 404 for an unknown zone", func(t *testing.T) {
+		rr := serveShippingRequest(t, &mockShippingStore{}, http.MethodPut, "/shipping/zones/9", `{"name":"US","areas":[{"country":"US"}]}`, domain.RoleStaff)
+
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code %d, got %d", http.StatusNotFound, rr.Code)
+		}
+	})
+}
+
+func TestHandleDeleteZone(t *testing.T) {
+	t.Run("should delete an unused zone", func(t *testing.T) {
+		store := &mockShippingStore{zones: []domain.ShippingZone{{ID: 1, Name: "US"}}}
+
+		rr := serveShippingRequest(t, store, http.MethodDelete, "/shipping/zones/1", "", domain.RoleStaff)
+
+		if rr.Code != http.StatusNoContent {
+			t.Fatalf("expected status code %d, got %d: %s", http.StatusNoContent, rr.Code, rr.Body.String())
+		}
+		if len(store.zones) != 0 {
+			t.Errorf("expected the zone to be deleted, got %+v", store.zones)
+		}
+	})
+
+	t.Run("should return 409 while a method uses the zone", func(t *testing.T) {
+		zoneID := 1
+		store := &mockShippingStore{
+			zones:   []domain.ShippingZone{{ID: 1, Name: "US"}},
+			methods: []domain.ShippingMethod{{ID: 1, ZoneID: &zoneID}},
+		}
+
+		rr := serveShippingRequest(t, store, http.MethodDelete, "/shipping/zones/1", "", domain.RoleStaff)
+
+		if rr.Code != http.StatusConflict {
+			t.Errorf("expected status code %d, got %d", http.StatusConflict, rr.Code)
+		}
+	})
+
+	t.Run("should return 404 for an unknown zone", func(t *testing.T) {
+		rr := serveShippingRequest(t, &mockShippingStore{}, http.MethodDelete, "/shipping/zones/9", "", domain.RoleStaff)
+
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code %d, got %d", http.StatusNotFound, rr.Code)
+		}
+	})
+}
+
+func TestHandleCreateMethod(t *testing.T) {
+	t.Run("should create an active method in the zone", func(t *testing.T) {
+		store := &mockShippingStore{zones: []domain.ShippingZone{{ID: 1, Name: "US"}}}
+
+		body := `{"zoneId":1,"name":"Express","type":"weight_based","rate":"5.00","perKg":"1.50","maxWeight":20000}`
+		rr := serveShippingRequest(t, store, http.MethodPost, "/shipping/methods", body, domain.RoleStaff)
+
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status code %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+		}
+
+		var method domain.ShippingMethod
+		if err := json.NewDecoder(rr.Body).Decode(&method); err != nil {
+			t.Fatal(err)
+		}
+		if method.ZoneID == nil || *method.ZoneID != 1 || !method.Active || method.PerKg.String() != "1.50" || method.MaxWeight != 20000 {
+			t.Errorf("unexpected method %+v", method)
+		}
+	})
+
+	invalid := map[string]string{
+		"unknown type":  `{"name":"Express","type":"drone"}`,
+		"negative rate": `{"name":"Express","type":"flat_rate","rate":"-1"}`,
+		"unknown zone":  `{"zoneId":9,"name":"Express","type":"flat_rate"}`,
+	}
+	for name, body := range invalid {
+		t.Run("should reject an "+name, func(t *testing.T) {
+			rr := serveShippingRequest(t, &mockShippingStore{}, http.MethodPost, "/shipping/methods", body, domain.RoleAdmin)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+			}
+		})
+	}
+}
+
+func TestHandleUpdateMethod(t *testing.T) {
+	t.Run("should move the method out of its zone", func(t *testing.T) {
+		zoneID := 1
+		store := &mockShippingStore{methods: []domain.ShippingMethod{{ID: 1, ZoneID: &zoneID, Name: "Standard", Type: domain.ShippingFlatRate, Active: true}}}
+
+		rr := serveShippingRequest(t, store, http.MethodPut, "/shipping/methods/1", `{"name":"Standard","type":"flat_rate","active":false}`, domain.RoleAdmin)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+		if updated := store.methods[0]; updated.ZoneID != nil || updated.Active {
+			t.Errorf("unexpected method %+v", updated)
+		}
+	})
+
+	t.Run("should return 404 for an unknown method", func(t *testing.T) {
+		rr := serveShippingRequest(t, &mockShippingStore{}, http.MethodPut, "/shipping/methods/9", `{"name":"Standard","type":"flat_rate"}`, domain.RoleAdmin)
+
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code %d, got %d", http.StatusNotFound, rr.Code)
+		}
+	})
+}
+
+func TestHandleDeleteMethod(t *testing.T) {
+	t.Run("should deactivate the method", func(t *testing.T) {
+		store := &mockShippingStore{methods: []domain.ShippingMethod{{ID: 1, Name: "Standard", Active: true}}}
+
+		rr := serveShippingRequest(t, store, http.MethodDelete, "/shipping/methods/1", "", domain.RoleStaff)
+
+		if rr.Code != http.StatusNoContent {
+			t.Fatalf("expected status code %d, got %d: %s", http.StatusNoContent, rr.Code, rr.Body.String())
+		}
+		if store.methods[0].Active {
+			t.Errorf("expected the method to be deactivated")
+		}
+	})
+
+	t.Run("should return 404 for an unknown method", func(t *testing.T) {
+		rr := serveShippingRequest(t, &mockShippingStore{}, http.MethodDelete, "/shipping/methods/9", "", domain.RoleStaff)
+
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code %d, got %d", http.StatusNotFound, rr.Code)
+		}
+	})
+}
+
+func TestProtectedShippingRoutes(t *testing.T) {
+	for _, url := range []string{"/shipping/zones", "/shipping/zones/1", "/shipping/methods", "/shipping/methods/1"} {
+		t.Run(url+" should return 401 without a token", func(t *testing.T) {
+			rr := serveShippingRequest(t, &mockShippingStore{}, http.MethodGet, url, "", "")
+
+			if rr.Code != http.StatusUnauthorized {
+				t.Errorf("expected status code %d, got %d", http.StatusUnauthorized, rr.Code)
+			}
+		})
+
+		t.Run(url+" should return 403 for customers", func(t *testing.T) {
+			rr := serveShippingRequest(t, &mockShippingStore{}, http.MethodGet, url, "", domain.RoleCustomer)
+
+			if rr.Code != http.StatusForbidden {
+				t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,285 @@
+package shipping
+
+import (
+	"database/sql"
+	"ecom/domain"
+	"errors"
+)
+
+const methodColumns = "id, zoneId, name, type, rate, perKg, freeOver, maxWeight, active"
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) inTx(fn func(tx *sql.Tx) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanMethod(row scanner) (*domain.ShippingMethod, error) {
+	method := new(domain.ShippingMethod)
+	var zoneID sql.NullInt64
+	err := row.Scan(
+		&method.ID,
+		&zoneID,
+		&method.Name,
+		&method.Type,
+		&method.Rate,
+		&method.PerKg,
+		&method.FreeOver,
+		&method.MaxWeight,
+		&method.Active,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrShippingMethodNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	if zoneID.Valid {
+		id := int(zoneID.Int64)
+		method.ZoneID = &id
+	}
+	return method, nil
+}
+
+func scanMethods(rows *sql.Rows) (*[]domain.ShippingMethod, error) {
+	defer rows.Close()
+
+	methods := make([]domain.ShippingMethod, 0)
+	for rows.Next() {
+		method, err := scanMethod(rows)
+		if err != nil {
+			return nil, err
+		}
+		methods = append(methods, *method)
+	}
+
+	return &methods, rows.Err()
+}
+
+func (s *Store) GetShippingMethods(country, region string) (*[]domain.ShippingMethod, error) {
+	// an area without a region covers the whole country
+	rows, err := s.db.Query(`
+		SELECT `+methodColumns+`
+		FROM shipping_methods m
+		WHERE m.active = TRUE AND (
+			m.zoneId IS NULL OR EXISTS (
+				SELECT 1 FROM shipping_zone_areas a
+				WHERE a.zoneId = m.zoneId AND a.country = ? AND (a.region = '' OR a.region = ?)
+			)
+		)
+		ORDER BY m.id
+	`, country, region)
+	if err != nil {
+		return nil, err
+	}
+
+	return scanMethods(rows)
+}
+
+func (s *Store) GetAllShippingMethods() (*[]domain.ShippingMethod, error) {
+	rows, err := s.db.Query("SELECT " + methodColumns + " FROM shipping_methods ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+
+	return scanMethods(rows)
+}
+
+func (s *Store) GetShippingMethodByID(id int) (*domain.ShippingMethod, error) {
+	return scanMethod(s.db.QueryRow("SELECT "+methodColumns+" FROM shipping_methods WHERE id = ?", id))
+}
+
+func (s *Store) CreateShippingMethod(method domain.ShippingMethod) (int, error) {
+	result, err := s.db.Exec("INSERT INTO shipping_methods (zoneId, name, type, rate, perKg, freeOver, maxWeight, active) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
+		method.ZoneID, method.Name, method.Type, method.Rate, method.PerKg, method.FreeOver, method.MaxWeight, method.Active)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+func (s *Store) UpdateShippingMethod(method domain.ShippingMethod) error {
+	_, err := s.db.Exec("UPDATE shipping_methods SET zoneId = ?, name = ?, type = ?, rate = ?, perKg = ?, freeOver = ?, maxWeight = ?, active = ? WHERE id = ?",
+		method.ZoneID, method.Name, method.Type, method.Rate, method.PerKg, method.FreeOver, method.MaxWeight, method.Active, method.ID)
+	return err
+}
+
+// DeleteShippingMethod deactivates the method, as past orders keep pointing
+// at it.
+func (s *Store) DeleteShippingMethod(id int) error {
+	if _, err := s.GetShippingMethodByID(id); err != nil {
+		return err
+	}
+
+	_, err := s.db.Exec("UPDATE shipping_methods SET active = FALSE WHERE id = ?", id)
+	return err
+}
+
+func (s *Store) GetShippingZones() (*[]domain.ShippingZone, error) {
+	rows, err := s.db.Query("SELECT id, name FROM shipping_zones ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	zones := make([]domain.ShippingZone, 0)
+	for rows.Next() {
+		zone := domain.ShippingZone{Areas: make([]domain.ShippingZoneArea, 0)}
+		if err := rows.Scan(&zone.ID, &zone.Name); err != nil {
+			return nil, err
+		}
+		zones = append(zones, zone)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	areas, err := s.getZoneAreas()
+	if err != nil {
+		return nil, err
+	}
+	for i := range zones {
+		if zoneAreas, ok := areas[zones[i].ID]; ok {
+			zones[i].Areas = zoneAreas
+		}
+	}
+
+	return &zones, nil
+}
+
+func (s *Store) GetShippingZoneByID(id int) (*domain.ShippingZone, error) {
+	zone := &domain.ShippingZone{Areas: make([]domain.ShippingZoneArea, 0)}
+	err := s.db.QueryRow("SELECT id, name FROM shipping_zones WHERE id = ?", id).Scan(&zone.ID, &zone.Name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrShippingZoneNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query("SELECT country, region FROM shipping_zone_areas WHERE zoneId = ? ORDER BY country, region", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var area domain.ShippingZoneArea
+		if err := rows.Scan(&area.Country, &area.Region); err != nil {
+			return nil, err
+		}
+		zone.Areas = append(zone.Areas, area)
+	}
+
+	return zone, rows.Err()
+}
+
+// getZoneAreas returns the areas of every zone, keyed by zone ID.
+func (s *Store) getZoneAreas() (map[int][]domain.ShippingZoneArea, error) {
+	rows, err := s.db.Query("SELECT zoneId, country, region FROM shipping_zone_areas ORDER BY zoneId, country, region")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	areas := make(map[int][]domain.ShippingZoneArea)
+	for rows.Next() {
+		var zoneID int
+		var area domain.ShippingZoneArea
+		if err := rows.Scan(&zoneID, &area.Country, &area.Region); err != nil {
+			return nil, err
+		}
+		areas[zoneID] = append(areas[zoneID], area)
+	}
+
+	return areas, rows.Err()
+}
+
+func (s *Store) CreateShippingZone(zone domain.ShippingZone) (int, error) {
+	var id int
+	err := s.inTx(func(tx *sql.Tx) error {
+		result, err := tx.Exec("INSERT INTO shipping_zones (name) VALUES (?)", zone.Name)
+		if err != nil {
+			return err
+		}
+
+		zoneID, err := result.LastInsertId()
+		if err != nil {
+			return err
+		}
+		id = int(zoneID)
+
+		return insertZoneAreas(tx, id, zone.Areas)
+	})
+
+	return id, err
+}
+
+func (s *Store) UpdateShippingZone(zone domain.ShippingZone) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec("UPDATE shipping_zones SET name = ? WHERE id = ?", zone.Name, zone.ID); err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec("DELETE FROM shipping_zone_areas WHERE zoneId = ?", zone.ID); err != nil {
+			return err
+		}
+
+		return insertZoneAreas(tx, zone.ID, zone.Areas)
+	})
+}
+
+func insertZoneAreas(tx *sql.Tx, zoneID int, areas []domain.ShippingZoneArea) error {
+	for _, area := range areas {
+		_, err := tx.Exec("INSERT INTO shipping_zone_areas (zoneId, country, region) VALUES (?, ?, ?)", zoneID, area.Country, area.Region)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Store) DeleteShippingZone(id int) error {
+	return s.inTx(func(tx *sql.Tx) error {
+		// lock the zone so no method is added to it while it's deleted
+		var zoneID int
+		err := tx.QueryRow("SELECT id FROM shipping_zones WHERE id = ? FOR UPDATE", id).Scan(&zoneID)
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.ErrShippingZoneNotFound
+		} else if err != nil {
+			return err
+		}
+
+		var methods int
+		if err := tx.QueryRow("SELECT COUNT(*) FROM shipping_methods WHERE zoneId = ?", id).Scan(&methods); err != nil {
+			return err
+		}
+		if methods > 0 {
+			return domain.ErrShippingZoneInUse
+		}
+
+		// the areas go with the zone
+		_, err = tx.Exec("DELETE FROM shipping_zones WHERE id = ?", id)
+		return err
+	})
+}
@@ -0,0 +1,89 @@
+package tax
+
+import (
+	"ecom/domain"
+	"strings"
+)
+
+// TableCalculator looks rates up in the tax table.
+type TableCalculator struct {
+	rates     domain.TaxRateRepository
+	inclusive bool
+}
+
+// NewTableCalculator returns a calculator for prices that include tax when
+// inclusive is set, and have tax added on top otherwise.
+func NewTableCalculator(rates domain.TaxRateRepository, inclusive bool) *TableCalculator {
+	return &TableCalculator{rates: rates, inclusive: inclusive}
+}
+
+func (c *TableCalculator) CalculateTax(request domain.TaxRequest) (*domain.TaxResult, error) {
+	result := &domain.TaxResult{Lines: make([][]domain.TaxLine, len(request.Lines)), Inclusive: c.inclusive}
+
+	// without a country there is nothing to look up yet, e.g. for guests
+	if request.Address.Country == "" {
+		return result, nil
+	}
+
+	rates, err := c.rates.GetTaxRates(strings.ToUpper(request.Address.Country))
+	if err != nil {
+		return nil, err
+	}
+
+	for i, line := range request.Lines {
+		taxClass := line.TaxClass
+		if taxClass == "" {
+			taxClass = domain.TaxClassStandard
+		}
+
+		rate, ok := matchRate(*rates, request.Address, taxClass)
+		if !ok || rate.Rate == 0 {
+			continue
+		}
+
+		var amount domain.Money
+		if c.inclusive {
+			// the price already holds the tax: amount * rate / (1 + rate)
+			amount = line.Amount.MulFraction(int64(rate.Rate), int64(10000+rate.Rate))
+		} else {
+			amount = line.Amount.MulFraction(int64(rate.Rate), 10000)
+		}
+		result.Lines[i] = []domain.TaxLine{{Name: rate.Name, Rate: rate.Rate, Amount: amount}}
+	}
+
+	return result, nil
+}
+
+// matchRate returns the most specific rate for the address and tax class. A
+// postal prefix beats a region, and a longer prefix beats a shorter one.
+func matchRate(rates []domain.TaxRate, address domain.Address, taxClass string) (domain.TaxRate, bool) {
+	postalCode := strings.ToUpper(strings.ReplaceAll(address.PostalCode, " ", ""))
+
+	var best domain.TaxRate
+	bestScore := -1
+	for _, rate := range rates {
+		if rate.TaxClass != taxClass {
+			continue
+		}
+		if rate.Region != "" && !strings.EqualFold(rate.Region, address.Region) {
+			continue
+		}
+		prefix := strings.ToUpper(strings.ReplaceAll(rate.PostalPrefix, " ", ""))
+		if !strings.HasPrefix(postalCode, prefix) {
+			continue
+		}
+
+		score := 0
+		if rate.Region != "" {
+			score = 1
+		}
+		if prefix != "" {
+			score = 2 + len(prefix)
+		}
+		if score > bestScore {
+			best, bestScore = rate, score
+		}
+	}
+
+	return best, bestScore >= 0
+}
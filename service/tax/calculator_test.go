@@ -0,0 +1,98 @@
+package tax
+
+import (
+	"ecom/domain"
+	"testing"
+)
+
+type mockTaxRates struct {
+	rates []domain.TaxRate
+}
+
+func (m *mockTaxRates) GetTaxRates(country string) (*[]domain.TaxRate, error) {
+	rates := make([]domain.TaxRate, 0)
+	for _, rate := range m.rates {
+		if rate.Country == country {
+			rates = append(rates, rate)
+		}
+	}
+	return &rates, nil
+}
+
+func money(value string) domain.Money {
+	return domain.MustParseMoney(value, domain.DefaultCurrency)
+}
+
+var testRates = &mockTaxRates{rates: []domain.TaxRate{
+	{Country: "US", TaxClass: domain.TaxClassStandard, Name: "US", Rate: 0},
+	{Country: "US", Region: "CA", TaxClass: domain.TaxClassStandard, Name: "CA", Rate: 725},
+	{Country: "US", Region: "CA", PostalPrefix: "900", TaxClass: domain.TaxClassStandard, Name: "Los Angeles", Rate: 950},
+	{Country: "US", Region: "CA", PostalPrefix: "9001", TaxClass: domain.TaxClassStandard, Name: "Inglewood", Rate: 1000},
+	{Country: "DE", TaxClass: domain.TaxClassStandard, Name: "MwSt", Rate: 1900},
+	{Country: "DE", TaxClass: "reduced", Name: "MwSt reduced", Rate: 700},
+}}
+
+func TestTableCalculator(t *testing.T) {
+	tests := []struct {
+		name     string
+		address  domain.Address
+		taxClass string
+		tax      string // expected tax on 100.00, empty for none
+		taxName  string
+	}{
+		{name: "country without tax", address: domain.Address{Country: "US", Region: "NY", PostalCode: "10001"}},
+		{name: "region", address: domain.Address{Country: "US", Region: "CA", PostalCode: "94103"}, tax: "7.25", taxName: "CA"},
+		{name: "postal prefix", address: domain.Address{Country: "US", Region: "CA", PostalCode: "90024"}, tax: "9.50", taxName: "Los Angeles"},
+		{name: "longest postal prefix", address: domain.Address{Country: "us", Region: "ca", PostalCode: "90017"}, tax: "10.00", taxName: "Inglewood"},
+		{name: "default class", address: domain.Address{Country: "DE", PostalCode: "10115"}, tax: "19.00", taxName: "MwSt"},
+		{name: "product tax class", address: domain.Address{Country: "DE", PostalCode: "10115"}, taxClass: "reduced", tax: "7.00", taxName: "MwSt reduced"},
+		{name: "unknown tax class", address: domain.Address{Country: "DE", PostalCode: "10115"}, taxClass: "books"},
+		{name: "unknown country", address: domain.Address{Country: "FR", PostalCode: "75001"}},
+		{name: "no address yet", address: domain.Address{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			calculator := NewTableCalculator(testRates, false)
+
+			result, err := calculator.CalculateTax(domain.TaxRequest{
+				Address: test.address,
+				Lines:   []domain.TaxableLine{{ProductID: 1, TaxClass: test.taxClass, Quantity: 1, Amount: money("100")}},
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			taxes := result.Lines[0]
+			if test.tax == "" {
+				if len(taxes) != 0 {
+					t.Errorf("expected no tax, got %+v", taxes)
+				}
+				return
+			}
+			if len(taxes) != 1 || taxes[0].Amount != money(test.tax) || taxes[0].Name != test.taxName {
+				t.Errorf("expected %s %s, got %+v", test.taxName, test.tax, taxes)
+			}
+		})
+	}
+}
+
+func TestTableCalculatorInclusive(t *testing.T) {
+	calculator := NewTableCalculator(testRates, true)
+
+	result, err := calculator.CalculateTax(domain.TaxRequest{
+		Address: domain.Address{Country: "DE", PostalCode: "10115"},
+		Lines:   []domain.TaxableLine{{ProductID: 1, Quantity: 1, Amount: money("119")}, {ProductID: 2, Quantity: 1, Amount: money("10")}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !result.Inclusive {
+		t.Error("expected an inclusive result")
+	}
+	// 119.00 holds 19.00 of tax, 10.00 holds 1.5966 rounded to 1.60
+	if result.Lines[0][0].Amount != money("19") || result.Lines[1][0].Amount != money("1.6") {
+		t.Errorf("unexpected tax lines %+v", result.Lines)
+	}
+}
@@ -0,0 +1,46 @@
+package tax
+
+import (
+	"database/sql"
+	"ecom/domain"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) GetTaxRates(country string) (*[]domain.TaxRate, error) {
+	rows, err := s.db.Query(`
+		SELECT id, country, region, postalPrefix, taxClass, name, rate
+		FROM tax_rates
+		WHERE country = ?
+	`, country)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rates := make([]domain.TaxRate, 0)
+	for rows.Next() {
+		var rate domain.TaxRate
+		err := rows.Scan(
+			&rate.ID,
+			&rate.Country,
+			&rate.Region,
+			&rate.PostalPrefix,
+			&rate.TaxClass,
+			&rate.Name,
+			&rate.Rate,
+		)
+		if err != nil {
+			return nil, err
+		}
+		rates = append(rates, rate)
+	}
+
+	return &rates, rows.Err()
+}
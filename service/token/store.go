@@ -0,0 +1,80 @@
+package token
+
+import (
+	"database/sql"
+	"ecom/domain"
+	"errors"
+	"time"
+)
+
+type Store struct {
+	db *sql.DB
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+func (s *Store) CreateRefreshToken(token domain.RefreshToken) error {
+	_, err := s.db.Exec("INSERT INTO refresh_tokens (id, userId, familyId, tokenHash, expiresAt) VALUES (?, ?, ?, ?, ?)",
+		token.ID, token.UserID, token.FamilyID, token.TokenHash, token.ExpiresAt)
+	return err
+}
+
+func (s *Store) GetRefreshTokenByHash(hash string) (*domain.RefreshToken, error) {
+	row := s.db.QueryRow("SELECT id, userId, familyId, tokenHash, expiresAt, usedAt, revokedAt, createdAt FROM refresh_tokens WHERE tokenHash = ?", hash)
+
+	token := new(domain.RefreshToken)
+	err := row.Scan(
+		&token.ID,
+		&token.UserID,
+		&token.FamilyID,
+		&token.TokenHash,
+		&token.ExpiresAt,
+		&token.UsedAt,
+		&token.RevokedAt,
+		&token.CreatedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrRefreshTokenNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+func (s *Store) MarkRefreshTokenUsed(id string) (bool, error) {
+	result, err := s.db.Exec("UPDATE refresh_tokens SET usedAt = NOW() WHERE id = ? AND usedAt IS NULL AND revokedAt IS NULL", id)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected == 1, nil
+}
+
+func (s *Store) RevokeTokenFamily(familyID string) error {
+	_, err := s.db.Exec("UPDATE refresh_tokens SET revokedAt = NOW() WHERE familyId = ? AND revokedAt IS NULL", familyID)
+	return err
+}
+
+func (s *Store) RevokeUserRefreshTokens(userID string) error {
+	_, err := s.db.Exec("UPDATE refresh_tokens SET revokedAt = NOW() WHERE userId = ? AND revokedAt IS NULL", userID)
+	return err
+}
+
+func (s *Store) RevokeAccessToken(jti string, expiresAt time.Time) error {
+	_, err := s.db.Exec("INSERT IGNORE INTO revoked_tokens (jti, expiresAt) VALUES (?, ?)", jti, expiresAt)
+	return err
+}
+
+func (s *Store) IsAccessTokenRevoked(jti string) (bool, error) {
+	var revoked bool
+	err := s.db.QueryRow("SELECT EXISTS(SELECT 1 FROM revoked_tokens WHERE jti = ?)", jti).Scan(&revoked)
+	return revoked, err
+}
@@ -0,0 +1,113 @@
+package uow
+
+import (
+	"database/sql"
+	"ecom/domain"
+	"ecom/service/cart"
+	"ecom/service/inventory"
+	"ecom/service/order"
+	"ecom/service/payment"
+	"ecom/service/product"
+	"ecom/service/promotion"
+	"ecom/service/returns"
+	"ecom/service/warehouse"
+)
+
+type Store struct {
+	db         *sql.DB
+	products   *product.Store
+	orders     *order.Store
+	carts      *cart.Store
+	promotions *promotion.Store
+	payments   *payment.Store
+	returns    *returns.Store
+	inventory  *inventory.Store
+	warehouses *warehouse.Store
+}
+
+func NewStore(db *sql.DB, products *product.Store, orders *order.Store, carts *cart.Store, promotions *promotion.Store, payments *payment.Store, returns *returns.Store, inventory *inventory.Store, warehouses *warehouse.Store) *Store {
+	return &Store{
+		db:         db,
+		products:   products,
+		orders:     orders,
+		carts:      carts,
+		promotions: promotions,
+		payments:   payments,
+		returns:    returns,
+		inventory:  inventory,
+		warehouses: warehouses,
+	}
+}
+
+type repositories struct {
+	products   *product.Store
+	orders     *order.Store
+	carts      *cart.Store
+	promotions *promotion.Store
+	payments   *payment.Store
+	returns    *returns.Store
+	inventory  *inventory.Store
+	warehouses *warehouse.Store
+}
+
+func (r *repositories) Products() domain.ProductRepository {
+	return r.products
+}
+
+func (r *repositories) Orders() domain.OrderRepository {
+	return r.orders
+}
+
+func (r *repositories) Carts() domain.CartRepository {
+	return r.carts
+}
+
+func (r *repositories) Promotions() domain.PromotionRepository {
+	return r.promotions
+}
+
+func (r *repositories) Payments() domain.PaymentRepository {
+	return r.payments
+}
+
+func (r *repositories) Returns() domain.ReturnRepository {
+	return r.returns
+}
+
+func (r *repositories) Reservations() domain.ReservationRepository {
+	return r.inventory
+}
+
+func (r *repositories) Warehouses() domain.WarehouseRepository {
+	return r.warehouses
+}
+
+func (s *Store) Do(fn func(repos domain.Repositories) error) (err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		} else if err != nil {
+			tx.Rollback()
+		} else {
+			err = tx.Commit()
+		}
+	}()
+
+	err = fn(&repositories{
+		products:   s.products.WithTx(tx),
+		orders:     s.orders.WithTx(tx),
+		carts:      s.carts.WithTx(tx),
+		promotions: s.promotions.WithTx(tx),
+		payments:   s.payments.WithTx(tx),
+		returns:    s.returns.WithTx(tx),
+		inventory:  s.inventory.WithTx(tx),
+		warehouses: s.warehouses.WithTx(tx),
+	})
+	return err
+}
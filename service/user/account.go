@@ -0,0 +1,195 @@
+package user
+
+import (
+	"ecom/domain"
+	"ecom/middleware"
+	"ecom/utils"
+	"errors"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"net/http"
+)
+
+// currentUser loads the authenticated user, writing the error response
+// itself when that fails.
+func (h *Handler) currentUser(w http.ResponseWriter, r *http.Request) (*domain.User, bool) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, err)
+		return nil, false
+	}
+
+	user, err := h.store.GetUserByID(userID)
+	if errors.Is(err, domain.ErrUserNotFound) {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return nil, false
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return nil, false
+	}
+
+	return user, true
+}
+
+func (h *Handler) handleGetMe(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, user)
+}
+
+func (h *Handler) handleUpdateMe(w http.ResponseWriter, r *http.Request) {
+	// get JSON payload
+	var payload domain.UpdateProfilePayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// validate the payload
+	err := utils.Validate.Struct(payload)
+	if err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", validationErrors))
+		return
+	}
+
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	// apply the fields that were sent
+	if payload.FirstName != nil {
+		user.FirstName = *payload.FirstName
+	}
+	if payload.LastName != nil {
+		user.LastName = *payload.LastName
+	}
+	if payload.Address != nil {
+		user.Address = *payload.Address
+	}
+
+	if err := h.store.UpdateUser(*user); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, user)
+}
+
+func (h *Handler) handleChangePassword(w http.ResponseWriter, r *http.Request) {
+	// get JSON payload
+	var payload domain.ChangePasswordPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// validate the payload
+	err := utils.Validate.Struct(payload)
+	if err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", validationErrors))
+		return
+	}
+
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	// check the current password
+	if err := h.auth.ComparePassword(user.Password, payload.CurrentPassword); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("current password is incorrect"))
+		return
+	}
+
+	// hash and store the new password
+	hashedPassword, err := h.auth.HashPassword(payload.NewPassword)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := h.store.UpdatePassword(user.ID, hashedPassword); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// sign out every other session and hand this one a fresh token pair. The
+	// access tokens other sessions hold aren't recorded, so they keep working
+	// until they expire; only the one of this request can be denied.
+	if err := h.tokens.RevokeUserRefreshTokens(user.ID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	tokenInfo, err := middleware.GetTokenFromContext(r.Context())
+	if err == nil && tokenInfo.ID != "" {
+		if err := h.tokens.RevokeAccessToken(tokenInfo.ID, tokenInfo.ExpiresAt); err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	token, refreshToken, err := h.issueTokens(user, uuid.New().String())
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "password changed", "token": token, "refreshToken": refreshToken})
+}
+
+func (h *Handler) handleDeleteMe(w http.ResponseWriter, r *http.Request) {
+	// get JSON payload
+	var payload domain.DeleteAccountPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// validate the payload
+	err := utils.Validate.Struct(payload)
+	if err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", validationErrors))
+		return
+	}
+
+	user, ok := h.currentUser(w, r)
+	if !ok {
+		return
+	}
+
+	// confirm with the password before deleting anything
+	if err := h.auth.ComparePassword(user.Password, payload.Password); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("password is incorrect"))
+		return
+	}
+
+	if err := h.store.DeleteUser(user.ID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// end every session of the deleted account
+	if err := h.tokens.RevokeUserRefreshTokens(user.ID); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	tokenInfo, err := middleware.GetTokenFromContext(r.Context())
+	if err == nil && tokenInfo.ID != "" {
+		if err := h.tokens.RevokeAccessToken(tokenInfo.ID, tokenInfo.ExpiresAt); err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
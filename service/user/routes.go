@@ -1,31 +1,57 @@
 package user
 
 import (
-	"ecom/config"
 	"ecom/domain"
+	"ecom/middleware"
 	"ecom/utils"
+	"errors"
 	"fmt"
 	"github.com/go-playground/validator/v10"
 	"github.com/google/uuid"
 	"github.com/gorilla/mux"
+	"log"
 	"net/http"
+	"strconv"
+)
+
+const (
+	defaultUsersLimit = 20
+	maxUsersLimit     = 100
 )
 
 type Handler struct {
-	store domain.UserRepository
-	auth  domain.AuthService
+	store  domain.UserRepository
+	auth   domain.AuthService
+	tokens domain.TokenRepository
+	mailer domain.Mailer
+	carts  domain.GuestCartMerger
 }
 
-func NewHandler(store domain.UserRepository, auth domain.AuthService) *Handler {
+func NewHandler(store domain.UserRepository, auth domain.AuthService, tokens domain.TokenRepository, mailer domain.Mailer, carts domain.GuestCartMerger) *Handler {
 	return &Handler{
-		store: store,
-		auth:  auth,
+		store:  store,
+		auth:   auth,
+		tokens: tokens,
+		mailer: mailer,
+		carts:  carts,
 	}
 }
 
 func (h *Handler) UserRoutes(router *mux.Router) {
 	router.HandleFunc("/login", h.handleLogin).Methods("POST")
 	router.HandleFunc("/register", h.handleRegister).Methods("POST")
+	router.HandleFunc("/token/refresh", h.handleRefreshToken).Methods(http.MethodPost)
+	router.Handle("/logout", middleware.JWTMiddleware(http.HandlerFunc(h.handleLogout))).Methods(http.MethodPost)
+	router.HandleFunc("/verify-email", h.handleVerifyEmail).Methods(http.MethodGet)
+	router.Handle("/verify-email/resend", middleware.JWTMiddleware(http.HandlerFunc(h.handleResendVerification))).Methods(http.MethodPost)
+
+	router.Handle("/me", middleware.JWTMiddleware(http.HandlerFunc(h.handleGetMe))).Methods(http.MethodGet)
+	router.Handle("/me", middleware.JWTMiddleware(http.HandlerFunc(h.handleUpdateMe))).Methods(http.MethodPatch)
+	router.Handle("/me", middleware.JWTMiddleware(http.HandlerFunc(h.handleDeleteMe))).Methods(http.MethodDelete)
+	router.Handle("/me/password", middleware.JWTMiddleware(http.HandlerFunc(h.handleChangePassword))).Methods(http.MethodPost)
+
+	router.Handle("/users", middleware.Authorize(h.handleGetUsers, domain.RoleAdmin)).Methods(http.MethodGet)
+	router.Handle("/users/{id}/role", middleware.Authorize(h.handleUpdateUserRole, domain.RoleAdmin)).Methods(http.MethodPatch)
 }
 
 func (h *Handler) handleLogin(w http.ResponseWriter, r *http.Request) {
@@ -58,15 +84,16 @@ func (h *Handler) handleLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// generate a token
-	secret := []byte(config.ENV.JWTSecret)
-	token, err := h.auth.CreateToken(secret, user.ID, user.FirstName, user.LastName, user.Email, user.Address)
+	// generate the tokens, starting a new refresh token family
+	token, refreshToken, err := h.issueTokens(user, uuid.New().String())
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
 
-	utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "login successful", "token": token})
+	h.mergeGuestCart(w, r, user.ID)
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "login successful", "token": token, "refreshToken": refreshToken})
 }
 
 func (h *Handler) handleRegister(w http.ResponseWriter, r *http.Request) {
@@ -99,19 +126,102 @@ func (h *Handler) handleRegister(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// create the user
-	err = h.store.CreateUser(domain.User{
+	user := domain.User{
 		ID:        uuid.New().String(),
 		FirstName: payload.FirstName,
 		LastName:  payload.LastName,
 		Email:     payload.Email,
 		Password:  hashedPassword,
 		Address:   payload.Address,
-	})
+	}
+	err = h.store.CreateUser(user)
 
 	if err != nil {
 		utils.WriteError(w, http.StatusInternalServerError, err)
 		return
 	}
 
+	// the account exists either way, the user can ask for a new link later
+	if err := h.sendVerificationEmail(user); err != nil {
+		log.Println("email verification:", err)
+	}
+
+	h.mergeGuestCart(w, r, user.ID)
+
 	utils.WriteJSON(w, http.StatusCreated, map[string]string{"message": "user created"})
 }
+
+func (h *Handler) handleGetUsers(w http.ResponseWriter, r *http.Request) {
+	// parse pagination from the query string
+	limit, offset := defaultUsersLimit, 0
+	if value := r.URL.Query().Get("limit"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 1 || parsed > maxUsersLimit {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("limit must be between 1 and %d", maxUsersLimit))
+			return
+		}
+		limit = parsed
+	}
+	if value := r.URL.Query().Get("offset"); value != "" {
+		parsed, err := strconv.Atoi(value)
+		if err != nil || parsed < 0 {
+			utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid offset"))
+			return
+		}
+		offset = parsed
+	}
+
+	users, total, err := h.store.GetUsers(limit, offset)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]interface{}{
+		"users":  users,
+		"total":  total,
+		"limit":  limit,
+		"offset": offset,
+	})
+}
+
+func (h *Handler) handleUpdateUserRole(w http.ResponseWriter, r *http.Request) {
+	userID := mux.Vars(r)["id"]
+
+	// get JSON payload
+	var payload domain.UserRolePayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// validate the payload
+	err := utils.Validate.Struct(payload)
+	if err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", validationErrors))
+		return
+	}
+
+	// admins can't demote themselves and lock everyone out
+	actorID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, err)
+		return
+	}
+	if actorID == userID && payload.Role != domain.RoleAdmin {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("cannot change your own role"))
+		return
+	}
+
+	err = h.store.UpdateUserRole(userID, payload.Role)
+	if errors.Is(err, domain.ErrUserNotFound) {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "role updated"})
+}
@@ -2,21 +2,49 @@ package user
 
 import (
 	"bytes"
+	"ecom/config"
 	"ecom/domain"
+	"ecom/mailer"
+	"ecom/middleware"
+	"ecom/service/auth"
+	"ecom/service/cart"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gorilla/mux"
 	"net/http"
 	"net/http/httptest"
+	"regexp"
 	"testing"
+	"time"
 )
 
-type mockAuthStore struct{}
+type mockAuthStore struct {
+	refreshTokens int
+}
 
-func (m *mockAuthStore) CreateToken(secret []byte, userID string, firstName string, lastName string, email string, address string) (string, error) {
+func (m *mockAuthStore) CreateToken(secret []byte, user domain.User) (string, error) {
 	return "mockToken", nil
 }
 
+func (m *mockAuthStore) GenerateToken() (string, string, error) {
+	m.refreshTokens++
+	token := fmt.Sprintf("refresh-%d", m.refreshTokens)
+	return token, m.HashToken(token), nil
+}
+
+func (m *mockAuthStore) HashToken(token string) string {
+	return "hashed-" + token
+}
+
+func (m *mockAuthStore) CreateVerificationToken(secret []byte, user domain.User) (string, error) {
+	return auth.NewStore().CreateVerificationToken(secret, user)
+}
+
+func (m *mockAuthStore) ParseVerificationToken(secret []byte, token string) (string, string, error) {
+	return auth.NewStore().ParseVerificationToken(secret, token)
+}
+
 func (m *mockAuthStore) HashPassword(password string) (string, error) {
 	return "", nil
 }
@@ -28,7 +56,14 @@ func (m *mockAuthStore) ComparePassword(hashedPassword, password string) error {
 	return fmt.Errorf("invalid password")
 }
 
-type mockUserStore struct{}
+type mockUserStore struct {
+	roles     map[string]string
+	verified  map[string]bool
+	updated   *domain.User
+	passwords map[string]string
+	deleted   map[string]bool
+	getErr    error // returned by GetUserByID when set
+}
 
 func (m *mockUserStore) GetUserByEmail(email string) (*domain.User, error) {
 	if email == "existing.user@gmail.com" {
@@ -44,18 +79,163 @@ func (m *mockUserStore) GetUserByEmail(email string) (*domain.User, error) {
 	return nil, fmt.Errorf("user not found")
 }
 
-func (m *mockUserStore) GetUserByID(id int) (*domain.User, error) {
-	return nil, nil
+func (m *mockUserStore) GetUserByID(id string) (*domain.User, error) {
+	if m.getErr != nil {
+		return nil, m.getErr
+	}
+	if id == "1" && !m.deleted[id] {
+		if m.updated != nil {
+			user := *m.updated
+			return &user, nil
+		}
+		user, err := m.GetUserByEmail("existing.user@gmail.com")
+		user.Verified = m.verified[id]
+		return user, err
+	}
+	return nil, domain.ErrUserNotFound
+}
+
+func (m *mockUserStore) GetUsers(limit, offset int) (*[]domain.User, int, error) {
+	users := []domain.User{{ID: "1", Email: "existing.user@gmail.com", Role: domain.RoleCustomer}}
+	return &users, len(users), nil
 }
 
 func (m *mockUserStore) CreateUser(user domain.User) error {
 	return nil
 }
 
+func (m *mockUserStore) UpdatePassword(id string, hashedPassword string) error {
+	if m.passwords == nil {
+		m.passwords = make(map[string]string)
+	}
+	m.passwords[id] = hashedPassword
+	return nil
+}
+
+func (m *mockUserStore) UpdateUser(user domain.User) error {
+	if user.ID != "1" {
+		return domain.ErrUserNotFound
+	}
+	m.updated = &user
+	return nil
+}
+
+func (m *mockUserStore) DeleteUser(id string) error {
+	if id != "1" {
+		return domain.ErrUserNotFound
+	}
+	if m.deleted == nil {
+		m.deleted = make(map[string]bool)
+	}
+	m.deleted[id] = true
+	return nil
+}
+
+func (m *mockUserStore) MarkUserVerified(id string) error {
+	if m.verified == nil {
+		m.verified = make(map[string]bool)
+	}
+	m.verified[id] = true
+	return nil
+}
+
+func (m *mockUserStore) UpdateUserRole(id string, role string) error {
+	if id != "1" {
+		return domain.ErrUserNotFound
+	}
+	if m.roles == nil {
+		m.roles = make(map[string]string)
+	}
+	m.roles[id] = role
+	return nil
+}
+
+type mockCartMerger struct {
+	merged map[string]string
+}
+
+func (m *mockCartMerger) MergeGuestCart(userID, cartToken string) error {
+	if m.merged == nil {
+		m.merged = make(map[string]string)
+	}
+	m.merged[cartToken] = userID
+	return nil
+}
+
+type mockTokenStore struct {
+	refreshTokens map[string]*domain.RefreshToken
+	revoked       map[string]time.Time
+}
+
+func newMockTokenStore() *mockTokenStore {
+	return &mockTokenStore{
+		refreshTokens: make(map[string]*domain.RefreshToken),
+		revoked:       make(map[string]time.Time),
+	}
+}
+
+func (m *mockTokenStore) CreateRefreshToken(token domain.RefreshToken) error {
+	m.refreshTokens[token.TokenHash] = &token
+	return nil
+}
+
+func (m *mockTokenStore) GetRefreshTokenByHash(hash string) (*domain.RefreshToken, error) {
+	token, ok := m.refreshTokens[hash]
+	if !ok {
+		return nil, domain.ErrRefreshTokenNotFound
+	}
+	copied := *token
+	return &copied, nil
+}
+
+func (m *mockTokenStore) MarkRefreshTokenUsed(id string) (bool, error) {
+	for _, token := range m.refreshTokens {
+		if token.ID == id {
+			if token.UsedAt != nil || token.RevokedAt != nil {
+				return false, nil
+			}
+			now := time.Now()
+			token.UsedAt = &now
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *mockTokenStore) RevokeTokenFamily(familyID string) error {
+	now := time.Now()
+	for _, token := range m.refreshTokens {
+		if token.FamilyID == familyID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (m *mockTokenStore) RevokeUserRefreshTokens(userID string) error {
+	now := time.Now()
+	for _, token := range m.refreshTokens {
+		if token.UserID == userID && token.RevokedAt == nil {
+			token.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (m *mockTokenStore) RevokeAccessToken(jti string, expiresAt time.Time) error {
+	m.revoked[jti] = expiresAt
+	return nil
+}
+
+func (m *mockTokenStore) IsAccessTokenRevoked(jti string) (bool, error) {
+	_, ok := m.revoked[jti]
+	return ok, nil
+}
+
 func TestHandleRegister(t *testing.T) {
 	userStore := &mockUserStore{}
 	authStore := &mockAuthStore{}
-	handler := NewHandler(userStore, authStore)
+	handler := NewHandler(userStore, authStore, newMockTokenStore(), mailer.NewMemoryMailer(), &mockCartMerger{})
 
 	t.Run("should return 400 if the payload is invalid", func(t *testing.T) {
 		payload := domain.RegisterUserPayload{
@@ -141,7 +321,7 @@ func TestHandleRegister(t *testing.T) {
 func TestHandleLogin(t *testing.T) {
 	userStore := &mockUserStore{}
 	authStore := &mockAuthStore{}
-	handler := NewHandler(userStore, authStore)
+	handler := NewHandler(userStore, authStore, newMockTokenStore(), mailer.NewMemoryMailer(), &mockCartMerger{})
 
 	t.Run("should return 400 if the payload is invalid", func(t *testing.T) {
 		payload := "invalid payload"
@@ -231,3 +411,686 @@ func TestHandleLogin(t *testing.T) {
 		}
 	})
 }
+
+func newAdminRequest(t *testing.T, method, url, body, userID, role string) *http.Request {
+	req, err := http.NewRequest(method, url, bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if role != "" {
+		token, err := auth.NewStore().CreateToken([]byte(config.ENV.JWTSecret), domain.User{ID: userID, Role: role})
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	return req
+}
+
+func TestUserAdministrationRoutes(t *testing.T) {
+	routes := []struct {
+		method string
+		url    string
+		body   string
+		status int
+	}{
+		{http.MethodGet, "/users", "", http.StatusOK},
+		{http.MethodPatch, "/users/1/role", `{"role":"staff"}`, http.StatusOK},
+	}
+
+	for _, route := range routes {
+		name := route.method + " " + route.url
+
+		t.Run(name+" should return 401 without a token", func(t *testing.T) {
+			handler := NewHandler(&mockUserStore{}, &mockAuthStore{}, newMockTokenStore(), mailer.NewMemoryMailer(), &mockCartMerger{})
+			router := mux.NewRouter()
+			handler.UserRoutes(router)
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, newAdminRequest(t, route.method, route.url, route.body, "", ""))
+
+			if rr.Code != http.StatusUnauthorized {
+				t.Errorf("expected status code %d, got %d", http.StatusUnauthorized, rr.Code)
+			}
+		})
+
+		for _, role := range []string{domain.RoleCustomer, domain.RoleStaff} {
+			t.Run(name+" should return 403 for "+role, func(t *testing.T) {
+				handler := NewHandler(&mockUserStore{}, &mockAuthStore{}, newMockTokenStore(), mailer.NewMemoryMailer(), &mockCartMerger{})
+				router := mux.NewRouter()
+				handler.UserRoutes(router)
+
+				rr := httptest.NewRecorder()
+				router.ServeHTTP(rr, newAdminRequest(t, route.method, route.url, route.body, "2", role))
+
+				if rr.Code != http.StatusForbidden {
+					t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+				}
+			})
+		}
+
+		t.Run(name+" should be allowed for admins", func(t *testing.T) {
+			handler := NewHandler(&mockUserStore{}, &mockAuthStore{}, newMockTokenStore(), mailer.NewMemoryMailer(), &mockCartMerger{})
+			router := mux.NewRouter()
+			handler.UserRoutes(router)
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, newAdminRequest(t, route.method, route.url, route.body, "2", domain.RoleAdmin))
+
+			if rr.Code != route.status {
+				t.Errorf("expected status code %d, got %d", route.status, rr.Code)
+			}
+		})
+	}
+}
+
+func TestHandleUpdateUserRole(t *testing.T) {
+	t.Run("should update the role", func(t *testing.T) {
+		store := &mockUserStore{}
+		handler := NewHandler(store, &mockAuthStore{}, newMockTokenStore(), mailer.NewMemoryMailer(), &mockCartMerger{})
+		router := mux.NewRouter()
+		handler.UserRoutes(router)
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, newAdminRequest(t, http.MethodPatch, "/users/1/role", `{"role":"staff"}`, "2", domain.RoleAdmin))
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if store.roles["1"] != domain.RoleStaff {
+			t.Errorf("expected role staff, got %q", store.roles["1"])
+		}
+	})
+
+	t.Run("should return 400 for an unknown role", func(t *testing.T) {
+		handler := NewHandler(&mockUserStore{}, &mockAuthStore{}, newMockTokenStore(), mailer.NewMemoryMailer(), &mockCartMerger{})
+		router := mux.NewRouter()
+		handler.UserRoutes(router)
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, newAdminRequest(t, http.MethodPatch, "/users/1/role", `{"role":"owner"}`, "2", domain.RoleAdmin))
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should return 400 when admins demote themselves", func(t *testing.T) {
+		handler := NewHandler(&mockUserStore{}, &mockAuthStore{}, newMockTokenStore(), mailer.NewMemoryMailer(), &mockCartMerger{})
+		router := mux.NewRouter()
+		handler.UserRoutes(router)
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, newAdminRequest(t, http.MethodPatch, "/users/1/role", `{"role":"customer"}`, "1", domain.RoleAdmin))
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	t.Run("should return 404 for an unknown user", func(t *testing.T) {
+		handler := NewHandler(&mockUserStore{}, &mockAuthStore{}, newMockTokenStore(), mailer.NewMemoryMailer(), &mockCartMerger{})
+		router := mux.NewRouter()
+		handler.UserRoutes(router)
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, newAdminRequest(t, http.MethodPatch, "/users/9/role", `{"role":"staff"}`, "2", domain.RoleAdmin))
+
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code %d, got %d", http.StatusNotFound, rr.Code)
+		}
+	})
+}
+
+func refresh(t *testing.T, router *mux.Router, refreshToken string) *httptest.ResponseRecorder {
+	marshaled, _ := json.Marshal(domain.RefreshTokenPayload{RefreshToken: refreshToken})
+	req, err := http.NewRequest(http.MethodPost, "/token/refresh", bytes.NewBuffer(marshaled))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func login(t *testing.T, router *mux.Router) map[string]string {
+	marshaled, _ := json.Marshal(domain.LoginUserPayload{Email: "existing.user@gmail.com", Password: "password"})
+	req, err := http.NewRequest(http.MethodPost, "/login", bytes.NewBuffer(marshaled))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("login failed with status code %d", rr.Code)
+	}
+
+	var response map[string]string
+	if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+		t.Fatal(err)
+	}
+	return response
+}
+
+func TestHandleRefreshToken(t *testing.T) {
+	newRouter := func() (*mux.Router, *mockTokenStore) {
+		tokens := newMockTokenStore()
+		handler := NewHandler(&mockUserStore{}, &mockAuthStore{}, tokens, mailer.NewMemoryMailer(), &mockCartMerger{})
+		router := mux.NewRouter()
+		handler.UserRoutes(router)
+		return router, tokens
+	}
+
+	t.Run("should rotate the refresh token", func(t *testing.T) {
+		router, tokens := newRouter()
+		first := login(t, router)["refreshToken"]
+
+		rr := refresh(t, router, first)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		var response map[string]string
+		if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		if response["token"] == "" || response["refreshToken"] == "" || response["refreshToken"] == first {
+			t.Errorf("expected a new token pair, got %v", response)
+		}
+
+		rotated := tokens.refreshTokens["hashed-"+response["refreshToken"]]
+		original := tokens.refreshTokens["hashed-"+first]
+		if rotated.FamilyID != original.FamilyID {
+			t.Errorf("expected the rotated token to stay in the same family")
+		}
+	})
+
+	t.Run("should revoke the family when a used token is replayed", func(t *testing.T) {
+		router, tokens := newRouter()
+		first := login(t, router)["refreshToken"]
+
+		rr := refresh(t, router, first)
+		var response map[string]string
+		json.NewDecoder(rr.Body).Decode(&response)
+		second := response["refreshToken"]
+
+		rr = refresh(t, router, first)
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected status code %d on reuse, got %d", http.StatusUnauthorized, rr.Code)
+		}
+
+		if tokens.refreshTokens["hashed-"+second].RevokedAt == nil {
+			t.Errorf("expected the newest token of the family to be revoked")
+		}
+
+		rr = refresh(t, router, second)
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected status code %d after revocation, got %d", http.StatusUnauthorized, rr.Code)
+		}
+	})
+
+	t.Run("should return 401 for unknown or expired tokens", func(t *testing.T) {
+		router, tokens := newRouter()
+		tokens.CreateRefreshToken(domain.RefreshToken{
+			ID:        "expired",
+			UserID:    "1",
+			FamilyID:  "family",
+			TokenHash: "hashed-expired",
+			ExpiresAt: time.Now().Add(-time.Minute),
+		})
+
+		for _, token := range []string{"unknown", "expired"} {
+			rr := refresh(t, router, token)
+			if rr.Code != http.StatusUnauthorized {
+				t.Errorf("%s: expected status code %d, got %d", token, http.StatusUnauthorized, rr.Code)
+			}
+		}
+	})
+}
+
+func TestHandleLogout(t *testing.T) {
+	tokens := newMockTokenStore()
+	middleware.SetTokenDenylist(tokens)
+	t.Cleanup(func() { middleware.SetTokenDenylist(nil) })
+
+	handler := NewHandler(&mockUserStore{}, &mockAuthStore{}, tokens, mailer.NewMemoryMailer(), &mockCartMerger{})
+	router := mux.NewRouter()
+	handler.UserRoutes(router)
+
+	refreshToken := login(t, router)["refreshToken"]
+	accessToken, err := auth.NewStore().CreateToken([]byte(config.ENV.JWTSecret), domain.User{ID: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logout := func() *httptest.ResponseRecorder {
+		marshaled, _ := json.Marshal(domain.LogoutPayload{RefreshToken: refreshToken})
+		req, err := http.NewRequest(http.MethodPost, "/logout", bytes.NewBuffer(marshaled))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+accessToken)
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := logout()
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+	}
+
+	if len(tokens.revoked) != 1 {
+		t.Errorf("expected the access token to be revoked")
+	}
+
+	if rr := refresh(t, router, refreshToken); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected the refresh token to stop working, got status code %d", rr.Code)
+	}
+
+	if rr := logout(); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected the access token to stop working, got status code %d", rr.Code)
+	}
+}
+
+var verificationLinkPattern = regexp.MustCompile(`(/verify-email\?token=\S+)`)
+
+func TestEmailVerification(t *testing.T) {
+	t.Run("should email a verification link on registration", func(t *testing.T) {
+		mails := mailer.NewMemoryMailer()
+		handler := NewHandler(&mockUserStore{}, &mockAuthStore{}, newMockTokenStore(), mails, &mockCartMerger{})
+
+		payload := domain.RegisterUserPayload{
+			FirstName: "John",
+			LastName:  "Doe",
+			Email:     "john.doe@gmail.com",
+			Password:  "12345678",
+			Address:   "John Doe Address",
+		}
+		marshaled, _ := json.Marshal(payload)
+		req, err := http.NewRequest(http.MethodPost, "/register", bytes.NewBuffer(marshaled))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := httptest.NewRecorder()
+		router := mux.NewRouter()
+		handler.UserRoutes(router)
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status code %d, got %d", http.StatusCreated, rr.Code)
+		}
+
+		sent := mails.Sent()
+		if len(sent) != 1 || sent[0].To != "john.doe@gmail.com" {
+			t.Fatalf("expected a verification email, got %+v", sent)
+		}
+		if !verificationLinkPattern.MatchString(sent[0].Body) {
+			t.Errorf("expected the email to contain a verification link, got %q", sent[0].Body)
+		}
+	})
+
+	t.Run("should verify the user from the emailed link", func(t *testing.T) {
+		store := &mockUserStore{}
+		handler := NewHandler(store, &mockAuthStore{}, newMockTokenStore(), mailer.NewMemoryMailer(), &mockCartMerger{})
+		router := mux.NewRouter()
+		handler.UserRoutes(router)
+
+		token, err := auth.NewStore().CreateVerificationToken([]byte(config.ENV.JWTSecret), domain.User{ID: "1", Email: "existing.user@gmail.com"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req, _ := http.NewRequest(http.MethodGet, "/verify-email?token="+token, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if !store.verified["1"] {
+			t.Errorf("expected the user to be verified")
+		}
+	})
+
+	t.Run("should reject links for a previous email address", func(t *testing.T) {
+		store := &mockUserStore{}
+		handler := NewHandler(store, &mockAuthStore{}, newMockTokenStore(), mailer.NewMemoryMailer(), &mockCartMerger{})
+		router := mux.NewRouter()
+		handler.UserRoutes(router)
+
+		token, _ := auth.NewStore().CreateVerificationToken([]byte(config.ENV.JWTSecret), domain.User{ID: "1", Email: "old@gmail.com"})
+
+		for _, query := range []string{"token=" + token, "token=garbage", ""} {
+			req, _ := http.NewRequest(http.MethodGet, "/verify-email?"+query, nil)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("%q: expected status code %d, got %d", query, http.StatusBadRequest, rr.Code)
+			}
+		}
+		if store.verified["1"] {
+			t.Errorf("expected the user to stay unverified")
+		}
+	})
+
+	t.Run("should resend the link to unverified users", func(t *testing.T) {
+		store := &mockUserStore{}
+		mails := mailer.NewMemoryMailer()
+		handler := NewHandler(store, &mockAuthStore{}, newMockTokenStore(), mails, &mockCartMerger{})
+		router := mux.NewRouter()
+		handler.UserRoutes(router)
+
+		resend := func() *httptest.ResponseRecorder {
+			req := newAdminRequest(t, http.MethodPost, "/verify-email/resend", "", "1", domain.RoleCustomer)
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			return rr
+		}
+
+		if rr := resend(); rr.Code != http.StatusAccepted {
+			t.Errorf("expected status code %d, got %d", http.StatusAccepted, rr.Code)
+		}
+		if len(mails.Sent()) != 1 {
+			t.Errorf("expected 1 email, got %d", len(mails.Sent()))
+		}
+
+		store.MarkUserVerified("1")
+		if rr := resend(); rr.Code != http.StatusConflict {
+			t.Errorf("expected status code %d once verified, got %d", http.StatusConflict, rr.Code)
+		}
+	})
+}
+
+func TestAccountRoutes(t *testing.T) {
+	routes := []struct {
+		method string
+		url    string
+		body   string
+	}{
+		{http.MethodGet, "/me", ""},
+		{http.MethodPatch, "/me", `{"firstName":"New"}`},
+		{http.MethodPost, "/me/password", `{"currentPassword":"password","newPassword":"new-password"}`},
+		{http.MethodDelete, "/me", `{"password":"password"}`},
+	}
+
+	for _, route := range routes {
+		t.Run(route.method+" "+route.url+" should return 401 without a token", func(t *testing.T) {
+			handler := NewHandler(&mockUserStore{}, &mockAuthStore{}, newMockTokenStore(), mailer.NewMemoryMailer(), &mockCartMerger{})
+			router := mux.NewRouter()
+			handler.UserRoutes(router)
+
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, newAdminRequest(t, route.method, route.url, route.body, "", ""))
+
+			if rr.Code != http.StatusUnauthorized {
+				t.Errorf("expected status code %d, got %d", http.StatusUnauthorized, rr.Code)
+			}
+		})
+	}
+}
+
+func TestHandleGetMe(t *testing.T) {
+	handler := NewHandler(&mockUserStore{}, &mockAuthStore{}, newMockTokenStore(), mailer.NewMemoryMailer(), &mockCartMerger{})
+	router := mux.NewRouter()
+	handler.UserRoutes(router)
+
+	t.Run("should return the authenticated user", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, newAdminRequest(t, http.MethodGet, "/me", "", "1", domain.RoleCustomer))
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+
+		var response map[string]interface{}
+		if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+		if response["email"] != "existing.user@gmail.com" {
+			t.Errorf("expected the user's email, got %v", response["email"])
+		}
+		if _, ok := response["password"]; ok {
+			t.Errorf("expected the password hash to be omitted")
+		}
+	})
+
+	t.Run("should return 404 when the user no longer exists", func(t *testing.T) {
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, newAdminRequest(t, http.MethodGet, "/me", "", "9", domain.RoleCustomer))
+
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code %d, got %d", http.StatusNotFound, rr.Code)
+		}
+	})
+
+	t.Run("should return 500 when the user can't be read", func(t *testing.T) {
+		handler := NewHandler(&mockUserStore{getErr: errors.New("database is down")}, &mockAuthStore{}, newMockTokenStore(), mailer.NewMemoryMailer(), &mockCartMerger{})
+		router := mux.NewRouter()
+		handler.UserRoutes(router)
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, newAdminRequest(t, http.MethodGet, "/me", "", "1", domain.RoleCustomer))
+
+		if rr.Code != http.StatusInternalServerError {
+			t.Errorf("expected status code %d, got %d", http.StatusInternalServerError, rr.Code)
+		}
+	})
+}
+
+func TestHandleUpdateMe(t *testing.T) {
+	t.Run("should only change the fields that were sent", func(t *testing.T) {
+		users := &mockUserStore{}
+		handler := NewHandler(users, &mockAuthStore{}, newMockTokenStore(), mailer.NewMemoryMailer(), &mockCartMerger{})
+		router := mux.NewRouter()
+		handler.UserRoutes(router)
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, newAdminRequest(t, http.MethodPatch, "/me", `{"firstName":"Jane","address":"New Address"}`, "1", domain.RoleCustomer))
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if users.updated == nil {
+			t.Fatal("expected the user to be updated")
+		}
+		if users.updated.FirstName != "Jane" || users.updated.Address != "New Address" {
+			t.Errorf("expected the sent fields to change, got %+v", users.updated)
+		}
+		if users.updated.LastName != "User" || users.updated.Email != "existing.user@gmail.com" {
+			t.Errorf("expected the other fields to be kept, got %+v", users.updated)
+		}
+	})
+
+	t.Run("should return 400 for an empty name", func(t *testing.T) {
+		handler := NewHandler(&mockUserStore{}, &mockAuthStore{}, newMockTokenStore(), mailer.NewMemoryMailer(), &mockCartMerger{})
+		router := mux.NewRouter()
+		handler.UserRoutes(router)
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, newAdminRequest(t, http.MethodPatch, "/me", `{"firstName":""}`, "1", domain.RoleCustomer))
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+}
+
+func TestHandleChangePassword(t *testing.T) {
+	t.Run("should return 400 if the current password is incorrect", func(t *testing.T) {
+		users := &mockUserStore{}
+		handler := NewHandler(users, &mockAuthStore{}, newMockTokenStore(), mailer.NewMemoryMailer(), &mockCartMerger{})
+		router := mux.NewRouter()
+		handler.UserRoutes(router)
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, newAdminRequest(t, http.MethodPost, "/me/password", `{"currentPassword":"wrong","newPassword":"new-password"}`, "1", domain.RoleCustomer))
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+		if len(users.passwords) != 0 {
+			t.Errorf("expected the password to be unchanged")
+		}
+	})
+
+	t.Run("should change the password and revoke other sessions", func(t *testing.T) {
+		users := &mockUserStore{}
+		tokens := newMockTokenStore()
+		handler := NewHandler(users, &mockAuthStore{}, tokens, mailer.NewMemoryMailer(), &mockCartMerger{})
+		router := mux.NewRouter()
+		handler.UserRoutes(router)
+
+		oldRefreshToken := login(t, router)["refreshToken"]
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, newAdminRequest(t, http.MethodPost, "/me/password", `{"currentPassword":"password","newPassword":"new-password"}`, "1", domain.RoleCustomer))
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if _, ok := users.passwords["1"]; !ok {
+			t.Errorf("expected the password to be updated")
+		}
+		if len(tokens.revoked) != 1 {
+			t.Errorf("expected the access token of the request to be revoked")
+		}
+
+		var response map[string]string
+		if err := json.NewDecoder(rr.Body).Decode(&response); err != nil {
+			t.Fatal(err)
+		}
+
+		if rr := refresh(t, router, oldRefreshToken); rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected the old refresh token to stop working, got status code %d", rr.Code)
+		}
+		if rr := refresh(t, router, response["refreshToken"]); rr.Code != http.StatusOK {
+			t.Errorf("expected the new refresh token to work, got status code %d", rr.Code)
+		}
+	})
+}
+
+func TestHandleDeleteMe(t *testing.T) {
+	t.Run("should return 400 if the password is incorrect", func(t *testing.T) {
+		users := &mockUserStore{}
+		handler := NewHandler(users, &mockAuthStore{}, newMockTokenStore(), mailer.NewMemoryMailer(), &mockCartMerger{})
+		router := mux.NewRouter()
+		handler.UserRoutes(router)
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, newAdminRequest(t, http.MethodDelete, "/me", `{"password":"wrong"}`, "1", domain.RoleCustomer))
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+		if users.deleted["1"] {
+			t.Errorf("expected the account to be kept")
+		}
+	})
+
+	t.Run("should delete the account and end its sessions", func(t *testing.T) {
+		users := &mockUserStore{}
+		tokens := newMockTokenStore()
+		handler := NewHandler(users, &mockAuthStore{}, tokens, mailer.NewMemoryMailer(), &mockCartMerger{})
+		router := mux.NewRouter()
+		handler.UserRoutes(router)
+
+		refreshToken := login(t, router)["refreshToken"]
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, newAdminRequest(t, http.MethodDelete, "/me", `{"password":"password"}`, "1", domain.RoleCustomer))
+
+		if rr.Code != http.StatusNoContent {
+			t.Fatalf("expected status code %d, got %d", http.StatusNoContent, rr.Code)
+		}
+		if !users.deleted["1"] {
+			t.Errorf("expected the account to be deleted")
+		}
+		if len(tokens.revoked) != 1 {
+			t.Errorf("expected the access token to be revoked")
+		}
+		if rr := refresh(t, router, refreshToken); rr.Code != http.StatusUnauthorized {
+			t.Errorf("expected the refresh token to stop working, got status code %d", rr.Code)
+		}
+	})
+}
+
+func TestGuestCartMerge(t *testing.T) {
+	t.Run("should merge the guest cart on login", func(t *testing.T) {
+		carts := &mockCartMerger{}
+		handler := NewHandler(&mockUserStore{}, &mockAuthStore{}, newMockTokenStore(), mailer.NewMemoryMailer(), carts)
+		router := mux.NewRouter()
+		handler.UserRoutes(router)
+
+		marshaled, _ := json.Marshal(domain.LoginUserPayload{Email: "existing.user@gmail.com", Password: "password"})
+		req, err := http.NewRequest(http.MethodPost, "/login", bytes.NewBuffer(marshaled))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.AddCookie(&http.Cookie{Name: cart.CartTokenCookie, Value: "guest-token"})
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d", http.StatusOK, rr.Code)
+		}
+		if carts.merged["guest-token"] != "1" {
+			t.Errorf("expected the guest cart to be merged into user 1, got %v", carts.merged)
+		}
+		cookies := rr.Result().Cookies()
+		if len(cookies) != 1 || cookies[0].Name != cart.CartTokenCookie || cookies[0].MaxAge >= 0 {
+			t.Errorf("expected the cart cookie to be cleared, got %+v", cookies)
+		}
+	})
+
+	t.Run("should merge the guest cart on registration", func(t *testing.T) {
+		carts := &mockCartMerger{}
+		handler := NewHandler(&mockUserStore{}, &mockAuthStore{}, newMockTokenStore(), mailer.NewMemoryMailer(), carts)
+		router := mux.NewRouter()
+		handler.UserRoutes(router)
+
+		marshaled, _ := json.Marshal(domain.RegisterUserPayload{
+			FirstName: "John",
+			LastName:  "Doe",
+			Email:     "john.doe@gmail.com",
+			Password:  "12345678",
+			Address:   "Address",
+		})
+		req, err := http.NewRequest(http.MethodPost, "/register", bytes.NewBuffer(marshaled))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set(cart.CartTokenHeader, "guest-token")
+
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status code %d, got %d", http.StatusCreated, rr.Code)
+		}
+		if _, ok := carts.merged["guest-token"]; !ok {
+			t.Errorf("expected the guest cart to be merged")
+		}
+	})
+
+	t.Run("should not touch carts without a token", func(t *testing.T) {
+		carts := &mockCartMerger{}
+		handler := NewHandler(&mockUserStore{}, &mockAuthStore{}, newMockTokenStore(), mailer.NewMemoryMailer(), carts)
+		router := mux.NewRouter()
+		handler.UserRoutes(router)
+
+		login(t, router)
+
+		if len(carts.merged) != 0 {
+			t.Errorf("expected no merge, got %v", carts.merged)
+		}
+	})
+}
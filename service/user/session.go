@@ -0,0 +1,169 @@
+package user
+
+import (
+	"ecom/config"
+	"ecom/domain"
+	"ecom/middleware"
+	"ecom/service/cart"
+	"ecom/utils"
+	"errors"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"log"
+	"net/http"
+	"time"
+)
+
+// issueTokens creates an access token and a refresh token belonging to the
+// given refresh token family.
+func (h *Handler) issueTokens(user *domain.User, familyID string) (string, string, error) {
+	secret := []byte(config.ENV.JWTSecret)
+	token, err := h.auth.CreateToken(secret, *user)
+	if err != nil {
+		return "", "", err
+	}
+
+	refreshToken, hash, err := h.auth.GenerateToken()
+	if err != nil {
+		return "", "", err
+	}
+
+	err = h.tokens.CreateRefreshToken(domain.RefreshToken{
+		ID:        uuid.New().String(),
+		UserID:    user.ID,
+		FamilyID:  familyID,
+		TokenHash: hash,
+		ExpiresAt: time.Now().Add(config.ENV.RefreshTokenTTL),
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	return token, refreshToken, nil
+}
+
+func (h *Handler) handleRefreshToken(w http.ResponseWriter, r *http.Request) {
+	// get JSON payload
+	var payload domain.RefreshTokenPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// validate the payload
+	err := utils.Validate.Struct(payload)
+	if err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", validationErrors))
+		return
+	}
+
+	// look up the refresh token
+	stored, err := h.tokens.GetRefreshTokenByHash(h.auth.HashToken(payload.RefreshToken))
+	if errors.Is(err, domain.ErrRefreshTokenNotFound) {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid refresh token"))
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if stored.RevokedAt != nil || time.Now().After(stored.ExpiresAt) {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid refresh token"))
+		return
+	}
+
+	// a refresh token can only be used once; seeing it again means it was
+	// stolen, so the whole family is revoked
+	used, err := h.tokens.MarkRefreshTokenUsed(stored.ID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if !used {
+		if err := h.tokens.RevokeTokenFamily(stored.FamilyID); err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("refresh token reuse detected"))
+		return
+	}
+
+	// reload the user so the new token carries up to date claims
+	user, err := h.store.GetUserByID(stored.UserID)
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, fmt.Errorf("invalid refresh token"))
+		return
+	}
+
+	token, refreshToken, err := h.issueTokens(user, stored.FamilyID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"token": token, "refreshToken": refreshToken})
+}
+
+func (h *Handler) handleLogout(w http.ResponseWriter, r *http.Request) {
+	// the refresh token is optional, logging out always revokes the access token
+	var payload domain.LogoutPayload
+	if r.ContentLength != 0 {
+		if err := utils.ParseJSON(r, &payload); err != nil {
+			utils.WriteError(w, http.StatusBadRequest, err)
+			return
+		}
+	}
+
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	tokenInfo, err := middleware.GetTokenFromContext(r.Context())
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	if payload.RefreshToken != "" {
+		stored, err := h.tokens.GetRefreshTokenByHash(h.auth.HashToken(payload.RefreshToken))
+		if err != nil && !errors.Is(err, domain.ErrRefreshTokenNotFound) {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+		// ignore refresh tokens of other users
+		if stored != nil && stored.UserID == userID {
+			if err := h.tokens.RevokeTokenFamily(stored.FamilyID); err != nil {
+				utils.WriteError(w, http.StatusInternalServerError, err)
+				return
+			}
+		}
+	}
+
+	if tokenInfo.ID != "" {
+		if err := h.tokens.RevokeAccessToken(tokenInfo.ID, tokenInfo.ExpiresAt); err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "logout successful"})
+}
+
+// mergeGuestCart moves the guest cart the request carries, if any, into the
+// user's cart. Signing in never fails because of the cart.
+func (h *Handler) mergeGuestCart(w http.ResponseWriter, r *http.Request, userID string) {
+	token := cart.GuestCartToken(r)
+	if token == "" {
+		return
+	}
+
+	if err := h.carts.MergeGuestCart(userID, token); err != nil {
+		log.Println("guest cart merge:", err)
+		return
+	}
+	cart.ClearGuestCartCookie(w)
+}
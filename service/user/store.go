@@ -4,9 +4,10 @@ import (
 	"database/sql"
 	"ecom/domain"
 	"errors"
-	"fmt"
 )
 
+const userColumns = "id, firstName, lastName, email, password, address, role, verified, createdAt"
+
 type Store struct {
 	db *sql.DB
 }
@@ -15,9 +16,11 @@ func NewStore(db *sql.DB) *Store {
 	return &Store{db: db}
 }
 
-func (s *Store) GetUserByEmail(email string) (*domain.User, error) {
-	row := s.db.QueryRow("SELECT * FROM users WHERE email = ?", email)
+type scanner interface {
+	Scan(dest ...any) error
+}
 
+func scanUser(row scanner) (*domain.User, error) {
 	user := new(domain.User)
 	err := row.Scan(
 		&user.ID,
@@ -26,11 +29,13 @@ func (s *Store) GetUserByEmail(email string) (*domain.User, error) {
 		&user.Email,
 		&user.Password,
 		&user.Address,
+		&user.Role,
+		&user.Verified,
 		&user.CreatedAt,
 	)
 
 	if errors.Is(err, sql.ErrNoRows) {
-		return nil, fmt.Errorf("user not found")
+		return nil, domain.ErrUserNotFound
 	} else if err != nil {
 		return nil, err
 	}
@@ -38,39 +43,113 @@ func (s *Store) GetUserByEmail(email string) (*domain.User, error) {
 	return user, nil
 }
 
-func (s *Store) GetUserByID(id int) (*domain.User, error) {
-	row := s.db.QueryRow("SELECT * FROM users WHERE id = ?", id)
+func (s *Store) GetUserByEmail(email string) (*domain.User, error) {
+	return scanUser(s.db.QueryRow("SELECT "+userColumns+" FROM users WHERE email = ? AND deletedAt IS NULL", email))
+}
 
-	user := new(domain.User)
-	err := row.Scan(
-		&user.ID,
-		&user.FirstName,
-		&user.LastName,
-		&user.Email,
-		&user.Password,
-		&user.Address,
-		&user.CreatedAt,
-	)
+func (s *Store) GetUserByID(id string) (*domain.User, error) {
+	return scanUser(s.db.QueryRow("SELECT "+userColumns+" FROM users WHERE id = ? AND deletedAt IS NULL", id))
+}
 
-	if errors.Is(err, sql.ErrNoRows) {
-		return nil, fmt.Errorf("user not found")
-	} else if err != nil {
-		return nil, err
+func (s *Store) GetUsers(limit, offset int) (*[]domain.User, int, error) {
+	var total int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM users WHERE deletedAt IS NULL").Scan(&total); err != nil {
+		return nil, 0, err
 	}
 
-	return user, nil
+	rows, err := s.db.Query("SELECT "+userColumns+" FROM users WHERE deletedAt IS NULL ORDER BY createdAt, id LIMIT ? OFFSET ?", limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	users := make([]domain.User, 0)
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		users = append(users, *user)
+	}
+
+	return &users, total, rows.Err()
 }
 
 func (s *Store) CreateUser(user domain.User) error {
+	if user.Role == "" {
+		user.Role = domain.RoleCustomer
+	}
+
 	_, err := s.db.Exec(
-		"INSERT INTO users (id,firstName, lastName, email, password, address) VALUES (?,?, ?, ?, ?, ?)",
+		"INSERT INTO users (id,firstName, lastName, email, password, address, role) VALUES (?,?, ?, ?, ?, ?, ?)",
 		user.ID,
 		user.FirstName,
 		user.LastName,
 		user.Email,
 		user.Password,
 		user.Address,
+		user.Role,
 	)
 
 	return err
 }
+
+func (s *Store) UpdateUserRole(id string, role string) error {
+	result, err := s.db.Exec("UPDATE users SET role = ? WHERE id = ? AND deletedAt IS NULL", role, id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		// MySQL reports zero rows for an unchanged role too
+		if _, err := s.GetUserByID(id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Store) UpdatePassword(id string, hashedPassword string) error {
+	_, err := s.db.Exec("UPDATE users SET password = ? WHERE id = ?", hashedPassword, id)
+	return err
+}
+
+func (s *Store) MarkUserVerified(id string) error {
+	_, err := s.db.Exec("UPDATE users SET verified = TRUE WHERE id = ?", id)
+	return err
+}
+
+func (s *Store) UpdateUser(user domain.User) error {
+	_, err := s.db.Exec("UPDATE users SET firstName = ?, lastName = ?, address = ? WHERE id = ? AND deletedAt IS NULL",
+		user.FirstName, user.LastName, user.Address, user.ID)
+	return err
+}
+
+// DeleteUser soft-deletes the account so its orders stay intact, and scrubs
+// the personal data. The email is replaced so it can be registered again.
+func (s *Store) DeleteUser(id string) error {
+	result, err := s.db.Exec(`
+		UPDATE users
+		SET firstName = '', lastName = '', address = '', password = '',
+			email = CONCAT('deleted-', id, '@deleted.invalid'), deletedAt = NOW()
+		WHERE id = ? AND deletedAt IS NULL
+	`, id)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return domain.ErrUserNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,84 @@
+package user
+
+import (
+	"ecom/config"
+	"ecom/domain"
+	"ecom/middleware"
+	"ecom/utils"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+func (h *Handler) sendVerificationEmail(user domain.User) error {
+	token, err := h.auth.CreateVerificationToken([]byte(config.ENV.JWTSecret), user)
+	if err != nil {
+		return err
+	}
+
+	link := fmt.Sprintf("%s/api/v1/verify-email?token=%s", config.ENV.AppURL, url.QueryEscape(token))
+	return h.mailer.Send(domain.Mail{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening the link below. It expires in %s.\n\n%s\n",
+			user.FirstName, config.ENV.EmailVerificationTTL, link),
+	})
+}
+
+func (h *Handler) handleVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	invalidToken := fmt.Errorf("invalid or expired verification link")
+
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("missing token"))
+		return
+	}
+
+	userID, email, err := h.auth.ParseVerificationToken([]byte(config.ENV.JWTSecret), token)
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, invalidToken)
+		return
+	}
+
+	// links sent to a previous email address are no longer valid
+	user, err := h.store.GetUserByID(userID)
+	if err != nil || user.Email != email {
+		utils.WriteError(w, http.StatusBadRequest, invalidToken)
+		return
+	}
+
+	if !user.Verified {
+		if err := h.store.MarkUserVerified(user.ID); err != nil {
+			utils.WriteError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	utils.WriteJSON(w, http.StatusOK, map[string]string{"message": "email verified"})
+}
+
+func (h *Handler) handleResendVerification(w http.ResponseWriter, r *http.Request) {
+	userID, err := middleware.GetUserIDFromContext(r.Context())
+	if err != nil {
+		utils.WriteError(w, http.StatusUnauthorized, err)
+		return
+	}
+
+	user, err := h.store.GetUserByID(userID)
+	if err != nil {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	}
+
+	if user.Verified {
+		utils.WriteError(w, http.StatusConflict, fmt.Errorf("email is already verified"))
+		return
+	}
+
+	if err := h.sendVerificationEmail(*user); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusAccepted, map[string]string{"message": "verification email sent"})
+}
@@ -0,0 +1,227 @@
+package warehouse
+
+import (
+	"ecom/domain"
+	"ecom/middleware"
+	"ecom/utils"
+	"errors"
+	"fmt"
+	"github.com/go-playground/validator/v10"
+	"github.com/gorilla/mux"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type Handler struct {
+	store        domain.WarehouseRepository
+	productStore domain.ProductRepository
+}
+
+func NewHandler(store domain.WarehouseRepository, productStore domain.ProductRepository) *Handler {
+	return &Handler{store: store, productStore: productStore}
+}
+
+func (h *Handler) WarehouseRoutes(router *mux.Router) {
+	router.Handle("/warehouses", middleware.Authorize(h.handleGetWarehouses, domain.RoleStaff, domain.RoleAdmin)).Methods(http.MethodGet)
+	router.Handle("/warehouses", middleware.Authorize(h.handleCreateWarehouse, domain.RoleStaff, domain.RoleAdmin)).Methods(http.MethodPost)
+	router.Handle("/warehouses/{id}", middleware.Authorize(h.handleGetWarehouse, domain.RoleStaff, domain.RoleAdmin)).Methods(http.MethodGet)
+	router.Handle("/warehouses/{id}", middleware.Authorize(h.handleUpdateWarehouse, domain.RoleStaff, domain.RoleAdmin)).Methods(http.MethodPut)
+	router.Handle("/warehouses/{id}/stock/{productId}", middleware.Authorize(h.handleSetStock, domain.RoleStaff, domain.RoleAdmin)).Methods(http.MethodPut)
+}
+
+func (h *Handler) handleGetWarehouses(w http.ResponseWriter, r *http.Request) {
+	warehouses, err := h.store.GetWarehouses()
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, warehouses)
+}
+
+func (h *Handler) handleGetWarehouse(w http.ResponseWriter, r *http.Request) {
+	// get the warehouse ID from the URL
+	warehouseID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid warehouse ID"))
+		return
+	}
+
+	warehouse, err := h.store.GetWarehouseByID(warehouseID)
+	if errors.Is(err, domain.ErrWarehouseNotFound) {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, warehouse)
+}
+
+func (h *Handler) handleCreateWarehouse(w http.ResponseWriter, r *http.Request) {
+	// get JSON payload
+	var payload domain.WarehousePayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	warehouse, ok := h.parseWarehouse(w, payload, 0)
+	if !ok {
+		return
+	}
+
+	id, err := h.store.CreateWarehouse(warehouse)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	created, err := h.store.GetWarehouseByID(id)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusCreated, created)
+}
+
+func (h *Handler) handleUpdateWarehouse(w http.ResponseWriter, r *http.Request) {
+	// get the warehouse ID from the URL
+	warehouseID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid warehouse ID"))
+		return
+	}
+
+	// get JSON payload
+	var payload domain.WarehousePayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// make sure the warehouse exists
+	if _, err := h.store.GetWarehouseByID(warehouseID); errors.Is(err, domain.ErrWarehouseNotFound) {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	warehouse, ok := h.parseWarehouse(w, payload, warehouseID)
+	if !ok {
+		return
+	}
+	warehouse.ID = warehouseID
+
+	if err := h.store.UpdateWarehouse(warehouse); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	updated, err := h.store.GetWarehouseByID(warehouseID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, updated)
+}
+
+func (h *Handler) handleSetStock(w http.ResponseWriter, r *http.Request) {
+	// get the warehouse and product IDs from the URL
+	warehouseID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid warehouse ID"))
+		return
+	}
+	productID, err := strconv.Atoi(mux.Vars(r)["productId"])
+	if err != nil {
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid product ID"))
+		return
+	}
+
+	// get JSON payload
+	var payload domain.WarehouseStockPayload
+	if err := utils.ParseJSON(r, &payload); err != nil {
+		utils.WriteError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// validate the payload
+	if err := utils.Validate.Struct(payload); err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", validationErrors))
+		return
+	}
+
+	// make sure both exist
+	if _, err := h.store.GetWarehouseByID(warehouseID); errors.Is(err, domain.ErrWarehouseNotFound) {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if _, err := h.productStore.GetProductByID(productID); errors.Is(err, domain.ErrProductNotFound) {
+		utils.WriteError(w, http.StatusNotFound, err)
+		return
+	} else if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	if err := h.store.SetWarehouseStock(productID, warehouseID, payload.Quantity); err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	stock, err := h.productStore.GetProductStock(productID)
+	if err != nil {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	utils.WriteJSON(w, http.StatusOK, stock)
+}
+
+// parseWarehouse validates the payload of the warehouse with the given ID,
+// zero for a new one, writing the error response itself when it's invalid.
+func (h *Handler) parseWarehouse(w http.ResponseWriter, payload domain.WarehousePayload, warehouseID int) (domain.Warehouse, bool) {
+	// validate the payload
+	err := utils.Validate.Struct(payload)
+	if err != nil {
+		validationErrors := err.(validator.ValidationErrors)
+		utils.WriteError(w, http.StatusBadRequest, fmt.Errorf("invalid payload: %v", validationErrors))
+		return domain.Warehouse{}, false
+	}
+
+	code := strings.ToLower(payload.Code)
+	existing, err := h.store.GetWarehouseByCode(code)
+	if err == nil && existing.ID != warehouseID {
+		utils.WriteError(w, http.StatusConflict, domain.ErrWarehouseCodeTaken)
+		return domain.Warehouse{}, false
+	} else if err != nil && !errors.Is(err, domain.ErrWarehouseNotFound) {
+		utils.WriteError(w, http.StatusInternalServerError, err)
+		return domain.Warehouse{}, false
+	}
+
+	active := true
+	if payload.Active != nil {
+		active = *payload.Active
+	}
+
+	return domain.Warehouse{
+		Code:       code,
+		Name:       payload.Name,
+		Country:    strings.ToUpper(payload.Country),
+		Region:     payload.Region,
+		PostalCode: payload.PostalCode,
+		Priority:   payload.Priority,
+		Active:     active,
+	}, true
+}
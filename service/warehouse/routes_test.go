@@ -0,0 +1,240 @@
+package warehouse
+
+import (
+	"bytes"
+	"ecom/config"
+	"ecom/domain"
+	"ecom/service/auth"
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type mockWarehouseStore struct {
+	domain.WarehouseRepository
+	warehouses []domain.Warehouse
+	stock      map[[2]int]int // product and warehouse ID to quantity
+}
+
+func (m *mockWarehouseStore) GetWarehouses() (*[]domain.Warehouse, error) {
+	return &m.warehouses, nil
+}
+
+func (m *mockWarehouseStore) GetWarehouseByID(id int) (*domain.Warehouse, error) {
+	for _, warehouse := range m.warehouses {
+		if warehouse.ID == id {
+			return &warehouse, nil
+		}
+	}
+	return nil, domain.ErrWarehouseNotFound
+}
+
+func (m *mockWarehouseStore) GetWarehouseByCode(code string) (*domain.Warehouse, error) {
+	for _, warehouse := range m.warehouses {
+		if warehouse.Code == code {
+			return &warehouse, nil
+		}
+	}
+	return nil, domain.ErrWarehouseNotFound
+}
+
+func (m *mockWarehouseStore) CreateWarehouse(warehouse domain.Warehouse) (int, error) {
+	warehouse.ID = len(m.warehouses) + 1
+	m.warehouses = append(m.warehouses, warehouse)
+	return warehouse.ID, nil
+}
+
+func (m *mockWarehouseStore) UpdateWarehouse(warehouse domain.Warehouse) error {
+	for i := range m.warehouses {
+		if m.warehouses[i].ID == warehouse.ID {
+			m.warehouses[i] = warehouse
+		}
+	}
+	return nil
+}
+
+func (m *mockWarehouseStore) SetWarehouseStock(productID, warehouseID, quantity int) error {
+	if m.stock == nil {
+		m.stock = make(map[[2]int]int)
+	}
+	m.stock[[2]int{productID, warehouseID}] = quantity
+	return nil
+}
+
+type mockProductStore struct {
+	domain.ProductRepository
+	warehouses *mockWarehouseStore
+}
+
+func (m *mockProductStore) GetProductByID(id int) (*domain.Product, error) {
+	if id != 1 {
+		return nil, domain.ErrProductNotFound
+	}
+	return &domain.Product{ID: 1, Name: "Product"}, nil
+}
+
+func (m *mockProductStore) GetProductStock(productID int) (*domain.ProductStock, error) {
+	stock := &domain.ProductStock{ProductID: productID}
+	for _, warehouse := range m.warehouses.warehouses {
+		quantity := m.warehouses.stock[[2]int{productID, warehouse.ID}]
+		stock.Warehouses = append(stock.Warehouses, domain.WarehouseStock{WarehouseID: warehouse.ID, Quantity: quantity, Available: quantity})
+		stock.Quantity += quantity
+		stock.Available += quantity
+	}
+	return stock, nil
+}
+
+func serveWarehouseRequest(t *testing.T, store *mockWarehouseStore, method, url, body, role string) *httptest.ResponseRecorder {
+	router := mux.NewRouter()
+	NewHandler(store, &mockProductStore{warehouses: store}).WarehouseRoutes(router)
+
+	req, err := http.NewRequest(method, url, bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if role != "" {
+		token, err := auth.NewStore().CreateToken([]byte(config.ENV.JWTSecret), domain.User{ID: "user-1", Role: role})
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestHandleCreateWarehouse(t *testing.T) {
+	t.Run("should create an active warehouse with a lower case code", func(t *testing.T) {
+		store := &mockWarehouseStore{}
+
+		body := `{"code":"EAST","name":"East coast","country":"us","region":"NY","postalCode":"10001","priority":2}`
+		rr := serveWarehouseRequest(t, store, http.MethodPost, "/warehouses", body, domain.RoleStaff)
+
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status code %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+		}
+
+		var warehouse domain.Warehouse
+		if err := json.NewDecoder(rr.Body).Decode(&warehouse); err != nil {
+			t.Fatal(err)
+		}
+		if warehouse.Code != "east" || warehouse.Country != "US" || !warehouse.Active || warehouse.Priority != 2 {
+			t.Errorf("unexpected warehouse %+v", warehouse)
+		}
+	})
+
+	invalid := map[string]string{
+		"missing name":      `{"code":"east","country":"US"}`,
+		"long country":      `{"code":"east","name":"East","country":"USA"}`,
+		"negative priority": `{"code":"east","name":"East","country":"US","priority":-1}`,
+	}
+	for name, body := range invalid {
+		t.Run("should reject a "+name, func(t *testing.T) {
+			rr := serveWarehouseRequest(t, &mockWarehouseStore{}, http.MethodPost, "/warehouses", body, domain.RoleAdmin)
+
+			if rr.Code != http.StatusBadRequest {
+				t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+			}
+		})
+	}
+
+	t.Run("should return 409 for a code in use", func(t *testing.T) {
+		store := &mockWarehouseStore{warehouses: []domain.Warehouse{{ID: 1, Code: "main"}}}
+
+		rr := serveWarehouseRequest(t, store, http.MethodPost, "/warehouses", `{"code":"MAIN","name":"Main","country":"US"}`, domain.RoleAdmin)
+
+		if rr.Code != http.StatusConflict {
+			t.Errorf("expected status code %d, got %d", http.StatusConflict, rr.Code)
+		}
+	})
+}
+
+func TestHandleUpdateWarehouse(t *testing.T) {
+	t.Run("should deactivate the warehouse and keep its own code", func(t *testing.T) {
+		store := &mockWarehouseStore{warehouses: []domain.Warehouse{{ID: 1, Code: "main", Country: "US", Active: true}}}
+
+		body := `{"code":"main","name":"Main","country":"US","active":false}`
+		rr := serveWarehouseRequest(t, store, http.MethodPut, "/warehouses/1", body, domain.RoleAdmin)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+		if updated := store.warehouses[0]; updated.Active || updated.Name != "Main" {
+			t.Errorf("unexpected warehouse %+v", updated)
+		}
+	})
+
+	t.Run("should return 404 for an unknown warehouse", func(t *testing.T) {
+		rr := serveWarehouseRequest(t, &mockWarehouseStore{}, http.MethodPut, "/warehouses/9", `{"code":"main","name":"Main","country":"US"}`, domain.RoleAdmin)
+
+		if rr.Code != http.StatusNotFound {
+			t.Errorf("expected status code %d, got %d", http.StatusNotFound, rr.Code)
+		}
+	})
+}
+
+func TestHandleSetStock(t *testing.T) {
+	t.Run("should set the stock and return the product stock", func(t *testing.T) {
+		store := &mockWarehouseStore{warehouses: []domain.Warehouse{{ID: 1, Code: "main"}, {ID: 2, Code: "east"}}}
+
+		rr := serveWarehouseRequest(t, store, http.MethodPut, "/warehouses/2/stock/1", `{"quantity":7}`, domain.RoleStaff)
+
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected status code %d, got %d: %s", http.StatusOK, rr.Code, rr.Body.String())
+		}
+
+		var stock domain.ProductStock
+		if err := json.NewDecoder(rr.Body).Decode(&stock); err != nil {
+			t.Fatal(err)
+		}
+		if stock.Available != 7 || len(stock.Warehouses) != 2 || stock.Warehouses[1].Quantity != 7 {
+			t.Errorf("unexpected stock %+v", stock)
+		}
+	})
+
+	t.Run("should reject a negative quantity", func(t *testing.T) {
+		store := &mockWarehouseStore{warehouses: []domain.Warehouse{{ID: 1, Code: "main"}}}
+
+		rr := serveWarehouseRequest(t, store, http.MethodPut, "/warehouses/1/stock/1", `{"quantity":-1}`, domain.RoleStaff)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("expected status code %d, got %d", http.StatusBadRequest, rr.Code)
+		}
+	})
+
+	for name, url := range map[string]string{"warehouse": "/warehouses/9/stock/1", "product": "/warehouses/1/stock/9"} {
+		t.Run("should return 404 for an unknown "+name, func(t *testing.T) {
+			store := &mockWarehouseStore{warehouses: []domain.Warehouse{{ID: 1, Code: "main"}}}
+
+			rr := serveWarehouseRequest(t, store, http.MethodPut, url, `{"quantity":1}`, domain.RoleStaff)
+
+			if rr.Code != http.StatusNotFound {
+				t.Errorf("expected status code %d, got %d", http.StatusNotFound, rr.Code)
+			}
+		})
+	}
+}
+
+func TestProtectedWarehouseRoutes(t *testing.T) {
+	for _, url := range []string{"/warehouses", "/warehouses/1"} {
+		t.Run(url+" should return 401 without a token", func(t *testing.T) {
+			rr := serveWarehouseRequest(t, &mockWarehouseStore{}, http.MethodGet, url, "", "")
+
+			if rr.Code != http.StatusUnauthorized {
+				t.Errorf("expected status code %d, got %d", http.StatusUnauthorized, rr.Code)
+			}
+		})
+
+		t.Run(url+" should return 403 for customers", func(t *testing.T) {
+			rr := serveWarehouseRequest(t, &mockWarehouseStore{}, http.MethodGet, url, "", domain.RoleCustomer)
+
+			if rr.Code != http.StatusForbidden {
+				t.Errorf("expected status code %d, got %d", http.StatusForbidden, rr.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package warehouse
+
+import (
+	"database/sql"
+	"ecom/db"
+	"ecom/domain"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const warehouseColumns = "id, code, name, country, region, postalCode, priority, active, createdAt"
+
+type Store struct {
+	db db.Querier
+}
+
+func NewStore(db *sql.DB) *Store {
+	return &Store{db: db}
+}
+
+// WithTx returns a store whose queries run inside tx.
+func (s *Store) WithTx(tx *sql.Tx) *Store {
+	return &Store{db: tx}
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanWarehouse(row scanner) (*domain.Warehouse, error) {
+	warehouse := new(domain.Warehouse)
+	err := row.Scan(
+		&warehouse.ID,
+		&warehouse.Code,
+		&warehouse.Name,
+		&warehouse.Country,
+		&warehouse.Region,
+		&warehouse.PostalCode,
+		&warehouse.Priority,
+		&warehouse.Active,
+		&warehouse.CreatedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrWarehouseNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	return warehouse, nil
+}
+
+func (s *Store) CreateWarehouse(warehouse domain.Warehouse) (int, error) {
+	result, err := s.db.Exec("INSERT INTO warehouses (code, name, country, region, postalCode, priority, active) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		warehouse.Code, warehouse.Name, warehouse.Country, warehouse.Region, warehouse.PostalCode, warehouse.Priority, warehouse.Active)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	return int(id), err
+}
+
+func (s *Store) GetWarehouses() (*[]domain.Warehouse, error) {
+	rows, err := s.db.Query("SELECT " + warehouseColumns + " FROM warehouses ORDER BY priority, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	warehouses := make([]domain.Warehouse, 0)
+	for rows.Next() {
+		warehouse, err := scanWarehouse(rows)
+		if err != nil {
+			return nil, err
+		}
+		warehouses = append(warehouses, *warehouse)
+	}
+
+	return &warehouses, rows.Err()
+}
+
+func (s *Store) GetWarehouseByID(id int) (*domain.Warehouse, error) {
+	return scanWarehouse(s.db.QueryRow("SELECT "+warehouseColumns+" FROM warehouses WHERE id = ?", id))
+}
+
+func (s *Store) GetWarehouseByCode(code string) (*domain.Warehouse, error) {
+	return scanWarehouse(s.db.QueryRow("SELECT "+warehouseColumns+" FROM warehouses WHERE code = ?", code))
+}
+
+func (s *Store) UpdateWarehouse(warehouse domain.Warehouse) error {
+	_, err := s.db.Exec("UPDATE warehouses SET code = ?, name = ?, country = ?, region = ?, postalCode = ?, priority = ?, active = ? WHERE id = ?",
+		warehouse.Code, warehouse.Name, warehouse.Country, warehouse.Region, warehouse.PostalCode, warehouse.Priority, warehouse.Active, warehouse.ID)
+	return err
+}
+
+func (s *Store) GetWarehouseStock(productIDs []int) (map[int][]domain.WarehouseStock, error) {
+	stock := make(map[int][]domain.WarehouseStock, len(productIDs))
+	if len(productIDs) == 0 {
+		return stock, nil
+	}
+
+	placeholders := make([]string, len(productIDs))
+	args := make([]interface{}, len(productIDs))
+	for i, id := range productIDs {
+		placeholders[i] = "?"
+		args[i] = id
+	}
+
+	rows, err := s.db.Query(fmt.Sprintf(`
+		SELECT product_id, warehouse_id, quantity, reserved
+		FROM product_stock
+		WHERE product_id IN (%s)
+		ORDER BY product_id, warehouse_id
+	`, strings.Join(placeholders, ",")), args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var productID int
+		var warehouseStock domain.WarehouseStock
+		if err := rows.Scan(&productID, &warehouseStock.WarehouseID, &warehouseStock.Quantity, &warehouseStock.Reserved); err != nil {
+			return nil, err
+		}
+		warehouseStock.Available = warehouseStock.Quantity - warehouseStock.Reserved
+		stock[productID] = append(stock[productID], warehouseStock)
+	}
+
+	return stock, rows.Err()
+}
+
+func (s *Store) SetWarehouseStock(productID, warehouseID, quantity int) error {
+	_, err := s.db.Exec(`
+		INSERT INTO product_stock (product_id, warehouse_id, quantity) VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE quantity = VALUES(quantity) + reserved
+	`, productID, warehouseID, quantity)
+	return err
+}
@@ -1,13 +1,24 @@
 package utils
 
 import (
+	"ecom/domain"
 	"encoding/json"
 	"fmt"
 	"github.com/go-playground/validator/v10"
 	"net/http"
+	"reflect"
 )
 
-var Validate = validator.New()
+var Validate = newValidator()
+
+func newValidator() *validator.Validate {
+	v := validator.New()
+	// validate money by its amount, so tags like gt=0 work on prices
+	v.RegisterCustomTypeFunc(func(field reflect.Value) interface{} {
+		return field.Interface().(domain.Money).Amount
+	}, domain.Money{})
+	return v
+}
 
 func ParseJSON(r *http.Request, payload any) error {
 	if r.Body == nil {